@@ -0,0 +1,98 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Namespaced
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name=LastUnpacked,type=date,JSONPath=`.status.lastUnpacked`
+//+kubebuilder:printcolumn:name="Serving",type=string,JSONPath=`.status.conditions[?(@.type=="Serving")].status`
+//+kubebuilder:printcolumn:name=Packages,type=integer,JSONPath=`.status.content.packages`
+//+kubebuilder:printcolumn:name=Bundles,type=integer,JSONPath=`.status.content.bundles`
+//+kubebuilder:printcolumn:name=Size,type=integer,JSONPath=`.status.content.sizeBytes`
+//+kubebuilder:printcolumn:name=Age,type=date,JSONPath=`.metadata.creationTimestamp`
+
+// Catalog enables the users of a namespace to make File-Based Catalog (FBC) catalog data
+// available to clients in that namespace, without the cluster-wide permissions needed to
+// create a ClusterCatalog.
+// Its content is unpacked in the same way as the content of a ClusterCatalog, and is served
+// under a URL that includes its namespace.
+type Catalog struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// metadata is the standard object's metadata.
+	// More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#metadata
+	metav1.ObjectMeta `json:"metadata"`
+
+	// spec is the desired state of the Catalog.
+	// spec is required.
+	// The controller will work to ensure that the desired
+	// catalog is unpacked and served over the catalog content HTTP server.
+	// +kubebuilder:validation:Required
+	Spec CatalogSpec `json:"spec"`
+
+	// status contains information about the state of the Catalog. It has the same
+	// fields as the status of a ClusterCatalog.
+	// +optional
+	Status ClusterCatalogStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CatalogList contains a list of Catalog
+type CatalogList struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// metadata is the standard object's metadata.
+	// More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#metadata
+	metav1.ListMeta `json:"metadata"`
+
+	// items is a list of Catalogs.
+	// items is required.
+	// +kubebuilder:validation:Required
+	Items []Catalog `json:"items"`
+}
+
+// CatalogSpec defines the desired state of Catalog. It has the fields of a
+// ClusterCatalogSpec, and the pull secrets used to pull the image of the catalog.
+// +kubebuilder:validation:XValidation:rule="self.source.type == 'Image'",message="source type must be Image for a Catalog"
+type CatalogSpec struct {
+	ClusterCatalogSpec `json:",inline"`
+
+	// pullSecrets lists the Secrets in the namespace of the Catalog that hold
+	// the credentials used to pull its image.
+	// pullSecrets is optional.
+	//
+	// Each Secret must be of type kubernetes.io/dockerconfigjson. When more than
+	// one Secret has credentials for the same registry, the ones of the Secret
+	// listed first are used. The global pull secret of the cluster is never used
+	// to pull the image of a Catalog.
+	//
+	// +kubebuilder:validation:MaxItems:=16
+	// +listType=atomic
+	// +optional
+	PullSecrets []corev1.LocalObjectReference `json:"pullSecrets,omitempty"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Catalog{}, &CatalogList{})
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package v1
 
 import (
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -27,8 +28,37 @@ type SourceType string
 // AvailabilityMode defines the availability of the catalog
 type AvailabilityMode string
 
+// CompositeMemberType defines the type of a member of a composite source.
+// +enum
+type CompositeMemberType string
+
+// ConflictPolicy defines how conflicts between the members of a composite
+// source are resolved.
+// +enum
+type ConflictPolicy string
+
 const (
-	SourceTypeImage SourceType = "Image"
+	CompositeMemberTypeImage          CompositeMemberType = "Image"
+	CompositeMemberTypeClusterCatalog CompositeMemberType = "ClusterCatalog"
+
+	ConflictPolicyFail           ConflictPolicy = "Fail"
+	ConflictPolicyPreferFirst    ConflictPolicy = "PreferFirst"
+	ConflictPolicyPreferPriority ConflictPolicy = "PreferPriority"
+)
+
+// PatchType defines the type of a patch of the catalog contents.
+// +enum
+type PatchType string
+
+const (
+	PatchTypeJSONPatch PatchType = "JSONPatch"
+	PatchTypeRemove    PatchType = "Remove"
+	PatchTypeAdd       PatchType = "Add"
+)
+
+const (
+	SourceTypeImage     SourceType = "Image"
+	SourceTypeComposite SourceType = "Composite"
 
 	TypeProgressing = "Progressing"
 	TypeServing     = "Serving"
@@ -54,6 +84,9 @@ const (
 //+kubebuilder:subresource:status
 //+kubebuilder:printcolumn:name=LastUnpacked,type=date,JSONPath=`.status.lastUnpacked`
 //+kubebuilder:printcolumn:name="Serving",type=string,JSONPath=`.status.conditions[?(@.type=="Serving")].status`
+//+kubebuilder:printcolumn:name=Packages,type=integer,JSONPath=`.status.content.packages`
+//+kubebuilder:printcolumn:name=Bundles,type=integer,JSONPath=`.status.content.bundles`
+//+kubebuilder:printcolumn:name=Size,type=integer,JSONPath=`.status.content.sizeBytes`
 //+kubebuilder:printcolumn:name=Age,type=date,JSONPath=`.metadata.creationTimestamp`
 
 // ClusterCatalog enables users to make File-Based Catalog (FBC) catalog data available to the cluster.
@@ -161,6 +194,220 @@ type ClusterCatalogSpec struct {
 	// +kubebuilder:default:="Available"
 	// +optional
 	AvailabilityMode AvailabilityMode `json:"availabilityMode,omitempty"`
+
+	// filter allows users to restrict the catalog contents that are served to a subset
+	// of the packages, channels and bundles of the source.
+	// filter is optional.
+	//
+	// When omitted, all of the catalog contents of the source are served.
+	//
+	// The filter is applied after the contents are unpacked and before they are served.
+	// The filtered contents must be a valid File-Based Catalog, or the ClusterCatalog
+	// will fail to progress. The effect of the filter is summarized in status.filterResult.
+	//
+	// Below is an example of a filter that serves two packages, and only the stable
+	// channel and versions 2.0.0 and above of one of them:
+	//
+	//  filter:
+	//    includePackages:
+	//    - cert-manager
+	//    - prometheus
+	//    packages:
+	//    - name: prometheus
+	//      channels:
+	//      - stable
+	//      minVersion: 2.0.0
+	//
+	// +optional
+	Filter *CatalogFilter `json:"filter,omitempty"`
+
+	// patches allows users to modify the catalog contents of the source without rebuilding
+	// it, for example to deprecate a bundle or to remove a channel.
+	// patches is optional.
+	//
+	// Patches are applied in order to the objects of the catalog contents, after they are
+	// unpacked and before spec.filter is applied. The patched contents must be a valid
+	// File-Based Catalog, or the ClusterCatalog will fail to progress. The patches that were
+	// applied are recorded in status.patchResult.
+	//
+	// Below is an example of patches that deprecate a bundle of a package without any
+	// deprecations, and remove the beta channel of another package along with its only bundle:
+	//
+	//  patches:
+	//  - type: Add
+	//    object:
+	//      schema: olm.deprecations
+	//      package: foo
+	//      entries:
+	//      - reference:
+	//          schema: olm.bundle
+	//          name: foo.v1.0.0
+	//        message: foo.v1.0.0 has a critical bug, upgrade to foo.v1.0.1
+	//  - type: Remove
+	//    target:
+	//      schema: olm.channel
+	//      package: bar
+	//      name: beta
+	//  - type: Remove
+	//    target:
+	//      schema: olm.bundle
+	//      package: bar
+	//      name: bar.v2.0.0-beta.1
+	//
+	// +kubebuilder:validation:MaxItems:=100
+	// +listType=atomic
+	// +optional
+	Patches []CatalogPatch `json:"patches,omitempty"`
+}
+
+// CatalogPatch is a discriminated union of the possible modifications of the contents of a catalog.
+// +union
+// +kubebuilder:validation:XValidation:rule="self.type == 'Add' ? !has(self.target) : has(self.target)",message="target is required when patch type is JSONPatch or Remove, and forbidden otherwise"
+// +kubebuilder:validation:XValidation:rule="self.type == 'JSONPatch' ? has(self.jsonPatch) : !has(self.jsonPatch)",message="jsonPatch is required when patch type is JSONPatch, and forbidden otherwise"
+// +kubebuilder:validation:XValidation:rule="self.type == 'Add' ? has(self.object) : !has(self.object)",message="object is required when patch type is Add, and forbidden otherwise"
+type CatalogPatch struct {
+	// type is the type of modification made by the patch.
+	// type is required.
+	//
+	// Allowed values are "JSONPatch", "Remove" and "Add".
+	//
+	// When set to "JSONPatch", the operations in jsonPatch are applied to each of the objects
+	// selected by target.
+	//
+	// When set to "Remove", the objects selected by target are removed.
+	//
+	// When set to "Add", object is added to the catalog contents.
+	//
+	// +unionDiscriminator
+	// +kubebuilder:validation:Enum:="JSONPatch";"Remove";"Add"
+	// +kubebuilder:validation:Required
+	Type PatchType `json:"type"`
+	// target selects the objects the patch applies to.
+	// This field is required when type is JSONPatch or Remove, and forbidden otherwise.
+	// +optional
+	Target *PatchTarget `json:"target,omitempty"`
+	// jsonPatch is a list of JSON patch (RFC 6902) operations applied to each selected object.
+	// This field is required when type is JSONPatch, and forbidden otherwise.
+	// +kubebuilder:validation:MinItems:=1
+	// +kubebuilder:validation:MaxItems:=100
+	// +listType=atomic
+	// +optional
+	JSONPatch []JSONPatchOperation `json:"jsonPatch,omitempty"`
+	// object is a File-Based Catalog object that is added to the catalog contents.
+	// It must have a schema.
+	// This field is required when type is Add, and forbidden otherwise.
+	// +kubebuilder:validation:Type:=object
+	// +optional
+	Object *apiextensionsv1.JSON `json:"object,omitempty"`
+}
+
+// PatchTarget selects objects of the contents of a catalog by their schema, package and name.
+type PatchTarget struct {
+	// schema is the schema of the objects to select, for example "olm.bundle".
+	// schema is required.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength:=1
+	// +kubebuilder:validation:MaxLength:=253
+	Schema string `json:"schema"`
+	// package is the package of the objects to select. For olm.package objects, it is
+	// compared with the name of the package.
+	// package is optional. When omitted, objects of any package are selected.
+	// +kubebuilder:validation:MaxLength:=253
+	// +optional
+	Package string `json:"package,omitempty"`
+	// name is the name of the objects to select.
+	// name is optional. When omitted, objects with any name are selected.
+	// +kubebuilder:validation:MaxLength:=253
+	// +optional
+	Name string `json:"name,omitempty"`
+}
+
+// JSONPatchOperation is an operation of a JSON patch, as defined by RFC 6902.
+type JSONPatchOperation struct {
+	// op is the operation to perform.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum:="add";"remove";"replace";"move";"copy";"test"
+	Op string `json:"op"`
+	// path is the JSON pointer to the location the operation applies to.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MaxLength:=1024
+	Path string `json:"path"`
+	// from is the JSON pointer to the location the value is moved or copied from.
+	// It is required by the move and copy operations.
+	// +kubebuilder:validation:MaxLength:=1024
+	// +optional
+	From string `json:"from,omitempty"`
+	// value is the value used by the add, replace and test operations.
+	// +optional
+	Value *apiextensionsv1.JSON `json:"value,omitempty"`
+}
+
+// CatalogFilter selects the subset of the contents of a catalog that is served.
+//
+// A package is served if it is listed in includePackages, or includePackages is empty,
+// and it is not listed in excludePackages. The channels and bundles served for a package
+// may be further restricted with an entry for it in packages.
+//
+// Channels left without any entries and packages left without any channels are removed.
+// Bundles that are no longer an entry of any channel served are removed as well. If the
+// default channel of a package is removed, the first of its remaining channels in
+// alphabetical order becomes its default channel.
+type CatalogFilter struct {
+	// includePackages is a list of names of the packages to serve.
+	// includePackages is optional. When omitted or empty, all packages are served
+	// except the ones listed in excludePackages.
+	// +kubebuilder:validation:MaxItems:=1000
+	// +kubebuilder:validation:items:MaxLength:=253
+	// +listType=set
+	// +optional
+	IncludePackages []string `json:"includePackages,omitempty"`
+
+	// excludePackages is a list of names of packages not to serve, even if they are
+	// listed in includePackages.
+	// excludePackages is optional.
+	// +kubebuilder:validation:MaxItems:=1000
+	// +kubebuilder:validation:items:MaxLength:=253
+	// +listType=set
+	// +optional
+	ExcludePackages []string `json:"excludePackages,omitempty"`
+
+	// packages restricts the channels and bundle versions served for individual packages.
+	// packages is optional. Entries for packages that are not served have no effect.
+	// +kubebuilder:validation:MaxItems:=1000
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Packages []PackageFilter `json:"packages,omitempty"`
+}
+
+// PackageFilter restricts the channels and bundle versions served for a package.
+type PackageFilter struct {
+	// name is the name of the package the filter applies to.
+	// name is required.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength:=1
+	// +kubebuilder:validation:MaxLength:=253
+	Name string `json:"name"`
+
+	// channels is a list of names of the channels of the package to serve.
+	// channels is optional. When omitted or empty, all channels of the package are served.
+	// +kubebuilder:validation:MaxItems:=100
+	// +kubebuilder:validation:items:MaxLength:=253
+	// +listType=set
+	// +optional
+	Channels []string `json:"channels,omitempty"`
+
+	// minVersion is the lowest version of the bundles of the package to serve, inclusive.
+	// minVersion is optional. When set, it must be a valid semantic version.
+	// +kubebuilder:validation:MaxLength:=128
+	// +optional
+	MinVersion string `json:"minVersion,omitempty"`
+
+	// maxVersion is the highest version of the bundles of the package to serve, inclusive.
+	// maxVersion is optional. When set, it must be a valid semantic version.
+	// +kubebuilder:validation:MaxLength:=128
+	// +optional
+	MaxVersion string `json:"maxVersion,omitempty"`
 }
 
 // ClusterCatalogStatus defines the observed state of ClusterCatalog
@@ -201,6 +448,125 @@ type ClusterCatalogStatus struct {
 	// act of this extraction from the source format as "unpacking".
 	// +optional
 	LastUnpacked *metav1.Time `json:"lastUnpacked,omitempty"`
+	// content summarizes the catalog contents currently being served.
+	// +optional
+	Content *CatalogContentSummary `json:"content,omitempty"`
+	// lastContentChange summarizes how the catalog contents changed between
+	// the previously served revision and the revision currently being served.
+	// The complete list of changes is available from the /api/v1/diff endpoint
+	// of the catalog content HTTP server.
+	// +optional
+	LastContentChange *ContentChangeSummary `json:"lastContentChange,omitempty"`
+	// filterResult summarizes the effect of spec.filter on the catalog contents
+	// currently being served. It is omitted when spec.filter is not set.
+	// +optional
+	FilterResult *CatalogFilterResult `json:"filterResult,omitempty"`
+	// patchResult records the spec.patches applied to the catalog contents
+	// currently being served. It is omitted when spec.patches is empty.
+	// +optional
+	PatchResult *CatalogPatchResult `json:"patchResult,omitempty"`
+}
+
+// CatalogPatchResult describes the spec.patches applied to the catalog contents.
+type CatalogPatchResult struct {
+	// digest identifies the patches that were applied. It is computed from spec.patches,
+	// so it changes whenever the patches do.
+	// +kubebuilder:validation:Required
+	Digest string `json:"digest"`
+	// patchedObjects is the number of objects of the catalog contents that were
+	// modified, removed or added by the patches.
+	// +kubebuilder:validation:Minimum:=0
+	PatchedObjects int32 `json:"patchedObjects"`
+	// unmatchedPatches lists the indexes in spec.patches of the patches with a target
+	// that did not select any object.
+	// +kubebuilder:validation:MaxItems:=100
+	// +listType=atomic
+	// +optional
+	UnmatchedPatches []int32 `json:"unmatchedPatches,omitempty"`
+}
+
+// CatalogFilterResult summarizes the catalog contents of the source that are not
+// served because of spec.filter.
+type CatalogFilterResult struct {
+	// removedPackages is the number of packages of the source that are not served.
+	// +kubebuilder:validation:Minimum:=0
+	RemovedPackages int32 `json:"removedPackages"`
+	// removedChannels is the number of channels of the source that are not served.
+	// +kubebuilder:validation:Minimum:=0
+	RemovedChannels int32 `json:"removedChannels"`
+	// removedBundles is the number of bundles of the source that are not served.
+	// +kubebuilder:validation:Minimum:=0
+	RemovedBundles int32 `json:"removedBundles"`
+	// missingPackages lists the packages named in spec.filter that are not in
+	// the catalog contents of the source.
+	// +kubebuilder:validation:MaxItems:=3000
+	// +listType=set
+	// +optional
+	MissingPackages []string `json:"missingPackages,omitempty"`
+}
+
+// CatalogContentSummary describes the contents of a catalog as it is stored
+// and served by catalogd.
+type CatalogContentSummary struct {
+	// digest is the digest of the stored catalog contents. It changes whenever
+	// the contents served for the catalog change.
+	// +kubebuilder:validation:Required
+	Digest string `json:"digest"`
+	// sizeBytes is the size of the stored catalog contents in bytes.
+	// +kubebuilder:validation:Minimum:=0
+	SizeBytes int64 `json:"sizeBytes"`
+	// packages is the number of olm.package objects in the catalog.
+	// +kubebuilder:validation:Minimum:=0
+	Packages int32 `json:"packages"`
+	// channels is the number of olm.channel objects in the catalog.
+	// +kubebuilder:validation:Minimum:=0
+	Channels int32 `json:"channels"`
+	// bundles is the number of olm.bundle objects in the catalog.
+	// +kubebuilder:validation:Minimum:=0
+	Bundles int32 `json:"bundles"`
+	// deprecations is the number of olm.deprecations objects in the catalog.
+	// +kubebuilder:validation:Minimum:=0
+	Deprecations int32 `json:"deprecations"`
+	// unknownSchemas is the number of distinct schemas, other than the ones
+	// counted above, used by objects in the catalog.
+	// +kubebuilder:validation:Minimum:=0
+	UnknownSchemas int32 `json:"unknownSchemas"`
+}
+
+// ContentChangeSummary summarizes the differences between two revisions of the
+// contents of a catalog, computed from the File-Based Catalog (FBC) model rather
+// than from the raw text of the catalog.
+type ContentChangeSummary struct {
+	// previousDigest is the digest of the contents of the previously served revision.
+	// It is omitted when no other revision of the catalog has been served, in which
+	// case all of the contents are counted as added.
+	// +optional
+	PreviousDigest string `json:"previousDigest,omitempty"`
+	// digest is the digest of the contents of the revision currently being served.
+	// +kubebuilder:validation:Required
+	Digest string `json:"digest"`
+	// addedPackages is the number of packages added to the catalog.
+	// +kubebuilder:validation:Minimum:=0
+	AddedPackages int32 `json:"addedPackages"`
+	// removedPackages is the number of packages removed from the catalog.
+	// +kubebuilder:validation:Minimum:=0
+	RemovedPackages int32 `json:"removedPackages"`
+	// addedChannels is the number of channels added to the catalog.
+	// +kubebuilder:validation:Minimum:=0
+	AddedChannels int32 `json:"addedChannels"`
+	// removedChannels is the number of channels removed from the catalog.
+	// +kubebuilder:validation:Minimum:=0
+	RemovedChannels int32 `json:"removedChannels"`
+	// changedChannels is the number of channels present in both revisions
+	// whose entries were added, removed or modified.
+	// +kubebuilder:validation:Minimum:=0
+	ChangedChannels int32 `json:"changedChannels"`
+	// addedBundles is the number of bundles added to the catalog.
+	// +kubebuilder:validation:Minimum:=0
+	AddedBundles int32 `json:"addedBundles"`
+	// removedBundles is the number of bundles removed from the catalog.
+	// +kubebuilder:validation:Minimum:=0
+	RemovedBundles int32 `json:"removedBundles"`
 }
 
 // ClusterCatalogURLs contains the URLs that can be used to access the catalog.
@@ -230,44 +596,208 @@ type ClusterCatalogURLs struct {
 // CatalogSource contains the sourcing information for a Catalog
 // +union
 // +kubebuilder:validation:XValidation:rule="has(self.type) && self.type == 'Image' ? has(self.image) : !has(self.image)",message="image is required when source type is Image, and forbidden otherwise"
+// +kubebuilder:validation:XValidation:rule="has(self.type) && self.type == 'Composite' ? has(self.composite) : !has(self.composite)",message="composite is required when source type is Composite, and forbidden otherwise"
 type CatalogSource struct {
 	// type is a reference to the type of source the catalog is sourced from.
 	// type is required.
 	//
-	// The only allowed value is "Image".
+	// Allowed values are "Image" and "Composite".
 	//
 	// When set to "Image", the ClusterCatalog content will be sourced from an OCI image.
 	// When using an image source, the image field must be set and must be the only field defined for this type.
 	//
+	// When set to "Composite", the ClusterCatalog content will be merged from the contents of multiple
+	// OCI images and other ClusterCatalogs.
+	// When using a composite source, the composite field must be set and must be the only field defined for this type.
+	//
 	// +unionDiscriminator
-	// +kubebuilder:validation:Enum:="Image"
+	// +kubebuilder:validation:Enum:="Image";"Composite"
 	// +kubebuilder:validation:Required
 	Type SourceType `json:"type"`
 	// image is used to configure how catalog contents are sourced from an OCI image.
 	// This field is required when type is Image, and forbidden otherwise.
 	// +optional
 	Image *ImageSource `json:"image,omitempty"`
+	// composite is used to configure how catalog contents are merged from multiple sources.
+	// This field is required when type is Composite, and forbidden otherwise.
+	// +optional
+	Composite *CompositeSource `json:"composite,omitempty"`
+}
+
+// CompositeSource enables users to define a catalog whose contents are merged from
+// the contents of multiple members.
+//
+// Members are merged package by package: all of the objects of a package, such as
+// its channels, bundles and deprecations, are taken from a single member. Objects
+// that do not belong to a package are taken from every member. A package is in
+// conflict when more than one member contains objects that belong to it, in which
+// case conflictPolicy determines which member it is taken from.
+//
+// The contents are merged again whenever the image of a member resolves to a new
+// digest or the contents served for a member ClusterCatalog change.
+type CompositeSource struct {
+	// members is the list of sources whose contents are merged.
+	// members is required, must have at least 1 and at most 16 entries.
+	//
+	// Below is an example of a composite source that extends a vendor catalog with
+	// the contents of an overlay image, preferring the overlay when both contain a package:
+	//
+	//  composite:
+	//    conflictPolicy: PreferFirst
+	//    members:
+	//    - type: Image
+	//      image:
+	//        ref: registry.example.com/platform/overlay:latest
+	//        pollIntervalMinutes: 10
+	//    - type: ClusterCatalog
+	//      clusterCatalog:
+	//        name: operatorhubio
+	//
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems:=1
+	// +kubebuilder:validation:MaxItems:=16
+	// +listType=atomic
+	Members []CompositeMember `json:"members"`
+
+	// conflictPolicy determines how a package contained in more than one member is merged.
+	// conflictPolicy is optional.
+	//
+	// Allowed values are "Fail", "PreferFirst" and "PreferPriority".
+	//
+	// When omitted, the default value is "Fail".
+	//
+	// When set to "Fail", the contents are not merged if any package is in conflict,
+	// and the previously merged contents, if any, continue to be served.
+	//
+	// When set to "PreferFirst", a package in conflict is taken from the member that
+	// appears first in members.
+	//
+	// When set to "PreferPriority", a package in conflict is taken from the member with
+	// the highest priority. Conflicts between members with the same priority are resolved
+	// as if the conflictPolicy was "PreferFirst".
+	//
+	// +kubebuilder:validation:Enum:="Fail";"PreferFirst";"PreferPriority"
+	// +kubebuilder:default:="Fail"
+	// +optional
+	ConflictPolicy ConflictPolicy `json:"conflictPolicy,omitempty"`
+}
+
+// CompositeMember is a discriminated union of the possible sources of a member of a composite source.
+// +union
+// +kubebuilder:validation:XValidation:rule="self.type == 'Image' ? has(self.image) : !has(self.image)",message="image is required when member type is Image, and forbidden otherwise"
+// +kubebuilder:validation:XValidation:rule="self.type == 'ClusterCatalog' ? has(self.clusterCatalog) : !has(self.clusterCatalog)",message="clusterCatalog is required when member type is ClusterCatalog, and forbidden otherwise"
+type CompositeMember struct {
+	// type is a reference to the type of source the member is sourced from.
+	// type is required.
+	//
+	// Allowed values are "Image" and "ClusterCatalog".
+	//
+	// When set to "Image", the member contents are sourced from an OCI image, which is
+	// unpacked and polled in the same way as the image of an Image source.
+	//
+	// When set to "ClusterCatalog", the member contents are the contents currently being
+	// served for another ClusterCatalog. The contents can not be merged until that
+	// ClusterCatalog is serving its contents.
+	//
+	// +unionDiscriminator
+	// +kubebuilder:validation:Enum:="Image";"ClusterCatalog"
+	// +kubebuilder:validation:Required
+	Type CompositeMemberType `json:"type"`
+	// image is used to configure how the member contents are sourced from an OCI image.
+	// This field is required when type is Image, and forbidden otherwise.
+	// +optional
+	Image *ImageSource `json:"image,omitempty"`
+	// clusterCatalog references the ClusterCatalog whose contents are used as the member contents.
+	// This field is required when type is ClusterCatalog, and forbidden otherwise.
+	// +optional
+	ClusterCatalog *ClusterCatalogReference `json:"clusterCatalog,omitempty"`
+	// priority is used to resolve conflicts between members when conflictPolicy is "PreferPriority".
+	// A higher number means higher priority.
+	// priority is optional. When omitted, the default priority is 0.
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+}
+
+// ClusterCatalogReference references another ClusterCatalog.
+type ClusterCatalogReference struct {
+	// name is the name of the referenced ClusterCatalog.
+	// name is required. It can not be the name of the ClusterCatalog that references it.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength:=1
+	// +kubebuilder:validation:MaxLength:=253
+	Name string `json:"name"`
 }
 
 // ResolvedCatalogSource is a discriminated union of resolution information for a Catalog.
 // ResolvedCatalogSource contains the information about a sourced Catalog
 // +union
 // +kubebuilder:validation:XValidation:rule="has(self.type) && self.type == 'Image' ? has(self.image) : !has(self.image)",message="image is required when source type is Image, and forbidden otherwise"
+// +kubebuilder:validation:XValidation:rule="has(self.type) && self.type == 'Composite' ? has(self.composite) : !has(self.composite)",message="composite is required when source type is Composite, and forbidden otherwise"
 type ResolvedCatalogSource struct {
 	// type is a reference to the type of source the catalog is sourced from.
 	// type is required.
 	//
-	// The only allowed value is "Image".
+	// Allowed values are "Image" and "Composite".
 	//
 	// When set to "Image", information about the resolved image source will be set in the 'image' field.
 	//
+	// When set to "Composite", information about the resolved members of the composite source
+	// will be set in the 'composite' field.
+	//
 	// +unionDiscriminator
-	// +kubebuilder:validation:Enum:="Image"
+	// +kubebuilder:validation:Enum:="Image";"Composite"
 	// +kubebuilder:validation:Required
 	Type SourceType `json:"type"`
 	// image is a field containing resolution information for a catalog sourced from an image.
 	// This field must be set when type is Image, and forbidden otherwise.
-	Image *ResolvedImageSource `json:"image"`
+	// +optional
+	Image *ResolvedImageSource `json:"image,omitempty"`
+	// composite is a field containing resolution information for a catalog sourced from a composite source.
+	// This field must be set when type is Composite, and forbidden otherwise.
+	// +optional
+	Composite *ResolvedCompositeSource `json:"composite,omitempty"`
+}
+
+// ResolvedCompositeSource provides information about the resolved members of a composite source.
+type ResolvedCompositeSource struct {
+	// members contains the resolution information of each of the members of the
+	// composite source, in the order they are listed in the spec.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MaxItems:=16
+	// +listType=atomic
+	Members []ResolvedCompositeMember `json:"members"`
+}
+
+// ResolvedCompositeMember is a discriminated union of resolution information for a member of a composite source.
+// +union
+// +kubebuilder:validation:XValidation:rule="self.type == 'Image' ? has(self.image) : !has(self.image)",message="image is required when member type is Image, and forbidden otherwise"
+// +kubebuilder:validation:XValidation:rule="self.type == 'ClusterCatalog' ? has(self.clusterCatalog) : !has(self.clusterCatalog)",message="clusterCatalog is required when member type is ClusterCatalog, and forbidden otherwise"
+type ResolvedCompositeMember struct {
+	// type is a reference to the type of source the member is sourced from.
+	// +unionDiscriminator
+	// +kubebuilder:validation:Enum:="Image";"ClusterCatalog"
+	// +kubebuilder:validation:Required
+	Type CompositeMemberType `json:"type"`
+	// image contains the resolved digest-based reference of the image of the member.
+	// This field must be set when type is Image, and forbidden otherwise.
+	// +optional
+	Image *ResolvedImageSource `json:"image,omitempty"`
+	// clusterCatalog contains the digest of the contents of the ClusterCatalog of the member.
+	// This field must be set when type is ClusterCatalog, and forbidden otherwise.
+	// +optional
+	ClusterCatalog *ResolvedClusterCatalogSource `json:"clusterCatalog,omitempty"`
+}
+
+// ResolvedClusterCatalogSource provides information about the contents of a ClusterCatalog
+// that were merged into a composite source.
+type ResolvedClusterCatalogSource struct {
+	// name is the name of the ClusterCatalog.
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+	// contentDigest is the digest of the contents of the ClusterCatalog that were merged,
+	// as reported in its status.content.digest.
+	// +kubebuilder:validation:Required
+	ContentDigest string `json:"contentDigest"`
 }
 
 // ResolvedImageSource provides information about the resolved source of a Catalog sourced from an image.
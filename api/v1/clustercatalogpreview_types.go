@@ -0,0 +1,159 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	TypeValidated = "Validated"
+)
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Validated",type=string,JSONPath=`.status.conditions[?(@.type=="Validated")].status`
+//+kubebuilder:printcolumn:name=Packages,type=integer,JSONPath=`.status.content.packages`
+//+kubebuilder:printcolumn:name=Bundles,type=integer,JSONPath=`.status.content.bundles`
+//+kubebuilder:printcolumn:name=Age,type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ClusterCatalogPreview enables users to check that the File-Based Catalog (FBC) catalog data
+// of a source can be unpacked and is valid before using that source in a ClusterCatalog.
+// Its content is unpacked, patched, filtered and validated in the same way as the content of
+// a ClusterCatalog, but in a location of its own, and is never served.
+type ClusterCatalogPreview struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// metadata is the standard object's metadata.
+	// More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#metadata
+	metav1.ObjectMeta `json:"metadata"`
+
+	// spec is the desired state of the ClusterCatalogPreview.
+	// spec is required.
+	// The controller previews the content of each generation of the spec once.
+	// +kubebuilder:validation:Required
+	Spec ClusterCatalogPreviewSpec `json:"spec"`
+
+	// status contains the results of the preview.
+	// +optional
+	Status ClusterCatalogPreviewStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterCatalogPreviewList contains a list of ClusterCatalogPreview
+type ClusterCatalogPreviewList struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// metadata is the standard object's metadata.
+	// More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#metadata
+	metav1.ListMeta `json:"metadata"`
+
+	// items is a list of ClusterCatalogPreviews.
+	// items is required.
+	// +kubebuilder:validation:Required
+	Items []ClusterCatalogPreview `json:"items"`
+}
+
+// ClusterCatalogPreviewSpec defines the desired state of ClusterCatalogPreview. Its
+// fields have the same meaning as the fields of the same name of a ClusterCatalogSpec.
+// +kubebuilder:validation:XValidation:rule="self.source.type == 'Image'",message="source type must be Image for a ClusterCatalogPreview"
+type ClusterCatalogPreviewSpec struct {
+	// source is the source of the catalog contents to preview.
+	// source is required, and its type must be Image.
+	//
+	// Below is a minimal example of a ClusterCatalogPreviewSpec that previews the contents
+	// of an image:
+	//
+	//  source:
+	//    type: Image
+	//    image:
+	//      ref: quay.io/operatorhubio/catalog:latest
+	//
+	// +kubebuilder:validation:Required
+	Source CatalogSource `json:"source"`
+
+	// filter is the filter applied to the catalog contents of the source.
+	// filter is optional.
+	// +optional
+	Filter *CatalogFilter `json:"filter,omitempty"`
+
+	// patches are the patches applied to the catalog contents of the source.
+	// patches is optional.
+	// +kubebuilder:validation:MaxItems:=100
+	// +listType=atomic
+	// +optional
+	Patches []CatalogPatch `json:"patches,omitempty"`
+
+	// clusterCatalogName is the name of a ClusterCatalog whose served contents the
+	// previewed contents are compared with.
+	// clusterCatalogName is optional.
+	//
+	// When set, status.contentChange summarizes how the contents served for the
+	// ClusterCatalog would change if its spec had the source, filter and patches of
+	// the ClusterCatalogPreview. The ClusterCatalog is not modified.
+	//
+	// +kubebuilder:validation:MaxLength:=253
+	// +optional
+	ClusterCatalogName string `json:"clusterCatalogName,omitempty"`
+}
+
+// ClusterCatalogPreviewStatus defines the observed state of ClusterCatalogPreview
+type ClusterCatalogPreviewStatus struct {
+	// conditions is a representation of the current state for this ClusterCatalogPreview.
+	//
+	// The current condition type is Validated.
+	//
+	// When it has a status of True and a reason of Succeeded, the contents of the source were
+	// unpacked, patched, filtered and found to be a valid catalog.
+	// When it has a status of False and a reason of Retrying, there was an error previewing the
+	// contents that may be resolved on subsequent attempts, such as an error pulling the image.
+	// When it has a status of False and a reason of Blocked, the contents can not be used as
+	// previewed, for example because they are not a valid catalog.
+	//
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
+	// resolvedSource contains information about the resolved source based on the source type.
+	// +optional
+	ResolvedSource *ResolvedCatalogSource `json:"resolvedSource,omitempty"`
+	// lastUnpacked is the time the previewed contents were unpacked.
+	// +optional
+	LastUnpacked *metav1.Time `json:"lastUnpacked,omitempty"`
+	// content summarizes the previewed catalog contents.
+	// +optional
+	Content *CatalogContentSummary `json:"content,omitempty"`
+	// contentChange summarizes how the previewed catalog contents differ from the contents
+	// served for the ClusterCatalog named by spec.clusterCatalogName. It is omitted when
+	// spec.clusterCatalogName is not set.
+	// +optional
+	ContentChange *ContentChangeSummary `json:"contentChange,omitempty"`
+	// filterResult summarizes the effect of spec.filter on the previewed catalog contents.
+	// It is omitted when spec.filter is not set.
+	// +optional
+	FilterResult *CatalogFilterResult `json:"filterResult,omitempty"`
+	// patchResult records the spec.patches applied to the previewed catalog contents.
+	// It is omitted when spec.patches is empty.
+	// +optional
+	PatchResult *CatalogPatchResult `json:"patchResult,omitempty"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterCatalogPreview{}, &ClusterCatalogPreviewList{})
+}
@@ -21,10 +21,190 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Catalog) DeepCopyInto(out *Catalog) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Catalog.
+func (in *Catalog) DeepCopy() *Catalog {
+	if in == nil {
+		return nil
+	}
+	out := new(Catalog)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Catalog) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CatalogContentSummary) DeepCopyInto(out *CatalogContentSummary) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CatalogContentSummary.
+func (in *CatalogContentSummary) DeepCopy() *CatalogContentSummary {
+	if in == nil {
+		return nil
+	}
+	out := new(CatalogContentSummary)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CatalogFilter) DeepCopyInto(out *CatalogFilter) {
+	*out = *in
+	if in.IncludePackages != nil {
+		in, out := &in.IncludePackages, &out.IncludePackages
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExcludePackages != nil {
+		in, out := &in.ExcludePackages, &out.ExcludePackages
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Packages != nil {
+		in, out := &in.Packages, &out.Packages
+		*out = make([]PackageFilter, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CatalogFilter.
+func (in *CatalogFilter) DeepCopy() *CatalogFilter {
+	if in == nil {
+		return nil
+	}
+	out := new(CatalogFilter)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CatalogFilterResult) DeepCopyInto(out *CatalogFilterResult) {
+	*out = *in
+	if in.MissingPackages != nil {
+		in, out := &in.MissingPackages, &out.MissingPackages
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CatalogFilterResult.
+func (in *CatalogFilterResult) DeepCopy() *CatalogFilterResult {
+	if in == nil {
+		return nil
+	}
+	out := new(CatalogFilterResult)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CatalogList) DeepCopyInto(out *CatalogList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]Catalog, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CatalogList.
+func (in *CatalogList) DeepCopy() *CatalogList {
+	if in == nil {
+		return nil
+	}
+	out := new(CatalogList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CatalogList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CatalogPatch) DeepCopyInto(out *CatalogPatch) {
+	*out = *in
+	if in.Target != nil {
+		in, out := &in.Target, &out.Target
+		*out = new(PatchTarget)
+		**out = **in
+	}
+	if in.JSONPatch != nil {
+		in, out := &in.JSONPatch, &out.JSONPatch
+		*out = make([]JSONPatchOperation, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Object != nil {
+		in, out := &in.Object, &out.Object
+		*out = new(apiextensionsv1.JSON)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CatalogPatch.
+func (in *CatalogPatch) DeepCopy() *CatalogPatch {
+	if in == nil {
+		return nil
+	}
+	out := new(CatalogPatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CatalogPatchResult) DeepCopyInto(out *CatalogPatchResult) {
+	*out = *in
+	if in.UnmatchedPatches != nil {
+		in, out := &in.UnmatchedPatches, &out.UnmatchedPatches
+		*out = make([]int32, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CatalogPatchResult.
+func (in *CatalogPatchResult) DeepCopy() *CatalogPatchResult {
+	if in == nil {
+		return nil
+	}
+	out := new(CatalogPatchResult)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CatalogSource) DeepCopyInto(out *CatalogSource) {
 	*out = *in
@@ -33,6 +213,11 @@ func (in *CatalogSource) DeepCopyInto(out *CatalogSource) {
 		*out = new(ImageSource)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Composite != nil {
+		in, out := &in.Composite, &out.Composite
+		*out = new(CompositeSource)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CatalogSource.
@@ -45,6 +230,27 @@ func (in *CatalogSource) DeepCopy() *CatalogSource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CatalogSpec) DeepCopyInto(out *CatalogSpec) {
+	*out = *in
+	in.ClusterCatalogSpec.DeepCopyInto(&out.ClusterCatalogSpec)
+	if in.PullSecrets != nil {
+		in, out := &in.PullSecrets, &out.PullSecrets
+		*out = make([]corev1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CatalogSpec.
+func (in *CatalogSpec) DeepCopy() *CatalogSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CatalogSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterCatalog) DeepCopyInto(out *ClusterCatalog) {
 	*out = *in
@@ -104,10 +310,175 @@ func (in *ClusterCatalogList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterCatalogPreview) DeepCopyInto(out *ClusterCatalogPreview) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterCatalogPreview.
+func (in *ClusterCatalogPreview) DeepCopy() *ClusterCatalogPreview {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterCatalogPreview)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterCatalogPreview) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterCatalogPreviewList) DeepCopyInto(out *ClusterCatalogPreviewList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterCatalogPreview, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterCatalogPreviewList.
+func (in *ClusterCatalogPreviewList) DeepCopy() *ClusterCatalogPreviewList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterCatalogPreviewList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterCatalogPreviewList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterCatalogPreviewSpec) DeepCopyInto(out *ClusterCatalogPreviewSpec) {
+	*out = *in
+	in.Source.DeepCopyInto(&out.Source)
+	if in.Filter != nil {
+		in, out := &in.Filter, &out.Filter
+		*out = new(CatalogFilter)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Patches != nil {
+		in, out := &in.Patches, &out.Patches
+		*out = make([]CatalogPatch, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterCatalogPreviewSpec.
+func (in *ClusterCatalogPreviewSpec) DeepCopy() *ClusterCatalogPreviewSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterCatalogPreviewSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterCatalogPreviewStatus) DeepCopyInto(out *ClusterCatalogPreviewStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ResolvedSource != nil {
+		in, out := &in.ResolvedSource, &out.ResolvedSource
+		*out = new(ResolvedCatalogSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastUnpacked != nil {
+		in, out := &in.LastUnpacked, &out.LastUnpacked
+		*out = (*in).DeepCopy()
+	}
+	if in.Content != nil {
+		in, out := &in.Content, &out.Content
+		*out = new(CatalogContentSummary)
+		**out = **in
+	}
+	if in.ContentChange != nil {
+		in, out := &in.ContentChange, &out.ContentChange
+		*out = new(ContentChangeSummary)
+		**out = **in
+	}
+	if in.FilterResult != nil {
+		in, out := &in.FilterResult, &out.FilterResult
+		*out = new(CatalogFilterResult)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PatchResult != nil {
+		in, out := &in.PatchResult, &out.PatchResult
+		*out = new(CatalogPatchResult)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterCatalogPreviewStatus.
+func (in *ClusterCatalogPreviewStatus) DeepCopy() *ClusterCatalogPreviewStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterCatalogPreviewStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterCatalogReference) DeepCopyInto(out *ClusterCatalogReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterCatalogReference.
+func (in *ClusterCatalogReference) DeepCopy() *ClusterCatalogReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterCatalogReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterCatalogSpec) DeepCopyInto(out *ClusterCatalogSpec) {
 	*out = *in
 	in.Source.DeepCopyInto(&out.Source)
+	if in.Filter != nil {
+		in, out := &in.Filter, &out.Filter
+		*out = new(CatalogFilter)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Patches != nil {
+		in, out := &in.Patches, &out.Patches
+		*out = make([]CatalogPatch, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterCatalogSpec.
@@ -144,6 +515,26 @@ func (in *ClusterCatalogStatus) DeepCopyInto(out *ClusterCatalogStatus) {
 		in, out := &in.LastUnpacked, &out.LastUnpacked
 		*out = (*in).DeepCopy()
 	}
+	if in.Content != nil {
+		in, out := &in.Content, &out.Content
+		*out = new(CatalogContentSummary)
+		**out = **in
+	}
+	if in.LastContentChange != nil {
+		in, out := &in.LastContentChange, &out.LastContentChange
+		*out = new(ContentChangeSummary)
+		**out = **in
+	}
+	if in.FilterResult != nil {
+		in, out := &in.FilterResult, &out.FilterResult
+		*out = new(CatalogFilterResult)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PatchResult != nil {
+		in, out := &in.PatchResult, &out.PatchResult
+		*out = new(CatalogPatchResult)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterCatalogStatus.
@@ -171,6 +562,68 @@ func (in *ClusterCatalogURLs) DeepCopy() *ClusterCatalogURLs {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CompositeMember) DeepCopyInto(out *CompositeMember) {
+	*out = *in
+	if in.Image != nil {
+		in, out := &in.Image, &out.Image
+		*out = new(ImageSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ClusterCatalog != nil {
+		in, out := &in.ClusterCatalog, &out.ClusterCatalog
+		*out = new(ClusterCatalogReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CompositeMember.
+func (in *CompositeMember) DeepCopy() *CompositeMember {
+	if in == nil {
+		return nil
+	}
+	out := new(CompositeMember)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CompositeSource) DeepCopyInto(out *CompositeSource) {
+	*out = *in
+	if in.Members != nil {
+		in, out := &in.Members, &out.Members
+		*out = make([]CompositeMember, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CompositeSource.
+func (in *CompositeSource) DeepCopy() *CompositeSource {
+	if in == nil {
+		return nil
+	}
+	out := new(CompositeSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ContentChangeSummary) DeepCopyInto(out *ContentChangeSummary) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ContentChangeSummary.
+func (in *ContentChangeSummary) DeepCopy() *ContentChangeSummary {
+	if in == nil {
+		return nil
+	}
+	out := new(ContentChangeSummary)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ImageSource) DeepCopyInto(out *ImageSource) {
 	*out = *in
@@ -191,6 +644,61 @@ func (in *ImageSource) DeepCopy() *ImageSource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JSONPatchOperation) DeepCopyInto(out *JSONPatchOperation) {
+	*out = *in
+	if in.Value != nil {
+		in, out := &in.Value, &out.Value
+		*out = new(apiextensionsv1.JSON)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JSONPatchOperation.
+func (in *JSONPatchOperation) DeepCopy() *JSONPatchOperation {
+	if in == nil {
+		return nil
+	}
+	out := new(JSONPatchOperation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PackageFilter) DeepCopyInto(out *PackageFilter) {
+	*out = *in
+	if in.Channels != nil {
+		in, out := &in.Channels, &out.Channels
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PackageFilter.
+func (in *PackageFilter) DeepCopy() *PackageFilter {
+	if in == nil {
+		return nil
+	}
+	out := new(PackageFilter)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PatchTarget) DeepCopyInto(out *PatchTarget) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PatchTarget.
+func (in *PatchTarget) DeepCopy() *PatchTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(PatchTarget)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ResolvedCatalogSource) DeepCopyInto(out *ResolvedCatalogSource) {
 	*out = *in
@@ -199,6 +707,11 @@ func (in *ResolvedCatalogSource) DeepCopyInto(out *ResolvedCatalogSource) {
 		*out = new(ResolvedImageSource)
 		**out = **in
 	}
+	if in.Composite != nil {
+		in, out := &in.Composite, &out.Composite
+		*out = new(ResolvedCompositeSource)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResolvedCatalogSource.
@@ -211,6 +724,68 @@ func (in *ResolvedCatalogSource) DeepCopy() *ResolvedCatalogSource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResolvedClusterCatalogSource) DeepCopyInto(out *ResolvedClusterCatalogSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResolvedClusterCatalogSource.
+func (in *ResolvedClusterCatalogSource) DeepCopy() *ResolvedClusterCatalogSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ResolvedClusterCatalogSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResolvedCompositeMember) DeepCopyInto(out *ResolvedCompositeMember) {
+	*out = *in
+	if in.Image != nil {
+		in, out := &in.Image, &out.Image
+		*out = new(ResolvedImageSource)
+		**out = **in
+	}
+	if in.ClusterCatalog != nil {
+		in, out := &in.ClusterCatalog, &out.ClusterCatalog
+		*out = new(ResolvedClusterCatalogSource)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResolvedCompositeMember.
+func (in *ResolvedCompositeMember) DeepCopy() *ResolvedCompositeMember {
+	if in == nil {
+		return nil
+	}
+	out := new(ResolvedCompositeMember)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResolvedCompositeSource) DeepCopyInto(out *ResolvedCompositeSource) {
+	*out = *in
+	if in.Members != nil {
+		in, out := &in.Members, &out.Members
+		*out = make([]ResolvedCompositeMember, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResolvedCompositeSource.
+func (in *ResolvedCompositeSource) DeepCopy() *ResolvedCompositeSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ResolvedCompositeSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ResolvedImageSource) DeepCopyInto(out *ResolvedImageSource) {
 	*out = *in
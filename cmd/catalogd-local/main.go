@@ -0,0 +1,158 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// catalogd-local serves catalogs defined in a file on localhost, without
+// Kubernetes. It unpacks, patches, filters and stores them in the same way
+// as the ClusterCatalog controller, for development and CI.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/containers/image/v5/types"
+	"github.com/go-logr/logr"
+	"github.com/spf13/pflag"
+	"k8s.io/klog/v2"
+	"k8s.io/klog/v2/textlogger"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+	"github.com/operator-framework/catalogd/internal/local"
+	"github.com/operator-framework/catalogd/internal/source"
+	"github.com/operator-framework/catalogd/internal/storage"
+	"github.com/operator-framework/catalogd/internal/version"
+)
+
+var setupLog = ctrl.Log.WithName("setup")
+
+func main() {
+	var (
+		configFile            string
+		addr                  string
+		cacheDir              string
+		caCertDir             string
+		directoryPollInterval time.Duration
+		retryInterval         time.Duration
+		catalogdVersion       bool
+	)
+	flag.StringVar(&configFile, "config", "", "The YAML file listing the catalogs to serve. Each catalog has a name, and either a spec with the schema of a ClusterCatalog spec or a directory holding its content.")
+	flag.StringVar(&addr, "addr", "localhost:8080", "The address the catalogs are served at.")
+	flag.StringVar(&cacheDir, "cache-dir", filepath.Join(os.TempDir(), "catalogd-local"), "The directory catalogs are unpacked and stored in.")
+	flag.StringVar(&caCertDir, "ca-certs-dir", "", "The directory of CA certificates to use for verifying HTTPS connections to image registries.")
+	flag.DurationVar(&directoryPollInterval, "directory-poll-interval", 5*time.Second, "How often the directories of catalogs, and the content of the ClusterCatalog members of composite catalogs, are checked again for changes.")
+	flag.DurationVar(&retryInterval, "retry-interval", 30*time.Second, "How long to wait before retrying to unpack a catalog that failed to be unpacked.")
+	flag.BoolVar(&catalogdVersion, "version", false, "print the catalogd version and exit")
+
+	klog.InitFlags(flag.CommandLine)
+	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
+	pflag.Parse()
+
+	if catalogdVersion {
+		fmt.Printf("%#v\n", version.Version())
+		os.Exit(0)
+	}
+
+	ctrl.SetLogger(textlogger.NewLogger(textlogger.NewConfig()))
+
+	if configFile == "" {
+		setupLog.Error(nil, "the config flag is required")
+		os.Exit(1)
+	}
+	cfg, err := local.LoadConfig(configFile)
+	if err != nil {
+		setupLog.Error(err, "unable to load catalogs")
+		os.Exit(1)
+	}
+
+	unpackCacheBasePath := filepath.Join(cacheDir, source.UnpackCacheDir)
+	storeDir := filepath.Join(cacheDir, "catalogs")
+	for _, dir := range []string{unpackCacheBasePath, storeDir} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			setupLog.Error(err, "unable to create cache directory")
+			os.Exit(1)
+		}
+	}
+
+	baseStorageURL, err := url.Parse(fmt.Sprintf("http://%s/catalogs/", addr))
+	if err != nil {
+		setupLog.Error(err, "unable to create base storage URL")
+		os.Exit(1)
+	}
+	localStorage := &storage.LocalDirV1{RootDir: storeDir, RootURL: baseStorageURL, Priorities: cfg.Priorities}
+
+	// Images are pulled with the credentials and registry configuration of
+	// the user running catalogd-local, as with other container tools.
+	imageUnpacker := &source.ContainersImageRegistry{
+		BaseCachePath: unpackCacheBasePath,
+		SourceContextFunc: func(logr.Logger) (*types.SystemContext, error) {
+			return &types.SystemContext{
+				DockerCertPath: caCertDir,
+				OCICertPath:    caCertDir,
+			}, nil
+		},
+	}
+	runner := &local.Runner{
+		Catalogs: cfg.Catalogs,
+		Unpacker: source.Router{
+			catalogdv1.SourceTypeImage: imageUnpacker,
+			catalogdv1.SourceTypeComposite: &source.Composite{
+				BaseCachePath:  unpackCacheBasePath,
+				Images:         imageUnpacker,
+				Catalogs:       localStorage,
+				CatalogSources: cfg.CatalogSource,
+			},
+		},
+		Storage:               localStorage,
+		DirectoryPollInterval: directoryPollInterval,
+		RetryInterval:         retryInterval,
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	ctx = log.IntoContext(ctx, ctrl.Log.WithName("local"))
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           localStorage.StorageServerHandler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer shutdownCancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			setupLog.Error(err, "error shutting down server")
+		}
+	}()
+	go runner.Run(ctx)
+
+	setupLog.Info("serving catalogs", "url", baseStorageURL.String(), "catalogs", len(cfg.Catalogs))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		setupLog.Error(err, "problem running server")
+		os.Exit(1)
+	}
+}
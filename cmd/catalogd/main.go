@@ -0,0 +1,37 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// catalogd queries the content served for ClusterCatalogs. Installed as
+// kubectl-catalogd, it can also be run as the kubectl plugin "kubectl catalogd".
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/operator-framework/catalogd/internal/cli"
+	"github.com/operator-framework/catalogd/internal/version"
+)
+
+func main() {
+	cmd := cli.NewCommand()
+	cmd.Version = version.Version().GitVersion
+	// Registers --kubeconfig.
+	cmd.PersistentFlags().AddGoFlagSet(flag.CommandLine)
+	if err := cmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
@@ -17,10 +17,13 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -31,6 +34,7 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/spf13/pflag"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/fields"
 	k8slabels "k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -57,9 +61,11 @@ import (
 	"github.com/operator-framework/catalogd/internal/features"
 	"github.com/operator-framework/catalogd/internal/garbagecollection"
 	catalogdmetrics "github.com/operator-framework/catalogd/internal/metrics"
+	"github.com/operator-framework/catalogd/internal/replication"
 	"github.com/operator-framework/catalogd/internal/serverutil"
 	"github.com/operator-framework/catalogd/internal/source"
 	"github.com/operator-framework/catalogd/internal/storage"
+	"github.com/operator-framework/catalogd/internal/tracing"
 	"github.com/operator-framework/catalogd/internal/version"
 	"github.com/operator-framework/catalogd/internal/webhook"
 )
@@ -72,6 +78,18 @@ var (
 const (
 	storageDir     = "catalogs"
 	authFilePrefix = "catalogd-global-pull-secret"
+
+	// The content of namespaced Catalogs is unpacked and stored apart from
+	// the content of ClusterCatalogs, so that the names of the two can never
+	// collide and the garbage collection of the unpack cache of
+	// ClusterCatalogs leaves it alone.
+	namespacedStorageDir     = "namespaces"
+	namespacedUnpackCacheDir = "unpack-namespaces"
+
+	// The content of ClusterCatalogPreviews is only kept while it is
+	// previewed, and is never served.
+	previewStorageDir     = "previews"
+	previewUnpackCacheDir = "unpack-previews"
 )
 
 func init() {
@@ -90,14 +108,27 @@ func main() {
 		catalogdVersion      bool
 		systemNamespace      string
 		catalogServerAddr    string
+		catalogServerAuth    bool
+		clientCAFile         string
+		catalogServerLimits  serverutil.RateLimitConfig
 		externalAddr         string
 		cacheDir             string
 		gcInterval           time.Duration
+		gcMinAge             time.Duration
+		gcDryRun             bool
+		cacheDirMaxSize      resource.QuantityValue
+		maxContentSize       resource.QuantityValue
 		certFile             string
 		keyFile              string
 		webhookPort          int
 		caCertDir            string
 		globalPullSecret     string
+		tracingConfig        tracing.Config
+		replicateFrom        string
+		replicationCAFile    string
+		replicationTokenFile string
+		replicationInterval  time.Duration
+		replicationMaxLag    time.Duration
 	)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "", "The address for the metrics endpoint. Requires tls-cert and tls-key. (Default: ':7443')")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
@@ -107,15 +138,33 @@ func main() {
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.StringVar(&systemNamespace, "system-namespace", "", "The namespace catalogd uses for internal state, configuration, and workloads")
 	flag.StringVar(&catalogServerAddr, "catalogs-server-addr", ":8443", "The address where the unpacked catalogs' content will be accessible")
+	flag.BoolVar(&catalogServerAuth, "catalogs-server-auth", false, "Require clients of the catalog server to authenticate with a bearer token and to be authorized to get the clustercatalogs/content or catalogs/content subresource of the catalog they request.")
+	flag.StringVar(&clientCAFile, "catalogs-server-client-ca", "", "The CA bundle file used to verify client certificates presented to the catalog server. The file is reloaded when it changes. Client certificates are required unless catalogs-server-auth is set, in which case clients may authenticate with either a certificate or a bearer token. Requires tls-cert and tls-key.")
+	flag.Float64Var(&catalogServerLimits.RequestsPerSecond, "catalogs-server-rate-limit", 0, "The sustained number of requests per second each client of the catalog server may make. Clients are identified by their authenticated user when catalogs-server-auth is set and by their IP address otherwise. 0 disables the limit.")
+	flag.IntVar(&catalogServerLimits.Burst, "catalogs-server-rate-limit-burst", 10, "The number of requests each client of the catalog server may make at once before catalogs-server-rate-limit applies.")
+	flag.IntVar(&catalogServerLimits.MaxInFlight, "catalogs-server-max-in-flight", 0, "The maximum number of requests the catalog server serves concurrently, not counting event streams. 0 disables the limit.")
 	flag.StringVar(&externalAddr, "external-address", "catalogd-service.olmv1-system.svc", "The external address at which the http(s) server is reachable.")
 	flag.StringVar(&cacheDir, "cache-dir", "/var/cache/", "The directory in the filesystem that catalogd will use for file based caching")
 	flag.BoolVar(&catalogdVersion, "version", false, "print the catalogd version and exit")
-	flag.DurationVar(&gcInterval, "gc-interval", 12*time.Hour, "interval in which garbage collection should be run against the catalog content cache")
+	flag.DurationVar(&gcInterval, "gc-interval", 12*time.Hour, "interval in which full garbage collection sweeps should be run against the catalog content cache, in addition to the one on startup. The content of deleted catalogs is cleaned up as soon as their deletion is observed.")
+	flag.Var(&cacheDirMaxSize, "cache-dir-max-size", "The disk budget for the cache directory, such as 10Gi. Room is reserved for the decompressed layers of an image as it is unpacked, by evicting the least recently unpacked images of other catalogs that are not in use, and it is not unpacked if it does not fit. The content served for catalogs is never evicted. There is no budget if unset.")
+	flag.Var(&maxContentSize, "max-catalog-content-size", "The maximum size of the image of a catalog, and of its layers once decompressed, such as 1Gi. Larger images are not unpacked. There is no maximum if unset.")
+	flag.DurationVar(&gcMinAge, "gc-min-age", time.Hour, "minimum time since the last modification of a stale cache, storage or temporary entry before garbage collection removes it, so that entries that are still being written to are left alone")
+	flag.BoolVar(&gcDryRun, "gc-dry-run", false, "log and count the stale entries garbage collection finds in its metrics without removing them")
 	flag.StringVar(&certFile, "tls-cert", "", "The certificate file used for serving catalog and metrics. Required to enable the metrics server. Requires tls-key.")
 	flag.StringVar(&keyFile, "tls-key", "", "The key file used for serving catalog contents and metrics. Required to enable the metrics server. Requires tls-cert.")
 	flag.IntVar(&webhookPort, "webhook-server-port", 9443, "The port that the mutating webhook server serves at.")
 	flag.StringVar(&caCertDir, "ca-certs-dir", "", "The directory of CA certificate to use for verifying HTTPS connections to image registries.")
 	flag.StringVar(&globalPullSecret, "global-pull-secret", "", "The <namespace>/<name> of the global pull secret that is going to be used to pull bundle images.")
+	flag.StringVar(&tracingConfig.Endpoint, "tracing-otlp-endpoint", "", "The host:port of an OTLP/gRPC collector to export traces to. If unset, the standard OTEL_EXPORTER_OTLP_TRACES_ENDPOINT and OTEL_EXPORTER_OTLP_ENDPOINT environment variables are used, and traces are not exported if neither is set.")
+	flag.BoolVar(&tracingConfig.Insecure, "tracing-otlp-insecure", false, "Connect to the OTLP collector without TLS.")
+	flag.Float64Var(&tracingConfig.SampleRatio, "tracing-sample-ratio", 1, "The fraction of traces started by catalogd that are sampled, between 0 and 1. Traces continued from a client keep the client's sampling decision.")
+
+	flag.StringVar(&replicateFrom, "replicate-from", "", "The URL of the metrics server of the catalogd instance to replicate catalog content from, e.g. https://catalogd-service.olmv1-system.svc:7443. If set, catalogd runs as a read-only replica of the catalog server: it serves the content it replicates, and runs no controllers, webhooks or garbage collection.")
+	flag.StringVar(&replicationCAFile, "replication-ca-file", "", "The CA bundle file used to verify the certificate of the server given by replicate-from. The system CAs are used if unset.")
+	flag.StringVar(&replicationTokenFile, "replication-token-file", "/var/run/secrets/kubernetes.io/serviceaccount/token", "The file of the bearer token used to authenticate to the server given by replicate-from.")
+	flag.DurationVar(&replicationInterval, "replication-interval", 10*time.Second, "How often a read-only replica syncs catalog content from the server given by replicate-from.")
+	flag.DurationVar(&replicationMaxLag, "replication-max-lag", 5*time.Minute, "How long a read-only replica stays ready after it last fetched the catalog revisions of the server given by replicate-from.")
 
 	klog.InitFlags(flag.CommandLine)
 
@@ -229,7 +278,7 @@ func main() {
 		Metrics:                metricsServerOptions,
 		PprofBindAddress:       pprofAddr,
 		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
+		LeaderElection:         enableLeaderElection && replicateFrom == "",
 		LeaderElectionID:       "catalogd-operator-lock",
 		WebhookServer:          webhookServer,
 		Cache:                  cacheOptions,
@@ -260,8 +309,15 @@ func main() {
 		setupLog.Error(err, "unable to create cache directory for unpacking")
 		os.Exit(1)
 	}
-	unpacker := &source.ContainersImageRegistry{
-		BaseCachePath: unpackCacheBasePath,
+	diskQuota := &source.DiskQuota{
+		Root:       cacheDir,
+		MaxBytes:   cacheDirMaxSize.Value(),
+		CachePaths: []string{unpackCacheBasePath},
+	}
+	imageUnpacker := &source.ContainersImageRegistry{
+		BaseCachePath:   unpackCacheBasePath,
+		MaxContentBytes: maxContentSize.Value(),
+		Quota:           diskQuota,
 		SourceContextFunc: func(logger logr.Logger) (*types.SystemContext, error) {
 			srcContext := &types.SystemContext{
 				DockerCertPath: caCertDir,
@@ -279,8 +335,20 @@ func main() {
 		},
 	}
 
-	var localStorage storage.Instance
 	metrics.Registry.MustRegister(catalogdmetrics.RequestDurationMetric)
+	metrics.Registry.MustRegister(catalogdmetrics.ResponseEncodingMetric)
+	metrics.Registry.MustRegister(catalogdmetrics.RejectedRequestsMetric)
+	metrics.Registry.MustRegister(catalogdmetrics.CatalogRequestsMetric)
+	metrics.Registry.MustRegister(catalogdmetrics.CatalogRequestDurationMetric)
+	metrics.Registry.MustRegister(catalogdmetrics.CatalogResponseSizeMetric)
+	metrics.Registry.MustRegister(catalogdmetrics.CatalogOperationDurationMetric)
+	metrics.Registry.MustRegister(catalogdmetrics.UnpackOutcomeMetric)
+	metrics.Registry.MustRegister(catalogdmetrics.PulledBytesMetric)
+	metrics.Registry.MustRegister(catalogdmetrics.StoredBytesMetric)
+	metrics.Registry.MustRegister(catalogdmetrics.GCRemovedEntriesMetric)
+	metrics.Registry.MustRegister(catalogdmetrics.GCReclaimedBytesMetric)
+	metrics.Registry.MustRegister(catalogdmetrics.GCErrorsMetric)
+	metrics.Registry.MustRegister(catalogdmetrics.GCLastRunMetric)
 
 	storeDir := filepath.Join(cacheDir, storageDir)
 	if err := os.MkdirAll(storeDir, 0700); err != nil {
@@ -294,7 +362,23 @@ func main() {
 		os.Exit(1)
 	}
 
-	localStorage = storage.LocalDirV1{RootDir: storeDir, RootURL: baseStorageURL}
+	localStorage := &storage.LocalDirV1{
+		RootDir:    storeDir,
+		RootURL:    baseStorageURL,
+		Priorities: clusterCatalogPriorities(mgr.GetClient()),
+	}
+
+	namespacedStoreDir := filepath.Join(cacheDir, namespacedStorageDir)
+	if err := os.MkdirAll(namespacedStoreDir, 0700); err != nil {
+		setupLog.Error(err, "unable to create storage directory for namespaced catalogs")
+		os.Exit(1)
+	}
+	namespacedStorageURL, err := url.Parse(fmt.Sprintf("%s/namespaces/", externalAddr))
+	if err != nil {
+		setupLog.Error(err, "unable to create base storage URL for namespaced catalogs")
+		os.Exit(1)
+	}
+	namespacedStorage := &storage.LocalDirV1{RootDir: namespacedStoreDir, RootURL: namespacedStorageURL}
 
 	// Config for the the catalogd web server
 	catalogServerConfig := serverutil.CatalogServerConfig{
@@ -302,7 +386,30 @@ func main() {
 		CatalogAddr:  catalogServerAddr,
 		CertFile:     certFile,
 		KeyFile:      keyFile,
+		CatalogsPath: baseStorageURL.Path,
 		LocalStorage: localStorage,
+		RateLimit:    catalogServerLimits,
+
+		NamespacedCatalogsPath: namespacedStorageURL.Path,
+		NamespacedStorage:      namespacedStorage,
+	}
+	if clientCAFile != "" {
+		catalogServerConfig.ClientCA, err = serverutil.NewClientCAWatcher(clientCAFile)
+		if err != nil {
+			setupLog.Error(err, "unable to initialize client CA watcher")
+			os.Exit(1)
+		}
+		if err := mgr.Add(catalogServerConfig.ClientCA); err != nil {
+			setupLog.Error(err, "unable to add client CA watcher to manager")
+			os.Exit(1)
+		}
+	}
+	if catalogServerAuth {
+		catalogServerConfig.Auth, err = serverutil.NewDelegatingAuthConfig(mgr.GetConfig(), mgr.GetHTTPClient(), catalogServerConfig.ClientCA)
+		if err != nil {
+			setupLog.Error(err, "unable to configure catalog server authentication and authorization")
+			os.Exit(1)
+		}
 	}
 
 	err = serverutil.AddCatalogServerToManager(mgr, catalogServerConfig, cw)
@@ -311,14 +418,146 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err = (&corecontrollers.ClusterCatalogReconciler{
+	// Requests to the metrics server are authenticated and authorized, so
+	// replicating content requires access to GET below /replication/.
+	replicatedStorages := map[string]replication.Storage{
+		"clustercatalogs": localStorage,
+		"catalogs":        namespacedStorage,
+	}
+	if err := mgr.AddMetricsServerExtraHandler(replication.Path, replication.NewHandler(replicatedStorages)); err != nil {
+		setupLog.Error(err, "unable to add replication API to metrics server")
+		os.Exit(1)
+	}
+
+	if replicateFrom != "" {
+		leaderURL, err := url.Parse(replicateFrom)
+		if err != nil {
+			setupLog.Error(err, "unable to parse replicate-from URL")
+			os.Exit(1)
+		}
+		replicationClient, err := newReplicationClient(replicationCAFile)
+		if err != nil {
+			setupLog.Error(err, "unable to create replication client")
+			os.Exit(1)
+		}
+		follower := &replication.Follower{
+			LeaderURL: leaderURL,
+			Client:    replicationClient,
+			TokenFile: replicationTokenFile,
+			Storages:  replicatedStorages,
+			Interval:  replicationInterval,
+			MaxLag:    replicationMaxLag,
+			Logger:    ctrl.Log.WithName("replication"),
+		}
+		if err := mgr.Add(follower); err != nil {
+			setupLog.Error(err, "unable to add replication to manager")
+			os.Exit(1)
+		}
+		if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
+			setupLog.Error(err, "unable to set up health check")
+			os.Exit(1)
+		}
+		if err := mgr.AddReadyzCheck("replicated", follower.ReadyCheck); err != nil {
+			setupLog.Error(err, "unable to set up ready check")
+			os.Exit(1)
+		}
+		setupLog.Info("starting read-only replica", "replicate-from", replicateFrom)
+		startManager(mgr, tracingConfig)
+		return
+	}
+
+	unpacker := source.Router{
+		catalogdv1.SourceTypeImage: imageUnpacker,
+		catalogdv1.SourceTypeComposite: &source.Composite{
+			BaseCachePath: unpackCacheBasePath,
+			Images:        imageUnpacker,
+			Catalogs:      localStorage,
+			CatalogSources: func(ctx context.Context, name string) (*catalogdv1.CatalogSource, error) {
+				var member catalogdv1.ClusterCatalog
+				if err := mgr.GetClient().Get(ctx, client.ObjectKey{Name: name}, &member); err != nil {
+					return nil, client.IgnoreNotFound(err)
+				}
+				return &member.Spec.Source, nil
+			},
+			Quota: diskQuota,
+		},
+	}
+	clusterCatalogReconciler := &corecontrollers.ClusterCatalogReconciler{
 		Client:   mgr.GetClient(),
 		Unpacker: unpacker,
 		Storage:  localStorage,
-	}).SetupWithManager(mgr); err != nil {
+		Recorder: mgr.GetEventRecorderFor("catalogd-controller-manager"),
+	}
+	if err = clusterCatalogReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ClusterCatalog")
 		os.Exit(1)
 	}
+	metrics.Registry.MustRegister(catalogdmetrics.NewLastSuccessfulPollCollector(clusterCatalogReconciler.LastSuccessfulPolls))
+
+	namespacedUnpackCacheBasePath := filepath.Join(cacheDir, namespacedUnpackCacheDir)
+	if err := os.MkdirAll(namespacedUnpackCacheBasePath, 0770); err != nil {
+		setupLog.Error(err, "unable to create cache directory for unpacking namespaced catalogs")
+		os.Exit(1)
+	}
+	diskQuota.CachePaths = append(diskQuota.CachePaths, namespacedUnpackCacheBasePath)
+	catalogReconciler := &corecontrollers.CatalogReconciler{
+		Client:    mgr.GetClient(),
+		APIReader: mgr.GetAPIReader(),
+		Storage:   namespacedStorage,
+		Recorder:  mgr.GetEventRecorderFor("catalogd-controller-manager"),
+	}
+	// Namespaced catalogs are pulled with their own pull secrets only, never
+	// with the global pull secret.
+	catalogReconciler.Unpacker = source.Router{
+		catalogdv1.SourceTypeImage: &source.ContainersImageRegistry{
+			BaseCachePath: namespacedUnpackCacheBasePath,
+			SourceContextFunc: func(logr.Logger) (*types.SystemContext, error) {
+				return &types.SystemContext{
+					DockerCertPath: caCertDir,
+					OCICertPath:    caCertDir,
+				}, nil
+			},
+			AuthFunc:        catalogReconciler.PullSecretAuth,
+			MaxContentBytes: maxContentSize.Value(),
+			Quota:           diskQuota,
+		},
+	}
+	if err = catalogReconciler.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Catalog")
+		os.Exit(1)
+	}
+
+	// Any content left over from previews interrupted by a restart is
+	// removed, as previews are never resumed.
+	previewStoreDir := filepath.Join(cacheDir, previewStorageDir)
+	previewUnpackCacheBasePath := filepath.Join(cacheDir, previewUnpackCacheDir)
+	for _, dir := range []string{previewStoreDir, previewUnpackCacheBasePath} {
+		if err := os.RemoveAll(dir); err != nil {
+			setupLog.Error(err, "unable to remove preview directory", "dir", dir)
+			os.Exit(1)
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			setupLog.Error(err, "unable to create preview directory", "dir", dir)
+			os.Exit(1)
+		}
+	}
+	diskQuota.CachePaths = append(diskQuota.CachePaths, previewUnpackCacheBasePath)
+	// Previews are not served, so their storage has no URL.
+	previewStorage := &storage.LocalDirV1{RootDir: previewStoreDir}
+	if err = (&corecontrollers.ClusterCatalogPreviewReconciler{
+		Client: mgr.GetClient(),
+		Unpacker: &source.ContainersImageRegistry{
+			BaseCachePath:     previewUnpackCacheBasePath,
+			SourceContextFunc: imageUnpacker.SourceContextFunc,
+			MaxContentBytes:   maxContentSize.Value(),
+			Quota:             diskQuota,
+		},
+		Storage:  previewStorage,
+		Catalogs: localStorage,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterCatalogPreview")
+		os.Exit(1)
+	}
 
 	if globalPullSecretKey != nil {
 		setupLog.Info("creating SecretSyncer controller for watching secret", "Secret", globalPullSecret)
@@ -349,35 +588,111 @@ func main() {
 		os.Exit(1)
 	}
 
-	ctx := ctrl.SetupSignalHandler()
 	gc := &garbagecollection.GarbageCollector{
-		CachePath:      unpackCacheBasePath,
-		Logger:         ctrl.Log.WithName("garbage-collector"),
-		MetadataClient: metaClient,
-		Interval:       gcInterval,
+		CachePath:             unpackCacheBasePath,
+		StoragePath:           storeDir,
+		NamespacedCachePath:   namespacedUnpackCacheBasePath,
+		NamespacedStoragePath: namespacedStoreDir,
+		PreviewCachePath:      previewUnpackCacheBasePath,
+		PreviewStoragePath:    previewStoreDir,
+		Storage:               localStorage,
+		NamespacedStorage:     namespacedStorage,
+		PreviewStorage:        previewStorage,
+		TempDir:               os.TempDir(),
+		MinAge:                gcMinAge,
+		DryRun:                gcDryRun,
+		Logger:                ctrl.Log.WithName("garbage-collector"),
+		MetadataClient:        metaClient,
+		Interval:              gcInterval,
 	}
 	if err := mgr.Add(gc); err != nil {
 		setupLog.Error(err, "unable to add garbage collector to manager")
 		os.Exit(1)
 	}
+	// Requests to the metrics server are authenticated and authorized, so
+	// triggering garbage collection requires access to POST to /gc.
+	if err := mgr.AddMetricsServerExtraHandler("/gc", gc.TriggerHandler()); err != nil {
+		setupLog.Error(err, "unable to add garbage collection trigger to metrics server")
+		os.Exit(1)
+	}
 
-	// mutating webhook that labels ClusterCatalogs with name label
-	if err = (&webhook.ClusterCatalog{}).SetupWebhookWithManager(mgr); err != nil {
+	// mutating webhook that labels ClusterCatalogs with name label, and
+	// validating webhooks for ClusterCatalogs and Catalogs
+	if err = (&webhook.ClusterCatalog{StorageDir: storeDir}).SetupWebhookWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create webhook", "webhook", "ClusterCatalog")
 		os.Exit(1)
 	}
-
-	setupLog.Info("starting mutating webhook manager")
-	if err := mgr.Start(ctx); err != nil {
-		setupLog.Error(err, "problem running manager")
+	if err = (&webhook.Catalog{Reader: mgr.GetAPIReader(), StorageDir: namespacedStoreDir}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "Catalog")
 		os.Exit(1)
 	}
+
+	setupLog.Info("starting manager")
+	startManager(mgr, tracingConfig)
 	if err := os.Remove(authFilePath); err != nil {
 		setupLog.Error(err, "failed to cleanup temporary auth file")
 		os.Exit(1)
 	}
 }
 
+// startManager runs mgr until a termination signal is received, exporting
+// traces as configured by tracingConfig.
+func startManager(mgr ctrl.Manager, tracingConfig tracing.Config) {
+	ctx := ctrl.SetupSignalHandler()
+	shutdownTracing, err := tracing.Setup(ctx, ctrl.Log.WithName("tracing"), tracingConfig)
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+	if err := mgr.Start(ctx); err != nil {
+		setupLog.Error(err, "problem running manager")
+		os.Exit(1)
+	}
+	// The signal handler context is done by now, so give pending spans a
+	// fresh deadline to be flushed in.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		setupLog.Error(err, "failed to flush traces")
+	}
+	cancel()
+}
+
+// newReplicationClient returns a client for the replication API that
+// verifies the server against the CA bundle in caFile, or the system CAs if
+// caFile is empty.
+func newReplicationClient(caFile string) (*http.Client, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		caPEM, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA bundle: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in %q", caFile)
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport, Timeout: 5 * time.Minute}, nil
+}
+
+// clusterCatalogPriorities returns a function that maps the name of each
+// ClusterCatalog to its priority, for searching the content of all of them.
+func clusterCatalogPriorities(cl client.Reader) func(context.Context) (map[string]int32, error) {
+	return func(ctx context.Context) (map[string]int32, error) {
+		var catalogs catalogdv1.ClusterCatalogList
+		if err := cl.List(ctx, &catalogs); err != nil {
+			return nil, err
+		}
+		priorities := make(map[string]int32, len(catalogs.Items))
+		for _, catalog := range catalogs.Items {
+			priorities[catalog.Name] = catalog.Spec.Priority
+		}
+		return priorities, nil
+	}
+}
+
 func podNamespace() string {
 	namespace, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
 	if err != nil {
@@ -0,0 +1,204 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+
+	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+)
+
+// catalog is a ClusterCatalog that is serving its content.
+type catalog struct {
+	Name     string `json:"name"`
+	Priority int32  `json:"priority"`
+	URL      string `json:"url"`
+}
+
+// discoverCatalogs lists the ClusterCatalogs that are serving their content,
+// ordered from the highest to the lowest priority and then by name. When
+// catalogs are selected with --catalog, only those are returned, and an error
+// is returned if one of them is not serving.
+func (o *options) discoverCatalogs(ctx context.Context) ([]catalog, error) {
+	cl, err := o.newClient()
+	if err != nil {
+		return nil, fmt.Errorf("error creating client: %w", err)
+	}
+	var list catalogdv1.ClusterCatalogList
+	if err := cl.List(ctx, &list); err != nil {
+		return nil, fmt.Errorf("error listing ClusterCatalogs: %w", err)
+	}
+
+	wanted, missing := sets.New(o.catalogs...), sets.New(o.catalogs...)
+	var catalogs []catalog
+	for _, cc := range list.Items {
+		if wanted.Len() > 0 && !wanted.Has(cc.Name) {
+			continue
+		}
+		if !meta.IsStatusConditionTrue(cc.Status.Conditions, catalogdv1.TypeServing) || cc.Status.URLs == nil {
+			continue
+		}
+		u, err := o.contentURL(cc.Status.URLs.Base)
+		if err != nil {
+			return nil, fmt.Errorf("ClusterCatalog %q: %w", cc.Name, err)
+		}
+		catalogs = append(catalogs, catalog{Name: cc.Name, Priority: cc.Spec.Priority, URL: u})
+		missing.Delete(cc.Name)
+	}
+	if missing.Len() > 0 {
+		return nil, fmt.Errorf("ClusterCatalogs not found or not serving: %s", strings.Join(sets.List(missing), ", "))
+	}
+	slices.SortFunc(catalogs, func(a, b catalog) int {
+		if a.Priority != b.Priority {
+			return int(b.Priority) - int(a.Priority)
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return catalogs, nil
+}
+
+// contentURL returns the URL of the content of a catalog served at base. If
+// a server is set, the scheme and host of base are replaced with those of the
+// server, so that catalogs can be fetched through a port-forward.
+func (o *options) contentURL(base string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid base URL %q: %w", base, err)
+	}
+	if o.server != "" {
+		server, err := url.Parse(o.server)
+		if err != nil {
+			return "", fmt.Errorf("invalid server URL %q: %w", o.server, err)
+		}
+		u.Scheme, u.Host = server.Scheme, server.Host
+		u.Path = path.Join("/", server.Path, u.Path)
+	}
+	return u.JoinPath("api", "v1", "all").String(), nil
+}
+
+// httpClient returns a client for the catalog server configured with the TLS
+// options. It authenticates with the credentials of the current kubeconfig
+// context, such as a bearer token or a client certificate, as the catalog
+// server authorizes requests for content like the Kubernetes API server.
+//
+// The credentials are only sent to the catalog server of the cluster, at the
+// URLs in the status of ClusterCatalogs, or to the server set with --server
+// when --send-credentials is set, and never without verifying the certificate
+// of the catalog server.
+func (o *options) httpClient() (*http.Client, error) {
+	if o.sendCredentials && o.insecureSkipTLSVerify {
+		return nil, errors.New("--send-credentials can not be used with --insecure-skip-tls-verify")
+	}
+	cfg := &rest.Config{}
+	if o.restConfig != nil && (o.server == "" || o.sendCredentials) && !o.insecureSkipTLSVerify {
+		kubeconfig, err := o.restConfig()
+		if err != nil {
+			return nil, fmt.Errorf("error loading kubeconfig: %w", err)
+		}
+		cfg = rest.CopyConfig(kubeconfig)
+	}
+	// Only the credentials apply to the catalog server, which has its own
+	// certificate and is not reached through the proxy of the cluster.
+	cfg.TLSClientConfig = rest.TLSClientConfig{
+		Insecure:   o.insecureSkipTLSVerify,
+		ServerName: o.tlsServerName,
+		CAFile:     o.caFile,
+		CertFile:   cfg.CertFile,
+		KeyFile:    cfg.KeyFile,
+		CertData:   cfg.CertData,
+		KeyData:    cfg.KeyData,
+	}
+	cfg.Proxy = nil
+	cfg.Impersonate = rest.ImpersonationConfig{}
+	transport, err := rest.TransportFor(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error configuring transport: %w", err)
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// catalogContent is the content served by a catalog.
+type catalogContent struct {
+	catalog
+	*declcfg.DeclarativeConfig
+}
+
+// fetchContent fetches the content of the catalogs concurrently, and returns
+// it in the order of catalogs.
+func (o *options) fetchContent(ctx context.Context, catalogs []catalog) ([]catalogContent, error) {
+	httpClient, err := o.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	contents := make([]catalogContent, len(catalogs))
+	errs := make([]error, len(catalogs))
+	var wg sync.WaitGroup
+	for i, c := range catalogs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cfg, err := fetch(ctx, httpClient, c.URL)
+			if err != nil {
+				errs[i] = fmt.Errorf("error fetching content of ClusterCatalog %q: %w", c.Name, err)
+				return
+			}
+			contents[i] = catalogContent{catalog: c, DeclarativeConfig: cfg}
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return contents, nil
+}
+
+func fetch(ctx context.Context, httpClient *http.Client, contentURL string) (*declcfg.DeclarativeConfig, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, contentURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %q from %s", resp.Status, contentURL)
+	}
+	return declcfg.LoadReader(resp.Body)
+}
+
+// listCatalogs returns the content of the selected catalogs.
+func (o *options) listCatalogs(ctx context.Context) ([]catalogContent, error) {
+	catalogs, err := o.discoverCatalogs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return o.fetchContent(ctx, catalogs)
+}
+
+// newClient returns a client for the cluster of the current kubeconfig
+// context.
+func newClient() (client.Client, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	return client.New(cfg, client.Options{Scheme: scheme})
+}
@@ -0,0 +1,129 @@
+// Package cli implements the catalogd command line interface, which queries
+// the content served for ClusterCatalogs.
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputDot   = "dot"
+
+	// extraOutputsAnnotation lists the output formats a command supports
+	// besides table and json, separated by commas.
+	extraOutputsAnnotation = "catalogd.operatorframework.io/extra-outputs"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(catalogdv1.AddToScheme(scheme))
+}
+
+type options struct {
+	server                string
+	caFile                string
+	tlsServerName         string
+	insecureSkipTLSVerify bool
+	sendCredentials       bool
+	catalogs              []string
+	output                string
+
+	newClient  func() (client.Client, error)
+	restConfig func() (*rest.Config, error)
+}
+
+// NewCommand returns the root catalogd command.
+func NewCommand() *cobra.Command {
+	return newCommand(&options{newClient: newClient, restConfig: config.GetConfig})
+}
+
+func newCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "catalogd",
+		Short: "Query the content served for ClusterCatalogs",
+		Long: `Query the content served for ClusterCatalogs.
+
+The ClusterCatalogs that are serving their content are discovered in the
+cluster of the current kubeconfig context, and their content is fetched from
+the URL in their status with the credentials of that context. When the catalog server is not reachable at that URL,
+for example from outside of the cluster, set --server to the URL of a
+port-forward to the catalog server:
+
+  kubectl -n olmv1-system port-forward svc/catalogd-service 8443:443
+  catalogd packages --server https://localhost:8443 --tls-server-name catalogd-service.olmv1-system.svc --certificate-authority ca.crt --send-credentials
+
+The credentials of the context are only sent to the server set with --server
+if --send-credentials is set, and never with --insecure-skip-tls-verify.
+
+Results are ordered by the priority of their ClusterCatalog, highest first.`,
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+			outputs := []string{outputTable, outputJSON}
+			if extra := cmd.Annotations[extraOutputsAnnotation]; extra != "" {
+				outputs = append(outputs, strings.Split(extra, ",")...)
+			}
+			if !slices.Contains(outputs, o.output) {
+				return fmt.Errorf("unsupported output format %q, must be one of %s", o.output, strings.Join(outputs, ", "))
+			}
+			return nil
+		},
+	}
+	flags := cmd.PersistentFlags()
+	flags.StringVar(&o.server, "server", "", "The URL of the catalog server, replacing the scheme and host of the URLs in the status of ClusterCatalogs.")
+	flags.StringVar(&o.caFile, "certificate-authority", "", "The file of the certificate authority that signed the certificate of the catalog server.")
+	flags.StringVar(&o.tlsServerName, "tls-server-name", "", "The name to verify the certificate of the catalog server against, instead of the host of its URL.")
+	flags.BoolVar(&o.insecureSkipTLSVerify, "insecure-skip-tls-verify", false, "Do not verify the certificate of the catalog server. The credentials of the kubeconfig context are then not sent.")
+	flags.BoolVar(&o.sendCredentials, "send-credentials", false, "Send the credentials of the kubeconfig context to the catalog server set with --server.")
+	flags.StringSliceVar(&o.catalogs, "catalog", nil, "The ClusterCatalogs to query. All ClusterCatalogs that are serving their content are queried by default.")
+	flags.StringVarP(&o.output, "output", "o", outputTable, "The output format, one of table or json. The graph command also supports dot.")
+
+	cmd.AddCommand(
+		newCatalogsCommand(o),
+		newPackagesCommand(o),
+		newChannelsCommand(o),
+		newBundlesCommand(o),
+		newGraphCommand(o),
+		newSearchCommand(o),
+	)
+	return cmd
+}
+
+// printRows prints rows as a table with headers, using cells to format each
+// row, or as a JSON array.
+func printRows[T any](w io.Writer, output string, rows []T, headers []string, cells func(T) []string) error {
+	switch output {
+	case outputJSON:
+		if rows == nil {
+			rows = []T{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	case outputTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(headers, "\t"))
+		for _, row := range rows {
+			fmt.Fprintln(tw, strings.Join(cells(row), "\t"))
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unsupported output format %q", output)
+	}
+}
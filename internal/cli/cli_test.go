@@ -0,0 +1,301 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+)
+
+const (
+	platformContent = `{"schema":"olm.package","name":"foo","defaultChannel":"stable","description":"Runs foo databases"}
+{"schema":"olm.channel","package":"foo","name":"stable","entries":[{"name":"foo.v1.0.0"},{"name":"foo.v1.1.0","replaces":"foo.v1.0.0"},{"name":"foo.v2.0.0","skipRange":"<2.0.0","skips":["foo.v1.1.0"]}]}
+{"schema":"olm.channel","package":"foo","name":"candidate","entries":[{"name":"foo.v2.0.0"}]}
+{"schema":"olm.bundle","package":"foo","name":"foo.v1.0.0","image":"registry.example.com/foo:v1.0.0","properties":[{"type":"olm.package","value":{"packageName":"foo","version":"1.0.0"}}]}
+{"schema":"olm.bundle","package":"foo","name":"foo.v1.1.0","image":"registry.example.com/foo:v1.1.0","properties":[{"type":"olm.package","value":{"packageName":"foo","version":"1.1.0"}}]}
+{"schema":"olm.bundle","package":"foo","name":"foo.v2.0.0","image":"registry.example.com/foo:v2.0.0","properties":[{"type":"olm.package","value":{"packageName":"foo","version":"2.0.0"}}]}
+`
+	communityContent = `{"schema":"olm.package","name":"bar","defaultChannel":"stable"}
+{"schema":"olm.channel","package":"bar","name":"stable","entries":[{"name":"bar.v0.1.0"}]}
+{"schema":"olm.bundle","package":"bar","name":"bar.v0.1.0","image":"registry.example.com/bar:v0.1.0","properties":[{"type":"olm.package","value":{"packageName":"bar","version":"0.1.0"}}]}
+{"schema":"olm.package","name":"foo","defaultChannel":"stable"}
+{"schema":"olm.channel","package":"foo","name":"stable","entries":[{"name":"foo.v0.9.0"}]}
+{"schema":"olm.bundle","package":"foo","name":"foo.v0.9.0","image":"registry.example.com/foo:v0.9.0","properties":[{"type":"olm.package","value":{"packageName":"foo","version":"0.9.0"}}]}
+`
+)
+
+func clusterCatalog(name string, priority int32, serving bool) *catalogdv1.ClusterCatalog {
+	cc := &catalogdv1.ClusterCatalog{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       catalogdv1.ClusterCatalogSpec{Priority: priority},
+	}
+	if serving {
+		cc.Status.URLs = &catalogdv1.ClusterCatalogURLs{Base: "https://catalogd-service.olmv1-system.svc/catalogs/" + name}
+		cc.Status.Conditions = []metav1.Condition{{Type: catalogdv1.TypeServing, Status: metav1.ConditionTrue, Reason: catalogdv1.ReasonAvailable}}
+	}
+	return cc
+}
+
+func run(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/catalogs/platform/api/v1/all":
+			_, _ = w.Write([]byte(platformContent))
+		case "/catalogs/community/api/v1/all":
+			_, _ = w.Write([]byte(communityContent))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		clusterCatalog("community", 0, true),
+		clusterCatalog("platform", 100, true),
+		clusterCatalog("unpacking", 0, false),
+	).Build()
+	cmd := newCommand(&options{newClient: func() (client.Client, error) { return cl, nil }})
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&bytes.Buffer{})
+	// Flags in args take precedence over the server set here.
+	cmd.SetArgs(append([]string{"--server", server.URL}, args...))
+	err := cmd.ExecuteContext(context.Background())
+	return out.String(), err
+}
+
+func table(lines ...string) string {
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// normalize removes the padding of a table, so that tests do not depend on
+// the width of columns.
+func normalize(out string) string {
+	lines := strings.Split(out, "\n")
+	for i, l := range lines {
+		lines[i] = strings.Join(strings.Fields(l), " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestCommands(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name: "catalogs are ordered by priority",
+			args: []string{"catalogs", "--server", "http://localhost:8080/prefix"},
+			expected: table(
+				"NAME PRIORITY URL",
+				"platform 100 http://localhost:8080/prefix/catalogs/platform/api/v1/all",
+				"community 0 http://localhost:8080/prefix/catalogs/community/api/v1/all",
+			),
+		},
+		{
+			name: "packages",
+			args: []string{"packages"},
+			expected: table(
+				"CATALOG PRIORITY PACKAGE DEFAULT CHANNEL LATEST VERSION",
+				"platform 100 foo stable 2.0.0",
+				"community 0 bar stable 0.1.0",
+				"community 0 foo stable 0.9.0",
+			),
+		},
+		{
+			name: "packages of selected catalogs",
+			args: []string{"packages", "--catalog", "community"},
+			expected: table(
+				"CATALOG PRIORITY PACKAGE DEFAULT CHANNEL LATEST VERSION",
+				"community 0 bar stable 0.1.0",
+				"community 0 foo stable 0.9.0",
+			),
+		},
+		{
+			name: "search matches names and descriptions",
+			args: []string{"search", "DATABASE"},
+			expected: table(
+				"CATALOG PRIORITY PACKAGE DEFAULT CHANNEL LATEST VERSION",
+				"platform 100 foo stable 2.0.0",
+			),
+		},
+		{
+			name: "channels",
+			args: []string{"channels", "foo"},
+			expected: table(
+				"CATALOG CHANNEL DEFAULT HEAD ENTRIES",
+				"platform candidate false foo.v2.0.0 1",
+				"platform stable true foo.v2.0.0 3",
+				"community stable true foo.v0.9.0 1",
+			),
+		},
+		{
+			name: "bundles of a channel",
+			args: []string{"bundles", "foo", "--channel", "stable", "--catalog", "platform"},
+			expected: table(
+				"CATALOG BUNDLE VERSION CHANNELS IMAGE",
+				"platform foo.v2.0.0 2.0.0 candidate,stable registry.example.com/foo:v2.0.0",
+				"platform foo.v1.1.0 1.1.0 stable registry.example.com/foo:v1.1.0",
+				"platform foo.v1.0.0 1.0.0 stable registry.example.com/foo:v1.0.0",
+			),
+		},
+		{
+			name: "upgrade graph of the default channel",
+			args: []string{"graph", "foo", "--catalog", "platform"},
+			expected: table(
+				"CATALOG CHANNEL BUNDLE VERSION HEAD UPGRADES FROM",
+				"platform stable foo.v2.0.0 2.0.0 true foo.v1.0.0,foo.v1.1.0",
+				"platform stable foo.v1.1.0 1.1.0 false foo.v1.0.0",
+				"platform stable foo.v1.0.0 1.0.0 false",
+			),
+		},
+		{
+			name: "upgrade graph as dot",
+			args: []string{"graph", "foo", "--catalog", "platform", "-o", "dot"},
+			expected: `digraph "foo" {
+  subgraph "cluster_platform" {
+    label="platform/stable";
+    "platform/foo.v2.0.0" [label="foo.v2.0.0", style=bold];
+    "platform/foo.v1.0.0" -> "platform/foo.v2.0.0";
+    "platform/foo.v1.1.0" -> "platform/foo.v2.0.0";
+    "platform/foo.v1.1.0" [label="foo.v1.1.0"];
+    "platform/foo.v1.0.0" -> "platform/foo.v1.1.0";
+    "platform/foo.v1.0.0" [label="foo.v1.0.0"];
+  }
+}
+`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := run(t, tc.args...)
+			require.NoError(t, err)
+			if strings.Contains(tc.expected, "digraph") {
+				assert.Equal(t, tc.expected, out)
+				return
+			}
+			assert.Equal(t, normalize(tc.expected), normalize(out))
+		})
+	}
+}
+
+func TestCommandsJSON(t *testing.T) {
+	out, err := run(t, "channels", "bar", "-o", "json")
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"catalog":"community","package":"bar","channel":"stable","default":true,"heads":["bar.v0.1.0"],"entries":1}]`, out)
+}
+
+func TestCommandErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "catalog not serving",
+			args:     []string{"packages", "--catalog", "unpacking"},
+			expected: `ClusterCatalogs not found or not serving: unpacking`,
+		},
+		{
+			name:     "unknown package",
+			args:     []string{"channels", "baz"},
+			expected: `package "baz" not found`,
+		},
+		{
+			name:     "unknown channel",
+			args:     []string{"graph", "foo", "--channel", "fast"},
+			expected: `channel "fast" of package "foo" not found`,
+		},
+		{
+			name:     "dot output is only supported by graph",
+			args:     []string{"packages", "-o", "dot"},
+			expected: `unsupported output format "dot", must be one of table, json`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := run(t, tc.args...)
+			require.EqualError(t, err, tc.expected)
+		})
+	}
+}
+
+func TestFetchAuthenticatesWithKubeconfigCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer kube-token" || r.Header.Get("Impersonate-User") != "" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(platformContent))
+	}))
+	defer server.Close()
+
+	kubeconfig := func() (*rest.Config, error) {
+		return &rest.Config{
+			Host:        "https://kubernetes.example.com",
+			BearerToken: "kube-token",
+			Impersonate: rest.ImpersonationConfig{UserName: "admin"},
+		}, nil
+	}
+	for _, tc := range []struct {
+		name          string
+		options       options
+		authenticated bool
+		expectedErr   string
+	}{
+		{
+			name:          "URL in the status",
+			options:       options{restConfig: kubeconfig},
+			authenticated: true,
+		},
+		{
+			name:    "without a kubeconfig",
+			options: options{},
+		},
+		{
+			name:    "server without --send-credentials",
+			options: options{restConfig: kubeconfig, server: server.URL},
+		},
+		{
+			name:          "server with --send-credentials",
+			options:       options{restConfig: kubeconfig, server: server.URL, sendCredentials: true},
+			authenticated: true,
+		},
+		{
+			name:    "insecure-skip-tls-verify",
+			options: options{restConfig: kubeconfig, insecureSkipTLSVerify: true},
+		},
+		{
+			name:        "--send-credentials with insecure-skip-tls-verify",
+			options:     options{restConfig: kubeconfig, server: server.URL, sendCredentials: true, insecureSkipTLSVerify: true},
+			expectedErr: "--send-credentials can not be used with --insecure-skip-tls-verify",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			httpClient, err := tc.options.httpClient()
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			cfg, err := fetch(context.Background(), httpClient, server.URL+"/catalogs/platform/api/v1/all")
+			if !tc.authenticated {
+				require.ErrorContains(t, err, "401 Unauthorized")
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, cfg.Bundles, 3)
+		})
+	}
+}
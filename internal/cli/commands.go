@@ -0,0 +1,276 @@
+package cli
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/blang/semver/v4"
+	"github.com/spf13/cobra"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/alpha/property"
+)
+
+func newCatalogsCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "catalogs",
+		Short: "List the ClusterCatalogs that are serving their content",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			catalogs, err := o.discoverCatalogs(cmd.Context())
+			if err != nil {
+				return err
+			}
+			return printRows(cmd.OutOrStdout(), o.output, catalogs,
+				[]string{"NAME", "PRIORITY", "URL"},
+				func(c catalog) []string { return []string{c.Name, strconv.Itoa(int(c.Priority)), c.URL} })
+		},
+	}
+}
+
+type packageRow struct {
+	Catalog        string `json:"catalog"`
+	Priority       int32  `json:"priority"`
+	Package        string `json:"package"`
+	DefaultChannel string `json:"defaultChannel"`
+	LatestVersion  string `json:"latestVersion"`
+}
+
+var packageHeaders = []string{"CATALOG", "PRIORITY", "PACKAGE", "DEFAULT CHANNEL", "LATEST VERSION"}
+
+func packageCells(r packageRow) []string {
+	return []string{r.Catalog, strconv.Itoa(int(r.Priority)), r.Package, r.DefaultChannel, r.LatestVersion}
+}
+
+// packageRows returns a row for each package of contents accepted by match.
+func packageRows(contents []catalogContent, match func(declcfg.Package) bool) []packageRow {
+	var rows []packageRow
+	for _, c := range contents {
+		latest := map[string]semver.Version{}
+		for _, b := range c.Bundles {
+			if v, err := bundleVersion(b); err == nil && v.GT(latest[b.Package]) {
+				latest[b.Package] = v
+			}
+		}
+		pkgs := slices.Clone(c.Packages)
+		slices.SortFunc(pkgs, func(a, b declcfg.Package) int { return strings.Compare(a.Name, b.Name) })
+		for _, p := range pkgs {
+			if !match(p) {
+				continue
+			}
+			row := packageRow{Catalog: c.Name, Priority: c.Priority, Package: p.Name, DefaultChannel: p.DefaultChannel}
+			if v, ok := latest[p.Name]; ok {
+				row.LatestVersion = v.String()
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+func newPackagesCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "packages",
+		Short: "List the packages of ClusterCatalogs",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			contents, err := o.listCatalogs(cmd.Context())
+			if err != nil {
+				return err
+			}
+			rows := packageRows(contents, func(declcfg.Package) bool { return true })
+			return printRows(cmd.OutOrStdout(), o.output, rows, packageHeaders, packageCells)
+		},
+	}
+}
+
+func newSearchCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "search QUERY",
+		Short: "Search the packages of ClusterCatalogs by name and description",
+		Long: `Search the packages of ClusterCatalogs by name and description.
+
+A package matches when its name or description contains the query, ignoring
+case. Packages in more than one ClusterCatalog are listed for each of them,
+from the ClusterCatalog with the highest priority to the lowest.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			contents, err := o.listCatalogs(cmd.Context())
+			if err != nil {
+				return err
+			}
+			query := strings.ToLower(args[0])
+			rows := packageRows(contents, func(p declcfg.Package) bool {
+				return strings.Contains(strings.ToLower(p.Name), query) || strings.Contains(strings.ToLower(p.Description), query)
+			})
+			return printRows(cmd.OutOrStdout(), o.output, rows, packageHeaders, packageCells)
+		},
+	}
+}
+
+type channelRow struct {
+	Catalog string   `json:"catalog"`
+	Package string   `json:"package"`
+	Channel string   `json:"channel"`
+	Default bool     `json:"default"`
+	Heads   []string `json:"heads"`
+	Entries int      `json:"entries"`
+}
+
+func newChannelsCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "channels PACKAGE",
+		Short: "List the channels of a package",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			contents, err := o.listCatalogs(cmd.Context())
+			if err != nil {
+				return err
+			}
+			pkg := args[0]
+			if err := requirePackage(contents, pkg); err != nil {
+				return err
+			}
+			var rows []channelRow
+			for _, c := range contents {
+				defaultChannel := ""
+				for _, p := range c.Packages {
+					if p.Name == pkg {
+						defaultChannel = p.DefaultChannel
+					}
+				}
+				for _, ch := range packageChannels(c.DeclarativeConfig, pkg) {
+					rows = append(rows, channelRow{
+						Catalog: c.Name,
+						Package: pkg,
+						Channel: ch.Name,
+						Default: ch.Name == defaultChannel,
+						Heads:   channelHeads(ch),
+						Entries: len(ch.Entries),
+					})
+				}
+			}
+			return printRows(cmd.OutOrStdout(), o.output, rows,
+				[]string{"CATALOG", "CHANNEL", "DEFAULT", "HEAD", "ENTRIES"},
+				func(r channelRow) []string {
+					return []string{r.Catalog, r.Channel, strconv.FormatBool(r.Default), strings.Join(r.Heads, ","), strconv.Itoa(r.Entries)}
+				})
+		},
+	}
+}
+
+type bundleRow struct {
+	Catalog  string   `json:"catalog"`
+	Package  string   `json:"package"`
+	Bundle   string   `json:"bundle"`
+	Version  string   `json:"version"`
+	Channels []string `json:"channels"`
+	Image    string   `json:"image"`
+}
+
+func newBundlesCommand(o *options) *cobra.Command {
+	var channel string
+	cmd := &cobra.Command{
+		Use:   "bundles PACKAGE",
+		Short: "List the bundles of a package, from the highest version to the lowest",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			contents, err := o.listCatalogs(cmd.Context())
+			if err != nil {
+				return err
+			}
+			pkg := args[0]
+			if err := requirePackage(contents, pkg); err != nil {
+				return err
+			}
+			var rows []bundleRow
+			for _, c := range contents {
+				bundleChannels := map[string][]string{}
+				for _, ch := range packageChannels(c.DeclarativeConfig, pkg) {
+					for _, e := range ch.Entries {
+						bundleChannels[e.Name] = append(bundleChannels[e.Name], ch.Name)
+					}
+				}
+				var bundles []declcfg.Bundle
+				for _, b := range c.Bundles {
+					if b.Package != pkg || (channel != "" && !slices.Contains(bundleChannels[b.Name], channel)) {
+						continue
+					}
+					bundles = append(bundles, b)
+				}
+				sortBundles(bundles)
+				for _, b := range bundles {
+					row := bundleRow{Catalog: c.Name, Package: pkg, Bundle: b.Name, Channels: bundleChannels[b.Name], Image: b.Image}
+					if v, err := bundleVersion(b); err == nil {
+						row.Version = v.String()
+					}
+					rows = append(rows, row)
+				}
+			}
+			return printRows(cmd.OutOrStdout(), o.output, rows,
+				[]string{"CATALOG", "BUNDLE", "VERSION", "CHANNELS", "IMAGE"},
+				func(r bundleRow) []string {
+					return []string{r.Catalog, r.Bundle, r.Version, strings.Join(r.Channels, ","), r.Image}
+				})
+		},
+	}
+	cmd.Flags().StringVar(&channel, "channel", "", "Only list the bundles of this channel.")
+	return cmd
+}
+
+// requirePackage returns an error if pkg is not in any of contents.
+func requirePackage(contents []catalogContent, pkg string) error {
+	for _, c := range contents {
+		for _, p := range c.Packages {
+			if p.Name == pkg {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("package %q not found", pkg)
+}
+
+// packageChannels returns the channels of pkg in cfg, sorted by name.
+func packageChannels(cfg *declcfg.DeclarativeConfig, pkg string) []declcfg.Channel {
+	var channels []declcfg.Channel
+	for _, ch := range cfg.Channels {
+		if ch.Package == pkg {
+			channels = append(channels, ch)
+		}
+	}
+	slices.SortFunc(channels, func(a, b declcfg.Channel) int { return strings.Compare(a.Name, b.Name) })
+	return channels
+}
+
+func bundleVersion(b declcfg.Bundle) (semver.Version, error) {
+	props, err := property.Parse(b.Properties)
+	if err != nil {
+		return semver.Version{}, err
+	}
+	if len(props.Packages) != 1 {
+		return semver.Version{}, fmt.Errorf("bundle %q must have exactly one %q property", b.Name, property.TypePackage)
+	}
+	return semver.Parse(props.Packages[0].Version)
+}
+
+// sortBundles sorts bundles from the highest version to the lowest. Bundles
+// without a valid version are sorted last, by name.
+func sortBundles(bundles []declcfg.Bundle) {
+	slices.SortStableFunc(bundles, func(a, b declcfg.Bundle) int {
+		va, errA := bundleVersion(a)
+		vb, errB := bundleVersion(b)
+		switch {
+		case errA == nil && errB == nil:
+			if c := vb.Compare(va); c != 0 {
+				return c
+			}
+		case errA == nil:
+			return -1
+		case errB == nil:
+			return 1
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+}
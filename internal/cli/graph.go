@@ -0,0 +1,194 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/blang/semver/v4"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+)
+
+// graphNode is a bundle in the upgrade graph of a channel, along with the
+// bundles that can be upgraded to it.
+type graphNode struct {
+	Catalog      string   `json:"catalog"`
+	Channel      string   `json:"channel"`
+	Bundle       string   `json:"bundle"`
+	Version      string   `json:"version"`
+	Head         bool     `json:"head"`
+	UpgradesFrom []string `json:"upgradesFrom"`
+}
+
+func newGraphCommand(o *options) *cobra.Command {
+	var channel string
+	cmd := &cobra.Command{
+		Use:   "graph PACKAGE",
+		Short: "Show the upgrade graph of a channel of a package",
+		Long: `Show the upgrade graph of a channel of a package.
+
+Each bundle of the channel is listed from the highest version to the lowest,
+along with the bundles that can be upgraded to it through its replaces, skips
+and skipRange. The heads of the channel are the bundles no other bundle
+replaces or skips. With --output dot, the graph is printed in the DOT language
+of Graphviz:
+
+  catalogd graph my-operator -o dot | dot -Tsvg > graph.svg`,
+		Args:        cobra.ExactArgs(1),
+		Annotations: map[string]string{extraOutputsAnnotation: outputDot},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			contents, err := o.listCatalogs(cmd.Context())
+			if err != nil {
+				return err
+			}
+			pkg := args[0]
+			if err := requirePackage(contents, pkg); err != nil {
+				return err
+			}
+			var nodes []graphNode
+			for _, c := range contents {
+				name := channel
+				if name == "" {
+					for _, p := range c.Packages {
+						if p.Name == pkg {
+							name = p.DefaultChannel
+						}
+					}
+				}
+				for _, ch := range packageChannels(c.DeclarativeConfig, pkg) {
+					if ch.Name == name {
+						nodes = append(nodes, channelGraph(c.Name, ch, bundleVersions(c.DeclarativeConfig, pkg))...)
+					}
+				}
+			}
+			if len(nodes) == 0 && channel != "" {
+				return fmt.Errorf("channel %q of package %q not found", channel, pkg)
+			}
+			if o.output == outputDot {
+				return printDot(cmd.OutOrStdout(), pkg, nodes)
+			}
+			return printRows(cmd.OutOrStdout(), o.output, nodes,
+				[]string{"CATALOG", "CHANNEL", "BUNDLE", "VERSION", "HEAD", "UPGRADES FROM"},
+				func(n graphNode) []string {
+					return []string{n.Catalog, n.Channel, n.Bundle, n.Version, strconv.FormatBool(n.Head), strings.Join(n.UpgradesFrom, ",")}
+				})
+		},
+	}
+	cmd.Flags().StringVar(&channel, "channel", "", "The channel to show the upgrade graph of. Defaults to the default channel of the package.")
+	return cmd
+}
+
+// bundleVersions returns the versions of the bundles of pkg in cfg, by name.
+func bundleVersions(cfg *declcfg.DeclarativeConfig, pkg string) map[string]semver.Version {
+	versions := map[string]semver.Version{}
+	for _, b := range cfg.Bundles {
+		if b.Package != pkg {
+			continue
+		}
+		if v, err := bundleVersion(b); err == nil {
+			versions[b.Name] = v
+		}
+	}
+	return versions
+}
+
+// channelHeads returns the names of the entries of ch that no other entry
+// replaces or skips, sorted by name.
+func channelHeads(ch declcfg.Channel) []string {
+	replaced := sets.New[string]()
+	for _, e := range ch.Entries {
+		if e.Replaces != "" {
+			replaced.Insert(e.Replaces)
+		}
+		replaced.Insert(e.Skips...)
+	}
+	heads := sets.New[string]()
+	for _, e := range ch.Entries {
+		if !replaced.Has(e.Name) {
+			heads.Insert(e.Name)
+		}
+	}
+	return sets.List(heads)
+}
+
+// channelGraph returns the nodes of the upgrade graph of ch, from the highest
+// version to the lowest.
+func channelGraph(catalogName string, ch declcfg.Channel, versions map[string]semver.Version) []graphNode {
+	heads := sets.New(channelHeads(ch)...)
+	nodes := make([]graphNode, 0, len(ch.Entries))
+	for _, e := range ch.Entries {
+		from := sets.New[string](e.Skips...)
+		if e.Replaces != "" {
+			from.Insert(e.Replaces)
+		}
+		if e.SkipRange != "" {
+			if inRange, err := semver.ParseRange(e.SkipRange); err == nil {
+				for _, other := range ch.Entries {
+					if v, ok := versions[other.Name]; ok && other.Name != e.Name && inRange(v) {
+						from.Insert(other.Name)
+					}
+				}
+			}
+		}
+		node := graphNode{
+			Catalog:      catalogName,
+			Channel:      ch.Name,
+			Bundle:       e.Name,
+			Head:         heads.Has(e.Name),
+			UpgradesFrom: sets.List(from),
+		}
+		if v, ok := versions[e.Name]; ok {
+			node.Version = v.String()
+		}
+		nodes = append(nodes, node)
+	}
+	slices.SortStableFunc(nodes, func(a, b graphNode) int {
+		va, okA := versions[a.Bundle]
+		vb, okB := versions[b.Bundle]
+		switch {
+		case okA && okB:
+			if c := vb.Compare(va); c != 0 {
+				return c
+			}
+		case okA:
+			return -1
+		case okB:
+			return 1
+		}
+		return strings.Compare(a.Bundle, b.Bundle)
+	})
+	return nodes
+}
+
+// printDot prints nodes as a DOT digraph, with a cluster for the channel of
+// each catalog. Edges point in the direction of upgrades.
+func printDot(w io.Writer, pkg string, nodes []graphNode) error {
+	id := func(catalogName, bundle string) string { return strconv.Quote(catalogName + "/" + bundle) }
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", strconv.Quote(pkg))
+	for i := 0; i < len(nodes); {
+		c := nodes[i].Catalog
+		fmt.Fprintf(&b, "  subgraph %s {\n", strconv.Quote("cluster_"+c))
+		fmt.Fprintf(&b, "    label=%s;\n", strconv.Quote(c+"/"+nodes[i].Channel))
+		for ; i < len(nodes) && nodes[i].Catalog == c; i++ {
+			n := nodes[i]
+			attrs := "label=" + strconv.Quote(n.Bundle)
+			if n.Head {
+				attrs += ", style=bold"
+			}
+			fmt.Fprintf(&b, "    %s [%s];\n", id(c, n.Bundle), attrs)
+			for _, from := range n.UpgradesFrom {
+				fmt.Fprintf(&b, "    %s -> %s;\n", id(c, from), id(c, n.Bundle))
+			}
+		}
+		b.WriteString("  }\n")
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
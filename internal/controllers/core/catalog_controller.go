@@ -0,0 +1,229 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+	"github.com/operator-framework/catalogd/internal/source"
+	"github.com/operator-framework/catalogd/internal/storage"
+	"github.com/operator-framework/catalogd/internal/tracing"
+)
+
+// CatalogReconciler reconciles a namespaced Catalog object.
+//
+// A Catalog is unpacked and stored exactly like a ClusterCatalog: it is
+// reconciled as a ClusterCatalog named after the name its content is stored
+// under, whose status and finalizers are then copied back to the Catalog.
+type CatalogReconciler struct {
+	client.Client
+	// APIReader reads the pull secrets of Catalogs. The Secrets cached by
+	// the manager are restricted to the global pull secret.
+	APIReader client.Reader
+	Unpacker  source.Unpacker
+	Storage   storage.Instance
+	Recorder  record.EventRecorder
+
+	catalogs *ClusterCatalogReconciler
+}
+
+//+kubebuilder:rbac:groups=olm.operatorframework.io,resources=catalogs,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=olm.operatorframework.io,resources=catalogs/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=olm.operatorframework.io,resources=catalogs/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get
+
+func (r *CatalogReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	l := log.FromContext(ctx).WithName("catalogd-controller")
+	ctx = log.IntoContext(ctx, l)
+
+	l.Info("reconcile starting")
+	defer l.Info("reconcile ending")
+
+	ctx, span := tracing.Tracer().Start(ctx, "CatalogReconciler.Reconcile", trace.WithAttributes(tracing.CatalogKey.String(storage.NamespacedCatalog(req.Namespace, req.Name))))
+
+	existingCatalog := catalogdv1.Catalog{}
+	if err := r.Client.Get(ctx, req.NamespacedName, &existingCatalog); err != nil {
+		err = client.IgnoreNotFound(err)
+		tracing.EndSpan(span, err)
+		return ctrl.Result{}, err
+	}
+
+	reconciledCatalog := existingCatalog.DeepCopy()
+	clusterCatalog := asClusterCatalog(reconciledCatalog)
+	res, reconcileErr := r.catalogs.reconcile(ctx, clusterCatalog)
+	if reconcileErr != nil {
+		r.catalogs.deleteStoredCatalog(clusterCatalog.Name)
+	}
+	if checkForUnexpectedFieldChange(*asClusterCatalog(&existingCatalog), *clusterCatalog) {
+		panic("spec or metadata changed by reconciler")
+	}
+	reconciledCatalog.Status = clusterCatalog.Status
+	reconciledCatalog.Finalizers = clusterCatalog.Finalizers
+
+	updateStatus := !equality.Semantic.DeepEqual(existingCatalog.Status, reconciledCatalog.Status)
+	updateFinalizers := !equality.Semantic.DeepEqual(existingCatalog.Finalizers, reconciledCatalog.Finalizers)
+
+	// As for ClusterCatalogs, the status update returns the object without
+	// the finalizers set by the reconciler, so they are set again after it.
+	finalizers := reconciledCatalog.Finalizers
+	if updateStatus {
+		if err := r.Client.Status().Update(ctx, reconciledCatalog); err != nil {
+			reconcileErr = errors.Join(reconcileErr, fmt.Errorf("error updating status: %v", err))
+		}
+	}
+	reconciledCatalog.Finalizers = finalizers
+	if updateFinalizers {
+		if err := r.Client.Update(ctx, reconciledCatalog); err != nil {
+			reconcileErr = errors.Join(reconcileErr, fmt.Errorf("error updating finalizers: %v", err))
+		}
+	}
+
+	tracing.EndSpan(span, reconcileErr)
+	return res, reconcileErr
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CatalogReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := r.setup(); err != nil {
+		return err
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&catalogdv1.Catalog{}).
+		Complete(r)
+}
+
+func (r *CatalogReconciler) setup() error {
+	r.catalogs = &ClusterCatalogReconciler{
+		Client:         r.Client,
+		Unpacker:       r.Unpacker,
+		Storage:        r.Storage,
+		storedCatalogs: map[string]storedCatalogData{},
+	}
+	if r.Recorder != nil {
+		r.catalogs.Recorder = catalogEventRecorder{r.Recorder}
+	}
+	if err := r.catalogs.setupFinalizers(); err != nil {
+		return fmt.Errorf("failed to setup finalizers: %v", err)
+	}
+	return nil
+}
+
+// PullSecretAuth returns the credentials in the pull secrets of the Catalog
+// that catalog was created from by the reconciler, in the format of an auth
+// file. It returns nil if the Catalog has no pull secrets. When more than one
+// pull secret has credentials for a registry, the ones of the pull secret
+// listed first are used.
+func (r *CatalogReconciler) PullSecretAuth(ctx context.Context, catalog *catalogdv1.ClusterCatalog) ([]byte, error) {
+	key := types.NamespacedName{Namespace: catalog.Namespace, Name: path.Base(catalog.Name)}
+	var owner catalogdv1.Catalog
+	if err := r.Client.Get(ctx, key, &owner); err != nil {
+		return nil, err
+	}
+	if len(owner.Spec.PullSecrets) == 0 {
+		return nil, nil
+	}
+
+	auths := map[string]json.RawMessage{}
+	for _, ref := range owner.Spec.PullSecrets {
+		var secret corev1.Secret
+		if err := r.APIReader.Get(ctx, types.NamespacedName{Namespace: key.Namespace, Name: ref.Name}, &secret); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("pull secret %q not found", ref.Name)
+			}
+			return nil, fmt.Errorf("error getting pull secret %q: %w", ref.Name, err)
+		}
+		// Like the global pull secret, pull secrets are in the format of
+		// a .dockerconfigjson file, which is the format of auth files.
+		data, ok := secret.Data[corev1.DockerConfigJsonKey]
+		if !ok {
+			return nil, fmt.Errorf("pull secret %q has no %s key", ref.Name, corev1.DockerConfigJsonKey)
+		}
+		var config struct {
+			Auths map[string]json.RawMessage `json:"auths"`
+		}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("error parsing pull secret %q: %w", ref.Name, err)
+		}
+		for registry, auth := range config.Auths {
+			if _, ok := auths[registry]; !ok {
+				auths[registry] = auth
+			}
+		}
+	}
+	return json.Marshal(map[string]any{"auths": auths})
+}
+
+// asClusterCatalog returns the ClusterCatalog that catalog is reconciled as.
+// It keeps the namespace of catalog, which identifies the Catalog it was
+// created from along with the base of its name.
+func asClusterCatalog(catalog *catalogdv1.Catalog) *catalogdv1.ClusterCatalog {
+	clusterCatalog := &catalogdv1.ClusterCatalog{
+		ObjectMeta: *catalog.ObjectMeta.DeepCopy(),
+		Spec:       *catalog.Spec.ClusterCatalogSpec.DeepCopy(),
+		Status:     *catalog.Status.DeepCopy(),
+	}
+	clusterCatalog.Name = storage.NamespacedCatalog(catalog.Namespace, catalog.Name)
+	return clusterCatalog
+}
+
+// catalogEventRecorder records the events of the ClusterCatalogs that
+// Catalogs are reconciled as on the Catalogs.
+type catalogEventRecorder struct {
+	record.EventRecorder
+}
+
+func (r catalogEventRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	r.EventRecorder.Event(catalogFor(object), eventtype, reason, message)
+}
+
+func (r catalogEventRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.EventRecorder.Eventf(catalogFor(object), eventtype, reason, messageFmt, args...)
+}
+
+func (r catalogEventRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.EventRecorder.AnnotatedEventf(catalogFor(object), annotations, eventtype, reason, messageFmt, args...)
+}
+
+func catalogFor(object runtime.Object) runtime.Object {
+	clusterCatalog, ok := object.(*catalogdv1.ClusterCatalog)
+	if !ok {
+		return object
+	}
+	catalog := &catalogdv1.Catalog{
+		TypeMeta:   metav1.TypeMeta{APIVersion: catalogdv1.GroupVersion.String(), Kind: "Catalog"},
+		ObjectMeta: *clusterCatalog.ObjectMeta.DeepCopy(),
+	}
+	catalog.Name = path.Base(clusterCatalog.Name)
+	return catalog
+}
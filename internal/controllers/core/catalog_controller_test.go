@@ -0,0 +1,167 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+	"github.com/operator-framework/catalogd/internal/source"
+)
+
+func newTestCatalog(finalizers ...string) *catalogdv1.Catalog {
+	return &catalogdv1.Catalog{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "tenant-a",
+			Name:       "mine",
+			Generation: 1,
+			Finalizers: finalizers,
+		},
+		Spec: catalogdv1.CatalogSpec{
+			ClusterCatalogSpec: catalogdv1.ClusterCatalogSpec{
+				Source: catalogdv1.CatalogSource{
+					Type: catalogdv1.SourceTypeImage,
+					Image: &catalogdv1.ImageSource{
+						Ref: "my.org/someimage:latest",
+					},
+				},
+				AvailabilityMode: catalogdv1.AvailabilityModeAvailable,
+			},
+		},
+	}
+}
+
+func newCatalogTestClient(t *testing.T, objs ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	require.NoError(t, catalogdv1.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).WithStatusSubresource(&catalogdv1.Catalog{}).Build()
+}
+
+func TestCatalogReconcile(t *testing.T) {
+	ctx := context.Background()
+	cl := newCatalogTestClient(t, newTestCatalog())
+	reconciler := &CatalogReconciler{
+		Client: cl,
+		Unpacker: &MockSource{result: &source.Result{
+			State: source.StateUnpacked,
+			FS:    &fstest.MapFS{},
+			ResolvedSource: &catalogdv1.ResolvedCatalogSource{
+				Image: &catalogdv1.ResolvedImageSource{Ref: "my.org/someimage@someSHA256Digest"},
+			},
+		}},
+		Storage: &MockStore{},
+	}
+	require.NoError(t, reconciler.setup())
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "tenant-a", Name: "mine"}}
+
+	// The first reconcile adds the finalizer, and the second one unpacks.
+	_, err := reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+	var catalog catalogdv1.Catalog
+	require.NoError(t, cl.Get(ctx, req.NamespacedName, &catalog))
+	assert.Equal(t, []string{fbcDeletionFinalizer}, catalog.Finalizers)
+
+	_, err = reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.NoError(t, cl.Get(ctx, req.NamespacedName, &catalog))
+	assert.True(t, meta.IsStatusConditionTrue(catalog.Status.Conditions, catalogdv1.TypeServing))
+	assert.Equal(t, &catalogdv1.ClusterCatalogURLs{Base: "URL"}, catalog.Status.URLs)
+	assert.Equal(t, "my.org/someimage@someSHA256Digest", catalog.Status.ResolvedSource.Image.Ref)
+	assert.Contains(t, reconciler.catalogs.storedCatalogs, "tenant-a/catalogs/mine")
+}
+
+func TestCatalogFor(t *testing.T) {
+	catalog := newTestCatalog(fbcDeletionFinalizer)
+	clusterCatalog := asClusterCatalog(catalog)
+	assert.Equal(t, "tenant-a/catalogs/mine", clusterCatalog.Name)
+	assert.Equal(t, catalog.Spec.ClusterCatalogSpec, clusterCatalog.Spec)
+
+	object, ok := catalogFor(clusterCatalog).(*catalogdv1.Catalog)
+	require.True(t, ok)
+	assert.Equal(t, "tenant-a", object.Namespace)
+	assert.Equal(t, "mine", object.Name)
+	assert.Equal(t, "Catalog", object.Kind)
+}
+
+func TestPullSecretAuth(t *testing.T) {
+	dockerConfig := func(auths string) *corev1.Secret {
+		return &corev1.Secret{
+			Type: corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":` + auths + `}`)},
+		}
+	}
+	first := dockerConfig(`{"registry-a.example.com":{"auth":"Zmlyc3Q="}}`)
+	first.ObjectMeta = metav1.ObjectMeta{Namespace: "tenant-a", Name: "first"}
+	second := dockerConfig(`{"registry-a.example.com":{"auth":"c2Vjb25k"},"registry-b.example.com":{"auth":"c2Vjb25k"}}`)
+	second.ObjectMeta = metav1.ObjectMeta{Namespace: "tenant-a", Name: "second"}
+	elsewhere := dockerConfig(`{"registry-c.example.com":{"auth":"b3RoZXI="}}`)
+	elsewhere.ObjectMeta = metav1.ObjectMeta{Namespace: "tenant-b", Name: "elsewhere"}
+
+	for _, tc := range []struct {
+		name          string
+		pullSecrets   []string
+		expectedAuths map[string]string
+		expectedError string
+	}{
+		{
+			name: "no pull secrets",
+		},
+		{
+			name:        "the first pull secret with credentials for a registry wins",
+			pullSecrets: []string{"first", "second"},
+			expectedAuths: map[string]string{
+				"registry-a.example.com": "Zmlyc3Q=",
+				"registry-b.example.com": "c2Vjb25k",
+			},
+		},
+		{
+			name:          "pull secrets in other namespaces are not found",
+			pullSecrets:   []string{"first", "elsewhere"},
+			expectedError: `pull secret "elsewhere" not found`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			catalog := newTestCatalog()
+			for _, name := range tc.pullSecrets {
+				catalog.Spec.PullSecrets = append(catalog.Spec.PullSecrets, corev1.LocalObjectReference{Name: name})
+			}
+			cl := newCatalogTestClient(t, catalog, first, second, elsewhere)
+			reconciler := &CatalogReconciler{Client: cl, APIReader: cl}
+
+			auth, err := reconciler.PullSecretAuth(context.Background(), asClusterCatalog(catalog))
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			if tc.expectedAuths == nil {
+				assert.Nil(t, auth)
+				return
+			}
+			var config struct {
+				Auths map[string]struct {
+					Auth string `json:"auth"`
+				} `json:"auths"`
+			}
+			require.NoError(t, json.Unmarshal(auth, &config))
+			auths := map[string]string{}
+			for registry, a := range config.Auths {
+				auths[registry] = a.Auth
+			}
+			assert.Equal(t, tc.expectedAuths, auths)
+		})
+	}
+}
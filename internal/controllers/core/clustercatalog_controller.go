@@ -20,26 +20,37 @@ import (
 	"context" // #nosec
 	"errors"
 	"fmt"
+	"maps"
+	"math"
 	"slices"
 	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	crfinalizer "sigs.k8s.io/controller-runtime/pkg/finalizer"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+	"github.com/operator-framework/catalogd/internal/filter"
+	catalogdmetrics "github.com/operator-framework/catalogd/internal/metrics"
+	"github.com/operator-framework/catalogd/internal/patch"
 	"github.com/operator-framework/catalogd/internal/source"
 	"github.com/operator-framework/catalogd/internal/storage"
+	"github.com/operator-framework/catalogd/internal/tracing"
 )
 
 const (
@@ -54,6 +65,9 @@ type ClusterCatalogReconciler struct {
 	client.Client
 	Unpacker source.Unpacker
 	Storage  storage.Instance
+	// Recorder emits Events for transitions in the lifecycle of catalogs.
+	// Events are not emitted if it is nil.
+	Recorder record.EventRecorder
 
 	finalizers crfinalizer.Finalizers
 
@@ -63,16 +77,33 @@ type ClusterCatalogReconciler struct {
 	//    of the Unpacker and Storage interfaces. We should fix this.
 	storedCatalogsMu sync.RWMutex
 	storedCatalogs   map[string]storedCatalogData
+
+	// lastSuccessfulPolls records when each catalog was last unpacked and
+	// stored successfully. Unlike storedCatalogs, entries are kept when a
+	// later attempt fails, until the catalog is no longer served.
+	lastSuccessfulPollsMu sync.Mutex
+	lastSuccessfulPolls   map[string]time.Time
+
+	// resolvedRefs records the source each catalog was last resolved to, so
+	// that retries of an unpack that resolved the same source do not emit
+	// DigestResolved events again.
+	resolvedRefsMu sync.Mutex
+	resolvedRefs   map[string]string
 }
 
 type storedCatalogData struct {
 	observedGeneration int64
 	unpackResult       source.Result
+	contentDiff        *storage.Diff
+	contentSummary     *storage.ContentSummary
+	filterResult       *filter.Result
+	patchResult        *patch.Result
 }
 
 //+kubebuilder:rbac:groups=olm.operatorframework.io,resources=clustercatalogs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=olm.operatorframework.io,resources=clustercatalogs/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=olm.operatorframework.io,resources=clustercatalogs/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -86,9 +117,13 @@ func (r *ClusterCatalogReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	l.Info("reconcile starting")
 	defer l.Info("reconcile ending")
 
+	ctx, span := tracing.Tracer().Start(ctx, "ClusterCatalogReconciler.Reconcile", trace.WithAttributes(tracing.CatalogKey.String(req.Name)))
+
 	existingCatsrc := catalogdv1.ClusterCatalog{}
 	if err := r.Client.Get(ctx, req.NamespacedName, &existingCatsrc); err != nil {
-		return ctrl.Result{}, client.IgnoreNotFound(err)
+		err = client.IgnoreNotFound(err)
+		tracing.EndSpan(span, err)
+		return ctrl.Result{}, err
 	}
 
 	reconciledCatsrc := existingCatsrc.DeepCopy()
@@ -131,6 +166,7 @@ func (r *ClusterCatalogReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		}
 	}
 
+	tracing.EndSpan(span, reconcileErr)
 	return res, reconcileErr
 }
 
@@ -146,9 +182,33 @@ func (r *ClusterCatalogReconciler) SetupWithManager(mgr ctrl.Manager) error {
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&catalogdv1.ClusterCatalog{}).
+		Watches(&catalogdv1.ClusterCatalog{}, handler.EnqueueRequestsFromMapFunc(r.compositesWithMember)).
 		Complete(r)
 }
 
+// compositesWithMember returns requests for the composite catalogs that have
+// obj as a member, so that they are merged again when its content changes.
+func (r *ClusterCatalogReconciler) compositesWithMember(ctx context.Context, obj client.Object) []reconcile.Request {
+	var catalogs catalogdv1.ClusterCatalogList
+	if err := r.Client.List(ctx, &catalogs); err != nil {
+		log.FromContext(ctx).Error(err, "error listing composite catalogs with member", "member", obj.GetName())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, catalog := range catalogs.Items {
+		if catalog.Spec.Source.Composite == nil {
+			continue
+		}
+		for _, m := range catalog.Spec.Source.Composite.Members {
+			if m.ClusterCatalog != nil && m.ClusterCatalog.Name == obj.GetName() {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: catalog.Name}})
+				break
+			}
+		}
+	}
+	return requests
+}
+
 // Note: This function always returns ctrl.Result{}. The linter
 // fusses about this as we could instead just return error. This was
 // discussed in https://github.com/operator-framework/rukpak/pull/635#discussion_r1229859464
@@ -159,6 +219,7 @@ func (r *ClusterCatalogReconciler) SetupWithManager(mgr ctrl.Manager) error {
 // nolint:unparam
 func (r *ClusterCatalogReconciler) reconcile(ctx context.Context, catalog *catalogdv1.ClusterCatalog) (ctrl.Result, error) {
 	l := log.FromContext(ctx)
+	previousStatus := catalog.Status.DeepCopy()
 	// Check if the catalog availability is set to disabled, if true then
 	// unset base URL, delete it from the cache and set appropriate status
 	if catalog.Spec.AvailabilityMode == catalogdv1.AvailabilityModeUnavailable {
@@ -171,6 +232,7 @@ func (r *ClusterCatalogReconciler) reconcile(ctx context.Context, catalog *catal
 		// Set status.conditions[type=Progressing] to False as we are done with
 		// all that needs to be done with the catalog
 		updateStatusProgressingUserSpecifiedUnavailable(&catalog.Status, catalog.GetGeneration())
+		r.emitAvailabilityModeChanged(catalog, previousStatus)
 
 		// Remove the fbcDeletionFinalizer as we do not want a finalizer attached to the catalog
 		// when it is disabled. Because the finalizer serves no purpose now.
@@ -188,6 +250,7 @@ func (r *ClusterCatalogReconciler) reconcile(ctx context.Context, catalog *catal
 		// On delete: make sure we do nothing after the finalizer is removed
 		return ctrl.Result{}, nil
 	}
+	r.emitAvailabilityModeChanged(catalog, previousStatus)
 
 	// TODO: The below algorithm to get the current state based on an in-memory
 	//    storedCatalogs map is a hack that helps us keep the ClusterCatalog's
@@ -202,6 +265,7 @@ func (r *ClusterCatalogReconciler) reconcile(ctx context.Context, catalog *catal
 	//   - we have a stored catalog, the content exists, but the expected status differs from the actual status
 	//   - we have a stored catalog, the content exists, the status looks correct, but the catalog generation is different from the observed generation in the stored catalog
 	//   - we have a stored catalog, the content exists, the status looks correct and reflects the catalog generation, but it is time to poll again
+	//   - we have a stored composite catalog, and the content of one of its member catalogs has changed since it was merged
 	needsUnpack := false
 	switch {
 	case !hasStoredCatalog:
@@ -219,6 +283,9 @@ func (r *ClusterCatalogReconciler) reconcile(ctx context.Context, catalog *catal
 	case r.needsPoll(storedCatalog.unpackResult.LastSuccessfulPollAttempt.Time, catalog):
 		l.Info("unpack required: poll duration has elapsed")
 		needsUnpack = true
+	case r.membersChanged(storedCatalog):
+		l.Info("unpack required: content of a member catalog has changed")
+		needsUnpack = true
 	}
 
 	if !needsUnpack {
@@ -227,28 +294,95 @@ func (r *ClusterCatalogReconciler) reconcile(ctx context.Context, catalog *catal
 		return nextPollResult(storedCatalog.unpackResult.LastSuccessfulPollAttempt.Time, catalog), nil
 	}
 
+	defer recordUnpackOutcome(&catalog.Status)
+	// The unpacked content must not be evicted from the cache directory
+	// before it is stored.
+	ctx, unpin := source.WithPins(ctx)
+	defer unpin()
+	// Polls are only reported once they resolve a new digest.
+	started := !generationObserved(previousStatus, catalog.GetGeneration())
+	if started {
+		r.eventf(catalog, corev1.EventTypeNormal, EventReasonUnpackStarted, "Unpacking %s", specSourceRef(catalog))
+	}
 	unpackResult, err := r.Unpacker.Unpack(ctx, catalog)
 	if err != nil {
 		unpackErr := fmt.Errorf("source catalog content: %w", err)
 		updateStatusProgressing(&catalog.Status, catalog.GetGeneration(), unpackErr)
+		r.emitFailed(catalog, previousStatus, EventReasonUnpackFailed, unpackErr)
 		return ctrl.Result{}, unpackErr
 	}
+	started = r.emitDigestResolved(catalog, previousStatus, unpackResult.ResolvedSource, started)
 
+	var (
+		contentDiff    *storage.Diff
+		contentSummary *storage.ContentSummary
+		filterResult   *filter.Result
+		patchResult    *patch.Result
+	)
 	switch unpackResult.State {
 	case source.StateUnpacked:
 		// TODO: We should check to see if the unpacked result has the same content
 		//   as the already unpacked content. If it does, we should skip this rest
 		//   of the unpacking steps.
-		err := r.Storage.Store(ctx, catalog.Name, unpackResult.FS)
+		contentFS := unpackResult.FS
+		if len(catalog.Spec.Patches) > 0 {
+			contentFS, patchResult, err = patch.Apply(ctx, contentFS, catalog.Spec.Patches)
+			if err != nil {
+				patchErr := fmt.Errorf("error patching catalog content: %w", err)
+				updateStatusProgressing(&catalog.Status, catalog.GetGeneration(), patchErr)
+				r.emitFailed(catalog, previousStatus, EventReasonPatchFailed, patchErr)
+				return ctrl.Result{}, patchErr
+			}
+		}
+		if catalog.Spec.Filter != nil {
+			contentFS, filterResult, err = filter.Apply(ctx, contentFS, *catalog.Spec.Filter)
+			if err != nil {
+				filterErr := fmt.Errorf("error filtering catalog content: %w", err)
+				updateStatusProgressing(&catalog.Status, catalog.GetGeneration(), filterErr)
+				r.emitFailed(catalog, previousStatus, EventReasonFilterFailed, filterErr)
+				return ctrl.Result{}, filterErr
+			}
+		}
+		storeStart := time.Now()
+		err := r.Storage.Store(ctx, catalog.Name, contentFS)
 		if err != nil {
 			storageErr := fmt.Errorf("error storing fbc: %v", err)
 			updateStatusProgressing(&catalog.Status, catalog.GetGeneration(), storageErr)
+			r.emitFailed(catalog, previousStatus, EventReasonStoreFailed, storageErr)
 			return ctrl.Result{}, storageErr
 		}
+		catalogdmetrics.CatalogOperationDurationMetric.WithLabelValues(catalogdmetrics.OperationStore).Observe(time.Since(storeStart).Seconds())
+		contentDiff, err = r.Storage.ContentDiff(catalog.Name)
+		if err != nil {
+			diffErr := fmt.Errorf("error computing content diff: %v", err)
+			updateStatusProgressing(&catalog.Status, catalog.GetGeneration(), diffErr)
+			r.emitFailed(catalog, previousStatus, EventReasonStoreFailed, diffErr)
+			return ctrl.Result{}, diffErr
+		}
+		contentSummary, err = r.Storage.ContentSummary(catalog.Name)
+		if err != nil {
+			summaryErr := fmt.Errorf("error computing content summary: %v", err)
+			updateStatusProgressing(&catalog.Status, catalog.GetGeneration(), summaryErr)
+			r.emitFailed(catalog, previousStatus, EventReasonStoreFailed, summaryErr)
+			return ctrl.Result{}, summaryErr
+		}
+		if contentSummary != nil {
+			catalogdmetrics.StoredBytesMetric.WithLabelValues(catalog.Name).Set(float64(contentSummary.SizeBytes))
+		}
+		if catalog.Spec.Source.Type != catalogdv1.SourceTypeComposite {
+			// The images of the members of a previous composite source
+			// are not pulled anymore.
+			catalogdmetrics.DeleteMemberMetrics(catalog.Name, nil)
+		}
 		baseURL := r.Storage.BaseURL(catalog.Name)
 
 		updateStatusProgressing(&catalog.Status, catalog.GetGeneration(), nil)
 		updateStatusServing(&catalog.Status, *unpackResult, baseURL, catalog.GetGeneration())
+		updateStatusContent(&catalog.Status, contentSummary)
+		updateStatusContentChange(&catalog.Status, contentDiff)
+		updateStatusFilter(&catalog.Status, filterResult)
+		updateStatusPatch(&catalog.Status, patchResult)
+		r.emitStored(catalog, previousStatus, started, contentSummary)
 	default:
 		panic(fmt.Sprintf("unknown unpack state %q", unpackResult.State))
 	}
@@ -257,8 +391,13 @@ func (r *ClusterCatalogReconciler) reconcile(ctx context.Context, catalog *catal
 	r.storedCatalogs[catalog.Name] = storedCatalogData{
 		unpackResult:       *unpackResult,
 		observedGeneration: catalog.GetGeneration(),
+		contentDiff:        contentDiff,
+		contentSummary:     contentSummary,
+		filterResult:       filterResult,
+		patchResult:        patchResult,
 	}
 	r.storedCatalogsMu.Unlock()
+	r.setLastSuccessfulPoll(catalog.Name, unpackResult.LastSuccessfulPollAttempt.Time)
 	return nextPollResult(unpackResult.LastSuccessfulPollAttempt.Time, catalog), nil
 }
 
@@ -273,6 +412,10 @@ func (r *ClusterCatalogReconciler) getCurrentState(catalog *catalogdv1.ClusterCa
 	clearUnknownConditions(expectedStatus)
 	if hasStoredCatalog && r.Storage.ContentExists(catalog.Name) {
 		updateStatusServing(expectedStatus, storedCatalog.unpackResult, r.Storage.BaseURL(catalog.Name), storedCatalog.observedGeneration)
+		updateStatusContent(expectedStatus, storedCatalog.contentSummary)
+		updateStatusContentChange(expectedStatus, storedCatalog.contentDiff)
+		updateStatusFilter(expectedStatus, storedCatalog.filterResult)
+		updateStatusPatch(expectedStatus, storedCatalog.patchResult)
 		updateStatusProgressing(expectedStatus, storedCatalog.observedGeneration, nil)
 	}
 
@@ -281,13 +424,9 @@ func (r *ClusterCatalogReconciler) getCurrentState(catalog *catalogdv1.ClusterCa
 
 func nextPollResult(lastSuccessfulPoll time.Time, catalog *catalogdv1.ClusterCatalog) ctrl.Result {
 	var requeueAfter time.Duration
-	switch catalog.Spec.Source.Type {
-	case catalogdv1.SourceTypeImage:
-		if catalog.Spec.Source.Image != nil && catalog.Spec.Source.Image.PollIntervalMinutes != nil {
-			pollDuration := time.Duration(*catalog.Spec.Source.Image.PollIntervalMinutes) * time.Minute
-			jitteredDuration := wait.Jitter(pollDuration, requeueJitterMaxFactor)
-			requeueAfter = time.Until(lastSuccessfulPoll.Add(jitteredDuration))
-		}
+	if pollDuration, ok := source.PollInterval(catalog.Spec.Source); ok {
+		jitteredDuration := wait.Jitter(pollDuration, requeueJitterMaxFactor)
+		requeueAfter = time.Until(lastSuccessfulPoll.Add(jitteredDuration))
 	}
 	return ctrl.Result{RequeueAfter: requeueAfter}
 }
@@ -341,6 +480,91 @@ func updateStatusServing(status *catalogdv1.ClusterCatalogStatus, result source.
 	})
 }
 
+func updateStatusContent(status *catalogdv1.ClusterCatalogStatus, summary *storage.ContentSummary) {
+	status.Content = statusContent(summary)
+}
+
+func updateStatusContentChange(status *catalogdv1.ClusterCatalogStatus, diff *storage.Diff) {
+	status.LastContentChange = statusContentChange(diff)
+}
+
+func updateStatusFilter(status *catalogdv1.ClusterCatalogStatus, result *filter.Result) {
+	status.FilterResult = statusFilterResult(result)
+}
+
+func updateStatusPatch(status *catalogdv1.ClusterCatalogStatus, result *patch.Result) {
+	status.PatchResult = statusPatchResult(result)
+}
+
+func statusContent(summary *storage.ContentSummary) *catalogdv1.CatalogContentSummary {
+	if summary == nil {
+		return nil
+	}
+	return &catalogdv1.CatalogContentSummary{
+		Digest:         summary.Digest,
+		SizeBytes:      summary.SizeBytes,
+		Packages:       toInt32(summary.Packages),
+		Channels:       toInt32(summary.Channels),
+		Bundles:        toInt32(summary.Bundles),
+		Deprecations:   toInt32(summary.Deprecations),
+		UnknownSchemas: count(summary.UnknownSchemas),
+	}
+}
+
+func statusContentChange(diff *storage.Diff) *catalogdv1.ContentChangeSummary {
+	if diff == nil {
+		return nil
+	}
+	return &catalogdv1.ContentChangeSummary{
+		PreviousDigest:  diff.From,
+		Digest:          diff.To,
+		AddedPackages:   count(diff.Added.Packages),
+		RemovedPackages: count(diff.Removed.Packages),
+		AddedChannels:   count(diff.Added.Channels),
+		RemovedChannels: count(diff.Removed.Channels),
+		ChangedChannels: count(diff.Changed),
+		AddedBundles:    count(diff.Added.Bundles),
+		RemovedBundles:  count(diff.Removed.Bundles),
+	}
+}
+
+func statusFilterResult(result *filter.Result) *catalogdv1.CatalogFilterResult {
+	if result == nil {
+		return nil
+	}
+	return &catalogdv1.CatalogFilterResult{
+		RemovedPackages: toInt32(result.RemovedPackages),
+		RemovedChannels: toInt32(result.RemovedChannels),
+		RemovedBundles:  toInt32(result.RemovedBundles),
+		MissingPackages: result.MissingPackages,
+	}
+}
+
+func statusPatchResult(result *patch.Result) *catalogdv1.CatalogPatchResult {
+	if result == nil {
+		return nil
+	}
+	var unmatched []int32
+	for _, i := range result.UnmatchedPatches {
+		unmatched = append(unmatched, toInt32(i))
+	}
+	return &catalogdv1.CatalogPatchResult{
+		Digest:           result.Digest,
+		PatchedObjects:   toInt32(result.PatchedObjects),
+		UnmatchedPatches: unmatched,
+	}
+}
+
+// count returns the length of s as an int32, for use in status fields.
+func count[T any](s []T) int32 {
+	return toInt32(len(s))
+}
+
+// toInt32 converts a non-negative count to an int32, for use in status fields.
+func toInt32(n int) int32 {
+	return int32(min(n, math.MaxInt32)) //nolint:gosec // bounded by math.MaxInt32
+}
+
 func updateStatusProgressingUserSpecifiedUnavailable(status *catalogdv1.ClusterCatalogStatus, generation int64) {
 	// Set Progressing condition to True with reason Succeeded
 	// since we have successfully progressed to the unavailable
@@ -373,6 +597,10 @@ func updateStatusNotServing(status *catalogdv1.ClusterCatalogStatus, generation
 	status.ResolvedSource = nil
 	status.URLs = nil
 	status.LastUnpacked = nil
+	status.Content = nil
+	status.LastContentChange = nil
+	status.FilterResult = nil
+	status.PatchResult = nil
 	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
 		Type:               catalogdv1.TypeServing,
 		Status:             metav1.ConditionFalse,
@@ -383,15 +611,36 @@ func updateStatusNotServing(status *catalogdv1.ClusterCatalogStatus, generation
 
 func (r *ClusterCatalogReconciler) needsPoll(lastSuccessfulPoll time.Time, catalog *catalogdv1.ClusterCatalog) bool {
 	// If polling is disabled, we don't need to poll.
-	if catalog.Spec.Source.Image.PollIntervalMinutes == nil {
+	interval, ok := source.PollInterval(catalog.Spec.Source)
+	if !ok {
 		return false
 	}
 
 	// Only poll if the next poll time is in the past.
-	nextPoll := lastSuccessfulPoll.Add(time.Duration(*catalog.Spec.Source.Image.PollIntervalMinutes) * time.Minute)
+	nextPoll := lastSuccessfulPoll.Add(interval)
 	return nextPoll.Before(time.Now())
 }
 
+// membersChanged returns true if the content served for any of the
+// ClusterCatalog members of a composite catalog differs from the content that
+// was merged into it.
+func (r *ClusterCatalogReconciler) membersChanged(storedCatalog storedCatalogData) bool {
+	resolved := storedCatalog.unpackResult.ResolvedSource
+	if resolved == nil || resolved.Composite == nil {
+		return false
+	}
+	for _, m := range resolved.Composite.Members {
+		if m.ClusterCatalog == nil {
+			continue
+		}
+		summary, err := r.Storage.ContentSummary(m.ClusterCatalog.Name)
+		if err != nil || summary == nil || summary.Digest != m.ClusterCatalog.ContentDigest {
+			return true
+		}
+	}
+	return false
+}
+
 // Compare resources - ignoring status & metadata.finalizers
 func checkForUnexpectedFieldChange(a, b catalogdv1.ClusterCatalog) bool {
 	a.Status, b.Status = catalogdv1.ClusterCatalogStatus{}, catalogdv1.ClusterCatalogStatus{}
@@ -439,5 +688,58 @@ func (r *ClusterCatalogReconciler) deleteCatalogCache(ctx context.Context, catal
 		return err
 	}
 	r.deleteStoredCatalog(catalog.Name)
+	r.deleteLastSuccessfulPoll(catalog.Name)
+	r.deleteResolvedRef(catalog.Name)
+	catalogdmetrics.DeleteCatalogMetrics(catalog.Name)
 	return nil
 }
+
+func (r *ClusterCatalogReconciler) setLastSuccessfulPoll(catalogName string, t time.Time) {
+	r.lastSuccessfulPollsMu.Lock()
+	defer r.lastSuccessfulPollsMu.Unlock()
+	if r.lastSuccessfulPolls == nil {
+		r.lastSuccessfulPolls = map[string]time.Time{}
+	}
+	r.lastSuccessfulPolls[catalogName] = t
+}
+
+func (r *ClusterCatalogReconciler) deleteLastSuccessfulPoll(catalogName string) {
+	r.lastSuccessfulPollsMu.Lock()
+	defer r.lastSuccessfulPollsMu.Unlock()
+	delete(r.lastSuccessfulPolls, catalogName)
+}
+
+// swapResolvedRef records ref as the source catalogName was last resolved
+// to, and returns the one it was resolved to before, if any.
+func (r *ClusterCatalogReconciler) swapResolvedRef(catalogName, ref string) (string, bool) {
+	r.resolvedRefsMu.Lock()
+	defer r.resolvedRefsMu.Unlock()
+	if r.resolvedRefs == nil {
+		r.resolvedRefs = map[string]string{}
+	}
+	last, ok := r.resolvedRefs[catalogName]
+	r.resolvedRefs[catalogName] = ref
+	return last, ok
+}
+
+func (r *ClusterCatalogReconciler) deleteResolvedRef(catalogName string) {
+	r.resolvedRefsMu.Lock()
+	defer r.resolvedRefsMu.Unlock()
+	delete(r.resolvedRefs, catalogName)
+}
+
+// LastSuccessfulPolls returns the time each catalog being served was last
+// unpacked and stored successfully.
+func (r *ClusterCatalogReconciler) LastSuccessfulPolls() map[string]time.Time {
+	r.lastSuccessfulPollsMu.Lock()
+	defer r.lastSuccessfulPollsMu.Unlock()
+	return maps.Clone(r.lastSuccessfulPolls)
+}
+
+// recordUnpackOutcome counts an attempt to unpack and store a catalog by the
+// reason of the Progressing condition it resulted in.
+func recordUnpackOutcome(status *catalogdv1.ClusterCatalogStatus) {
+	if cond := meta.FindStatusCondition(status.Conditions, catalogdv1.TypeProgressing); cond != nil {
+		catalogdmetrics.UnpackOutcomeMetric.WithLabelValues(cond.Reason).Inc()
+	}
+}
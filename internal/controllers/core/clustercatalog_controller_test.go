@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"net/http"
 	"testing"
@@ -12,17 +13,29 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+	catalogdmetrics "github.com/operator-framework/catalogd/internal/metrics"
 	"github.com/operator-framework/catalogd/internal/source"
 	"github.com/operator-framework/catalogd/internal/storage"
+	"github.com/operator-framework/catalogd/internal/tracing"
 )
 
 var _ source.Unpacker = &MockSource{}
@@ -54,7 +67,9 @@ func (ms *MockSource) Cleanup(_ context.Context, _ *catalogdv1.ClusterCatalog) e
 var _ storage.Instance = &MockStore{}
 
 type MockStore struct {
-	shouldError bool
+	shouldError    bool
+	contentDiff    *storage.Diff
+	contentSummary *storage.ContentSummary
 }
 
 func (m MockStore) Store(_ context.Context, _ string, _ fs.FS) error {
@@ -75,6 +90,18 @@ func (m MockStore) BaseURL(_ string) string {
 	return "URL"
 }
 
+func (m MockStore) ContentDiff(_ string) (*storage.Diff, error) {
+	return m.contentDiff, nil
+}
+
+func (m MockStore) ContentSummary(_ string) (*storage.ContentSummary, error) {
+	return m.contentSummary, nil
+}
+
+func (m MockStore) ContentReader(_ string) (io.ReadCloser, string, error) {
+	return nil, "", fs.ErrNotExist
+}
+
 func (m MockStore) StorageServerHandler() http.Handler {
 	panic("not needed")
 }
@@ -284,6 +311,366 @@ func TestCatalogdControllerReconcile(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "valid source type, unpack state == Unpacked, content changed, content and change summaries reflected in status",
+			source: &MockSource{
+				result: &source.Result{
+					State: source.StateUnpacked,
+					FS:    &fstest.MapFS{},
+					ResolvedSource: &catalogdv1.ResolvedCatalogSource{
+						Image: &catalogdv1.ResolvedImageSource{
+							Ref: "my.org/someimage@someSHA256Digest",
+						},
+					},
+				},
+			},
+			store: &MockStore{
+				contentSummary: &storage.ContentSummary{
+					Digest:         "sha256:current",
+					SizeBytes:      4096,
+					Packages:       2,
+					Channels:       3,
+					Bundles:        5,
+					Deprecations:   1,
+					UnknownSchemas: []string{"example.com.custom"},
+				},
+				contentDiff: &storage.Diff{
+					From: "sha256:previous",
+					To:   "sha256:current",
+					Added: storage.ContentSet{
+						Packages: []string{"bar"},
+						Channels: []storage.ChannelRef{{Package: "bar", Name: "stable"}},
+						Bundles:  []storage.BundleRef{{Package: "bar", Name: "bar.v1.0.0"}, {Package: "foo", Name: "foo.v1.1.0"}},
+					},
+					Removed: storage.ContentSet{
+						Packages: []string{"baz"},
+						Bundles:  []storage.BundleRef{{Package: "baz", Name: "baz.v1.0.0"}},
+					},
+					Changed: []storage.ChannelChange{
+						{ChannelRef: storage.ChannelRef{Package: "foo", Name: "stable"}, AddedEntries: []string{"foo.v1.1.0"}},
+					},
+				},
+			},
+			catalog: &catalogdv1.ClusterCatalog{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "catalog",
+					Finalizers: []string{fbcDeletionFinalizer},
+				},
+				Spec: catalogdv1.ClusterCatalogSpec{
+					Source: catalogdv1.CatalogSource{
+						Type: catalogdv1.SourceTypeImage,
+						Image: &catalogdv1.ImageSource{
+							Ref: "my.org/someimage:latest",
+						},
+					},
+				},
+			},
+			expectedCatalog: &catalogdv1.ClusterCatalog{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "catalog",
+					Finalizers: []string{fbcDeletionFinalizer},
+				},
+				Spec: catalogdv1.ClusterCatalogSpec{
+					Source: catalogdv1.CatalogSource{
+						Type: catalogdv1.SourceTypeImage,
+						Image: &catalogdv1.ImageSource{
+							Ref: "my.org/someimage:latest",
+						},
+					},
+				},
+				Status: catalogdv1.ClusterCatalogStatus{
+					URLs: &catalogdv1.ClusterCatalogURLs{Base: "URL"},
+					Conditions: []metav1.Condition{
+						{
+							Type:   catalogdv1.TypeServing,
+							Status: metav1.ConditionTrue,
+							Reason: catalogdv1.ReasonAvailable,
+						},
+						{
+							Type:   catalogdv1.TypeProgressing,
+							Status: metav1.ConditionTrue,
+							Reason: catalogdv1.ReasonSucceeded,
+						},
+					},
+					ResolvedSource: &catalogdv1.ResolvedCatalogSource{
+						Image: &catalogdv1.ResolvedImageSource{
+							Ref: "my.org/someimage@someSHA256Digest",
+						},
+					},
+					LastUnpacked: &metav1.Time{},
+					Content: &catalogdv1.CatalogContentSummary{
+						Digest:         "sha256:current",
+						SizeBytes:      4096,
+						Packages:       2,
+						Channels:       3,
+						Bundles:        5,
+						Deprecations:   1,
+						UnknownSchemas: 1,
+					},
+					LastContentChange: &catalogdv1.ContentChangeSummary{
+						PreviousDigest:  "sha256:previous",
+						Digest:          "sha256:current",
+						AddedPackages:   1,
+						RemovedPackages: 1,
+						AddedChannels:   1,
+						ChangedChannels: 1,
+						AddedBundles:    2,
+						RemovedBundles:  1,
+					},
+				},
+			},
+		},
+		{
+			name: "valid source type, unpack state == Unpacked, filter set, filter result reflected in status",
+			source: &MockSource{
+				result: &source.Result{
+					State: source.StateUnpacked,
+					FS:    &fstest.MapFS{},
+					ResolvedSource: &catalogdv1.ResolvedCatalogSource{
+						Image: &catalogdv1.ResolvedImageSource{
+							Ref: "my.org/someimage@someSHA256Digest",
+						},
+					},
+				},
+			},
+			store: &MockStore{},
+			catalog: &catalogdv1.ClusterCatalog{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "catalog",
+					Finalizers: []string{fbcDeletionFinalizer},
+				},
+				Spec: catalogdv1.ClusterCatalogSpec{
+					Source: catalogdv1.CatalogSource{
+						Type: catalogdv1.SourceTypeImage,
+						Image: &catalogdv1.ImageSource{
+							Ref: "my.org/someimage:latest",
+						},
+					},
+					Filter: &catalogdv1.CatalogFilter{IncludePackages: []string{"foo"}},
+				},
+			},
+			expectedCatalog: &catalogdv1.ClusterCatalog{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "catalog",
+					Finalizers: []string{fbcDeletionFinalizer},
+				},
+				Spec: catalogdv1.ClusterCatalogSpec{
+					Source: catalogdv1.CatalogSource{
+						Type: catalogdv1.SourceTypeImage,
+						Image: &catalogdv1.ImageSource{
+							Ref: "my.org/someimage:latest",
+						},
+					},
+					Filter: &catalogdv1.CatalogFilter{IncludePackages: []string{"foo"}},
+				},
+				Status: catalogdv1.ClusterCatalogStatus{
+					URLs: &catalogdv1.ClusterCatalogURLs{Base: "URL"},
+					Conditions: []metav1.Condition{
+						{
+							Type:   catalogdv1.TypeServing,
+							Status: metav1.ConditionTrue,
+							Reason: catalogdv1.ReasonAvailable,
+						},
+						{
+							Type:   catalogdv1.TypeProgressing,
+							Status: metav1.ConditionTrue,
+							Reason: catalogdv1.ReasonSucceeded,
+						},
+					},
+					ResolvedSource: &catalogdv1.ResolvedCatalogSource{
+						Image: &catalogdv1.ResolvedImageSource{
+							Ref: "my.org/someimage@someSHA256Digest",
+						},
+					},
+					LastUnpacked: &metav1.Time{},
+					FilterResult: &catalogdv1.CatalogFilterResult{
+						MissingPackages: []string{"foo"},
+					},
+				},
+			},
+		},
+		{
+			name:          "valid source type, unpack state == Unpacked, invalid filter, status updated to reflect terminal error state(Blocked) and error is returned",
+			expectedError: errors.New(`error filtering catalog content: terminal error: invalid filter: package "foo": invalid minVersion "latest": No Major.Minor.Patch elements found`),
+			source: &MockSource{
+				result: &source.Result{
+					State: source.StateUnpacked,
+					FS:    &fstest.MapFS{},
+				},
+			},
+			store: &MockStore{},
+			catalog: &catalogdv1.ClusterCatalog{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "catalog",
+					Finalizers: []string{fbcDeletionFinalizer},
+				},
+				Spec: catalogdv1.ClusterCatalogSpec{
+					Source: catalogdv1.CatalogSource{
+						Type: catalogdv1.SourceTypeImage,
+						Image: &catalogdv1.ImageSource{
+							Ref: "my.org/someimage:latest",
+						},
+					},
+					Filter: &catalogdv1.CatalogFilter{Packages: []catalogdv1.PackageFilter{{Name: "foo", MinVersion: "latest"}}},
+				},
+			},
+			expectedCatalog: &catalogdv1.ClusterCatalog{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "catalog",
+					Finalizers: []string{fbcDeletionFinalizer},
+				},
+				Spec: catalogdv1.ClusterCatalogSpec{
+					Source: catalogdv1.CatalogSource{
+						Type: catalogdv1.SourceTypeImage,
+						Image: &catalogdv1.ImageSource{
+							Ref: "my.org/someimage:latest",
+						},
+					},
+					Filter: &catalogdv1.CatalogFilter{Packages: []catalogdv1.PackageFilter{{Name: "foo", MinVersion: "latest"}}},
+				},
+				Status: catalogdv1.ClusterCatalogStatus{
+					Conditions: []metav1.Condition{
+						{
+							Type:   catalogdv1.TypeProgressing,
+							Status: metav1.ConditionFalse,
+							Reason: catalogdv1.ReasonBlocked,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "valid source type, unpack state == Unpacked, patches set, patch result reflected in status",
+			source: &MockSource{
+				result: &source.Result{
+					State: source.StateUnpacked,
+					FS:    &fstest.MapFS{},
+					ResolvedSource: &catalogdv1.ResolvedCatalogSource{
+						Image: &catalogdv1.ResolvedImageSource{
+							Ref: "my.org/someimage@someSHA256Digest",
+						},
+					},
+				},
+			},
+			store: &MockStore{},
+			catalog: &catalogdv1.ClusterCatalog{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "catalog",
+					Finalizers: []string{fbcDeletionFinalizer},
+				},
+				Spec: catalogdv1.ClusterCatalogSpec{
+					Source: catalogdv1.CatalogSource{
+						Type: catalogdv1.SourceTypeImage,
+						Image: &catalogdv1.ImageSource{
+							Ref: "my.org/someimage:latest",
+						},
+					},
+					Patches: []catalogdv1.CatalogPatch{{
+						Type:   catalogdv1.PatchTypeRemove,
+						Target: &catalogdv1.PatchTarget{Schema: "olm.channel", Package: "foo"},
+					}},
+				},
+			},
+			expectedCatalog: &catalogdv1.ClusterCatalog{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "catalog",
+					Finalizers: []string{fbcDeletionFinalizer},
+				},
+				Spec: catalogdv1.ClusterCatalogSpec{
+					Source: catalogdv1.CatalogSource{
+						Type: catalogdv1.SourceTypeImage,
+						Image: &catalogdv1.ImageSource{
+							Ref: "my.org/someimage:latest",
+						},
+					},
+					Patches: []catalogdv1.CatalogPatch{{
+						Type:   catalogdv1.PatchTypeRemove,
+						Target: &catalogdv1.PatchTarget{Schema: "olm.channel", Package: "foo"},
+					}},
+				},
+				Status: catalogdv1.ClusterCatalogStatus{
+					URLs: &catalogdv1.ClusterCatalogURLs{Base: "URL"},
+					Conditions: []metav1.Condition{
+						{
+							Type:   catalogdv1.TypeServing,
+							Status: metav1.ConditionTrue,
+							Reason: catalogdv1.ReasonAvailable,
+						},
+						{
+							Type:   catalogdv1.TypeProgressing,
+							Status: metav1.ConditionTrue,
+							Reason: catalogdv1.ReasonSucceeded,
+						},
+					},
+					ResolvedSource: &catalogdv1.ResolvedCatalogSource{
+						Image: &catalogdv1.ResolvedImageSource{
+							Ref: "my.org/someimage@someSHA256Digest",
+						},
+					},
+					LastUnpacked: &metav1.Time{},
+					PatchResult: &catalogdv1.CatalogPatchResult{
+						Digest:           "sha256:3a37dad0a36a7e4e1f98d000b0f10291b4b19959baa0ffea8c530b17b284034e",
+						UnmatchedPatches: []int32{0},
+					},
+				},
+			},
+		},
+		{
+			name:          "valid source type, unpack state == Unpacked, malformed patch, status updated to reflect terminal error state(Blocked) and error is returned",
+			expectedError: errors.New(`error patching catalog content: terminal error: invalid patch 0: object has no schema`),
+			source: &MockSource{
+				result: &source.Result{
+					State: source.StateUnpacked,
+					FS:    &fstest.MapFS{},
+				},
+			},
+			store: &MockStore{},
+			catalog: &catalogdv1.ClusterCatalog{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "catalog",
+					Finalizers: []string{fbcDeletionFinalizer},
+				},
+				Spec: catalogdv1.ClusterCatalogSpec{
+					Source: catalogdv1.CatalogSource{
+						Type: catalogdv1.SourceTypeImage,
+						Image: &catalogdv1.ImageSource{
+							Ref: "my.org/someimage:latest",
+						},
+					},
+					Patches: []catalogdv1.CatalogPatch{{
+						Type:   catalogdv1.PatchTypeAdd,
+						Object: &apiextensionsv1.JSON{Raw: []byte(`{"name":"foo"}`)},
+					}},
+				},
+			},
+			expectedCatalog: &catalogdv1.ClusterCatalog{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "catalog",
+					Finalizers: []string{fbcDeletionFinalizer},
+				},
+				Spec: catalogdv1.ClusterCatalogSpec{
+					Source: catalogdv1.CatalogSource{
+						Type: catalogdv1.SourceTypeImage,
+						Image: &catalogdv1.ImageSource{
+							Ref: "my.org/someimage:latest",
+						},
+					},
+					Patches: []catalogdv1.CatalogPatch{{
+						Type:   catalogdv1.PatchTypeAdd,
+						Object: &apiextensionsv1.JSON{Raw: []byte(`{"name":"foo"}`)},
+					}},
+				},
+				Status: catalogdv1.ClusterCatalogStatus{
+					Conditions: []metav1.Condition{
+						{
+							Type:   catalogdv1.TypeProgressing,
+							Status: metav1.ConditionFalse,
+							Reason: catalogdv1.ReasonBlocked,
+						},
+					},
+				},
+			},
+		},
 		{
 			name:          "valid source type, unpack state == Unpacked, storage fails, failure reflected in status and error returned",
 			expectedError: fmt.Errorf("error storing fbc: mockstore store error"),
@@ -814,6 +1201,28 @@ func TestPollingRequeue(t *testing.T) {
 			expectedRequeueAfter: time.Minute * 5,
 			lastPollTime:         metav1.Now(),
 		},
+		"ClusterCatalog with composite source, requeueAfter set to wait.jitter(shortest pollInterval of its image members)": {
+			catalog: &catalogdv1.ClusterCatalog{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "test-catalog",
+					Finalizers: []string{fbcDeletionFinalizer},
+				},
+				Spec: catalogdv1.ClusterCatalogSpec{
+					Source: catalogdv1.CatalogSource{
+						Type: catalogdv1.SourceTypeComposite,
+						Composite: &catalogdv1.CompositeSource{
+							Members: []catalogdv1.CompositeMember{
+								{Type: catalogdv1.CompositeMemberTypeImage, Image: &catalogdv1.ImageSource{Ref: "my.org/someimage:latest", PollIntervalMinutes: ptr.To(10)}},
+								{Type: catalogdv1.CompositeMemberTypeClusterCatalog, ClusterCatalog: &catalogdv1.ClusterCatalogReference{Name: "other"}},
+								{Type: catalogdv1.CompositeMemberTypeImage, Image: &catalogdv1.ImageSource{Ref: "my.org/otherimage:latest", PollIntervalMinutes: ptr.To(3)}},
+							},
+						},
+					},
+				},
+			},
+			expectedRequeueAfter: time.Minute * 3,
+			lastPollTime:         metav1.Now(),
+		},
 	} {
 		t.Run(name, func(t *testing.T) {
 			reconciler := &ClusterCatalogReconciler{
@@ -887,9 +1296,40 @@ func TestPollingReconcilerUnpack(t *testing.T) {
 		}
 	}
 
+	compositeSpec := catalogdv1.ClusterCatalogSpec{
+		Source: catalogdv1.CatalogSource{
+			Type: catalogdv1.SourceTypeComposite,
+			Composite: &catalogdv1.CompositeSource{
+				Members: []catalogdv1.CompositeMember{
+					{Type: catalogdv1.CompositeMemberTypeClusterCatalog, ClusterCatalog: &catalogdv1.ClusterCatalogReference{Name: "member"}},
+				},
+			},
+		},
+	}
+	compositeResolvedSource := func(status *catalogdv1.ClusterCatalogStatus) {
+		status.ResolvedSource = &catalogdv1.ResolvedCatalogSource{
+			Type: catalogdv1.SourceTypeComposite,
+			Composite: &catalogdv1.ResolvedCompositeSource{
+				Members: []catalogdv1.ResolvedCompositeMember{
+					{Type: catalogdv1.CompositeMemberTypeClusterCatalog, ClusterCatalog: &catalogdv1.ResolvedClusterCatalogSource{Name: "member", ContentDigest: "sha256:" + oldDigest}},
+				},
+			},
+		}
+	}
+	compositeStoredCatalogData := map[string]storedCatalogData{
+		"test-catalog": {
+			observedGeneration: successfulObservedGeneration,
+			unpackResult: source.Result{
+				ResolvedSource:            successfulUnpackStatus(compositeResolvedSource).ResolvedSource,
+				LastSuccessfulPollAttempt: metav1.Now(),
+			},
+		},
+	}
+
 	for name, tc := range map[string]struct {
 		catalog           *catalogdv1.ClusterCatalog
 		storedCatalogData map[string]storedCatalogData
+		store             *MockStore
 		expectedUnpackRun bool
 	}{
 		"ClusterCatalog being resolved the first time, unpack should run": {
@@ -1036,16 +1476,48 @@ func TestPollingReconcilerUnpack(t *testing.T) {
 			storedCatalogData: successfulStoredCatalogData(metav1.Now()),
 			expectedUnpackRun: true,
 		},
+		"ClusterCatalog with composite source not being resolved the first time, content of member catalog unchanged, unpack should not run": {
+			catalog: &catalogdv1.ClusterCatalog{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "test-catalog",
+					Finalizers: []string{fbcDeletionFinalizer},
+					Generation: 2,
+				},
+				Spec:   compositeSpec,
+				Status: successfulUnpackStatus(compositeResolvedSource),
+			},
+			storedCatalogData: compositeStoredCatalogData,
+			store:             &MockStore{contentSummary: &storage.ContentSummary{Digest: "sha256:" + oldDigest}},
+			expectedUnpackRun: false,
+		},
+		"ClusterCatalog with composite source not being resolved the first time, content of member catalog changed, unpack should run": {
+			catalog: &catalogdv1.ClusterCatalog{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "test-catalog",
+					Finalizers: []string{fbcDeletionFinalizer},
+					Generation: 2,
+				},
+				Spec:   compositeSpec,
+				Status: successfulUnpackStatus(compositeResolvedSource),
+			},
+			storedCatalogData: compositeStoredCatalogData,
+			store:             &MockStore{contentSummary: &storage.ContentSummary{Digest: "sha256:" + newDigest}},
+			expectedUnpackRun: true,
+		},
 	} {
 		t.Run(name, func(t *testing.T) {
 			scd := tc.storedCatalogData
 			if scd == nil {
 				scd = map[string]storedCatalogData{}
 			}
+			store := tc.store
+			if store == nil {
+				store = &MockStore{}
+			}
 			reconciler := &ClusterCatalogReconciler{
 				Client:         nil,
 				Unpacker:       &MockSource{unpackError: errors.New("mocksource error")},
-				Storage:        &MockStore{},
+				Storage:        store,
 				storedCatalogs: scd,
 			}
 			require.NoError(t, reconciler.setupFinalizers())
@@ -1058,3 +1530,147 @@ func TestPollingReconcilerUnpack(t *testing.T) {
 		})
 	}
 }
+
+func TestUnpackMetrics(t *testing.T) {
+	catalog := &catalogdv1.ClusterCatalog{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "metrics-catalog",
+			Finalizers: []string{fbcDeletionFinalizer},
+		},
+		Spec: catalogdv1.ClusterCatalogSpec{
+			Source: catalogdv1.CatalogSource{
+				Type: catalogdv1.SourceTypeImage,
+				Image: &catalogdv1.ImageSource{
+					Ref: "my.org/someimage:latest",
+				},
+			},
+		},
+	}
+	lastPoll := metav1.NewTime(time.Now().Add(-time.Minute).Truncate(time.Second))
+	mockSource := &MockSource{result: &source.Result{
+		State: source.StateUnpacked,
+		FS:    &fstest.MapFS{},
+		ResolvedSource: &catalogdv1.ResolvedCatalogSource{
+			Image: &catalogdv1.ResolvedImageSource{
+				Ref: "my.org/someimage@someSHA256Digest",
+			},
+		},
+		LastSuccessfulPollAttempt: lastPoll,
+	}}
+	reconciler := &ClusterCatalogReconciler{
+		Unpacker:       mockSource,
+		Storage:        &MockStore{contentSummary: &storage.ContentSummary{SizeBytes: 4096}},
+		storedCatalogs: map[string]storedCatalogData{},
+	}
+	require.NoError(t, reconciler.setupFinalizers())
+	succeeded := testutil.ToFloat64(catalogdmetrics.UnpackOutcomeMetric.WithLabelValues(catalogdv1.ReasonSucceeded))
+	retrying := testutil.ToFloat64(catalogdmetrics.UnpackOutcomeMetric.WithLabelValues(catalogdv1.ReasonRetrying))
+
+	_, err := reconciler.reconcile(context.Background(), catalog)
+	require.NoError(t, err)
+	assert.InDelta(t, succeeded+1, testutil.ToFloat64(catalogdmetrics.UnpackOutcomeMetric.WithLabelValues(catalogdv1.ReasonSucceeded)), 0)
+	assert.InDelta(t, 4096, testutil.ToFloat64(catalogdmetrics.StoredBytesMetric.WithLabelValues(catalog.Name)), 0)
+	assert.Equal(t, map[string]time.Time{catalog.Name: lastPoll.Time}, reconciler.LastSuccessfulPolls())
+
+	// A failed poll is counted, but does not reset the time of the last
+	// successful one.
+	mockSource.unpackError = errors.New("mocksource error")
+	catalog.Generation++
+	_, err = reconciler.reconcile(context.Background(), catalog)
+	require.Error(t, err)
+	assert.InDelta(t, retrying+1, testutil.ToFloat64(catalogdmetrics.UnpackOutcomeMetric.WithLabelValues(catalogdv1.ReasonRetrying)), 0)
+	assert.Equal(t, map[string]time.Time{catalog.Name: lastPoll.Time}, reconciler.LastSuccessfulPolls())
+
+	collector := catalogdmetrics.NewLastSuccessfulPollCollector(reconciler.LastSuccessfulPolls)
+	assert.Equal(t, 1, testutil.CollectAndCount(collector, catalogdmetrics.SecondsSinceLastPollMetricName))
+	assert.GreaterOrEqual(t, testutil.ToFloat64(collector), time.Minute.Seconds())
+
+	require.NoError(t, reconciler.deleteCatalogCache(context.Background(), catalog))
+	assert.Empty(t, reconciler.LastSuccessfulPolls())
+	assert.Equal(t, 0, testutil.CollectAndCount(catalogdmetrics.StoredBytesMetric, catalogdmetrics.StoredBytesMetricName))
+}
+
+func TestReconcileTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, catalogdv1.AddToScheme(scheme))
+	catalog := &catalogdv1.ClusterCatalog{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "traced-catalog",
+			Finalizers: []string{fbcDeletionFinalizer},
+		},
+		Spec: catalogdv1.ClusterCatalogSpec{
+			Source: catalogdv1.CatalogSource{
+				Type: catalogdv1.SourceTypeImage,
+				Image: &catalogdv1.ImageSource{
+					Ref: "my.org/someimage:latest",
+				},
+			},
+		},
+	}
+	reconciler := &ClusterCatalogReconciler{
+		Client:         fake.NewClientBuilder().WithScheme(scheme).WithObjects(catalog).WithStatusSubresource(catalog).Build(),
+		Unpacker:       &MockSource{unpackError: errors.New("mocksource error")},
+		Storage:        &MockStore{},
+		storedCatalogs: map[string]storedCatalogData{},
+	}
+	require.NoError(t, reconciler.setupFinalizers())
+
+	_, err := reconciler.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: catalog.Name}})
+	require.Error(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "ClusterCatalogReconciler.Reconcile", spans[0].Name())
+	assert.Contains(t, spans[0].Attributes(), tracing.CatalogKey.String(catalog.Name))
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+}
+
+func TestCompositesWithMember(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, catalogdv1.AddToScheme(scheme))
+	composite := func(name string, members ...string) *catalogdv1.ClusterCatalog {
+		catalog := &catalogdv1.ClusterCatalog{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: catalogdv1.ClusterCatalogSpec{
+				Source: catalogdv1.CatalogSource{
+					Type:      catalogdv1.SourceTypeComposite,
+					Composite: &catalogdv1.CompositeSource{},
+				},
+			},
+		}
+		for _, m := range members {
+			catalog.Spec.Source.Composite.Members = append(catalog.Spec.Source.Composite.Members, catalogdv1.CompositeMember{
+				Type:           catalogdv1.CompositeMemberTypeClusterCatalog,
+				ClusterCatalog: &catalogdv1.ClusterCatalogReference{Name: m},
+			})
+		}
+		return catalog
+	}
+	vendor := &catalogdv1.ClusterCatalog{
+		ObjectMeta: metav1.ObjectMeta{Name: "vendor"},
+		Spec: catalogdv1.ClusterCatalogSpec{
+			Source: catalogdv1.CatalogSource{
+				Type:  catalogdv1.SourceTypeImage,
+				Image: &catalogdv1.ImageSource{Ref: "my.org/someimage:latest"},
+			},
+		},
+	}
+	reconciler := &ClusterCatalogReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			vendor,
+			composite("overlay", "vendor", "other"),
+			composite("unrelated", "other"),
+			composite("platform", "overlay", "vendor"),
+		).Build(),
+	}
+
+	requests := reconciler.compositesWithMember(context.Background(), vendor)
+	assert.ElementsMatch(t, []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Name: "overlay"}},
+		{NamespacedName: types.NamespacedName{Name: "platform"}},
+	}, requests)
+}
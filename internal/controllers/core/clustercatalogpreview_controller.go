@@ -0,0 +1,260 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+
+	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+	"github.com/operator-framework/catalogd/internal/filter"
+	"github.com/operator-framework/catalogd/internal/fsutil"
+	"github.com/operator-framework/catalogd/internal/patch"
+	"github.com/operator-framework/catalogd/internal/source"
+	"github.com/operator-framework/catalogd/internal/storage"
+	"github.com/operator-framework/catalogd/internal/tracing"
+)
+
+// ClusterCatalogPreviewReconciler reconciles a ClusterCatalogPreview object.
+//
+// The contents of each generation of a ClusterCatalogPreview are unpacked,
+// patched, filtered, validated and stored once, and removed as soon as they
+// have been summarized in its status.
+type ClusterCatalogPreviewReconciler struct {
+	client.Client
+	// Unpacker unpacks the previewed contents. It must unpack them in a
+	// location of its own, so that previews never replace the contents
+	// unpacked for a ClusterCatalog of the same name.
+	Unpacker source.Unpacker
+	// Storage stores the previewed contents while they are summarized. It
+	// must not be the storage the catalog server serves contents from.
+	Storage storage.Instance
+	// Catalogs reads the contents served for the ClusterCatalogs that
+	// previews are compared with.
+	Catalogs source.CatalogContentReader
+}
+
+//+kubebuilder:rbac:groups=olm.operatorframework.io,resources=clustercatalogpreviews,verbs=get;list;watch
+//+kubebuilder:rbac:groups=olm.operatorframework.io,resources=clustercatalogpreviews/status,verbs=get;update;patch
+
+func (r *ClusterCatalogPreviewReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	l := log.FromContext(ctx).WithName("catalogd-preview-controller")
+	ctx = log.IntoContext(ctx, l)
+
+	l.Info("reconcile starting")
+	defer l.Info("reconcile ending")
+
+	ctx, span := tracing.Tracer().Start(ctx, "ClusterCatalogPreviewReconciler.Reconcile", trace.WithAttributes(tracing.CatalogKey.String(req.Name)))
+
+	existingPreview := catalogdv1.ClusterCatalogPreview{}
+	if err := r.Client.Get(ctx, req.NamespacedName, &existingPreview); err != nil {
+		err = client.IgnoreNotFound(err)
+		tracing.EndSpan(span, err)
+		return ctrl.Result{}, err
+	}
+
+	reconciledPreview := existingPreview.DeepCopy()
+	reconcileErr := r.reconcile(ctx, reconciledPreview)
+
+	if !equality.Semantic.DeepEqual(existingPreview.Status, reconciledPreview.Status) {
+		if err := r.Client.Status().Update(ctx, reconciledPreview); err != nil {
+			reconcileErr = errors.Join(reconcileErr, fmt.Errorf("error updating status: %v", err))
+		}
+	}
+
+	tracing.EndSpan(span, reconcileErr)
+	return ctrl.Result{}, reconcileErr
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ClusterCatalogPreviewReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&catalogdv1.ClusterCatalogPreview{}).
+		Complete(r)
+}
+
+func (r *ClusterCatalogPreviewReconciler) reconcile(ctx context.Context, preview *catalogdv1.ClusterCatalogPreview) error {
+	// A generation is previewed again only until the preview succeeds or
+	// fails with an error that retrying can not resolve.
+	cond := meta.FindStatusCondition(preview.Status.Conditions, catalogdv1.TypeValidated)
+	if cond != nil && cond.ObservedGeneration == preview.Generation && cond.Reason != catalogdv1.ReasonRetrying {
+		return nil
+	}
+
+	status, err := r.preview(ctx, preview)
+	if err != nil {
+		status = &catalogdv1.ClusterCatalogPreviewStatus{Conditions: preview.Status.Conditions}
+	}
+	updateStatusValidated(status, preview.Generation, err)
+	preview.Status = *status
+	return err
+}
+
+// preview returns the status of preview describing its contents. The
+// contents are removed before it returns.
+func (r *ClusterCatalogPreviewReconciler) preview(ctx context.Context, preview *catalogdv1.ClusterCatalogPreview) (*catalogdv1.ClusterCatalogPreviewStatus, error) {
+	l := log.FromContext(ctx)
+	// The unpacked content must not be evicted from the cache directory
+	// before it is stored.
+	ctx, unpin := source.WithPins(ctx)
+	defer unpin()
+	catalog := &catalogdv1.ClusterCatalog{
+		ObjectMeta: metav1.ObjectMeta{Name: preview.Name},
+		Spec: catalogdv1.ClusterCatalogSpec{
+			Source:  preview.Spec.Source,
+			Filter:  preview.Spec.Filter,
+			Patches: preview.Spec.Patches,
+		},
+	}
+	defer func() {
+		if err := r.Unpacker.Cleanup(ctx, catalog); err != nil {
+			l.Error(err, "error removing unpacked preview contents")
+		}
+		if err := r.Storage.Delete(catalog.Name); err != nil {
+			l.Error(err, "error removing stored preview contents")
+		}
+	}()
+
+	unpackResult, err := r.Unpacker.Unpack(ctx, catalog)
+	if err != nil {
+		return nil, fmt.Errorf("source catalog content: %w", err)
+	}
+	if unpackResult.State != source.StateUnpacked {
+		panic(fmt.Sprintf("unknown unpack state %q", unpackResult.State))
+	}
+
+	contentFS := unpackResult.FS
+	var (
+		patchResult  *patch.Result
+		filterResult *filter.Result
+	)
+	if len(catalog.Spec.Patches) > 0 {
+		contentFS, patchResult, err = patch.Apply(ctx, contentFS, catalog.Spec.Patches)
+		if err != nil {
+			return nil, fmt.Errorf("error patching catalog content: %w", err)
+		}
+	}
+	if catalog.Spec.Filter != nil {
+		contentFS, filterResult, err = filter.Apply(ctx, contentFS, *catalog.Spec.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("error filtering catalog content: %w", err)
+		}
+	}
+	if err := validateContent(ctx, contentFS); err != nil {
+		return nil, err
+	}
+
+	// The contents served for the ClusterCatalog are stored first, so that
+	// the diff of the previewed contents is the change from them.
+	if preview.Spec.ClusterCatalogName != "" {
+		servedFS, err := r.servedContent(preview.Spec.ClusterCatalogName)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.Storage.Store(ctx, catalog.Name, servedFS); err != nil {
+			return nil, fmt.Errorf("error storing served content of ClusterCatalog %q: %v", preview.Spec.ClusterCatalogName, err)
+		}
+	}
+	if err := r.Storage.Store(ctx, catalog.Name, contentFS); err != nil {
+		return nil, fmt.Errorf("error storing fbc: %v", err)
+	}
+	summary, err := r.Storage.ContentSummary(catalog.Name)
+	if err != nil {
+		return nil, fmt.Errorf("error computing content summary: %v", err)
+	}
+	status := &catalogdv1.ClusterCatalogPreviewStatus{
+		Conditions:     preview.Status.Conditions,
+		ResolvedSource: unpackResult.ResolvedSource,
+		LastUnpacked:   ptr.To(metav1.NewTime(unpackResult.UnpackTime)),
+		Content:        statusContent(summary),
+		FilterResult:   statusFilterResult(filterResult),
+		PatchResult:    statusPatchResult(patchResult),
+	}
+	if preview.Spec.ClusterCatalogName != "" {
+		diff, err := r.Storage.ContentDiff(catalog.Name)
+		if err != nil {
+			return nil, fmt.Errorf("error computing content diff: %v", err)
+		}
+		status.ContentChange = statusContentChange(diff)
+	}
+	return status, nil
+}
+
+func (r *ClusterCatalogPreviewReconciler) servedContent(name string) (fs.FS, error) {
+	reader, _, err := r.Catalogs.ContentReader(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("ClusterCatalog %q is not serving any content", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading served content of ClusterCatalog %q: %v", name, err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading served content of ClusterCatalog %q: %v", name, err)
+	}
+	return fsutil.NewSingleFileFS("catalog.json", data), nil
+}
+
+// validateContent checks that the objects in fsys form a valid catalog.
+func validateContent(ctx context.Context, fsys fs.FS) error {
+	cfg, err := declcfg.LoadFS(ctx, fsys)
+	if err != nil {
+		return reconcile.TerminalError(fmt.Errorf("catalog content is invalid: %w", err))
+	}
+	if _, err := declcfg.ConvertToModel(*cfg); err != nil {
+		return reconcile.TerminalError(fmt.Errorf("catalog content is invalid: %w", err))
+	}
+	return nil
+}
+
+func updateStatusValidated(status *catalogdv1.ClusterCatalogPreviewStatus, generation int64, err error) {
+	validatedCond := metav1.Condition{
+		Type:               catalogdv1.TypeValidated,
+		Status:             metav1.ConditionTrue,
+		Reason:             catalogdv1.ReasonSucceeded,
+		Message:            "Successfully unpacked and validated content from resolved source",
+		ObservedGeneration: generation,
+	}
+
+	if err != nil {
+		validatedCond.Status = metav1.ConditionFalse
+		validatedCond.Reason = catalogdv1.ReasonRetrying
+		validatedCond.Message = err.Error()
+	}
+
+	if errors.Is(err, reconcile.TerminalError(nil)) {
+		validatedCond.Reason = catalogdv1.ReasonBlocked
+	}
+
+	meta.SetStatusCondition(&status.Conditions, validatedCond)
+}
@@ -0,0 +1,200 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+	"github.com/operator-framework/catalogd/internal/source"
+	"github.com/operator-framework/catalogd/internal/storage"
+)
+
+// mockContentReader serves the content of the ClusterCatalogs it has a key for.
+type mockContentReader map[string]string
+
+func (m mockContentReader) ContentReader(catalog string) (io.ReadCloser, string, error) {
+	content, ok := m[catalog]
+	if !ok {
+		return nil, "", fmt.Errorf("no content stored for catalog %q: %w", catalog, fs.ErrNotExist)
+	}
+	return io.NopCloser(strings.NewReader(content)), "sha256:served", nil
+}
+
+func packageContent(pkg string) string {
+	return fmt.Sprintf(`{"schema":"olm.package","name":%[1]q,"defaultChannel":"stable"}
+{"schema":"olm.channel","package":%[1]q,"name":"stable","entries":[{"name":"%[1]s.v1.0.0"}]}
+{"schema":"olm.bundle","package":%[1]q,"name":"%[1]s.v1.0.0","image":"registry.example.com/%[1]s:v1.0.0","properties":[{"type":"olm.package","value":{"packageName":%[1]q,"version":"1.0.0"}}]}
+`, pkg)
+}
+
+func TestClusterCatalogPreviewReconcile(t *testing.T) {
+	unpackTime := time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)
+	unpacked := func(content string) *MockSource {
+		return &MockSource{result: &source.Result{
+			State:      source.StateUnpacked,
+			FS:         fstest.MapFS{"catalog.json": &fstest.MapFile{Data: []byte(content)}},
+			UnpackTime: unpackTime,
+			ResolvedSource: &catalogdv1.ResolvedCatalogSource{
+				Type:  catalogdv1.SourceTypeImage,
+				Image: &catalogdv1.ResolvedImageSource{Ref: "my.org/someimage@someSHA256Digest"},
+			},
+		}}
+	}
+
+	for _, tc := range []struct {
+		name                  string
+		clusterCatalogName    string
+		existingConditions    []metav1.Condition
+		source                *MockSource
+		expectedReason        string
+		expectedError         string
+		expectedPackages      int32
+		expectedContentChange *catalogdv1.ContentChangeSummary
+		expectUnchanged       bool
+	}{
+		{
+			name:             "valid content is summarized",
+			source:           unpacked(packageContent("foo")),
+			expectedReason:   catalogdv1.ReasonSucceeded,
+			expectedPackages: 1,
+		},
+		{
+			name:               "valid content is compared with the content served for a ClusterCatalog",
+			clusterCatalogName: "served",
+			source:             unpacked(packageContent("foo") + packageContent("baz")),
+			expectedReason:     catalogdv1.ReasonSucceeded,
+			expectedPackages:   2,
+			expectedContentChange: &catalogdv1.ContentChangeSummary{
+				AddedPackages:   1,
+				RemovedPackages: 1,
+				AddedChannels:   1,
+				RemovedChannels: 1,
+				AddedBundles:    1,
+				RemovedBundles:  1,
+			},
+		},
+		{
+			name:               "comparing with a ClusterCatalog that is not serving content is retried",
+			clusterCatalogName: "missing",
+			source:             unpacked(packageContent("foo")),
+			expectedReason:     catalogdv1.ReasonRetrying,
+			expectedError:      `ClusterCatalog "missing" is not serving any content`,
+		},
+		{
+			name:           "invalid content is blocked",
+			source:         unpacked(`{"schema":"olm.channel","package":"foo","name":"stable","entries":[{"name":"foo.v1.0.0"}]}`),
+			expectedReason: catalogdv1.ReasonBlocked,
+			expectedError:  "catalog content is invalid",
+		},
+		{
+			name:           "unpack errors are retried",
+			source:         &MockSource{unpackError: errors.New("mocksource error")},
+			expectedReason: catalogdv1.ReasonRetrying,
+			expectedError:  "source catalog content: mocksource error",
+		},
+		{
+			name:           "terminal unpack errors are blocked",
+			source:         &MockSource{unpackError: reconcile.TerminalError(errors.New("mocksource terminal error"))},
+			expectedReason: catalogdv1.ReasonBlocked,
+			expectedError:  "mocksource terminal error",
+		},
+		{
+			name: "a generation that was previewed is not previewed again",
+			existingConditions: []metav1.Condition{{
+				Type:               catalogdv1.TypeValidated,
+				Status:             metav1.ConditionTrue,
+				Reason:             catalogdv1.ReasonSucceeded,
+				ObservedGeneration: 1,
+			}},
+			source:          &MockSource{unpackError: errors.New("mocksource error")},
+			expectedReason:  catalogdv1.ReasonSucceeded,
+			expectUnchanged: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			preview := &catalogdv1.ClusterCatalogPreview{
+				ObjectMeta: metav1.ObjectMeta{Name: "preview", Generation: 1},
+				Spec: catalogdv1.ClusterCatalogPreviewSpec{
+					Source: catalogdv1.CatalogSource{
+						Type:  catalogdv1.SourceTypeImage,
+						Image: &catalogdv1.ImageSource{Ref: "my.org/someimage:latest"},
+					},
+					ClusterCatalogName: tc.clusterCatalogName,
+				},
+				Status: catalogdv1.ClusterCatalogPreviewStatus{Conditions: tc.existingConditions},
+			}
+			scheme := runtime.NewScheme()
+			require.NoError(t, catalogdv1.AddToScheme(scheme))
+			cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(preview).WithStatusSubresource(preview).Build()
+			storageDir := t.TempDir()
+			reconciler := &ClusterCatalogPreviewReconciler{
+				Client:   cl,
+				Unpacker: tc.source,
+				Storage:  &storage.LocalDirV1{RootDir: storageDir},
+				Catalogs: mockContentReader{"served": packageContent("foo") + packageContent("bar")},
+			}
+
+			_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "preview"}})
+			if tc.expectedError != "" {
+				require.ErrorContains(t, err, tc.expectedError)
+			} else {
+				require.NoError(t, err)
+			}
+
+			var reconciled catalogdv1.ClusterCatalogPreview
+			require.NoError(t, cl.Get(ctx, types.NamespacedName{Name: "preview"}, &reconciled))
+			cond := meta.FindStatusCondition(reconciled.Status.Conditions, catalogdv1.TypeValidated)
+			require.NotNil(t, cond)
+			assert.Equal(t, tc.expectedReason, cond.Reason)
+			assert.Equal(t, int64(1), cond.ObservedGeneration)
+			if tc.expectUnchanged {
+				assert.Equal(t, preview.Status, reconciled.Status)
+				return
+			}
+			if tc.expectedError != "" {
+				assert.Equal(t, metav1.ConditionFalse, cond.Status)
+				assert.Contains(t, cond.Message, tc.expectedError)
+				assert.Nil(t, reconciled.Status.Content)
+				return
+			}
+
+			assert.Equal(t, metav1.ConditionTrue, cond.Status)
+			assert.Equal(t, "my.org/someimage@someSHA256Digest", reconciled.Status.ResolvedSource.Image.Ref)
+			assert.True(t, reconciled.Status.LastUnpacked.Time.Equal(unpackTime))
+			require.NotNil(t, reconciled.Status.Content)
+			assert.Equal(t, tc.expectedPackages, reconciled.Status.Content.Packages)
+			if tc.expectedContentChange == nil {
+				assert.Nil(t, reconciled.Status.ContentChange)
+			} else {
+				require.NotNil(t, reconciled.Status.ContentChange)
+				tc.expectedContentChange.PreviousDigest = reconciled.Status.ContentChange.PreviousDigest
+				tc.expectedContentChange.Digest = reconciled.Status.Content.Digest
+				assert.Equal(t, tc.expectedContentChange, reconciled.Status.ContentChange)
+			}
+
+			// The previewed content is not kept.
+			entries, err := os.ReadDir(storageDir)
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+
+	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+	"github.com/operator-framework/catalogd/internal/storage"
+)
+
+// Reasons of the Events emitted for ClusterCatalogs.
+const (
+	EventReasonUnpackStarted           = "UnpackStarted"
+	EventReasonUnpackSucceeded         = "UnpackSucceeded"
+	EventReasonUnpackFailed            = "UnpackFailed"
+	EventReasonDigestResolved          = "DigestResolved"
+	EventReasonContentStored           = "ContentStored"
+	EventReasonFilterFailed            = "FilterFailed"
+	EventReasonPatchFailed             = "PatchFailed"
+	EventReasonStoreFailed             = "StoreFailed"
+	EventReasonRevisionRolledBack      = "RevisionRolledBack"
+	EventReasonAvailabilityModeChanged = "AvailabilityModeChanged"
+)
+
+// eventf emits an event for catalog if the reconciler has a Recorder.
+//
+// Events are only emitted when a catalog transitions from one state to
+// another, which is determined by comparing its status before and after a
+// reconcile. Unpacks are reported for a new generation of the spec, a source
+// resolved to a new digest and a recovery from a failure, so that polls that
+// find the same digest emit no events. Since the status is persisted, this holds across restarts of the
+// controller, and reconciles that leave a catalog in the same state, such as
+// retries that fail the same way, emit no events.
+func (r *ClusterCatalogReconciler) eventf(catalog *catalogdv1.ClusterCatalog, eventType, reason, messageFmt string, args ...interface{}) {
+	if r.Recorder == nil {
+		return
+	}
+	r.Recorder.Eventf(catalog, eventType, reason, messageFmt, args...)
+}
+
+// generationObserved returns true if the Progressing condition in status
+// reflects generation of the spec of a catalog.
+func generationObserved(status *catalogdv1.ClusterCatalogStatus, generation int64) bool {
+	cond := meta.FindStatusCondition(status.Conditions, catalogdv1.TypeProgressing)
+	return cond != nil && cond.ObservedGeneration == generation
+}
+
+// retryingAfterFailure returns true if a catalog is being unpacked again
+// after a failure that was reported for the same generation of its spec.
+func retryingAfterFailure(previous *catalogdv1.ClusterCatalogStatus, generation int64) bool {
+	if !generationObserved(previous, generation) {
+		return false
+	}
+	cond := meta.FindStatusCondition(previous.Conditions, catalogdv1.TypeProgressing)
+	return cond.Reason != catalogdv1.ReasonSucceeded
+}
+
+// emitFailed emits a Warning event for err, which the Progressing condition
+// of catalog was just updated to report, unless it already reported the same
+// error before this reconcile.
+func (r *ClusterCatalogReconciler) emitFailed(catalog *catalogdv1.ClusterCatalog, previous *catalogdv1.ClusterCatalogStatus, reason string, err error) {
+	cond := meta.FindStatusCondition(catalog.Status.Conditions, catalogdv1.TypeProgressing)
+	prevCond := meta.FindStatusCondition(previous.Conditions, catalogdv1.TypeProgressing)
+	if cond != nil && prevCond != nil &&
+		cond.Reason == prevCond.Reason && cond.Message == prevCond.Message && cond.ObservedGeneration == prevCond.ObservedGeneration {
+		return
+	}
+	r.eventf(catalog, corev1.EventTypeWarning, reason, "%s", err.Error())
+}
+
+// emitStored emits the events for catalog having been unpacked and its
+// content stored successfully, given its status before this reconcile and
+// whether an UnpackStarted event was emitted for it.
+func (r *ClusterCatalogReconciler) emitStored(catalog *catalogdv1.ClusterCatalog, previous *catalogdv1.ClusterCatalogStatus, started bool, summary *storage.ContentSummary) {
+	resolvedRef := resolvedSourceRef(catalog.Status.ResolvedSource)
+	digestChanged := resolvedRef != resolvedSourceRef(previous.ResolvedSource)
+
+	prevCond := meta.FindStatusCondition(previous.Conditions, catalogdv1.TypeProgressing)
+	recovered := prevCond != nil && prevCond.Reason != catalogdv1.ReasonSucceeded
+	if started || digestChanged || recovered {
+		r.eventf(catalog, corev1.EventTypeNormal, EventReasonUnpackSucceeded, "Unpacked %s", resolvedRef)
+	}
+
+	if summary == nil || (previous.Content != nil && previous.Content.Digest == summary.Digest) {
+		return
+	}
+	if lastChange := previous.LastContentChange; lastChange != nil && lastChange.PreviousDigest == summary.Digest {
+		r.eventf(catalog, corev1.EventTypeNormal, EventReasonRevisionRolledBack, "Content rolled back from %s to the previously served %s", lastChange.Digest, summary.Digest)
+		return
+	}
+	r.eventf(catalog, corev1.EventTypeNormal, EventReasonContentStored, "Stored content %s with %d packages, %d channels and %d bundles (%d bytes)",
+		summary.Digest, summary.Packages, summary.Channels, summary.Bundles, summary.SizeBytes)
+}
+
+// emitDigestResolved emits an event if the source of catalog was just
+// resolved to a different reference than the one it was last resolved to,
+// or, after a restart of the controller, than the one in its status. Since a
+// poll only unpacks a new digest, UnpackStarted is emitted first, unless it
+// was already emitted for this unpack, as given by started, or the unpack is
+// a retry after a failure. It returns whether UnpackStarted was emitted for
+// this unpack.
+func (r *ClusterCatalogReconciler) emitDigestResolved(catalog *catalogdv1.ClusterCatalog, previous *catalogdv1.ClusterCatalogStatus, resolved *catalogdv1.ResolvedCatalogSource, started bool) bool {
+	resolvedRef := resolvedSourceRef(resolved)
+	lastRef, ok := r.swapResolvedRef(catalog.Name, resolvedRef)
+	if !ok {
+		lastRef = resolvedSourceRef(previous.ResolvedSource)
+	}
+	if resolvedRef == lastRef {
+		return started
+	}
+	if !started && !retryingAfterFailure(previous, catalog.GetGeneration()) {
+		r.eventf(catalog, corev1.EventTypeNormal, EventReasonUnpackStarted, "Unpacking %s", specSourceRef(catalog))
+		started = true
+	}
+	r.eventf(catalog, corev1.EventTypeNormal, EventReasonDigestResolved, "Resolved %s to %s", specSourceRef(catalog), resolvedRef)
+	return started
+}
+
+// emitAvailabilityModeChanged emits an event if the availability mode of
+// catalog differs from the one its status reflected before this reconcile.
+// Since the mode is part of the spec, a change is only emitted for the first
+// reconcile of a generation: the Serving condition keeps reflecting the
+// previous mode until the catalog is served again, which may take several
+// reconciles when unpacking fails. Catalogs that have not been reconciled
+// before have no mode to change from.
+func (r *ClusterCatalogReconciler) emitAvailabilityModeChanged(catalog *catalogdv1.ClusterCatalog, previous *catalogdv1.ClusterCatalogStatus) {
+	servingCond := meta.FindStatusCondition(previous.Conditions, catalogdv1.TypeServing)
+	if servingCond == nil || generationObserved(previous, catalog.GetGeneration()) {
+		return
+	}
+	wasUnavailable := servingCond.Reason == catalogdv1.ReasonUserSpecifiedUnavailable
+	isUnavailable := catalog.Spec.AvailabilityMode == catalogdv1.AvailabilityModeUnavailable
+	if wasUnavailable == isUnavailable {
+		return
+	}
+	mode := catalog.Spec.AvailabilityMode
+	if mode == "" {
+		mode = catalogdv1.AvailabilityModeAvailable
+	}
+	r.eventf(catalog, corev1.EventTypeNormal, EventReasonAvailabilityModeChanged, "Availability mode changed to %s", mode)
+}
+
+// resolvedSourceRef describes a resolved source: the resolved reference of
+// an image, or the resolved references and content digests of the members of
+// a composite source.
+func resolvedSourceRef(resolved *catalogdv1.ResolvedCatalogSource) string {
+	switch {
+	case resolved == nil:
+		return ""
+	case resolved.Image != nil:
+		return resolved.Image.Ref
+	case resolved.Composite != nil:
+		refs := make([]string, 0, len(resolved.Composite.Members))
+		for _, m := range resolved.Composite.Members {
+			switch {
+			case m.Image != nil:
+				refs = append(refs, m.Image.Ref)
+			case m.ClusterCatalog != nil:
+				refs = append(refs, fmt.Sprintf("ClusterCatalog %s@%s", m.ClusterCatalog.Name, m.ClusterCatalog.ContentDigest))
+			}
+		}
+		return strings.Join(refs, ", ")
+	}
+	return ""
+}
+
+// specSourceRef describes the source in the spec of catalog.
+func specSourceRef(catalog *catalogdv1.ClusterCatalog) string {
+	switch {
+	case catalog.Spec.Source.Image != nil:
+		return catalog.Spec.Source.Image.Ref
+	case catalog.Spec.Source.Composite != nil:
+		return fmt.Sprintf("composite source with %d members", len(catalog.Spec.Source.Composite.Members))
+	}
+	return ""
+}
@@ -0,0 +1,161 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+	"github.com/operator-framework/catalogd/internal/source"
+	"github.com/operator-framework/catalogd/internal/storage"
+)
+
+func TestCatalogLifecycleEvents(t *testing.T) {
+	recorder := record.NewFakeRecorder(100)
+	unpacker := &MockSource{}
+	store := &MockStore{}
+	reconciler := &ClusterCatalogReconciler{
+		Unpacker:       unpacker,
+		Storage:        store,
+		Recorder:       recorder,
+		storedCatalogs: map[string]storedCatalogData{},
+	}
+	require.NoError(t, reconciler.setupFinalizers())
+	catalog := &catalogdv1.ClusterCatalog{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "catalog",
+			Generation: 1,
+			Finalizers: []string{fbcDeletionFinalizer},
+		},
+		Spec: catalogdv1.ClusterCatalogSpec{
+			Source: catalogdv1.CatalogSource{
+				Type: catalogdv1.SourceTypeImage,
+				Image: &catalogdv1.ImageSource{
+					Ref: "my.org/someimage:latest",
+				},
+			},
+			AvailabilityMode: catalogdv1.AvailabilityModeAvailable,
+		},
+	}
+	unpacked := func(digest string) {
+		unpacker.unpackError = nil
+		unpacker.result = &source.Result{
+			State: source.StateUnpacked,
+			FS:    &fstest.MapFS{},
+			ResolvedSource: &catalogdv1.ResolvedCatalogSource{
+				Image: &catalogdv1.ResolvedImageSource{Ref: "my.org/someimage@" + digest},
+			},
+		}
+	}
+	stored := func(previousContent, content string) {
+		store.contentSummary = &storage.ContentSummary{Digest: content}
+		store.contentDiff = &storage.Diff{From: previousContent, To: content}
+	}
+	// reconcile reconciles the catalog as if it had not been seen before,
+	// as is the case on every poll and retry, and after a restart, and
+	// returns the reasons of the events emitted.
+	reconcile := func(t *testing.T) []string {
+		reconciler.deleteStoredCatalog(catalog.Name)
+		_, _ = reconciler.reconcile(context.Background(), catalog)
+		var reasons []string
+		for {
+			select {
+			case event := <-recorder.Events:
+				reasons = append(reasons, strings.Fields(event)[1])
+			default:
+				return reasons
+			}
+		}
+	}
+
+	t.Run("first unpack", func(t *testing.T) {
+		unpacked("sha256:image1")
+		stored("", "sha256:content1")
+		assert.Equal(t, []string{EventReasonUnpackStarted, EventReasonDigestResolved, EventReasonUnpackSucceeded, EventReasonContentStored}, reconcile(t))
+	})
+
+	t.Run("poll of an unchanged image", func(t *testing.T) {
+		assert.Empty(t, reconcile(t))
+	})
+
+	t.Run("poll resolving a new digest", func(t *testing.T) {
+		unpacked("sha256:image2")
+		stored("sha256:content1", "sha256:content2")
+		assert.Equal(t, []string{EventReasonUnpackStarted, EventReasonDigestResolved, EventReasonUnpackSucceeded, EventReasonContentStored}, reconcile(t))
+	})
+
+	t.Run("repeated failures", func(t *testing.T) {
+		unpacker.unpackError = errors.New("registry unavailable")
+		assert.Equal(t, []string{EventReasonUnpackFailed}, reconcile(t))
+		assert.Empty(t, reconcile(t))
+		unpacker.unpackError = errors.New("manifest unknown")
+		assert.Equal(t, []string{EventReasonUnpackFailed}, reconcile(t))
+	})
+
+	t.Run("recovery to the previous revision", func(t *testing.T) {
+		unpacked("sha256:image1")
+		stored("sha256:content2", "sha256:content1")
+		assert.Equal(t, []string{EventReasonDigestResolved, EventReasonUnpackSucceeded, EventReasonRevisionRolledBack}, reconcile(t))
+	})
+
+	t.Run("storage failure", func(t *testing.T) {
+		store.shouldError = true
+		assert.Equal(t, []string{EventReasonStoreFailed}, reconcile(t))
+		assert.Empty(t, reconcile(t))
+		store.shouldError = false
+		assert.Equal(t, []string{EventReasonUnpackSucceeded}, reconcile(t))
+	})
+
+	t.Run("storage failure after resolving a new digest", func(t *testing.T) {
+		store.shouldError = true
+		unpacked("sha256:image3")
+		assert.Equal(t, []string{EventReasonUnpackStarted, EventReasonDigestResolved, EventReasonStoreFailed}, reconcile(t))
+		assert.Empty(t, reconcile(t), "the digest is not resolved again by retries")
+		store.shouldError = false
+		stored("sha256:content1", "sha256:content3")
+		assert.Equal(t, []string{EventReasonUnpackSucceeded, EventReasonContentStored}, reconcile(t))
+	})
+
+	t.Run("availability mode changes", func(t *testing.T) {
+		catalog.Spec.AvailabilityMode = catalogdv1.AvailabilityModeUnavailable
+		catalog.Generation++
+		assert.Equal(t, []string{EventReasonAvailabilityModeChanged}, reconcile(t))
+		assert.Empty(t, reconcile(t))
+
+		catalog.Spec.AvailabilityMode = catalogdv1.AvailabilityModeAvailable
+		catalog.Generation++
+		assert.Empty(t, reconcile(t), "the finalizer is added back first")
+		// Content is deleted while the catalog is unavailable, so it is
+		// resolved and stored anew.
+		assert.Equal(t, []string{
+			EventReasonAvailabilityModeChanged, EventReasonUnpackStarted, EventReasonDigestResolved, EventReasonUnpackSucceeded, EventReasonContentStored,
+		}, reconcile(t))
+	})
+
+	t.Run("availability mode changes before a failing unpack", func(t *testing.T) {
+		catalog.Spec.AvailabilityMode = catalogdv1.AvailabilityModeUnavailable
+		catalog.Generation++
+		assert.Equal(t, []string{EventReasonAvailabilityModeChanged}, reconcile(t))
+
+		catalog.Spec.AvailabilityMode = catalogdv1.AvailabilityModeAvailable
+		catalog.Generation++
+		unpacker.unpackError = errors.New("registry unavailable")
+		assert.Empty(t, reconcile(t), "the finalizer is added back first")
+		assert.Equal(t, []string{EventReasonAvailabilityModeChanged, EventReasonUnpackStarted, EventReasonUnpackFailed}, reconcile(t))
+		// The catalog is still not served, so its Serving condition still
+		// reflects the previous mode.
+		assert.Empty(t, reconcile(t))
+		assert.Empty(t, reconcile(t))
+
+		unpacked("sha256:image3")
+		stored("", "sha256:content3")
+		assert.Equal(t, []string{EventReasonDigestResolved, EventReasonUnpackSucceeded, EventReasonContentStored}, reconcile(t))
+	})
+}
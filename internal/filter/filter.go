@@ -0,0 +1,236 @@
+// Package filter prunes the contents of a catalog down to the packages,
+// channels and bundles selected by the filter of a ClusterCatalog.
+package filter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"slices"
+
+	"github.com/blang/semver/v4"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/alpha/property"
+
+	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+	"github.com/operator-framework/catalogd/internal/fsutil"
+)
+
+// catalogFile is the name of the file holding the filtered contents in the
+// file system returned by Apply.
+const catalogFile = "catalog.json"
+
+// Result summarizes the contents of a catalog that were removed by a filter.
+type Result struct {
+	RemovedPackages int
+	RemovedChannels int
+	RemovedBundles  int
+	// MissingPackages are the packages named by the filter that are not in
+	// the catalog, sorted by name.
+	MissingPackages []string
+}
+
+// Apply loads the catalog in fsys, removes the contents not selected by spec,
+// and returns a file system holding the remaining contents along with a
+// summary of what was removed. An error is returned if spec is invalid or if
+// the remaining contents are not a valid File-Based Catalog.
+func Apply(ctx context.Context, fsys fs.FS, spec catalogdv1.CatalogFilter) (fs.FS, *Result, error) {
+	f, err := compile(spec)
+	if err != nil {
+		return nil, nil, reconcile.TerminalError(fmt.Errorf("invalid filter: %w", err))
+	}
+	cfg, err := declcfg.LoadFS(ctx, fsys)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error loading catalog to filter: %w", err)
+	}
+
+	filtered, result := f.apply(cfg)
+	if _, err := declcfg.ConvertToModel(*filtered); err != nil {
+		return nil, nil, fmt.Errorf("filtered catalog is invalid: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := declcfg.WriteJSON(*filtered, &buf); err != nil {
+		return nil, nil, fmt.Errorf("error writing filtered catalog: %w", err)
+	}
+	return fsutil.NewSingleFileFS(catalogFile, buf.Bytes()), result, nil
+}
+
+type filter struct {
+	include  sets.Set[string]
+	exclude  sets.Set[string]
+	packages map[string]packageFilter
+}
+
+type packageFilter struct {
+	channels sets.Set[string]
+	min, max *semver.Version
+}
+
+func compile(spec catalogdv1.CatalogFilter) (*filter, error) {
+	f := &filter{
+		include:  sets.New(spec.IncludePackages...),
+		exclude:  sets.New(spec.ExcludePackages...),
+		packages: make(map[string]packageFilter, len(spec.Packages)),
+	}
+	for _, p := range spec.Packages {
+		pf := packageFilter{channels: sets.New(p.Channels...)}
+		if p.MinVersion != "" {
+			v, err := semver.Parse(p.MinVersion)
+			if err != nil {
+				return nil, fmt.Errorf("package %q: invalid minVersion %q: %w", p.Name, p.MinVersion, err)
+			}
+			pf.min = &v
+		}
+		if p.MaxVersion != "" {
+			v, err := semver.Parse(p.MaxVersion)
+			if err != nil {
+				return nil, fmt.Errorf("package %q: invalid maxVersion %q: %w", p.Name, p.MaxVersion, err)
+			}
+			pf.max = &v
+		}
+		if pf.min != nil && pf.max != nil && pf.min.GT(*pf.max) {
+			return nil, fmt.Errorf("package %q: minVersion %s is greater than maxVersion %s", p.Name, pf.min, pf.max)
+		}
+		f.packages[p.Name] = pf
+	}
+	return f, nil
+}
+
+func (f *filter) servesPackage(name string) bool {
+	return (f.include.Len() == 0 || f.include.Has(name)) && !f.exclude.Has(name)
+}
+
+func (f *filter) servesChannel(ch declcfg.Channel) bool {
+	pf := f.packages[ch.Package]
+	return pf.channels.Len() == 0 || pf.channels.Has(ch.Name)
+}
+
+// servesBundle returns true if the version of b is within the range selected
+// for its package. Bundles without a valid version are not served if a range
+// is selected, since they cannot be shown to be within it.
+func (f *filter) servesBundle(b declcfg.Bundle) bool {
+	pf := f.packages[b.Package]
+	if pf.min == nil && pf.max == nil {
+		return true
+	}
+	v, err := bundleVersion(b)
+	if err != nil {
+		return false
+	}
+	return (pf.min == nil || v.GTE(*pf.min)) && (pf.max == nil || v.LTE(*pf.max))
+}
+
+func bundleVersion(b declcfg.Bundle) (semver.Version, error) {
+	props, err := property.Parse(b.Properties)
+	if err != nil {
+		return semver.Version{}, err
+	}
+	if len(props.Packages) != 1 {
+		return semver.Version{}, fmt.Errorf("bundle %q must have exactly one %q property", b.Name, property.TypePackage)
+	}
+	return semver.Parse(props.Packages[0].Version)
+}
+
+// apply returns the contents of cfg selected by f. The FBC model requires
+// every channel to have entries, every package to have channels and every
+// bundle to be an entry of a channel, so removing one kind of object cascades
+// to the others.
+func (f *filter) apply(cfg *declcfg.DeclarativeConfig) (*declcfg.DeclarativeConfig, *Result) {
+	candidateBundles := sets.New[bundleKey]()
+	for _, b := range cfg.Bundles {
+		if f.servesPackage(b.Package) && f.servesBundle(b) {
+			candidateBundles.Insert(bundleKey{b.Package, b.Name})
+		}
+	}
+
+	out := &declcfg.DeclarativeConfig{}
+	channels := map[string][]string{}
+	bundles := sets.New[bundleKey]()
+	for _, ch := range cfg.Channels {
+		if !f.servesPackage(ch.Package) || !f.servesChannel(ch) {
+			continue
+		}
+		entries := slices.DeleteFunc(slices.Clone(ch.Entries), func(e declcfg.ChannelEntry) bool {
+			return !candidateBundles.Has(bundleKey{ch.Package, e.Name})
+		})
+		if len(entries) == 0 {
+			continue
+		}
+		ch.Entries = entries
+		out.Channels = append(out.Channels, ch)
+		channels[ch.Package] = append(channels[ch.Package], ch.Name)
+		for _, e := range entries {
+			bundles.Insert(bundleKey{ch.Package, e.Name})
+		}
+	}
+
+	for _, b := range cfg.Bundles {
+		if bundles.Has(bundleKey{b.Package, b.Name}) {
+			out.Bundles = append(out.Bundles, b)
+		}
+	}
+
+	packages := sets.New[string]()
+	for _, p := range cfg.Packages {
+		chs, ok := channels[p.Name]
+		if !ok {
+			continue
+		}
+		if !slices.Contains(chs, p.DefaultChannel) {
+			p.DefaultChannel = slices.Min(chs)
+		}
+		out.Packages = append(out.Packages, p)
+		packages.Insert(p.Name)
+	}
+
+	for _, d := range cfg.Deprecations {
+		if !packages.Has(d.Package) {
+			continue
+		}
+		d.Entries = slices.DeleteFunc(slices.Clone(d.Entries), func(e declcfg.DeprecationEntry) bool {
+			switch e.Reference.Schema {
+			case declcfg.SchemaChannel:
+				return !slices.Contains(channels[d.Package], e.Reference.Name)
+			case declcfg.SchemaBundle:
+				return !bundles.Has(bundleKey{d.Package, e.Reference.Name})
+			}
+			return false
+		})
+		if len(d.Entries) > 0 {
+			out.Deprecations = append(out.Deprecations, d)
+		}
+	}
+
+	for _, m := range cfg.Others {
+		if m.Package == "" || packages.Has(m.Package) {
+			out.Others = append(out.Others, m)
+		}
+	}
+
+	sourcePackages := sets.New[string]()
+	for _, p := range cfg.Packages {
+		sourcePackages.Insert(p.Name)
+	}
+	named := f.include.Union(f.exclude)
+	for name := range f.packages {
+		named.Insert(name)
+	}
+
+	result := &Result{
+		RemovedPackages: len(cfg.Packages) - len(out.Packages),
+		RemovedChannels: len(cfg.Channels) - len(out.Channels),
+		RemovedBundles:  len(cfg.Bundles) - len(out.Bundles),
+	}
+	if missing := named.Difference(sourcePackages); missing.Len() > 0 {
+		result.MissingPackages = sets.List(missing)
+	}
+	return out, result
+}
+
+type bundleKey struct {
+	pkg, name string
+}
@@ -0,0 +1,240 @@
+package filter_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+
+	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+	"github.com/operator-framework/catalogd/internal/filter"
+)
+
+const testCatalog = `---
+schema: olm.package
+name: foo
+defaultChannel: beta
+---
+schema: olm.channel
+package: foo
+name: stable
+entries:
+- name: foo.v1.0.0
+- name: foo.v2.0.0
+  replaces: foo.v1.0.0
+---
+schema: olm.channel
+package: foo
+name: beta
+entries:
+- name: foo.v2.1.0
+---
+schema: olm.deprecations
+package: foo
+entries:
+- reference:
+    schema: olm.channel
+    name: beta
+  message: beta is deprecated
+- reference:
+    schema: olm.bundle
+    name: foo.v1.0.0
+  message: foo.v1.0.0 is deprecated
+---
+schema: olm.package
+name: bar
+defaultChannel: stable
+---
+schema: olm.channel
+package: bar
+name: stable
+entries:
+- name: bar.v0.1.0
+---
+schema: custom.schema
+package: bar
+---
+schema: custom.schema
+`
+
+func bundle(pkg, version string) string {
+	return fmt.Sprintf(`---
+schema: olm.bundle
+package: %[1]s
+name: %[1]s.v%[2]s
+image: example.com/%[1]s:v%[2]s
+properties:
+- type: olm.package
+  value:
+    packageName: %[1]s
+    version: %[2]s
+`, pkg, version)
+}
+
+func testFS() fstest.MapFS {
+	fbc := testCatalog + bundle("foo", "1.0.0") + bundle("foo", "2.0.0") + bundle("foo", "2.1.0") + bundle("bar", "0.1.0")
+	return fstest.MapFS{"catalog.yaml": &fstest.MapFile{Data: []byte(fbc)}}
+}
+
+type contents struct {
+	packages     map[string]string
+	channels     []string
+	bundles      []string
+	deprecations []string
+	others       int
+}
+
+func contentsOf(cfg *declcfg.DeclarativeConfig) contents {
+	c := contents{packages: map[string]string{}, others: len(cfg.Others)}
+	for _, p := range cfg.Packages {
+		c.packages[p.Name] = p.DefaultChannel
+	}
+	for _, ch := range cfg.Channels {
+		c.channels = append(c.channels, ch.Package+"/"+ch.Name)
+	}
+	for _, b := range cfg.Bundles {
+		c.bundles = append(c.bundles, b.Name)
+	}
+	for _, d := range cfg.Deprecations {
+		for _, e := range d.Entries {
+			c.deprecations = append(c.deprecations, e.Reference.Schema+"/"+e.Reference.Name)
+		}
+	}
+	// The filtered contents are written in a different order than the source.
+	slices.Sort(c.channels)
+	slices.Sort(c.bundles)
+	slices.Sort(c.deprecations)
+	return c
+}
+
+func TestApply(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		filter   catalogdv1.CatalogFilter
+		contents contents
+		result   filter.Result
+	}{
+		{
+			name:   "empty filter",
+			filter: catalogdv1.CatalogFilter{},
+			contents: contents{
+				packages:     map[string]string{"foo": "beta", "bar": "stable"},
+				channels:     []string{"bar/stable", "foo/beta", "foo/stable"},
+				bundles:      []string{"bar.v0.1.0", "foo.v1.0.0", "foo.v2.0.0", "foo.v2.1.0"},
+				deprecations: []string{"olm.bundle/foo.v1.0.0", "olm.channel/beta"},
+				others:       2,
+			},
+		},
+		{
+			name:   "include packages",
+			filter: catalogdv1.CatalogFilter{IncludePackages: []string{"bar", "baz"}},
+			contents: contents{
+				packages: map[string]string{"bar": "stable"},
+				channels: []string{"bar/stable"},
+				bundles:  []string{"bar.v0.1.0"},
+				others:   2,
+			},
+			result: filter.Result{RemovedPackages: 1, RemovedChannels: 2, RemovedBundles: 3, MissingPackages: []string{"baz"}},
+		},
+		{
+			name:   "exclude packages",
+			filter: catalogdv1.CatalogFilter{IncludePackages: []string{"foo", "bar"}, ExcludePackages: []string{"foo"}},
+			contents: contents{
+				packages: map[string]string{"bar": "stable"},
+				channels: []string{"bar/stable"},
+				bundles:  []string{"bar.v0.1.0"},
+				others:   2,
+			},
+			result: filter.Result{RemovedPackages: 1, RemovedChannels: 2, RemovedBundles: 3},
+		},
+		{
+			name: "channels, replacing the default channel",
+			filter: catalogdv1.CatalogFilter{Packages: []catalogdv1.PackageFilter{
+				{Name: "foo", Channels: []string{"stable"}},
+			}},
+			contents: contents{
+				packages:     map[string]string{"foo": "stable", "bar": "stable"},
+				channels:     []string{"bar/stable", "foo/stable"},
+				bundles:      []string{"bar.v0.1.0", "foo.v1.0.0", "foo.v2.0.0"},
+				deprecations: []string{"olm.bundle/foo.v1.0.0"},
+				others:       2,
+			},
+			result: filter.Result{RemovedChannels: 1, RemovedBundles: 1},
+		},
+		{
+			name: "version range removing empty channels",
+			filter: catalogdv1.CatalogFilter{Packages: []catalogdv1.PackageFilter{
+				{Name: "foo", MinVersion: "1.5.0", MaxVersion: "2.0.0"},
+			}},
+			contents: contents{
+				packages: map[string]string{"foo": "stable", "bar": "stable"},
+				channels: []string{"bar/stable", "foo/stable"},
+				bundles:  []string{"bar.v0.1.0", "foo.v2.0.0"},
+				others:   2,
+			},
+			result: filter.Result{RemovedChannels: 1, RemovedBundles: 2},
+		},
+		{
+			name: "version range removing a package",
+			filter: catalogdv1.CatalogFilter{Packages: []catalogdv1.PackageFilter{
+				{Name: "bar", MinVersion: "1.0.0"},
+				{Name: "qux", Channels: []string{"stable"}},
+			}},
+			contents: contents{
+				packages:     map[string]string{"foo": "beta"},
+				channels:     []string{"foo/beta", "foo/stable"},
+				bundles:      []string{"foo.v1.0.0", "foo.v2.0.0", "foo.v2.1.0"},
+				deprecations: []string{"olm.bundle/foo.v1.0.0", "olm.channel/beta"},
+				others:       1,
+			},
+			result: filter.Result{RemovedPackages: 1, RemovedChannels: 1, RemovedBundles: 1, MissingPackages: []string{"qux"}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys, result, err := filter.Apply(context.Background(), testFS(), tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.result, *result)
+
+			cfg, err := declcfg.LoadFS(context.Background(), fsys)
+			require.NoError(t, err)
+			assert.Equal(t, tt.contents, contentsOf(cfg))
+		})
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		filter   catalogdv1.CatalogFilter
+		terminal bool
+	}{
+		{
+			name: "invalid version",
+			filter: catalogdv1.CatalogFilter{Packages: []catalogdv1.PackageFilter{
+				{Name: "foo", MinVersion: "v1"},
+			}},
+			terminal: true,
+		},
+		{
+			name: "empty version range",
+			filter: catalogdv1.CatalogFilter{Packages: []catalogdv1.PackageFilter{
+				{Name: "foo", MinVersion: "2.0.0", MaxVersion: "1.0.0"},
+			}},
+			terminal: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := filter.Apply(context.Background(), testFS(), tt.filter)
+			require.Error(t, err)
+			assert.Equal(t, tt.terminal, errors.Is(err, reconcile.TerminalError(nil)))
+		})
+	}
+}
@@ -0,0 +1,90 @@
+// Package fsutil provides file systems shared by the transformations applied
+// to catalog contents before they are stored.
+package fsutil
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// fileFS is a read-only file system holding a single file in its root.
+type fileFS struct {
+	name string
+	data []byte
+}
+
+// NewSingleFileFS returns a file system holding a file with the given name and
+// contents in its root.
+func NewSingleFileFS(name string, data []byte) fs.FS {
+	return &fileFS{name: name, data: data}
+}
+
+func (f *fileFS) Open(name string) (fs.File, error) {
+	switch name {
+	case ".":
+		return &openDir{fsys: f}, nil
+	case f.name:
+		return &openFile{info: f.fileInfo(), Reader: bytes.NewReader(f.data)}, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (f *fileFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name != "." {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return []fs.DirEntry{fs.FileInfoToDirEntry(f.fileInfo())}, nil
+}
+
+func (f *fileFS) fileInfo() fileInfo {
+	return fileInfo{name: f.name, size: int64(len(f.data)), mode: 0444}
+}
+
+type fileInfo struct {
+	name string
+	size int64
+	mode fs.FileMode
+}
+
+func (i fileInfo) Name() string       { return i.name }
+func (i fileInfo) Size() int64        { return i.size }
+func (i fileInfo) Mode() fs.FileMode  { return i.mode }
+func (i fileInfo) ModTime() time.Time { return time.Time{} }
+func (i fileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i fileInfo) Sys() any           { return nil }
+
+type openFile struct {
+	info fileInfo
+	*bytes.Reader
+}
+
+func (f *openFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *openFile) Close() error               { return nil }
+
+type openDir struct {
+	fsys *fileFS
+	read bool
+}
+
+func (d *openDir) Stat() (fs.FileInfo, error) {
+	return fileInfo{name: ".", mode: fs.ModeDir | 0555}, nil
+}
+
+func (d *openDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: ".", Err: fs.ErrInvalid}
+}
+
+func (d *openDir) Close() error { return nil }
+
+func (d *openDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.read {
+		if n > 0 {
+			return nil, io.EOF
+		}
+		return nil, nil
+	}
+	d.read = true
+	return d.fsys.ReadDir(".")
+}
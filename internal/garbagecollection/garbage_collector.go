@@ -2,93 +2,499 @@ package garbagecollection
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/tools/cache"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 
 	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+	"github.com/operator-framework/catalogd/internal/metrics"
+	"github.com/operator-framework/catalogd/internal/source"
+	"github.com/operator-framework/catalogd/internal/storage"
 )
 
 var _ manager.Runnable = (*GarbageCollector)(nil)
 
+// CatalogStorage deletes the content stored for catalogs.
+type CatalogStorage interface {
+	Delete(catalog string) error
+}
+
+// namespacedCatalogDepth is the number of elements of the paths of
+// namespaced Catalogs relative to the namespaced directories.
+var namespacedCatalogDepth = len(strings.Split(storage.NamespacedCatalog("namespace", "name"), "/"))
+
 // GarbageCollector is an implementation of the manager.Runnable
 // interface for running garbage collection on the Catalog content
-// cache that is served by the catalogd HTTP server. It runs in a loop
-// and will ensure that no cache entries exist for Catalog resources
-// that no longer exist. This should only clean up cache entries that
-// were missed by the handling of a DELETE event on a Catalog resource.
+// cache that is served by the catalogd HTTP server. It will ensure that
+// no cache entries exist for Catalog resources that no longer exist. This
+// should only clean up cache entries that were missed by the handling of
+// a DELETE event on a Catalog resource.
+//
+// It watches the metadata of ClusterCatalogs, namespaced Catalogs and
+// ClusterCatalogPreviews with informers, and removes the entries of a
+// ClusterCatalog or Catalog as soon as its deletion is observed. Full sweeps
+// of the cache directories compare them with the informers' stores instead
+// of listing the resources, and only run on startup, every Interval and when
+// triggered.
+//
+// Along with the unpack cache in CachePath, it cleans up the stored content
+// in StoragePath, including the temporary files left over by interrupted
+// writes, and the temporary OCI layout directories in TempDir that images
+// are pulled to. The content of namespaced Catalogs, in NamespacedCachePath
+// and NamespacedStoragePath, is laid out as <namespace>/catalogs/<name>, and
+// the directories of namespaces that no longer have Catalogs are removed
+// along with it. The content of ClusterCatalogPreviews, in PreviewCachePath
+// and PreviewStoragePath, is removed once they no longer exist. Stored
+// catalogs are deleted through Storage, NamespacedStorage and PreviewStorage,
+// when set, so that the revisions and search indexes they keep for them are
+// forgotten along with their content. Entries
+// modified less than MinAge ago are never removed, so that the content of
+// catalogs that are being created, and files that are still being written
+// to, are left alone.
+//
+// With DryRun set, stale entries are only logged and counted in the
+// garbage collection metrics, and nothing is removed. A run can be
+// requested at any time with Trigger, instead of waiting for Interval.
 type GarbageCollector struct {
-	CachePath      string
-	Logger         logr.Logger
-	MetadataClient metadata.Interface
-	Interval       time.Duration
+	CachePath             string
+	StoragePath           string
+	NamespacedCachePath   string
+	NamespacedStoragePath string
+	PreviewCachePath      string
+	PreviewStoragePath    string
+	Storage               CatalogStorage
+	NamespacedStorage     CatalogStorage
+	PreviewStorage        CatalogStorage
+	TempDir               string
+	MinAge                time.Duration
+	DryRun                bool
+	Logger                logr.Logger
+	MetadataClient        metadata.Interface
+	Interval              time.Duration
+
+	triggerOnce sync.Once
+	trigger     chan struct{}
+
+	// catalogs, namespacedCatalogs and previews hold the metadata of the
+	// existing ClusterCatalogs, Catalogs and ClusterCatalogPreviews. The
+	// latter two are nil when their directories are not garbage collected.
+	catalogs           cache.Store
+	namespacedCatalogs cache.Store
+	previews           cache.Store
+	// mu serializes removals by full sweeps and by deletion events.
+	mu sync.Mutex
 }
 
 // Start will start the garbage collector. It will always run once on startup
 // and loop until context is canceled after an initial garbage collection run.
 // Garbage collection will run again every X amount of time, where X is the
-// supplied garbage collection interval.
+// supplied garbage collection interval, and whenever it is triggered.
 func (gc *GarbageCollector) Start(ctx context.Context) error {
-	// Run once on startup
-	removed, err := runGarbageCollection(ctx, gc.CachePath, gc.MetadataClient)
+	var err error
+	gc.catalogs, err = gc.watch(ctx, "clustercatalogs", func(key string) {
+		gc.handleDelete(gc.catalogs, key, key, cacheDir(gc.CachePath), storageDir(gc.StoragePath, gc.Storage, 1))
+	})
 	if err != nil {
-		gc.Logger.Error(err, "running garbage collection")
+		return err
+	}
+	if gc.NamespacedCachePath != "" || gc.NamespacedStoragePath != "" {
+		gc.namespacedCatalogs, err = gc.watch(ctx, "catalogs", func(key string) {
+			gc.handleDelete(gc.namespacedCatalogs, key, namespacedCatalogPath(key),
+				cacheDir(gc.NamespacedCachePath), storageDir(gc.NamespacedStoragePath, gc.NamespacedStorage, namespacedCatalogDepth))
+		})
+		if err != nil {
+			return err
+		}
 	}
-	if len(removed) > 0 {
-		gc.Logger.Info("removed stale cache entries", "removed entries", removed)
+	if gc.PreviewCachePath != "" || gc.PreviewStoragePath != "" {
+		// The content of a preview is removed by its reconciler once it
+		// is previewed, so deletions are left to it.
+		gc.previews, err = gc.watch(ctx, "clustercatalogpreviews", nil)
+		if err != nil {
+			return err
+		}
 	}
 
+	// Run once on startup
+	gc.run()
+
 	// Loop until context is canceled, running garbage collection
 	// at the configured interval
+	timer := time.NewTimer(gc.Interval)
+	defer timer.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-time.After(gc.Interval):
-			removed, err := runGarbageCollection(ctx, gc.CachePath, gc.MetadataClient)
+		case <-timer.C:
+		case <-gc.triggerChan():
+			gc.Logger.Info("running triggered garbage collection")
+			if !timer.Stop() {
+				<-timer.C
+			}
+		}
+		gc.run()
+		timer.Reset(gc.Interval)
+	}
+}
+
+// watch runs an informer on the metadata of resource until ctx is done,
+// calls deleted, if not nil, with the key of each deleted object, and
+// returns the informer's store once it is synced.
+func (gc *GarbageCollector) watch(ctx context.Context, resource string, deleted func(key string)) (cache.Store, error) {
+	informer := metadatainformer.NewFilteredMetadataInformer(
+		gc.MetadataClient,
+		catalogdv1.GroupVersion.WithResource(resource),
+		metav1.NamespaceAll,
+		0,
+		cache.Indexers{},
+		nil,
+	).Informer()
+	if deleted != nil {
+		if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			DeleteFunc: func(obj interface{}) {
+				key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+				if err != nil {
+					gc.Logger.Error(err, "error getting key of deleted object", "resource", resource)
+					return
+				}
+				deleted(key)
+			},
+		}); err != nil {
+			return nil, fmt.Errorf("error watching %s: %w", resource, err)
+		}
+	}
+	go informer.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return nil, fmt.Errorf("error waiting for %s to sync: %w", resource, ctx.Err())
+	}
+	return informer.GetStore(), nil
+}
+
+// namespacedCatalogPath returns the slash-separated path, relative to the
+// namespaced cache directories, of the Catalog with the given key.
+func namespacedCatalogPath(key string) string {
+	namespace, name, _ := cache.SplitMetaNamespaceKey(key)
+	return storage.NamespacedCatalog(namespace, name)
+}
+
+// Trigger requests a garbage collection run as soon as the current one, if
+// any, ends. Requests made before the run starts are coalesced into it.
+func (gc *GarbageCollector) Trigger() {
+	select {
+	case gc.triggerChan() <- struct{}{}:
+	default:
+	}
+}
+
+func (gc *GarbageCollector) triggerChan() chan struct{} {
+	gc.triggerOnce.Do(func() {
+		gc.trigger = make(chan struct{}, 1)
+	})
+	return gc.trigger
+}
+
+// TriggerHandler returns a handler that triggers a garbage collection run
+// on POST requests and responds with 202 Accepted without waiting for it.
+// It does not authenticate or authorize requests itself.
+func (gc *GarbageCollector) TriggerHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		gc.Trigger()
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// run runs garbage collection once, and logs and records metrics about it.
+func (gc *GarbageCollector) run() {
+	removed, reclaimed, err := gc.runGarbageCollection()
+	metrics.GCLastRunMetric.SetToCurrentTime()
+	if err != nil {
+		gc.Logger.Error(err, "running garbage collection")
+		metrics.GCErrorsMetric.Inc()
+	}
+	gc.report(removed, reclaimed)
+}
+
+// collectedDir is a garbage collected directory, and the function its
+// entries are removed with.
+type collectedDir struct {
+	path   string
+	remove func(path string) error
+}
+
+// cacheDir returns the cache directory dir, whose entries are removed from
+// the disk.
+func cacheDir(dir string) collectedDir {
+	return collectedDir{path: dir, remove: os.RemoveAll}
+}
+
+// storageDir returns the storage directory dir, where the paths of catalogs
+// have depth elements. The catalogs in its entries are deleted through
+// catalogs, if set, before the rest of the entries is removed from the disk.
+func storageDir(dir string, catalogs CatalogStorage, depth int) collectedDir {
+	if catalogs == nil {
+		return cacheDir(dir)
+	}
+	return collectedDir{path: dir, remove: func(entry string) error {
+		err := filepath.WalkDir(entry, func(p string, d fs.DirEntry, err error) error {
 			if err != nil {
-				gc.Logger.Error(err, "running garbage collection")
+				return err
+			}
+			// The names of catalogs can not start with a ".", unlike the
+			// temporary files of interrupted writes.
+			if !d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			catalog := filepath.ToSlash(rel)
+			if len(strings.Split(catalog, "/")) < depth {
+				return nil
 			}
-			if len(removed) > 0 {
-				gc.Logger.Info("removed stale cache entries", "removed entries", removed)
+			if err := catalogs.Delete(catalog); err != nil {
+				return fmt.Errorf("error deleting catalog %q: %w", catalog, err)
 			}
+			return filepath.SkipDir
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return os.RemoveAll(entry)
+	}}
+}
+
+// handleDelete removes the entries at catalogPath, a slash-separated path
+// relative to dirs, of the deleted object with the given key, unless an
+// object with the same key has been created in objects since. Unlike full
+// sweeps, it does not wait for the entries to be MinAge old, as nothing
+// writes to them once the object is gone.
+func (gc *GarbageCollector) handleDelete(objects cache.Store, key, catalogPath string, dirs ...collectedDir) {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	if _, exists, _ := objects.GetByKey(key); exists {
+		return
+	}
+
+	var (
+		removed   []string
+		reclaimed int64
+	)
+	parent, name := path.Split(catalogPath)
+	for _, dir := range dirs {
+		if dir.path == "" {
+			continue
+		}
+		parentDir := filepath.Join(dir.path, filepath.FromSlash(parent))
+		if _, err := os.Stat(parentDir); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		r, size, err := gc.removeEntries(parentDir, time.Now(), func(entry os.DirEntry) bool {
+			return entry.Name() == name
+		}, dir.remove)
+		removed = append(removed, r...)
+		reclaimed += size
+		if err != nil {
+			gc.Logger.Error(err, "removing entries of deleted catalog", "catalog", key)
+			metrics.GCErrorsMetric.Inc()
+			break
 		}
 	}
+	gc.report(removed, reclaimed)
 }
 
-func runGarbageCollection(ctx context.Context, cachePath string, metaClient metadata.Interface) ([]string, error) {
-	getter := metaClient.Resource(catalogdv1.GroupVersion.WithResource("clustercatalogs"))
-	metaList, err := getter.List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return nil, fmt.Errorf("error listing clustercatalogs: %w", err)
+// report logs the entries removed by garbage collection and records them
+// in its metrics.
+func (gc *GarbageCollector) report(removed []string, reclaimed int64) {
+	dryRun := strconv.FormatBool(gc.DryRun)
+	metrics.GCRemovedEntriesMetric.WithLabelValues(dryRun).Add(float64(len(removed)))
+	metrics.GCReclaimedBytesMetric.WithLabelValues(dryRun).Add(float64(reclaimed))
+	if len(removed) == 0 {
+		return
+	}
+	if gc.DryRun {
+		gc.Logger.Info("found stale cache entries, not removing them in dry run mode", "stale entries", removed, "bytes", reclaimed)
+		return
+	}
+	gc.Logger.Info("removed stale cache entries", "removed entries", removed, "bytes", reclaimed)
+}
+
+// runGarbageCollection removes the stale entries and returns their paths
+// and the number of bytes they took up. In dry run mode, the stale entries
+// are returned without being removed.
+func (gc *GarbageCollector) runGarbageCollection() ([]string, int64, error) {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	expectedCatalogs := sets.New[string](gc.catalogs.ListKeys()...)
+	expectedNamespacedCatalogs := sets.New[string]()
+	if gc.namespacedCatalogs != nil {
+		for _, key := range gc.namespacedCatalogs.ListKeys() {
+			expectedNamespacedCatalogs.Insert(namespacedCatalogPath(key))
+		}
+	}
+	expectedPreviews := sets.New[string]()
+	if gc.previews != nil {
+		expectedPreviews.Insert(gc.previews.ListKeys()...)
+	}
+
+	cutoff := time.Now().Add(-gc.MinAge)
+	removed := []string{}
+	var reclaimed int64
+	for _, root := range []struct {
+		dir      collectedDir
+		expected sets.Set[string]
+	}{
+		{cacheDir(gc.CachePath), expectedCatalogs},
+		{storageDir(gc.StoragePath, gc.Storage, 1), expectedCatalogs},
+		{cacheDir(gc.NamespacedCachePath), expectedNamespacedCatalogs},
+		{storageDir(gc.NamespacedStoragePath, gc.NamespacedStorage, namespacedCatalogDepth), expectedNamespacedCatalogs},
+		{cacheDir(gc.PreviewCachePath), expectedPreviews},
+		{storageDir(gc.PreviewStoragePath, gc.PreviewStorage, 1), expectedPreviews},
+	} {
+		if root.dir.path == "" {
+			continue
+		}
+		r, size, err := gc.removeStaleEntries(root.dir, cutoff, root.expected)
+		removed = append(removed, r...)
+		reclaimed += size
+		if err != nil {
+			return removed, reclaimed, err
+		}
+	}
+	if gc.TempDir != "" {
+		r, size, err := gc.removeEntries(gc.TempDir, cutoff, func(entry os.DirEntry) bool {
+			return entry.IsDir() && strings.HasPrefix(entry.Name(), source.OCILayoutTempDirPrefix)
+		}, os.RemoveAll)
+		removed = append(removed, r...)
+		reclaimed += size
+		if err != nil {
+			return removed, reclaimed, err
+		}
+	}
+	return removed, reclaimed, nil
+}
+
+// removeStaleEntries removes the entries below dir that are neither the
+// directory of an expected catalog, given as a slash-separated path relative
+// to dir, nor a directory that contains one, such as the directory of a
+// namespace. Anything else is stale, such as the temporary files of
+// interrupted writes, whose names start with a "." that the names of
+// catalogs can not.
+func (gc *GarbageCollector) removeStaleEntries(dir collectedDir, cutoff time.Time, expected sets.Set[string]) ([]string, int64, error) {
+	parents := sets.New[string]()
+	for catalogPath := range expected {
+		for p := path.Dir(catalogPath); p != "."; p = path.Dir(p) {
+			parents.Insert(p)
+		}
 	}
 
-	expectedCatalogs := sets.New[string]()
-	for _, meta := range metaList.Items {
-		expectedCatalogs.Insert(meta.GetName())
+	removed := []string{}
+	var reclaimed int64
+	pending := []string{"."}
+	for len(pending) > 0 {
+		rel := pending[0]
+		pending = pending[1:]
+		r, size, err := gc.removeEntries(filepath.Join(dir.path, filepath.FromSlash(rel)), cutoff, func(entry os.DirEntry) bool {
+			p := path.Join(rel, entry.Name())
+			if !entry.IsDir() {
+				return true
+			}
+			if parents.Has(p) {
+				pending = append(pending, p)
+				return false
+			}
+			return !expected.Has(p)
+		}, dir.remove)
+		removed = append(removed, r...)
+		reclaimed += size
+		if err != nil {
+			return removed, reclaimed, err
+		}
 	}
+	return removed, reclaimed, nil
+}
 
-	cacheDirEntries, err := os.ReadDir(cachePath)
+// removeEntries removes the entries of dir that are stale and were last
+// modified before cutoff with remove, and returns their paths and the number
+// of bytes they took up.
+func (gc *GarbageCollector) removeEntries(dir string, cutoff time.Time, stale func(os.DirEntry) bool, remove func(path string) error) ([]string, int64, error) {
+	entries, err := os.ReadDir(dir)
 	if err != nil {
-		return nil, fmt.Errorf("error reading cache directory: %w", err)
+		return nil, 0, fmt.Errorf("error reading directory %q: %w", dir, err)
 	}
 	removed := []string{}
-	for _, cacheDirEntry := range cacheDirEntries {
-		if cacheDirEntry.IsDir() && expectedCatalogs.Has(cacheDirEntry.Name()) {
+	var reclaimed int64
+	for _, entry := range entries {
+		if !stale(entry) {
 			continue
 		}
-		if err := os.RemoveAll(filepath.Join(cachePath, cacheDirEntry.Name())); err != nil {
-			return nil, fmt.Errorf("error removing cache directory entry %q: %w  ", cacheDirEntry.Name(), err)
+		path := filepath.Join(dir, entry.Name())
+		modTime, size, err := stat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
 		}
-
-		removed = append(removed, cacheDirEntry.Name())
+		if err != nil {
+			return removed, reclaimed, fmt.Errorf("error reading directory entry %q: %w", path, err)
+		}
+		if modTime.After(cutoff) {
+			continue
+		}
+		if !gc.DryRun {
+			if err := remove(path); err != nil {
+				return removed, reclaimed, fmt.Errorf("error removing directory entry %q: %w", path, err)
+			}
+		}
+		removed = append(removed, path)
+		reclaimed += size
 	}
-	return removed, nil
+	return removed, reclaimed, nil
+}
+
+// stat returns the time path, or anything in it if it is a directory, was
+// last modified, and the total size of the files in it. A directory that is
+// still being written to can have been created long ago.
+func stat(path string) (time.Time, int64, error) {
+	var (
+		latest time.Time
+		size   int64
+	)
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return latest, size, err
 }
@@ -2,19 +2,46 @@ package garbagecollection
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/metadata/fake"
+	"k8s.io/client-go/tools/cache"
 
 	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
 )
 
+// fakeStorage records the catalogs deleted through it, and removes their
+// directories.
+type fakeStorage struct {
+	rootDir string
+
+	mu      sync.Mutex
+	deleted []string
+}
+
+func (f *fakeStorage) Delete(catalog string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deleted = append(f.deleted, catalog)
+	return os.RemoveAll(filepath.Join(f.rootDir, filepath.FromSlash(catalog)))
+}
+
+func (f *fakeStorage) Deleted() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.deleted...)
+}
+
 func TestRunGarbageCollection(t *testing.T) {
 	for _, tt := range []struct {
 		name             string
@@ -58,24 +85,19 @@ func TestRunGarbageCollection(t *testing.T) {
 		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
-			ctx := context.Background()
 			cachePath := t.TempDir()
-			scheme := runtime.NewScheme()
-			require.NoError(t, metav1.AddMetaToScheme(scheme))
-
 			allCatalogs := append(tt.existCatalogs, tt.notExistCatalogs...)
 			for _, catalog := range allCatalogs {
 				require.NoError(t, os.MkdirAll(filepath.Join(cachePath, catalog.Name, "fakedigest"), os.ModePerm))
 			}
 
-			runtimeObjs := []runtime.Object{}
+			catalogs := cache.NewStore(cache.MetaNamespaceKeyFunc)
 			for _, catalog := range tt.existCatalogs {
-				runtimeObjs = append(runtimeObjs, catalog)
+				require.NoError(t, catalogs.Add(catalog))
 			}
 
-			metaClient := fake.NewSimpleMetadataClient(scheme, runtimeObjs...)
-
-			_, err := runGarbageCollection(ctx, cachePath, metaClient)
+			gc := &GarbageCollector{CachePath: cachePath, catalogs: catalogs}
+			_, _, err := gc.runGarbageCollection()
 			if !tt.wantErr {
 				assert.NoError(t, err)
 				entries, err := os.ReadDir(cachePath)
@@ -94,3 +116,221 @@ func TestRunGarbageCollection(t *testing.T) {
 		})
 	}
 }
+
+func TestRunGarbageCollectionStorageAndTempDir(t *testing.T) {
+	catalogs := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	require.NoError(t, catalogs.Add(&metav1.PartialObjectMetadata{
+		TypeMeta:   metav1.TypeMeta{Kind: "ClusterCatalog", APIVersion: catalogdv1.GroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{Name: "one"},
+	}))
+
+	cachePath, storagePath, tempDir := t.TempDir(), t.TempDir(), t.TempDir()
+	old := time.Now().Add(-2 * time.Hour)
+	create := func(path string, dir bool, modTime time.Time) {
+		if dir {
+			require.NoError(t, os.MkdirAll(filepath.Join(path, "content"), os.ModePerm))
+			require.NoError(t, os.Chtimes(filepath.Join(path, "content"), modTime, modTime))
+		} else {
+			require.NoError(t, os.WriteFile(path, []byte("partial"), 0600))
+		}
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+	create(filepath.Join(storagePath, "one"), true, old)
+	create(filepath.Join(storagePath, "stale"), true, old)
+	create(filepath.Join(storagePath, "new"), true, time.Now())
+	create(filepath.Join(storagePath, ".one-123"), false, old)
+	create(filepath.Join(storagePath, ".one-456"), false, time.Now())
+	create(filepath.Join(tempDir, "oci-layout-one123"), true, old)
+	create(filepath.Join(tempDir, "oci-layout-two456"), true, time.Now())
+	create(filepath.Join(tempDir, "unrelated"), true, old)
+	// A directory that was created long ago but is still being written to.
+	create(filepath.Join(tempDir, "oci-layout-three789"), true, old)
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "oci-layout-three789", "content", "blob"), []byte("partial"), 0600))
+
+	gc := &GarbageCollector{
+		CachePath:   cachePath,
+		StoragePath: storagePath,
+		TempDir:     tempDir,
+		MinAge:      time.Hour,
+		catalogs:    catalogs,
+	}
+	removed, reclaimed, err := gc.runGarbageCollection()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		filepath.Join(storagePath, "stale"),
+		filepath.Join(storagePath, ".one-123"),
+		filepath.Join(tempDir, "oci-layout-one123"),
+	}, removed)
+	assert.Equal(t, int64(len("partial")), reclaimed)
+
+	for _, path := range []string{
+		filepath.Join(storagePath, "one"),
+		filepath.Join(storagePath, "new"),
+		filepath.Join(storagePath, ".one-456"),
+		filepath.Join(tempDir, "oci-layout-two456"),
+		filepath.Join(tempDir, "oci-layout-three789"),
+		filepath.Join(tempDir, "unrelated"),
+	} {
+		_, err := os.Stat(path)
+		assert.NoError(t, err)
+	}
+}
+
+func TestRunGarbageCollectionNamespacedAndPreviews(t *testing.T) {
+	namespacedCatalogs := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	require.NoError(t, namespacedCatalogs.Add(&metav1.PartialObjectMetadata{
+		TypeMeta:   metav1.TypeMeta{Kind: "Catalog", APIVersion: catalogdv1.GroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "one"},
+	}))
+	previews := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	require.NoError(t, previews.Add(&metav1.PartialObjectMetadata{
+		TypeMeta:   metav1.TypeMeta{Kind: "ClusterCatalogPreview", APIVersion: catalogdv1.GroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{Name: "preview"},
+	}))
+
+	namespacedPath, previewPath := t.TempDir(), t.TempDir()
+	old := time.Now().Add(-2 * time.Hour)
+	for _, dir := range []string{
+		filepath.Join(namespacedPath, "ns1", "catalogs", "one"),
+		filepath.Join(namespacedPath, "ns1", "catalogs", "stale"),
+		filepath.Join(namespacedPath, "ns2", "catalogs", "two"),
+		filepath.Join(previewPath, "preview"),
+		filepath.Join(previewPath, "deleted"),
+	} {
+		require.NoError(t, os.MkdirAll(dir, os.ModePerm))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(namespacedPath, ".ns1-catalogs-one-123"), []byte("partial"), 0600))
+	for _, path := range []string{
+		filepath.Join(namespacedPath, ".ns1-catalogs-one-123"),
+		filepath.Join(namespacedPath, "ns1", "catalogs", "one"),
+		filepath.Join(namespacedPath, "ns1", "catalogs", "stale"),
+		filepath.Join(namespacedPath, "ns2", "catalogs", "two"),
+		filepath.Join(namespacedPath, "ns2", "catalogs"),
+		filepath.Join(namespacedPath, "ns2"),
+		filepath.Join(previewPath, "preview"),
+		filepath.Join(previewPath, "deleted"),
+	} {
+		require.NoError(t, os.Chtimes(path, old, old))
+	}
+
+	namespacedStorage, previewStorage := &fakeStorage{rootDir: namespacedPath}, &fakeStorage{rootDir: previewPath}
+	gc := &GarbageCollector{
+		NamespacedStoragePath: namespacedPath,
+		PreviewStoragePath:    previewPath,
+		NamespacedStorage:     namespacedStorage,
+		PreviewStorage:        previewStorage,
+		MinAge:                time.Hour,
+		catalogs:              cache.NewStore(cache.MetaNamespaceKeyFunc),
+		namespacedCatalogs:    namespacedCatalogs,
+		previews:              previews,
+	}
+	removed, _, err := gc.runGarbageCollection()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		filepath.Join(namespacedPath, ".ns1-catalogs-one-123"),
+		filepath.Join(namespacedPath, "ns1", "catalogs", "stale"),
+		filepath.Join(namespacedPath, "ns2"),
+		filepath.Join(previewPath, "deleted"),
+	}, removed)
+	assert.DirExists(t, filepath.Join(namespacedPath, "ns1", "catalogs", "one"))
+	assert.DirExists(t, filepath.Join(previewPath, "preview"))
+	// Stale catalogs, including those in the directories of namespaces, are
+	// deleted through their storage.
+	assert.ElementsMatch(t, []string{"ns1/catalogs/stale", "ns2/catalogs/two"}, namespacedStorage.Deleted())
+	assert.Equal(t, []string{"deleted"}, previewStorage.Deleted())
+}
+
+func TestRunGarbageCollectionDryRun(t *testing.T) {
+	storagePath := t.TempDir()
+	stale := filepath.Join(storagePath, "stale")
+	require.NoError(t, os.MkdirAll(stale, os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(stale, "catalog.json"), []byte("{}"), 0600))
+
+	gc := &GarbageCollector{StoragePath: storagePath, DryRun: true, catalogs: cache.NewStore(cache.MetaNamespaceKeyFunc)}
+	removed, reclaimed, err := gc.runGarbageCollection()
+	require.NoError(t, err)
+	assert.Equal(t, []string{stale}, removed)
+	assert.Equal(t, int64(2), reclaimed)
+	assert.DirExists(t, stale)
+}
+
+func TestTriggerHandler(t *testing.T) {
+	gc := &GarbageCollector{}
+	handler := gc.TriggerHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/gc", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Empty(t, gc.triggerChan())
+
+	for range 2 {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/gc", nil))
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+	}
+	// Both requests are coalesced into a single run.
+	assert.Len(t, gc.triggerChan(), 1)
+}
+
+func TestStartRemovesEntriesOfDeletedCatalogs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	scheme := runtime.NewScheme()
+	require.NoError(t, metav1.AddMetaToScheme(scheme))
+	gvr := catalogdv1.GroupVersion.WithResource("clustercatalogs")
+	metaClient := fake.NewSimpleMetadataClient(scheme, &metav1.PartialObjectMetadata{
+		TypeMeta:   metav1.TypeMeta{Kind: "ClusterCatalog", APIVersion: catalogdv1.GroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{Name: "one"},
+	}, &metav1.PartialObjectMetadata{
+		TypeMeta:   metav1.TypeMeta{Kind: "Catalog", APIVersion: catalogdv1.GroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "one"},
+	})
+
+	storagePath := t.TempDir()
+	old := time.Now().Add(-2 * time.Hour)
+	for _, name := range []string{"one", "stale"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(storagePath, name), os.ModePerm))
+	}
+	require.NoError(t, os.Chtimes(filepath.Join(storagePath, "stale"), old, old))
+	namespacedStoragePath := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(namespacedStoragePath, "ns", "catalogs", "one"), os.ModePerm))
+
+	catalogStorage, namespacedStorage := &fakeStorage{rootDir: storagePath}, &fakeStorage{rootDir: namespacedStoragePath}
+	gc := &GarbageCollector{
+		StoragePath:           storagePath,
+		NamespacedStoragePath: namespacedStoragePath,
+		Storage:               catalogStorage,
+		NamespacedStorage:     namespacedStorage,
+		MinAge:                time.Hour,
+		MetadataClient:        metaClient,
+		Interval:              time.Hour,
+	}
+	go func() { _ = gc.Start(ctx) }()
+
+	// The startup sweep removes the entries of catalogs that do not exist.
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(storagePath, "stale"))
+		return os.IsNotExist(err)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.DirExists(t, filepath.Join(storagePath, "one"))
+
+	// The entries of a deleted catalog are removed without waiting for a
+	// sweep, however recently they were modified.
+	require.NoError(t, metaClient.Resource(gvr).Delete(ctx, "one", metav1.DeleteOptions{}))
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(storagePath, "one"))
+		return os.IsNotExist(err)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// So are those of a deleted namespaced catalog.
+	require.NoError(t, metaClient.Resource(catalogdv1.GroupVersion.WithResource("catalogs")).Namespace("ns").Delete(ctx, "one", metav1.DeleteOptions{}))
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(namespacedStoragePath, "ns", "catalogs", "one"))
+		return os.IsNotExist(err)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Stored catalogs are deleted through their storage, so that it stops
+	// serving them.
+	assert.Equal(t, []string{"stale", "one"}, catalogStorage.Deleted())
+	assert.Equal(t, []string{"ns/catalogs/one"}, namespacedStorage.Deleted())
+}
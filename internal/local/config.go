@@ -0,0 +1,108 @@
+// Package local runs the source and storage stack of catalogd without
+// Kubernetes, for development and CI. Catalogs are defined in a file instead
+// of by ClusterCatalogs, and are unpacked, patched, filtered and stored in the
+// same way.
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+
+	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+)
+
+// Config is the list of catalogs to serve.
+type Config struct {
+	Catalogs []Catalog `json:"catalogs"`
+}
+
+// Catalog is the definition of a catalog to serve.
+type Catalog struct {
+	// Name is the name the catalog is served under.
+	Name string `json:"name"`
+	// Directory, if set, is a directory holding the content of the catalog,
+	// which is used instead of spec.source. Relative paths are relative to
+	// the directory of the config file.
+	Directory string `json:"directory,omitempty"`
+	// Spec is the spec of the catalog, as in a ClusterCatalog.
+	Spec catalogdv1.ClusterCatalogSpec `json:"spec"`
+}
+
+// LoadConfig reads and validates the Config in the file at path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("error parsing %q: %w", path, err)
+	}
+	for i := range cfg.Catalogs {
+		if dir := cfg.Catalogs[i].Directory; dir != "" && !filepath.IsAbs(dir) {
+			cfg.Catalogs[i].Directory = filepath.Join(filepath.Dir(path), dir)
+		}
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %q: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Priorities maps the name of each catalog that is served to its priority, for
+// searching the content of all of them.
+func (cfg *Config) Priorities(context.Context) (map[string]int32, error) {
+	priorities := map[string]int32{}
+	for _, c := range cfg.Catalogs {
+		if c.Spec.AvailabilityMode != catalogdv1.AvailabilityModeUnavailable {
+			priorities[c.Name] = c.Spec.Priority
+		}
+	}
+	return priorities, nil
+}
+
+// CatalogSource returns the source of the catalog with the given name, or nil
+// if there is no such catalog or its content is read from a directory.
+func (cfg *Config) CatalogSource(_ context.Context, name string) (*catalogdv1.CatalogSource, error) {
+	for _, c := range cfg.Catalogs {
+		if c.Name == name && c.Directory == "" {
+			return &c.Spec.Source, nil
+		}
+	}
+	return nil, nil
+}
+
+func (cfg *Config) validate() error {
+	var errs []error
+	names := sets.New[string]()
+	for i, c := range cfg.Catalogs {
+		if msgs := validation.IsDNS1123Subdomain(c.Name); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("catalogs[%d].name %q is invalid: %v", i, c.Name, msgs))
+		}
+		if names.Has(c.Name) {
+			errs = append(errs, fmt.Errorf("catalogs[%d].name %q is defined more than once", i, c.Name))
+		}
+		names.Insert(c.Name)
+
+		src := c.Spec.Source
+		switch {
+		case c.Directory != "" && src.Type != "":
+			errs = append(errs, fmt.Errorf("catalogs[%d]: only one of directory and spec.source may be set", i))
+		case c.Directory != "":
+		case src.Type == catalogdv1.SourceTypeImage && src.Image == nil:
+			errs = append(errs, fmt.Errorf("catalogs[%d]: spec.source.image is required when spec.source.type is %q", i, src.Type))
+		case src.Type == catalogdv1.SourceTypeComposite && (src.Composite == nil || len(src.Composite.Members) == 0):
+			errs = append(errs, fmt.Errorf("catalogs[%d]: spec.source.composite.members is required when spec.source.type is %q", i, src.Type))
+		case src.Type != catalogdv1.SourceTypeImage && src.Type != catalogdv1.SourceTypeComposite:
+			errs = append(errs, fmt.Errorf("catalogs[%d]: one of directory and spec.source must be set", i))
+		}
+	}
+	return errors.Join(errs...)
+}
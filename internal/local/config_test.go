@@ -0,0 +1,124 @@
+package local
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+)
+
+func TestLoadConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		config        string
+		expectedError string
+	}{
+		{
+			name: "image, composite and directory catalogs",
+			config: `catalogs:
+- name: operatorhubio
+  spec:
+    source:
+      type: Image
+      image:
+        ref: quay.io/operatorhubio/catalog:latest
+        pollIntervalMinutes: 10
+- name: dev
+  directory: dev-catalog
+  spec:
+    filter:
+      includePackages: [foo]
+- name: merged
+  spec:
+    source:
+      type: Composite
+      composite:
+        members:
+        - type: ClusterCatalog
+          clusterCatalog:
+            name: dev
+        - type: ClusterCatalog
+          clusterCatalog:
+            name: operatorhubio
+`,
+		},
+		{
+			name:          "unknown fields are rejected",
+			config:        "catalogs:\n- name: foo\n  directory: foo\n  sourc: {}\n",
+			expectedError: `unknown field "sourc"`,
+		},
+		{
+			name:          "names must be unique",
+			config:        "catalogs:\n- name: foo\n  directory: foo\n- name: foo\n  directory: bar\n",
+			expectedError: `catalogs[1].name "foo" is defined more than once`,
+		},
+		{
+			name:          "names must be valid",
+			config:        "catalogs:\n- name: Foo_Bar\n  directory: foo\n",
+			expectedError: `catalogs[0].name "Foo_Bar" is invalid`,
+		},
+		{
+			name:          "a directory or source is required",
+			config:        "catalogs:\n- name: foo\n",
+			expectedError: "catalogs[0]: one of directory and spec.source must be set",
+		},
+		{
+			name:          "a directory and source are exclusive",
+			config:        "catalogs:\n- name: foo\n  directory: foo\n  spec:\n    source:\n      type: Image\n      image:\n        ref: quay.io/foo/bar:latest\n",
+			expectedError: "catalogs[0]: only one of directory and spec.source may be set",
+		},
+		{
+			name:          "image sources require an image",
+			config:        "catalogs:\n- name: foo\n  spec:\n    source:\n      type: Image\n",
+			expectedError: `catalogs[0]: spec.source.image is required when spec.source.type is "Image"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "catalogs.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tc.config), 0600))
+
+			cfg, err := LoadConfig(path)
+			if tc.expectedError != "" {
+				require.ErrorContains(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, cfg.Catalogs, 3)
+			assert.Equal(t, catalogdv1.SourceTypeImage, cfg.Catalogs[0].Spec.Source.Type)
+			// Directories are relative to the config file.
+			assert.Equal(t, filepath.Join(dir, "dev-catalog"), cfg.Catalogs[1].Directory)
+			assert.Equal(t, []string{"foo"}, cfg.Catalogs[1].Spec.Filter.IncludePackages)
+			assert.Len(t, cfg.Catalogs[2].Spec.Source.Composite.Members, 2)
+		})
+	}
+}
+
+func TestConfigPriorities(t *testing.T) {
+	cfg := &Config{Catalogs: []Catalog{
+		{Name: "platform", Spec: catalogdv1.ClusterCatalogSpec{Priority: 100}},
+		{Name: "dev"},
+		{Name: "disabled", Spec: catalogdv1.ClusterCatalogSpec{AvailabilityMode: catalogdv1.AvailabilityModeUnavailable}},
+	}}
+	priorities, err := cfg.Priorities(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int32{"platform": 100, "dev": 0}, priorities)
+}
+
+func TestConfigCatalogSource(t *testing.T) {
+	image := catalogdv1.CatalogSource{Type: catalogdv1.SourceTypeImage, Image: &catalogdv1.ImageSource{Ref: "registry.example.com/catalog:latest"}}
+	cfg := &Config{Catalogs: []Catalog{
+		{Name: "image", Spec: catalogdv1.ClusterCatalogSpec{Source: image}},
+		{Name: "dev", Directory: "/catalogs/dev"},
+	}}
+	for name, want := range map[string]*catalogdv1.CatalogSource{"image": &image, "dev": nil, "missing": nil} {
+		src, err := cfg.CatalogSource(context.Background(), name)
+		require.NoError(t, err)
+		assert.Equal(t, want, src, name)
+	}
+}
@@ -0,0 +1,198 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+	"github.com/operator-framework/catalogd/internal/filter"
+	"github.com/operator-framework/catalogd/internal/patch"
+	"github.com/operator-framework/catalogd/internal/source"
+	"github.com/operator-framework/catalogd/internal/storage"
+)
+
+// pollJitterMaxFactor matches the jitter the ClusterCatalog controller adds
+// to poll intervals.
+const pollJitterMaxFactor = 0.01
+
+// Runner keeps the content of Catalogs in Storage up to date.
+//
+// Each catalog is unpacked, patched, filtered and stored once, and again on
+// the poll interval of its image source. Directories are read again every
+// DirectoryPollInterval, and only produce a new revision when their content
+// changed. Composite catalogs are merged again as soon as the content stored
+// for one of their ClusterCatalog members changes, which is checked every
+// DirectoryPollInterval. Failures are retried every RetryInterval, unless
+// retrying can not resolve them.
+type Runner struct {
+	Catalogs              []Catalog
+	Unpacker              source.Unpacker
+	Storage               storage.Instance
+	DirectoryPollInterval time.Duration
+	RetryInterval         time.Duration
+}
+
+// Run polls the catalogs until ctx is done.
+func (r *Runner) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, c := range r.Catalogs {
+		if c.Spec.AvailabilityMode == catalogdv1.AvailabilityModeUnavailable {
+			log.FromContext(ctx).Info("not serving catalog, its availability mode is Unavailable", "catalog", c.Name)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.poll(log.IntoContext(ctx, log.FromContext(ctx).WithValues("catalog", c.Name)), c)
+		}()
+	}
+	wg.Wait()
+}
+
+func (r *Runner) poll(ctx context.Context, c Catalog) {
+	l := log.FromContext(ctx)
+	for {
+		// The digests of the members are read before syncing, so that
+		// content stored for them while syncing is merged once more.
+		members := r.memberDigests(c)
+		next, err := r.syncAndSchedule(ctx, c)
+		if err != nil {
+			if errors.Is(err, reconcile.TerminalError(nil)) {
+				l.Error(err, "error syncing catalog, not retrying")
+				return
+			}
+			l.Error(err, "error syncing catalog, retrying", "after", r.RetryInterval)
+			next = r.RetryInterval
+		}
+		if !r.wait(ctx, c, members, next) {
+			return
+		}
+	}
+}
+
+// wait waits until c is to be synced again, after next or as soon as the
+// content stored for one of its ClusterCatalog members differs from members.
+// It returns false if ctx is done, or if next is 0 and c has no
+// ClusterCatalog members, as c is then never synced again.
+func (r *Runner) wait(ctx context.Context, c Catalog, members map[string]string, next time.Duration) bool {
+	var timer, ticker <-chan time.Time
+	if next != 0 {
+		timer = time.After(next)
+	}
+	if len(members) > 0 {
+		t := time.NewTicker(r.DirectoryPollInterval)
+		defer t.Stop()
+		ticker = t.C
+	}
+	if timer == nil && ticker == nil {
+		return false
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-timer:
+			return true
+		case <-ticker:
+			if !maps.Equal(members, r.memberDigests(c)) {
+				return true
+			}
+		}
+	}
+}
+
+// memberDigests returns the digests of the content stored for each of the
+// ClusterCatalog members of c, by name. The digest of a member that has no
+// content stored, or whose content can not be read, is empty.
+func (r *Runner) memberDigests(c Catalog) map[string]string {
+	if c.Directory != "" || c.Spec.Source.Type != catalogdv1.SourceTypeComposite || c.Spec.Source.Composite == nil {
+		return nil
+	}
+	digests := map[string]string{}
+	for _, m := range c.Spec.Source.Composite.Members {
+		if m.Type != catalogdv1.CompositeMemberTypeClusterCatalog || m.ClusterCatalog == nil {
+			continue
+		}
+		digests[m.ClusterCatalog.Name] = ""
+		if summary, err := r.Storage.ContentSummary(m.ClusterCatalog.Name); err == nil && summary != nil {
+			digests[m.ClusterCatalog.Name] = summary.Digest
+		}
+	}
+	return digests
+}
+
+// syncAndSchedule syncs c and returns how long to wait before syncing it
+// again, or 0 if it is not polled.
+func (r *Runner) syncAndSchedule(ctx context.Context, c Catalog) (time.Duration, error) {
+	if err := r.sync(ctx, c); err != nil {
+		return 0, err
+	}
+	if c.Directory != "" {
+		return r.DirectoryPollInterval, nil
+	}
+	interval, ok := source.PollInterval(c.Spec.Source)
+	if !ok {
+		return 0, nil
+	}
+	return wait.Jitter(interval, pollJitterMaxFactor), nil
+}
+
+// sync unpacks, patches, filters and stores the content of c.
+func (r *Runner) sync(ctx context.Context, c Catalog) error {
+	var contentFS fs.FS
+	if c.Directory != "" {
+		if _, err := os.Stat(c.Directory); err != nil {
+			return fmt.Errorf("error reading catalog directory: %w", err)
+		}
+		contentFS = os.DirFS(c.Directory)
+	} else {
+		catalog := &catalogdv1.ClusterCatalog{
+			ObjectMeta: metav1.ObjectMeta{Name: c.Name},
+			Spec:       c.Spec,
+		}
+		unpackResult, err := r.Unpacker.Unpack(ctx, catalog)
+		if err != nil {
+			return fmt.Errorf("source catalog content: %w", err)
+		}
+		contentFS = unpackResult.FS
+	}
+
+	var err error
+	if len(c.Spec.Patches) > 0 {
+		if contentFS, _, err = patch.Apply(ctx, contentFS, c.Spec.Patches); err != nil {
+			return fmt.Errorf("error patching catalog content: %w", err)
+		}
+	}
+	if c.Spec.Filter != nil {
+		if contentFS, _, err = filter.Apply(ctx, contentFS, *c.Spec.Filter); err != nil {
+			return fmt.Errorf("error filtering catalog content: %w", err)
+		}
+	}
+	previous, err := r.Storage.ContentSummary(c.Name)
+	if err != nil {
+		return fmt.Errorf("error computing content summary: %w", err)
+	}
+	if err := r.Storage.Store(ctx, c.Name, contentFS); err != nil {
+		return fmt.Errorf("error storing fbc: %w", err)
+	}
+	summary, err := r.Storage.ContentSummary(c.Name)
+	if err != nil {
+		return fmt.Errorf("error computing content summary: %w", err)
+	}
+	if previous == nil || previous.Digest != summary.Digest {
+		log.FromContext(ctx).Info("serving catalog content", "url", r.Storage.BaseURL(c.Name), "digest", summary.Digest,
+			"packages", summary.Packages, "channels", summary.Channels, "bundles", summary.Bundles)
+	}
+	return nil
+}
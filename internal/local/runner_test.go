@@ -0,0 +1,204 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+	"github.com/operator-framework/catalogd/internal/source"
+	"github.com/operator-framework/catalogd/internal/storage"
+)
+
+func packageContent(pkg string) string {
+	return fmt.Sprintf(`{"schema":"olm.package","name":%[1]q,"defaultChannel":"stable"}
+{"schema":"olm.channel","package":%[1]q,"name":"stable","entries":[{"name":"%[1]s.v1.0.0"}]}
+{"schema":"olm.bundle","package":%[1]q,"name":"%[1]s.v1.0.0","image":"registry.example.com/%[1]s:v1.0.0","properties":[{"type":"olm.package","value":{"packageName":%[1]q,"version":"1.0.0"}}]}
+`, pkg)
+}
+
+// mockUnpacker unpacks the same content for every catalog, or fails with err.
+type mockUnpacker struct {
+	content string
+	err     error
+	unpacks atomic.Int32
+}
+
+func (m *mockUnpacker) Unpack(_ context.Context, _ *catalogdv1.ClusterCatalog) (*source.Result, error) {
+	m.unpacks.Add(1)
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &source.Result{
+		ResolvedSource: &catalogdv1.ResolvedCatalogSource{
+			Type:  catalogdv1.SourceTypeImage,
+			Image: &catalogdv1.ResolvedImageSource{Ref: "registry.example.com/catalog@sha256:" + strings.Repeat("0", 64)},
+		},
+		State: source.StateUnpacked,
+		FS:    fstest.MapFS{"catalog.json": &fstest.MapFile{Data: []byte(m.content)}},
+	}, nil
+}
+
+func (m *mockUnpacker) Cleanup(_ context.Context, _ *catalogdv1.ClusterCatalog) error {
+	return nil
+}
+
+func TestRunner(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "catalog.json"), []byte(packageContent("foo")), 0600))
+	store := &storage.LocalDirV1{RootDir: t.TempDir(), RootURL: &url.URL{Scheme: "http", Host: "localhost:8080", Path: "/catalogs/"}}
+	unpacker := &mockUnpacker{content: packageContent("bar") + packageContent("baz")}
+	runner := &Runner{
+		Catalogs: []Catalog{
+			{Name: "dev", Directory: dir},
+			{
+				Name: "image",
+				Spec: catalogdv1.ClusterCatalogSpec{
+					Source: catalogdv1.CatalogSource{
+						Type:  catalogdv1.SourceTypeImage,
+						Image: &catalogdv1.ImageSource{Ref: "registry.example.com/catalog:latest"},
+					},
+					Filter: &catalogdv1.CatalogFilter{IncludePackages: []string{"baz"}},
+				},
+			},
+			{Name: "disabled", Directory: dir, Spec: catalogdv1.ClusterCatalogSpec{AvailabilityMode: catalogdv1.AvailabilityModeUnavailable}},
+		},
+		Unpacker:              unpacker,
+		Storage:               store,
+		DirectoryPollInterval: 10 * time.Millisecond,
+		RetryInterval:         10 * time.Millisecond,
+	}
+	done := make(chan struct{})
+	go func() {
+		runner.Run(ctx)
+		close(done)
+	}()
+
+	packages := func(catalog string) int {
+		summary, err := store.ContentSummary(catalog)
+		require.NoError(t, err)
+		if summary == nil {
+			return 0
+		}
+		return summary.Packages
+	}
+	require.Eventually(t, func() bool { return packages("dev") == 1 && packages("image") == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.False(t, store.ContentExists("disabled"))
+
+	// Directories are read again, and images without a poll interval are
+	// only unpacked once.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "more.json"), []byte(packageContent("qux")), 0600))
+	require.Eventually(t, func() bool { return packages("dev") == 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(1), unpacker.unpacks.Load())
+
+	cancel()
+	<-done
+}
+
+func TestRunnerMergesCompositesAgainWhenMembersChange(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "catalog.json"), []byte(packageContent("foo")), 0600))
+	store := &storage.LocalDirV1{RootDir: t.TempDir(), RootURL: &url.URL{Scheme: "http", Host: "localhost:8080", Path: "/catalogs/"}}
+	unpacker := &mockUnpacker{content: packageContent("bar")}
+	runner := &Runner{
+		Catalogs: []Catalog{
+			{Name: "dev", Directory: dir},
+			{
+				Name: "composite",
+				Spec: catalogdv1.ClusterCatalogSpec{Source: catalogdv1.CatalogSource{
+					Type: catalogdv1.SourceTypeComposite,
+					Composite: &catalogdv1.CompositeSource{Members: []catalogdv1.CompositeMember{
+						{Type: catalogdv1.CompositeMemberTypeImage, Image: &catalogdv1.ImageSource{Ref: "registry.example.com/overlay:latest"}},
+						{Type: catalogdv1.CompositeMemberTypeClusterCatalog, ClusterCatalog: &catalogdv1.ClusterCatalogReference{Name: "dev"}},
+					}},
+				}},
+			},
+		},
+		Unpacker: source.Router{
+			catalogdv1.SourceTypeComposite: &source.Composite{BaseCachePath: t.TempDir(), Images: unpacker, Catalogs: store},
+		},
+		Storage:               store,
+		DirectoryPollInterval: 10 * time.Millisecond,
+		RetryInterval:         10 * time.Millisecond,
+	}
+	done := make(chan struct{})
+	go func() {
+		runner.Run(ctx)
+		close(done)
+	}()
+
+	packages := func() int {
+		summary, err := store.ContentSummary("composite")
+		require.NoError(t, err)
+		if summary == nil {
+			return 0
+		}
+		return summary.Packages
+	}
+	require.Eventually(t, func() bool { return packages() == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	// Changes to the content of the directory member are merged, even
+	// though the image member has no poll interval.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "more.json"), []byte(packageContent("qux")), 0600))
+	require.Eventually(t, func() bool { return packages() == 3 }, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+}
+
+func TestRunnerRetries(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		err             error
+		expectedUnpacks func(int32) bool
+	}{
+		{
+			name:            "errors are retried",
+			err:             errors.New("registry unavailable"),
+			expectedUnpacks: func(n int32) bool { return n > 1 },
+		},
+		{
+			name:            "terminal errors are not retried",
+			err:             reconcile.TerminalError(errors.New("image too large")),
+			expectedUnpacks: func(n int32) bool { return n == 1 },
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			unpacker := &mockUnpacker{err: tc.err}
+			runner := &Runner{
+				Catalogs: []Catalog{{
+					Name: "image",
+					Spec: catalogdv1.ClusterCatalogSpec{Source: catalogdv1.CatalogSource{
+						Type:  catalogdv1.SourceTypeImage,
+						Image: &catalogdv1.ImageSource{Ref: "registry.example.com/catalog:latest"},
+					}},
+				}},
+				Unpacker:      unpacker,
+				Storage:       &storage.LocalDirV1{RootDir: t.TempDir(), RootURL: &url.URL{Path: "/catalogs/"}},
+				RetryInterval: 10 * time.Millisecond,
+			}
+			runner.Run(ctx)
+			assert.True(t, tc.expectedUnpacks(unpacker.unpacks.Load()), "unpacked %d times", unpacker.unpacks.Load())
+		})
+	}
+}
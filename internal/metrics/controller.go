@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	CatalogOperationDurationMetricName = "catalogd_catalog_operation_duration_seconds"
+	UnpackOutcomeMetricName            = "catalogd_catalog_unpack_outcomes_total"
+	PulledBytesMetricName              = "catalogd_catalog_pulled_bytes"
+	StoredBytesMetricName              = "catalogd_catalog_stored_bytes"
+	SecondsSinceLastPollMetricName     = "catalogd_catalog_seconds_since_last_successful_poll"
+
+	// Operation label values of CatalogOperationDurationMetric.
+	OperationResolve = "resolve"
+	OperationPull    = "pull"
+	OperationUnpack  = "unpack"
+	OperationStore   = "store"
+)
+
+var (
+	// CatalogOperationDurationMetric measures the steps taken to make the
+	// content of a catalog available: resolving the image reference to a
+	// digest, pulling the image, unpacking its catalog content and storing it
+	// for the catalog server.
+	CatalogOperationDurationMetric = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: CatalogOperationDurationMetricName,
+			Help: "Histogram of catalog resolve, pull, unpack and store durations in seconds",
+			// 100ms up to ~7 minutes, doubling each time.
+			Buckets: prometheus.ExponentialBuckets(0.1, 2, 13),
+		},
+		[]string{"operation"},
+	)
+
+	// UnpackOutcomeMetric counts attempts to unpack and store a catalog by the
+	// reason of the Progressing condition they resulted in.
+	UnpackOutcomeMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: UnpackOutcomeMetricName,
+			Help: "Total number of catalog unpack attempts by outcome",
+		},
+		[]string{"reason"},
+	)
+
+	// PulledBytesMetric and StoredBytesMetric report the size of the most
+	// recently pulled image and stored content of each catalog.
+	PulledBytesMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: PulledBytesMetricName,
+			Help: "Size in bytes of the most recently pulled image of each catalog",
+		},
+		[]string{"catalog"},
+	)
+	StoredBytesMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: StoredBytesMetricName,
+			Help: "Size in bytes of the content stored for each catalog",
+		},
+		[]string{"catalog"},
+	)
+)
+
+// DeleteCatalogMetrics removes the time series of catalog, and of the images
+// of its composite members, from the metrics labeled by catalog, once it is
+// no longer served.
+func DeleteCatalogMetrics(catalog string) {
+	PulledBytesMetric.DeleteLabelValues(catalog)
+	StoredBytesMetric.DeleteLabelValues(catalog)
+	DeleteMemberMetrics(catalog, nil)
+}
+
+// DeleteMemberMetrics removes the time series of PulledBytesMetric of the
+// images of the composite members of catalog, other than those of the
+// members in keep. The images of the members of a composite catalog are
+// pulled as the catalogs <catalog>/members/<index>.
+func DeleteMemberMetrics(catalog string, keep sets.Set[string]) {
+	prefix := catalog + "/members/"
+	for _, member := range catalogLabels(PulledBytesMetric) {
+		if strings.HasPrefix(member, prefix) && !keep.Has(member) {
+			PulledBytesMetric.DeleteLabelValues(member)
+		}
+	}
+}
+
+// catalogLabels returns the values of the catalog label of the time series
+// of vec.
+func catalogLabels(vec *prometheus.GaugeVec) []string {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		vec.Collect(ch)
+		close(ch)
+	}()
+	var catalogs []string
+	for m := range ch {
+		var metric dto.Metric
+		if err := m.Write(&metric); err != nil {
+			continue
+		}
+		for _, label := range metric.GetLabel() {
+			if label.GetName() == "catalog" {
+				catalogs = append(catalogs, label.GetValue())
+			}
+		}
+	}
+	return catalogs
+}
+
+var secondsSinceLastPollDesc = prometheus.NewDesc(
+	SecondsSinceLastPollMetricName,
+	"Number of seconds since the source of each catalog was last polled successfully",
+	[]string{"catalog"}, nil,
+)
+
+// lastSuccessfulPollCollector computes the time since the last successful poll
+// of each catalog when it is scraped, so that the value keeps growing while
+// polls are failing.
+type lastSuccessfulPollCollector struct {
+	lastPolls func() map[string]time.Time
+}
+
+// NewLastSuccessfulPollCollector returns a collector reporting the number of
+// seconds since each catalog was last polled successfully. lastPolls is called
+// on every scrape and must return the time of the last successful poll of
+// each catalog.
+func NewLastSuccessfulPollCollector(lastPolls func() map[string]time.Time) prometheus.Collector {
+	return &lastSuccessfulPollCollector{lastPolls: lastPolls}
+}
+
+func (c *lastSuccessfulPollCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- secondsSinceLastPollDesc
+}
+
+func (c *lastSuccessfulPollCollector) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+	for catalog, lastPoll := range c.lastPolls() {
+		ch <- prometheus.MustNewConstMetric(secondsSinceLastPollDesc, prometheus.GaugeValue, now.Sub(lastPoll).Seconds(), catalog)
+	}
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	GCRemovedEntriesMetricName = "catalogd_gc_removed_entries_total"
+	GCReclaimedBytesMetricName = "catalogd_gc_reclaimed_bytes_total"
+	GCErrorsMetricName         = "catalogd_gc_errors_total"
+	GCLastRunMetricName        = "catalogd_gc_last_run_timestamp_seconds"
+)
+
+var (
+	// GCRemovedEntriesMetric and GCReclaimedBytesMetric count the stale
+	// entries garbage collection found and the bytes they took up. Entries
+	// found by a dry run are counted with dry_run="true", as they are
+	// reported but not removed.
+	GCRemovedEntriesMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: GCRemovedEntriesMetricName,
+			Help: "Total number of stale cache, storage and temporary entries removed by garbage collection",
+		},
+		[]string{"dry_run"},
+	)
+	GCReclaimedBytesMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: GCReclaimedBytesMetricName,
+			Help: "Total number of bytes reclaimed by garbage collection",
+		},
+		[]string{"dry_run"},
+	)
+
+	// GCErrorsMetric counts the garbage collection runs that failed.
+	GCErrorsMetric = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: GCErrorsMetricName,
+			Help: "Total number of garbage collection runs that failed",
+		},
+	)
+
+	// GCLastRunMetric is the time the last garbage collection run ended,
+	// whether it succeeded or not.
+	GCLastRunMetric = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: GCLastRunMetricName,
+			Help: "Unix time in seconds at which the last garbage collection run ended",
+		},
+	)
+)
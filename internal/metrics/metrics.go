@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -8,7 +9,18 @@ import (
 )
 
 const (
-	RequestDurationMetricName = "catalogd_http_request_duration_seconds"
+	RequestDurationMetricName  = "catalogd_http_request_duration_seconds"
+	ResponseEncodingMetricName = "catalogd_http_response_encoding_total"
+	RejectedRequestsMetricName = "catalogd_http_rejected_requests_total"
+
+	CatalogRequestsMetricName        = "catalogd_http_catalog_requests_total"
+	CatalogRequestDurationMetricName = "catalogd_http_catalog_request_duration_seconds"
+	CatalogResponseSizeMetricName    = "catalogd_http_catalog_response_size_bytes"
+
+	// UnknownCatalog is the catalog label value used for requests that don't
+	// name a catalog being served, so that arbitrary request paths can't
+	// create new time series.
+	UnknownCatalog = "unknown"
 )
 
 // Sets up the necessary metrics for calculating the Apdex Score
@@ -33,8 +45,87 @@ var (
 		},
 		[]string{"code"},
 	)
+
+	// ResponseEncodingMetric counts catalog content responses by the
+	// Content-Encoding they were served with, so that adoption of the
+	// compressed encodings can be tracked.
+	ResponseEncodingMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: ResponseEncodingMetricName,
+			Help: "Total number of catalog content responses by content encoding",
+		},
+		[]string{"encoding"},
+	)
+
+	// RejectedRequestsMetric counts requests to the catalog server that were
+	// turned away with 429 Too Many Requests, by the limit that was hit.
+	RejectedRequestsMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: RejectedRequestsMetricName,
+			Help: "Total number of catalog server requests rejected by rate or concurrency limits",
+		},
+		[]string{"reason"},
+	)
+
+	// CatalogRequestsMetric, CatalogRequestDurationMetric and
+	// CatalogResponseSizeMetric break catalog server requests down by the
+	// catalog and the endpoint they are for. The sum of
+	// CatalogResponseSizeMetric is the number of bytes sent.
+	CatalogRequestsMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: CatalogRequestsMetricName,
+			Help: "Total number of catalog server requests by catalog, endpoint and status code",
+		},
+		[]string{"code", "catalog", "endpoint"},
+	)
+	CatalogRequestDurationMetric = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    CatalogRequestDurationMetricName,
+			Help:    "Histogram of catalog server request duration in seconds by catalog and endpoint",
+			Buckets: []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1, 1.2, 1.6, 2, 2.4, 2.8, 3.2, 3.6, 4, 10},
+		},
+		[]string{"catalog", "endpoint"},
+	)
+	CatalogResponseSizeMetric = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: CatalogResponseSizeMetricName,
+			Help: "Histogram of catalog server response size in bytes by catalog and endpoint",
+			// 1KiB up to 1GiB, in steps of 4x.
+			Buckets: prometheus.ExponentialBuckets(1024, 4, 11),
+		},
+		[]string{"catalog", "endpoint"},
+	)
 )
 
+// CatalogLabels are the catalog and endpoint label values of a request.
+type CatalogLabels struct {
+	Catalog  string
+	Endpoint string
+}
+
+type catalogLabelsKey struct{}
+
+// AddCatalogMetricsToHandler instruments handler with the per-catalog request
+// metrics. labelsFor determines the labels of each request, and must only
+// return a bounded set of values.
+func AddCatalogMetricsToHandler(handler http.Handler, labelsFor func(*http.Request) CatalogLabels) http.Handler {
+	catalogLabel := promhttp.WithLabelFromCtx("catalog", func(ctx context.Context) string {
+		return ctx.Value(catalogLabelsKey{}).(CatalogLabels).Catalog
+	})
+	endpointLabel := promhttp.WithLabelFromCtx("endpoint", func(ctx context.Context) string {
+		return ctx.Value(catalogLabelsKey{}).(CatalogLabels).Endpoint
+	})
+	instrumented := promhttp.InstrumentHandlerCounter(CatalogRequestsMetric,
+		promhttp.InstrumentHandlerDuration(CatalogRequestDurationMetric,
+			promhttp.InstrumentHandlerResponseSize(CatalogResponseSizeMetric, handler, catalogLabel, endpointLabel),
+			catalogLabel, endpointLabel),
+		catalogLabel, endpointLabel)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), catalogLabelsKey{}, labelsFor(r))
+		instrumented.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 func AddMetricsToHandler(handler http.Handler) http.Handler {
 	return promhttp.InstrumentHandlerDuration(RequestDurationMetric, handler)
 }
@@ -0,0 +1,211 @@
+// Package patch modifies the contents of a catalog with the patches of a
+// ClusterCatalog, so that objects of an upstream catalog can be changed
+// without rebuilding it.
+package patch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/opencontainers/go-digest"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+
+	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+	"github.com/operator-framework/catalogd/internal/fsutil"
+)
+
+// catalogFile is the name of the file holding the patched contents in the
+// file system returned by Apply.
+const catalogFile = "catalog.json"
+
+// Result summarizes the changes made to a catalog by its patches.
+type Result struct {
+	// Digest identifies the patches that were applied.
+	Digest string
+	// PatchedObjects is the number of objects that were modified, removed or
+	// added. An object modified by more than one patch is counted once.
+	PatchedObjects int
+	// UnmatchedPatches are the indexes of the patches with a target that did
+	// not select any object.
+	UnmatchedPatches []int
+}
+
+// Apply loads the catalog in fsys, applies patches to its objects in order,
+// and returns a file system holding the patched contents along with a summary
+// of the changes. A terminal error is returned if one of the patches is
+// malformed, since retrying cannot fix it. Otherwise, an error is returned if
+// a patch cannot be applied to an object it selects or if the patched
+// contents are not a valid File-Based Catalog.
+func Apply(ctx context.Context, fsys fs.FS, patches []catalogdv1.CatalogPatch) (fs.FS, *Result, error) {
+	compiled, err := compile(patches)
+	if err != nil {
+		return nil, nil, reconcile.TerminalError(err)
+	}
+	dgst, err := Digest(patches)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var metas []*declcfg.Meta
+	if err := declcfg.WalkMetasFS(ctx, fsys, func(path string, meta *declcfg.Meta, err error) error {
+		if err != nil {
+			return fmt.Errorf("error parsing %q: %w", path, err)
+		}
+		metas = append(metas, meta)
+		return nil
+	}, declcfg.WithConcurrency(1)); err != nil {
+		return nil, nil, fmt.Errorf("error loading catalog to patch: %w", err)
+	}
+
+	result := &Result{Digest: dgst.String()}
+	patched := map[*declcfg.Meta]struct{}{}
+	for i, p := range compiled {
+		matched := false
+		switch p.typ {
+		case catalogdv1.PatchTypeJSONPatch:
+			for j, m := range metas {
+				if !p.target.matches(m) {
+					continue
+				}
+				matched = true
+				pm, err := p.apply(m)
+				if err != nil {
+					return nil, nil, fmt.Errorf("error applying patch %d to %s: %w", i, describe(m), err)
+				}
+				delete(patched, m)
+				patched[pm] = struct{}{}
+				metas[j] = pm
+			}
+		case catalogdv1.PatchTypeRemove:
+			metas = slices.DeleteFunc(metas, func(m *declcfg.Meta) bool {
+				if !p.target.matches(m) {
+					return false
+				}
+				matched = true
+				delete(patched, m)
+				result.PatchedObjects++
+				return true
+			})
+		case catalogdv1.PatchTypeAdd:
+			matched = true
+			metas = append(metas, p.object)
+			patched[p.object] = struct{}{}
+		}
+		if !matched {
+			result.UnmatchedPatches = append(result.UnmatchedPatches, i)
+		}
+	}
+	result.PatchedObjects += len(patched)
+
+	cfg, err := declcfg.LoadSlice(metas)
+	if err != nil {
+		return nil, nil, fmt.Errorf("patched catalog is invalid: %w", err)
+	}
+	if _, err := declcfg.ConvertToModel(*cfg); err != nil {
+		return nil, nil, fmt.Errorf("patched catalog is invalid: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := declcfg.WriteJSON(*cfg, &buf); err != nil {
+		return nil, nil, fmt.Errorf("error writing patched catalog: %w", err)
+	}
+	return fsutil.NewSingleFileFS(catalogFile, buf.Bytes()), result, nil
+}
+
+// Digest returns the digest identifying patches.
+func Digest(patches []catalogdv1.CatalogPatch) (digest.Digest, error) {
+	data, err := json.Marshal(patches)
+	if err != nil {
+		return "", fmt.Errorf("error computing patch digest: %w", err)
+	}
+	return digest.FromBytes(data), nil
+}
+
+type patch struct {
+	typ       catalogdv1.PatchType
+	target    target
+	jsonPatch jsonpatch.Patch
+	object    *declcfg.Meta
+}
+
+type target struct {
+	schema, pkg, name string
+}
+
+// matches returns true if m is selected by t. The package of an olm.package
+// object is its own name.
+func (t target) matches(m *declcfg.Meta) bool {
+	pkg := m.Package
+	if m.Schema == declcfg.SchemaPackage {
+		pkg = m.Name
+	}
+	return m.Schema == t.schema &&
+		(t.pkg == "" || t.pkg == pkg) &&
+		(t.name == "" || t.name == m.Name)
+}
+
+func (p patch) apply(m *declcfg.Meta) (*declcfg.Meta, error) {
+	blob, err := p.jsonPatch.Apply(m.Blob)
+	if err != nil {
+		return nil, err
+	}
+	var out declcfg.Meta
+	if err := json.Unmarshal(blob, &out); err != nil {
+		return nil, err
+	}
+	if out.Schema == "" {
+		return nil, errors.New("patched object has no schema")
+	}
+	return &out, nil
+}
+
+func compile(patches []catalogdv1.CatalogPatch) ([]patch, error) {
+	compiled := make([]patch, 0, len(patches))
+	for i, p := range patches {
+		c := patch{typ: p.Type}
+		if p.Target != nil {
+			c.target = target{schema: p.Target.Schema, pkg: p.Target.Package, name: p.Target.Name}
+		}
+		switch p.Type {
+		case catalogdv1.PatchTypeJSONPatch:
+			ops, err := json.Marshal(p.JSONPatch)
+			if err != nil {
+				return nil, fmt.Errorf("invalid patch %d: %w", i, err)
+			}
+			if c.jsonPatch, err = jsonpatch.DecodePatch(ops); err != nil {
+				return nil, fmt.Errorf("invalid patch %d: %w", i, err)
+			}
+		case catalogdv1.PatchTypeRemove:
+		case catalogdv1.PatchTypeAdd:
+			if p.Object == nil {
+				return nil, fmt.Errorf("invalid patch %d: object is required", i)
+			}
+			var obj declcfg.Meta
+			if err := json.Unmarshal(p.Object.Raw, &obj); err != nil {
+				return nil, fmt.Errorf("invalid patch %d: invalid object: %w", i, err)
+			}
+			if obj.Schema == "" {
+				return nil, fmt.Errorf("invalid patch %d: object has no schema", i)
+			}
+			c.object = &obj
+		default:
+			return nil, fmt.Errorf("invalid patch %d: unknown type %q", i, p.Type)
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+func describe(m *declcfg.Meta) string {
+	if m.Package != "" {
+		return fmt.Sprintf("%s %q of package %q", m.Schema, m.Name, m.Package)
+	}
+	return fmt.Sprintf("%s %q", m.Schema, m.Name)
+}
@@ -0,0 +1,236 @@
+package patch_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+
+	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+	"github.com/operator-framework/catalogd/internal/patch"
+)
+
+const testCatalog = `---
+schema: olm.package
+name: foo
+defaultChannel: stable
+---
+schema: olm.channel
+package: foo
+name: stable
+entries:
+- name: foo.v1.0.0
+- name: foo.v2.0.0
+  replaces: foo.v1.0.0
+---
+schema: olm.channel
+package: foo
+name: beta
+entries:
+- name: foo.v2.1.0
+---
+schema: olm.bundle
+package: foo
+name: foo.v1.0.0
+image: example.com/foo:v1.0.0
+properties:
+- type: olm.package
+  value:
+    packageName: foo
+    version: 1.0.0
+---
+schema: olm.bundle
+package: foo
+name: foo.v2.0.0
+image: example.com/foo:v2.0.0
+properties:
+- type: olm.package
+  value:
+    packageName: foo
+    version: 2.0.0
+---
+schema: olm.bundle
+package: foo
+name: foo.v2.1.0
+image: example.com/foo:v2.1.0
+properties:
+- type: olm.package
+  value:
+    packageName: foo
+    version: 2.1.0
+`
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{"catalog.yaml": &fstest.MapFile{Data: []byte(testCatalog)}}
+}
+
+func jsonValue(s string) *apiextensionsv1.JSON {
+	return &apiextensionsv1.JSON{Raw: []byte(s)}
+}
+
+func TestApply(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		patches []catalogdv1.CatalogPatch
+		assert  func(*testing.T, *declcfg.DeclarativeConfig)
+		result  patch.Result
+	}{
+		{
+			name: "deprecate a bundle",
+			patches: []catalogdv1.CatalogPatch{{
+				Type:   catalogdv1.PatchTypeAdd,
+				Object: jsonValue(`{"schema":"olm.deprecations","package":"foo","entries":[{"reference":{"schema":"olm.bundle","name":"foo.v1.0.0"},"message":"upgrade to foo.v2.0.0"}]}`),
+			}},
+			assert: func(t *testing.T, cfg *declcfg.DeclarativeConfig) {
+				require.Len(t, cfg.Deprecations, 1)
+				assert.Equal(t, "upgrade to foo.v2.0.0", cfg.Deprecations[0].Entries[0].Message)
+			},
+			result: patch.Result{PatchedObjects: 1},
+		},
+		{
+			name: "remove a channel and its bundle",
+			patches: []catalogdv1.CatalogPatch{
+				{
+					Type:   catalogdv1.PatchTypeRemove,
+					Target: &catalogdv1.PatchTarget{Schema: "olm.channel", Package: "foo", Name: "beta"},
+				},
+				{
+					Type:   catalogdv1.PatchTypeRemove,
+					Target: &catalogdv1.PatchTarget{Schema: "olm.bundle", Name: "foo.v2.1.0"},
+				},
+			},
+			assert: func(t *testing.T, cfg *declcfg.DeclarativeConfig) {
+				assert.Len(t, cfg.Channels, 1)
+				assert.Len(t, cfg.Bundles, 2)
+			},
+			result: patch.Result{PatchedObjects: 2},
+		},
+		{
+			name: "json patch of a package selected by its name",
+			patches: []catalogdv1.CatalogPatch{{
+				Type:      catalogdv1.PatchTypeJSONPatch,
+				Target:    &catalogdv1.PatchTarget{Schema: "olm.package", Package: "foo"},
+				JSONPatch: []catalogdv1.JSONPatchOperation{{Op: "replace", Path: "/defaultChannel", Value: jsonValue(`"beta"`)}},
+			}},
+			assert: func(t *testing.T, cfg *declcfg.DeclarativeConfig) {
+				require.Len(t, cfg.Packages, 1)
+				assert.Equal(t, "beta", cfg.Packages[0].DefaultChannel)
+			},
+			result: patch.Result{PatchedObjects: 1},
+		},
+		{
+			name: "objects patched more than once are counted once",
+			patches: []catalogdv1.CatalogPatch{
+				{
+					Type:      catalogdv1.PatchTypeJSONPatch,
+					Target:    &catalogdv1.PatchTarget{Schema: "olm.bundle", Package: "foo"},
+					JSONPatch: []catalogdv1.JSONPatchOperation{{Op: "replace", Path: "/image", Value: jsonValue(`"mirror.example.com/foo"`)}},
+				},
+				{
+					Type:      catalogdv1.PatchTypeJSONPatch,
+					Target:    &catalogdv1.PatchTarget{Schema: "olm.bundle", Name: "foo.v1.0.0"},
+					JSONPatch: []catalogdv1.JSONPatchOperation{{Op: "replace", Path: "/image", Value: jsonValue(`"mirror.example.com/foo:v1"`)}},
+				},
+			},
+			assert: func(t *testing.T, cfg *declcfg.DeclarativeConfig) {
+				images := map[string]string{}
+				for _, b := range cfg.Bundles {
+					images[b.Name] = b.Image
+				}
+				assert.Equal(t, map[string]string{
+					"foo.v1.0.0": "mirror.example.com/foo:v1",
+					"foo.v2.0.0": "mirror.example.com/foo",
+					"foo.v2.1.0": "mirror.example.com/foo",
+				}, images)
+			},
+			result: patch.Result{PatchedObjects: 3},
+		},
+		{
+			name: "unmatched patch",
+			patches: []catalogdv1.CatalogPatch{
+				{
+					Type:   catalogdv1.PatchTypeRemove,
+					Target: &catalogdv1.PatchTarget{Schema: "olm.bundle", Name: "foo.v2.1.0"},
+				},
+				{
+					Type:   catalogdv1.PatchTypeRemove,
+					Target: &catalogdv1.PatchTarget{Schema: "olm.channel", Package: "bar"},
+				},
+				{
+					Type:   catalogdv1.PatchTypeRemove,
+					Target: &catalogdv1.PatchTarget{Schema: "olm.channel", Name: "beta"},
+				},
+			},
+			assert: func(t *testing.T, cfg *declcfg.DeclarativeConfig) {
+				assert.Len(t, cfg.Channels, 1)
+			},
+			result: patch.Result{PatchedObjects: 2, UnmatchedPatches: []int{1}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys, result, err := patch.Apply(context.Background(), testFS(), tt.patches)
+			require.NoError(t, err)
+			dgst, err := patch.Digest(tt.patches)
+			require.NoError(t, err)
+			tt.result.Digest = dgst.String()
+			assert.Equal(t, tt.result, *result)
+
+			cfg, err := declcfg.LoadFS(context.Background(), fsys)
+			require.NoError(t, err)
+			tt.assert(t, cfg)
+		})
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		patches  []catalogdv1.CatalogPatch
+		terminal bool
+	}{
+		{
+			name: "object without schema",
+			patches: []catalogdv1.CatalogPatch{{
+				Type:   catalogdv1.PatchTypeAdd,
+				Object: jsonValue(`{"name":"foo"}`),
+			}},
+			terminal: true,
+		},
+		{
+			name: "failed test operation",
+			patches: []catalogdv1.CatalogPatch{{
+				Type:      catalogdv1.PatchTypeJSONPatch,
+				Target:    &catalogdv1.PatchTarget{Schema: "olm.package"},
+				JSONPatch: []catalogdv1.JSONPatchOperation{{Op: "test", Path: "/defaultChannel", Value: jsonValue(`"beta"`)}},
+			}},
+		},
+		{
+			name: "removing the schema of an object",
+			patches: []catalogdv1.CatalogPatch{{
+				Type:      catalogdv1.PatchTypeJSONPatch,
+				Target:    &catalogdv1.PatchTarget{Schema: "olm.package"},
+				JSONPatch: []catalogdv1.JSONPatchOperation{{Op: "remove", Path: "/schema"}},
+			}},
+		},
+		{
+			name: "removing a bundle that is still in a channel",
+			patches: []catalogdv1.CatalogPatch{{
+				Type:   catalogdv1.PatchTypeRemove,
+				Target: &catalogdv1.PatchTarget{Schema: "olm.bundle", Name: "foo.v1.0.0"},
+			}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := patch.Apply(context.Background(), testFS(), tt.patches)
+			require.Error(t, err)
+			assert.Equal(t, tt.terminal, errors.Is(err, reconcile.TerminalError(nil)))
+		})
+	}
+}
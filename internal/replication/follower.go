@@ -0,0 +1,238 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+var (
+	_ manager.Runnable               = (*Follower)(nil)
+	_ manager.LeaderElectionRunnable = (*Follower)(nil)
+)
+
+// Follower is a manager.Runnable that keeps the content of Storages in sync
+// with the catalogd instance serving the replication API at LeaderURL. Every
+// Interval, it stores the revisions of catalogs that changed and deletes the
+// catalogs that are gone. A catalog that fails to be replicated is retried on
+// the next sync, without holding back the others.
+//
+// It is ready while it holds the revision of every catalog that the leader
+// last reported, for MaxLag after it last reached the leader, so that
+// replicas that stop being able to sync keep serving for a while but are
+// eventually taken out of rotation.
+type Follower struct {
+	// LeaderURL is the URL of the server serving the replication API, such
+	// as the metrics server of the catalogd instance that unpacks content.
+	LeaderURL *url.URL
+	// Client is used to make requests to LeaderURL.
+	Client *http.Client
+	// TokenFile, if set, is the file of the bearer token requests are
+	// authenticated with. It is read again for every sync, so that rotated
+	// tokens are picked up.
+	TokenFile string
+	// Storages are the storages to keep in sync, keyed by the names the
+	// leader serves them under.
+	Storages map[string]Storage
+	Interval time.Duration
+	MaxLag   time.Duration
+	Logger   logr.Logger
+
+	mu sync.Mutex
+	// lastSync is when the revisions of the leader were last fetched.
+	lastSync time.Time
+	// leader holds the revisions the leader last reported, and synced the
+	// revisions last synced from it.
+	leader Revisions
+	synced Revisions
+}
+
+// Start syncs the storages until ctx is done.
+func (f *Follower) Start(ctx context.Context) error {
+	for {
+		if err := f.sync(ctx); err != nil {
+			f.Logger.Error(err, "syncing catalog content", "leader", f.LeaderURL.String())
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(f.Interval):
+		}
+	}
+}
+
+// NeedLeaderElection returns false, as every replica serves content.
+func (f *Follower) NeedLeaderElection() bool {
+	return false
+}
+
+// ReadyCheck is a healthz.Checker that fails until the storages hold the
+// revision of every catalog the leader last reported, and once the leader
+// has not been reached for MaxLag.
+func (f *Follower) ReadyCheck(_ *http.Request) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.lastSync.IsZero() {
+		return errors.New("catalog content has not been replicated yet")
+	}
+	if lag := time.Since(f.lastSync); lag > f.MaxLag {
+		return fmt.Errorf("catalog content was last replicated %s ago", lag.Round(time.Second))
+	}
+	var lagging []string
+	for name := range f.Storages {
+		want, ok := f.leader[name]
+		if !ok {
+			lagging = append(lagging, name)
+			continue
+		}
+		have := f.synced[name]
+		for catalog, digest := range want {
+			if have[catalog] != digest {
+				lagging = append(lagging, name+"/"+catalog)
+			}
+		}
+		for catalog := range have {
+			if _, ok := want[catalog]; !ok {
+				lagging = append(lagging, name+"/"+catalog)
+			}
+		}
+	}
+	if len(lagging) > 0 {
+		slices.Sort(lagging)
+		return fmt.Errorf("catalog content differs from the leader for %s", strings.Join(lagging, ", "))
+	}
+	return nil
+}
+
+// sync replicates the revisions of the catalogs that changed on the leader,
+// and returns the errors replicating any of them.
+func (f *Follower) sync(ctx context.Context) error {
+	var revs Revisions
+	if err := f.get(ctx, revisionsPath, func(resp *http.Response) error {
+		return json.NewDecoder(resp.Body).Decode(&revs)
+	}); err != nil {
+		return fmt.Errorf("error getting catalog revisions: %w", err)
+	}
+
+	var errs []error
+	synced := Revisions{}
+	for name, s := range f.Storages {
+		want, ok := revs[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("leader does not serve storage %q", name))
+			continue
+		}
+		have, err := s.ContentDigests()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error listing catalogs in storage %q: %w", name, err))
+			continue
+		}
+		for catalog, digest := range want {
+			if have[catalog] == digest {
+				continue
+			}
+			if err := f.replicate(ctx, name, s, catalog, digest); err != nil {
+				errs = append(errs, fmt.Errorf("error replicating catalog %q in storage %q: %w", catalog, name, err))
+				continue
+			}
+			have[catalog] = digest
+			f.Logger.Info("replicated catalog content", "storage", name, "catalog", catalog, "digest", digest)
+		}
+		for catalog := range have {
+			if _, ok := want[catalog]; ok {
+				continue
+			}
+			if err := s.Delete(catalog); err != nil {
+				errs = append(errs, fmt.Errorf("error deleting catalog %q in storage %q: %w", catalog, name, err))
+				continue
+			}
+			delete(have, catalog)
+			f.Logger.Info("deleted catalog content", "storage", name, "catalog", catalog)
+		}
+		synced[name] = have
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastSync = time.Now()
+	f.leader = revs
+	f.synced = synced
+	return errors.Join(errs...)
+}
+
+// replicate stores the revision of catalog with the given digest in s.
+func (f *Follower) replicate(ctx context.Context, name string, s Storage, catalog, digest string) error {
+	tempDir, err := os.MkdirTemp("", "replicated-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	if err := f.get(ctx, contentURLPath(name, catalog), func(resp *http.Response) error {
+		if got := resp.Header.Get(DigestHeader); got != digest {
+			return fmt.Errorf("got revision %q instead of %q, the catalog changed while it was being replicated", got, digest)
+		}
+		file, err := os.Create(filepath.Join(tempDir, "catalog.json"))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if _, err := io.Copy(file, resp.Body); err != nil {
+			return err
+		}
+		return file.Close()
+	}); err != nil {
+		return err
+	}
+
+	if err := s.Store(ctx, catalog, os.DirFS(tempDir)); err != nil {
+		return fmt.Errorf("error storing content: %w", err)
+	}
+	summary, err := s.ContentSummary(catalog)
+	if err != nil {
+		return fmt.Errorf("error computing content summary: %w", err)
+	}
+	if summary == nil || summary.Digest != digest {
+		return fmt.Errorf("stored content does not have digest %q", digest)
+	}
+	return nil
+}
+
+// get makes a GET request for urlPath below LeaderURL, and calls handle with
+// the response if it is successful.
+func (f *Follower) get(ctx context.Context, urlPath string, handle func(*http.Response) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.LeaderURL.JoinPath(urlPath).String(), nil)
+	if err != nil {
+		return err
+	}
+	if f.TokenFile != "" {
+		token, err := os.ReadFile(f.TokenFile)
+		if err != nil {
+			return fmt.Errorf("error reading token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %q: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return handle(resp)
+}
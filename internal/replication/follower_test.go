@@ -0,0 +1,186 @@
+package replication
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/operator-framework/catalogd/internal/storage"
+)
+
+func packageFS(pkg string) fstest.MapFS {
+	return fstest.MapFS{"catalog.json": &fstest.MapFile{Data: []byte(fmt.Sprintf(`{"schema":"olm.package","name":%[1]q,"defaultChannel":"stable"}
+{"schema":"olm.channel","package":%[1]q,"name":"stable","entries":[{"name":"%[1]s.v1.0.0"}]}
+{"schema":"olm.bundle","package":%[1]q,"name":"%[1]s.v1.0.0","image":"registry.example.com/%[1]s:v1.0.0","properties":[{"type":"olm.package","value":{"packageName":%[1]q,"version":"1.0.0"}}]}
+`, pkg))}}
+}
+
+func newStorage(t *testing.T) *storage.LocalDirV1 {
+	return &storage.LocalDirV1{RootDir: t.TempDir(), RootURL: &url.URL{Path: "/catalogs/"}}
+}
+
+func TestFollowerSync(t *testing.T) {
+	ctx := context.Background()
+	leaderClusterCatalogs, leaderCatalogs := newStorage(t), newStorage(t)
+	require.NoError(t, leaderClusterCatalogs.Store(ctx, "foo", packageFS("foo")))
+	require.NoError(t, leaderClusterCatalogs.Store(ctx, "bar", packageFS("bar")))
+	require.NoError(t, leaderCatalogs.Store(ctx, storage.NamespacedCatalog("tenant-a", "mine"), packageFS("baz")))
+	leader := httptest.NewServer(NewHandler(map[string]Storage{
+		"clustercatalogs": leaderClusterCatalogs,
+		"catalogs":        leaderCatalogs,
+	}))
+	defer leader.Close()
+	leaderURL, err := url.Parse(leader.URL)
+	require.NoError(t, err)
+
+	replicaClusterCatalogs, replicaCatalogs := newStorage(t), newStorage(t)
+	// Content the leader no longer has is deleted.
+	require.NoError(t, replicaClusterCatalogs.Store(ctx, "gone", packageFS("gone")))
+	follower := &Follower{
+		LeaderURL: leaderURL,
+		Client:    leader.Client(),
+		Storages: map[string]Storage{
+			"clustercatalogs": replicaClusterCatalogs,
+			"catalogs":        replicaCatalogs,
+		},
+		MaxLag: time.Minute,
+		Logger: logr.Discard(),
+	}
+	assertInSync := func() {
+		t.Helper()
+		for _, s := range [][2]Storage{{leaderClusterCatalogs, replicaClusterCatalogs}, {leaderCatalogs, replicaCatalogs}} {
+			want, err := s[0].ContentDigests()
+			require.NoError(t, err)
+			got, err := s[1].ContentDigests()
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+		}
+	}
+
+	require.NoError(t, follower.sync(ctx))
+	assertInSync()
+	assert.False(t, replicaClusterCatalogs.ContentExists("gone"))
+
+	require.NoError(t, leaderClusterCatalogs.Store(ctx, "foo", packageFS("qux")))
+	require.NoError(t, leaderClusterCatalogs.Delete("bar"))
+	require.NoError(t, follower.sync(ctx))
+	assertInSync()
+
+	// The replica keeps track of revisions, so that the diff it serves is
+	// the same as the leader's.
+	replicaDiff, err := replicaClusterCatalogs.ContentDiff("foo")
+	require.NoError(t, err)
+	leaderDiff, err := leaderClusterCatalogs.ContentDiff("foo")
+	require.NoError(t, err)
+	assert.Equal(t, leaderDiff, replicaDiff)
+}
+
+func TestFollowerAuthenticatesWithToken(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("secret\n"), 0600))
+	handler := NewHandler(map[string]Storage{"clustercatalogs": newStorage(t)})
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer leader.Close()
+	leaderURL, err := url.Parse(leader.URL)
+	require.NoError(t, err)
+
+	follower := &Follower{
+		LeaderURL: leaderURL,
+		Client:    leader.Client(),
+		Storages:  map[string]Storage{"clustercatalogs": newStorage(t)},
+		Logger:    logr.Discard(),
+	}
+	require.ErrorContains(t, follower.sync(context.Background()), "401 Unauthorized")
+	follower.TokenFile = tokenFile
+	require.NoError(t, follower.sync(context.Background()))
+
+	// Storages the leader does not serve can not be kept in sync.
+	follower.Storages["catalogs"] = newStorage(t)
+	require.ErrorContains(t, follower.sync(context.Background()), `leader does not serve storage "catalogs"`)
+}
+
+func TestFollowerContinuesPastFailingCatalogs(t *testing.T) {
+	ctx := context.Background()
+	leaderStorage := newStorage(t)
+	require.NoError(t, leaderStorage.Store(ctx, "broken", packageFS("broken")))
+	require.NoError(t, leaderStorage.Store(ctx, "foo", packageFS("foo")))
+	handler := NewHandler(map[string]Storage{"clustercatalogs": leaderStorage})
+	brokenPath := contentURLPath("clustercatalogs", "broken")
+	var failing atomic.Bool
+	failing.Store(true)
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() && r.URL.Path == brokenPath {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer leader.Close()
+	leaderURL, err := url.Parse(leader.URL)
+	require.NoError(t, err)
+
+	replicaStorage := newStorage(t)
+	follower := &Follower{
+		LeaderURL: leaderURL,
+		Client:    leader.Client(),
+		Storages:  map[string]Storage{"clustercatalogs": replicaStorage},
+		MaxLag:    time.Minute,
+		Logger:    logr.Discard(),
+	}
+	require.ErrorContains(t, follower.sync(ctx), `error replicating catalog "broken"`)
+	assert.True(t, replicaStorage.ContentExists("foo"))
+	assert.False(t, replicaStorage.ContentExists("broken"))
+	require.EqualError(t, follower.ReadyCheck(nil), "catalog content differs from the leader for clustercatalogs/broken")
+
+	failing.Store(false)
+	require.NoError(t, follower.sync(ctx))
+	require.NoError(t, follower.ReadyCheck(nil))
+
+	// A replica that falls behind a new revision is not ready until it
+	// holds it.
+	require.NoError(t, leaderStorage.Store(ctx, "broken", packageFS("fixed")))
+	failing.Store(true)
+	require.Error(t, follower.sync(ctx))
+	require.EqualError(t, follower.ReadyCheck(nil), "catalog content differs from the leader for clustercatalogs/broken")
+}
+
+func TestFollowerReadyCheck(t *testing.T) {
+	follower := &Follower{
+		Storages: map[string]Storage{"clustercatalogs": newStorage(t), "catalogs": newStorage(t)},
+		MaxLag:   time.Minute,
+	}
+	require.ErrorContains(t, follower.ReadyCheck(nil), "not been replicated yet")
+
+	follower.lastSync = time.Now()
+	follower.leader = Revisions{"clustercatalogs": {"foo": "sha256:foo", "bar": "sha256:bar"}, "catalogs": {}}
+	follower.synced = Revisions{"clustercatalogs": {"foo": "sha256:foo", "bar": "sha256:bar"}, "catalogs": {}}
+	require.NoError(t, follower.ReadyCheck(nil))
+
+	follower.synced = Revisions{"clustercatalogs": {"foo": "sha256:old", "gone": "sha256:gone"}, "catalogs": {}}
+	require.EqualError(t, follower.ReadyCheck(nil), "catalog content differs from the leader for clustercatalogs/bar, clustercatalogs/foo, clustercatalogs/gone")
+
+	follower.leader = Revisions{"clustercatalogs": {}}
+	follower.synced = Revisions{"clustercatalogs": {}}
+	require.EqualError(t, follower.ReadyCheck(nil), "catalog content differs from the leader for catalogs")
+
+	follower.lastSync = time.Now().Add(-2 * time.Minute)
+	require.ErrorContains(t, follower.ReadyCheck(nil), "last replicated 2m0s ago")
+}
@@ -0,0 +1,102 @@
+// Package replication replicates the catalog content stored by the catalogd
+// instance that unpacks it to read-only replicas of the catalog server.
+//
+// The instance that unpacks content serves the replication API with
+// NewHandler. Replicas serve it too, so that the revisions each of them holds
+// can be compared with those of the instance they replicate, and keep their
+// own storage in sync with a Follower.
+package replication
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+
+	"github.com/operator-framework/catalogd/internal/storage"
+)
+
+const (
+	// Path is the URL path under which the replication API is served.
+	Path = "/replication/"
+
+	revisionsPath = Path + "v1/revisions"
+	contentPath   = Path + "v1/content/"
+
+	// DigestHeader is the response header carrying the digest of the content
+	// served by the replication API.
+	DigestHeader = "Catalog-Digest"
+)
+
+// Storage is a storage instance whose content can be replicated.
+type Storage interface {
+	storage.Instance
+	// ContentDigests returns the digest of the revision currently stored
+	// for each catalog, by the name of the catalog.
+	ContentDigests() (map[string]string, error)
+}
+
+// Revisions are the digests of the revisions of the catalogs stored in each
+// storage, by the name of the storage and of the catalog.
+type Revisions map[string]map[string]string
+
+// NewHandler returns a handler serving the replication API for storages,
+// keyed by the names replicas know them by. It does not authenticate or
+// authorize requests itself.
+//
+// GET requests to Path+"v1/revisions" are answered with the Revisions of
+// storages, and GET requests to Path+"v1/content/<storage>/<catalog>" with
+// the current revision of a catalog, along with its digest in DigestHeader.
+func NewHandler(storages map[string]Storage) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+revisionsPath, func(w http.ResponseWriter, r *http.Request) {
+		revs, err := currentRevisions(storages)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(revs)
+	})
+	mux.HandleFunc("GET "+contentPath+"{storage}/{catalog...}", func(w http.ResponseWriter, r *http.Request) {
+		s, ok := storages[r.PathValue("storage")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		reader, digest, err := s.ContentReader(r.PathValue("catalog"))
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer reader.Close()
+		w.Header().Set("Content-Type", "application/jsonl")
+		w.Header().Set(DigestHeader, digest)
+		_, _ = io.Copy(w, reader)
+	})
+	return mux
+}
+
+func currentRevisions(storages map[string]Storage) (Revisions, error) {
+	revs := Revisions{}
+	for name, s := range storages {
+		digests, err := s.ContentDigests()
+		if err != nil {
+			return nil, fmt.Errorf("error listing catalogs in storage %q: %w", name, err)
+		}
+		revs[name] = digests
+	}
+	return revs, nil
+}
+
+// contentURLPath returns the URL path of the content of catalog in storage.
+func contentURLPath(storage, catalog string) string {
+	return path.Join(contentPath, storage, catalog)
+}
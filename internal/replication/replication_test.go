@@ -0,0 +1,34 @@
+package replication
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlerContent(t *testing.T) {
+	ctx := context.Background()
+	s := newStorage(t)
+	require.NoError(t, s.Store(ctx, "foo", packageFS("foo")))
+	summary, err := s.ContentSummary("foo")
+	require.NoError(t, err)
+	server := httptest.NewServer(NewHandler(map[string]Storage{"clustercatalogs": s}))
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + contentURLPath("clustercatalogs", "foo"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, summary.Digest, resp.Header.Get(DigestHeader))
+
+	for _, urlPath := range []string{contentURLPath("clustercatalogs", "bar"), contentURLPath("catalogs", "foo")} {
+		resp, err := server.Client().Get(server.URL + urlPath)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, urlPath)
+	}
+}
@@ -0,0 +1,185 @@
+package serverutil
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/apis/apiserver"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/authenticatorfactory"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/authorization/authorizerfactory"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	authenticationv1 "k8s.io/client-go/kubernetes/typed/authentication/v1"
+	authorizationv1 "k8s.io/client-go/kubernetes/typed/authorization/v1"
+	"k8s.io/client-go/rest"
+
+	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+)
+
+const (
+	// ContentSubresource is the virtual subresource of a ClusterCatalog that
+	// clients must be allowed to get in order to read its content from the
+	// catalog server when authorization is enabled.
+	ContentSubresource = "content"
+
+	clusterCatalogsResource = "clustercatalogs"
+	catalogsResource        = "catalogs"
+
+	// The cache TTLs and webhook backoff match the ones used by the metrics
+	// server's filters.WithAuthenticationAndAuthorization.
+	authnCacheTTL     = 1 * time.Minute
+	authzAllowTTL     = 5 * time.Minute
+	authzDenyTTL      = 30 * time.Second
+	authReviewTimeout = 10 * time.Second
+)
+
+// AuthConfig configures how requests to the catalog server are authenticated
+// and authorized.
+type AuthConfig struct {
+	Authenticator authenticator.Request
+	Authorizer    authorizer.Authorizer
+}
+
+// NewDelegatingAuthConfig returns an AuthConfig that authenticates bearer
+// tokens using TokenReviews and authorizes requests using
+// SubjectAccessReviews against the kube-apiserver. Both decisions are cached.
+// If clientCA is not nil, clients presenting a certificate signed by its CA
+// bundle are authenticated as the user named by the certificate's common
+// name, in the groups named by its organizations.
+//
+// For this the catalog server needs a ClusterRole with the following rules:
+// * apiGroups: authentication.k8s.io, resources: tokenreviews, verbs: create
+// * apiGroups: authorization.k8s.io, resources: subjectaccessreviews, verbs: create
+//
+// To read the content of a catalog, clients need a ClusterRole with the
+// following rule:
+// * apiGroups: olm.operatorframework.io, resources: clustercatalogs/content, verbs: get
+//
+// To read the content of a namespaced Catalog, a Role in its namespace with the
+// following rule is enough:
+// * apiGroups: olm.operatorframework.io, resources: catalogs/content, verbs: get
+func NewDelegatingAuthConfig(config *rest.Config, httpClient *http.Client, clientCA *ClientCAWatcher) (*AuthConfig, error) {
+	authenticationV1Client, err := authenticationv1.NewForConfigAndClient(config, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	authorizationV1Client, err := authorizationv1.NewForConfigAndClient(config, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	authenticatorConfig := authenticatorfactory.DelegatingAuthenticatorConfig{
+		Anonymous:                &apiserver.AnonymousAuthConfig{Enabled: false},
+		CacheTTL:                 authnCacheTTL,
+		TokenAccessReviewClient:  authenticationV1Client,
+		TokenAccessReviewTimeout: authReviewTimeout,
+		WebhookRetryBackoff:      authWebhookRetryBackoff(),
+	}
+	if clientCA != nil {
+		authenticatorConfig.ClientCertificateCAContentProvider = clientCA.content
+	}
+	delegatingAuthenticator, _, err := authenticatorConfig.New()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create authenticator: %w", err)
+	}
+
+	authorizerConfig := authorizerfactory.DelegatingAuthorizerConfig{
+		SubjectAccessReviewClient: authorizationV1Client,
+		AllowCacheTTL:             authzAllowTTL,
+		DenyCacheTTL:              authzDenyTTL,
+		WebhookRetryBackoff:       authWebhookRetryBackoff(),
+	}
+	delegatingAuthorizer, err := authorizerConfig.New()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create authorizer: %w", err)
+	}
+
+	return &AuthConfig{
+		Authenticator: delegatingAuthenticator,
+		Authorizer:    delegatingAuthorizer,
+	}, nil
+}
+
+func authWebhookRetryBackoff() *wait.Backoff {
+	return &wait.Backoff{
+		Duration: 500 * time.Millisecond,
+		Factor:   1.5,
+		Jitter:   0.2,
+		Steps:    5,
+	}
+}
+
+// withAuthenticationAndAuthorization wraps handler so that only requests from
+// clients that are allowed to get the content subresource of the requested
+// ClusterCatalog or Catalog are served. The authenticated user is added to the
+// context of the requests passed on to handler. catalogsPath and
+// namespacedCatalogsPath are the URL paths under which the content of each
+// ClusterCatalog and Catalog is served.
+func withAuthenticationAndAuthorization(log logr.Logger, cfg AuthConfig, catalogsPath, namespacedCatalogsPath string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		res, ok, err := cfg.Authenticator.AuthenticateRequest(req)
+		if err != nil {
+			log.V(4).Info("Authentication failed", "error", err.Error())
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		attributes := contentAttributes(res.User, req, catalogsPath, namespacedCatalogsPath)
+		authorized, reason, err := cfg.Authorizer.Authorize(req.Context(), attributes)
+		if err != nil {
+			msg := fmt.Sprintf("Authorization for user %s failed", attributes.User.GetName())
+			log.Error(err, msg)
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+		if authorized != authorizer.DecisionAllow {
+			msg := fmt.Sprintf("Authorization denied for user %s", attributes.User.GetName())
+			log.V(4).Info(fmt.Sprintf("%s: %s", msg, reason))
+			http.Error(w, msg, http.StatusForbidden)
+			return
+		}
+
+		handler.ServeHTTP(w, req.WithContext(request.WithUser(req.Context(), res.User)))
+	})
+}
+
+// contentAttributes returns the attributes to authorize a request for the
+// content of a catalog with. Requests that do not name a catalog, such as
+// searches, require access to the content of all catalogs, or of all Catalogs
+// in a namespace.
+func contentAttributes(u user.Info, req *http.Request, catalogsPath, namespacedCatalogsPath string) authorizer.AttributesRecord {
+	verb := strings.ToLower(req.Method)
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		verb = "get"
+	}
+	name, _ := catalogFromPath(catalogsPath, req.URL.Path)
+	if isSearchPath(catalogsPath, req.URL.Path) {
+		name = ""
+	}
+	resource, namespace := clusterCatalogsResource, ""
+	if ns, nsName, _ := namespacedCatalogFromPath(namespacedCatalogsPath, req.URL.Path); ns != "" {
+		resource, namespace, name = catalogsResource, ns, nsName
+	}
+	return authorizer.AttributesRecord{
+		User:            u,
+		Verb:            verb,
+		Namespace:       namespace,
+		APIGroup:        catalogdv1.GroupVersion.Group,
+		APIVersion:      catalogdv1.GroupVersion.Version,
+		Resource:        resource,
+		Subresource:     ContentSubresource,
+		Name:            name,
+		ResourceRequest: true,
+		Path:            req.URL.Path,
+	}
+}
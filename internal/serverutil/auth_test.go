@@ -0,0 +1,286 @@
+package serverutil
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+func TestWithAuthenticationAndAuthorization(t *testing.T) {
+	authn := authenticator.RequestFunc(func(req *http.Request) (*authenticator.Response, bool, error) {
+		switch req.Header.Get("Authorization") {
+		case "":
+			return nil, false, nil
+		case "Bearer alice":
+			return &authenticator.Response{User: &user.DefaultInfo{Name: "alice"}}, true, nil
+		case "Bearer bob":
+			return &authenticator.Response{User: &user.DefaultInfo{Name: "bob"}}, true, nil
+		default:
+			return nil, false, errors.New("invalid bearer token")
+		}
+	})
+	authz := authorizer.AuthorizerFunc(func(_ context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+		if a.GetUser().GetName() == "bob" {
+			return authorizer.DecisionNoOpinion, "", errors.New("subjectaccessreview failed")
+		}
+		if a.GetName() == "allowed" {
+			return authorizer.DecisionAllow, "", nil
+		}
+		return authorizer.DecisionDeny, "not allowed", nil
+	})
+	handler := withAuthenticationAndAuthorization(logr.Discard(), AuthConfig{
+		Authenticator: authn,
+		Authorizer:    authz,
+	}, "/catalogs/", "/namespaces/", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("content"))
+	}))
+
+	for _, tc := range []struct {
+		name           string
+		token          string
+		path           string
+		expectedStatus int
+	}{
+		{
+			name:           "no token, unauthorized",
+			path:           "/catalogs/allowed/api/v1/all",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "invalid token, unauthorized",
+			token:          "mallory",
+			path:           "/catalogs/allowed/api/v1/all",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "authorized for the requested catalog, content served",
+			token:          "alice",
+			path:           "/catalogs/allowed/api/v1/all",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "not authorized for the requested catalog, forbidden",
+			token:          "alice",
+			path:           "/catalogs/denied/api/v1/all",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "path escaping the authorized catalog, forbidden",
+			token:          "alice",
+			path:           "/catalogs/allowed/../denied/api/v1/all",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "authorization error, internal server error",
+			token:          "bob",
+			path:           "/catalogs/allowed/api/v1/all",
+			expectedStatus: http.StatusInternalServerError,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, tc.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestContentAttributes(t *testing.T) {
+	u := &user.DefaultInfo{Name: "alice"}
+	for _, tc := range []struct {
+		name              string
+		method            string
+		path              string
+		expectedVerb      string
+		expectedNamespace string
+		expectedResource  string
+		expectedName      string
+	}{
+		{
+			name:         "get of catalog content",
+			method:       http.MethodGet,
+			path:         "/catalogs/operatorhubio/api/v1/all",
+			expectedVerb: "get",
+			expectedName: "operatorhubio",
+		},
+		{
+			name:         "head of catalog content",
+			method:       http.MethodHead,
+			path:         "/catalogs/operatorhubio/api/v1/all",
+			expectedVerb: "get",
+			expectedName: "operatorhubio",
+		},
+		{
+			name:         "request without a catalog name",
+			method:       http.MethodGet,
+			path:         "/catalogs/",
+			expectedVerb: "get",
+		},
+		{
+			name:         "search of all catalogs",
+			method:       http.MethodGet,
+			path:         "/catalogs/api/v1/search",
+			expectedVerb: "get",
+		},
+		{
+			name:         "request outside of the catalogs path",
+			method:       http.MethodGet,
+			path:         "/other/operatorhubio/api/v1/all",
+			expectedVerb: "get",
+		},
+		{
+			name:         "other methods use their own verb",
+			method:       http.MethodPost,
+			path:         "/catalogs/operatorhubio/api/v1/all",
+			expectedVerb: "post",
+			expectedName: "operatorhubio",
+		},
+		{
+			name:              "get of namespaced catalog content",
+			method:            http.MethodGet,
+			path:              "/namespaces/tenant-a/catalogs/mine/api/v1/all",
+			expectedVerb:      "get",
+			expectedNamespace: "tenant-a",
+			expectedResource:  "catalogs",
+			expectedName:      "mine",
+		},
+		{
+			name:              "request without a namespaced catalog name",
+			method:            http.MethodGet,
+			path:              "/namespaces/tenant-a/",
+			expectedVerb:      "get",
+			expectedNamespace: "tenant-a",
+			expectedResource:  "catalogs",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.expectedResource == "" {
+				tc.expectedResource = "clustercatalogs"
+			}
+			attrs := contentAttributes(u, httptest.NewRequest(tc.method, tc.path, nil), "/catalogs/", "/namespaces/")
+			assert.Equal(t, authorizer.AttributesRecord{
+				User:            u,
+				Verb:            tc.expectedVerb,
+				Namespace:       tc.expectedNamespace,
+				APIGroup:        "olm.operatorframework.io",
+				APIVersion:      "v1",
+				Resource:        tc.expectedResource,
+				Subresource:     "content",
+				Name:            tc.expectedName,
+				ResourceRequest: true,
+				Path:            tc.path,
+			}, attrs)
+		})
+	}
+}
+
+// TestDelegatingAuthConfig exercises TokenReviews and SubjectAccessReviews
+// against a real kube-apiserver. It requires the envtest binaries, which
+// `make test-unit` provides through KUBEBUILDER_ASSETS.
+func TestDelegatingAuthConfig(t *testing.T) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS is not set, skipping envtest based test")
+	}
+	testEnv := &envtest.Environment{}
+	cfg, err := testEnv.Start()
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, testEnv.Stop()) })
+
+	ctx := context.Background()
+	clientset, err := kubernetes.NewForConfig(cfg)
+	require.NoError(t, err)
+
+	sa, err := clientset.CoreV1().ServiceAccounts("default").Create(ctx, &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Name: "catalog-reader"},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = clientset.RbacV1().ClusterRoles().Create(ctx, &rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "catalog-reader"},
+		Rules: []rbacv1.PolicyRule{{
+			APIGroups:     []string{"olm.operatorframework.io"},
+			Resources:     []string{"clustercatalogs/content"},
+			ResourceNames: []string{"allowed"},
+			Verbs:         []string{"get"},
+		}},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = clientset.RbacV1().ClusterRoleBindings().Create(ctx, &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "catalog-reader"},
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "catalog-reader"},
+		Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Namespace: sa.Namespace, Name: sa.Name}},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	tokenRequest, err := clientset.CoreV1().ServiceAccounts(sa.Namespace).CreateToken(ctx, sa.Name, &authenticationv1.TokenRequest{}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	httpClient, err := rest.HTTPClientFor(cfg)
+	require.NoError(t, err)
+	authCfg, err := NewDelegatingAuthConfig(cfg, httpClient, nil)
+	require.NoError(t, err)
+	handler := withAuthenticationAndAuthorization(logr.Discard(), *authCfg, "/catalogs/", "/namespaces/", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("content"))
+	}))
+
+	for _, tc := range []struct {
+		name           string
+		token          string
+		path           string
+		expectedStatus int
+	}{
+		{
+			name:           "no token, unauthorized",
+			path:           "/catalogs/allowed/api/v1/all",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "invalid token, unauthorized",
+			token:          "not-a-token",
+			path:           "/catalogs/allowed/api/v1/all",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "service account allowed to get the content of the catalog, content served",
+			token:          tokenRequest.Status.Token,
+			path:           "/catalogs/allowed/api/v1/all",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "service account not allowed to get the content of the catalog, forbidden",
+			token:          tokenRequest.Status.Token,
+			path:           "/catalogs/denied/api/v1/all",
+			expectedStatus: http.StatusForbidden,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, tc.expectedStatus, rec.Code, strings.TrimSpace(rec.Body.String()))
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package serverutil
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+
+	"k8s.io/apiserver/pkg/server/dynamiccertificates"
+)
+
+// ClientCAWatcher holds the CA bundle used to verify the certificates of
+// clients of the catalog server. The bundle is reloaded whenever the file it
+// was read from changes, and is also re-read periodically in case a change
+// notification is missed. It must be added to a manager to keep it up to date.
+type ClientCAWatcher struct {
+	content *dynamiccertificates.DynamicFileCAContent
+}
+
+// NewClientCAWatcher returns a ClientCAWatcher for the PEM encoded CA bundle
+// in caFile. The bundle is loaded before returning.
+func NewClientCAWatcher(caFile string) (*ClientCAWatcher, error) {
+	content, err := dynamiccertificates.NewDynamicCAContentFromFile("catalog-server-client-ca", caFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading client CA bundle: %w", err)
+	}
+	return &ClientCAWatcher{content: content}, nil
+}
+
+// Start watches the CA bundle file for changes until ctx is done.
+func (w *ClientCAWatcher) Start(ctx context.Context) error {
+	w.content.Run(ctx, 1)
+	return nil
+}
+
+// configForClient returns a function suitable for tls.Config.GetConfigForClient
+// that verifies client certificates against the current CA bundle using
+// base as the rest of the configuration. If required is false, clients that
+// don't present a certificate are still accepted so that they can
+// authenticate by other means.
+func (w *ClientCAWatcher) configForClient(base *tls.Config, required bool) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	clientAuth := tls.VerifyClientCertIfGiven
+	if required {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+	return func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		opts, ok := w.content.VerifyOptions()
+		if !ok {
+			return nil, errors.New("no client CA bundle loaded")
+		}
+		config := base.Clone()
+		config.ClientAuth = clientAuth
+		config.ClientCAs = opts.Roots
+		return config, nil
+	}
+}
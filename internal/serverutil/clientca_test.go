@@ -0,0 +1,191 @@
+package serverutil
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	x509request "k8s.io/apiserver/pkg/authentication/request/x509"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+func TestClientCAWatcher(t *testing.T) {
+	serverCA := newTestCA(t, "server-ca")
+	serverCert := serverCA.issue(t, "server", nil, x509.ExtKeyUsageServerAuth)
+	clientCA := newTestCA(t, "client-ca")
+	rotatedClientCA := newTestCA(t, "rotated-client-ca")
+	clientCert := clientCA.issue(t, "edge-agent", []string{"edge"}, x509.ExtKeyUsageClientAuth)
+	rotatedClientCert := rotatedClientCA.issue(t, "edge-agent", []string{"edge"}, x509.ExtKeyUsageClientAuth)
+
+	caFile := filepath.Join(t.TempDir(), "client-ca.crt")
+	require.NoError(t, os.WriteFile(caFile, clientCA.certPEM, 0600))
+	watcher, err := NewClientCAWatcher(caFile)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = watcher.Start(ctx) }()
+
+	newServer := func(t *testing.T, required bool, handler http.Handler) string {
+		srv := httptest.NewUnstartedServer(handler)
+		base := &tls.Config{Certificates: []tls.Certificate{serverCert}, MinVersion: tls.VersionTLS12}
+		srv.TLS = &tls.Config{MinVersion: tls.VersionTLS12, GetConfigForClient: watcher.configForClient(base, required)}
+		srv.StartTLS()
+		t.Cleanup(srv.Close)
+		return srv.URL
+	}
+	get := func(url string, cert *tls.Certificate) (int, error) {
+		tlsConfig := &tls.Config{RootCAs: serverCA.pool(), MinVersion: tls.VersionTLS12}
+		if cert != nil {
+			// Always present the certificate, even if the server did not
+			// list its issuer as acceptable.
+			tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return cert, nil
+			}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		resp, err := client.Get(url)
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {})
+
+	t.Run("required client certificate signed by the CA is accepted", func(t *testing.T) {
+		url := newServer(t, true, ok)
+		code, err := get(url, &clientCert)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("required client certificate missing is rejected", func(t *testing.T) {
+		url := newServer(t, true, ok)
+		_, err := get(url, nil)
+		require.Error(t, err)
+	})
+
+	t.Run("client certificate signed by another CA is rejected", func(t *testing.T) {
+		url := newServer(t, false, ok)
+		_, err := get(url, &rotatedClientCert)
+		require.Error(t, err)
+	})
+
+	t.Run("optional client certificate missing is accepted", func(t *testing.T) {
+		url := newServer(t, false, ok)
+		code, err := get(url, nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("client certificate authenticates the user it names", func(t *testing.T) {
+		authn := x509request.NewDynamic(watcher.content.VerifyOptions, x509request.CommonNameUserConversion)
+		authz := authorizer.AuthorizerFunc(func(_ context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+			if a.GetUser().GetName() == "edge-agent" && a.GetUser().GetGroups()[0] == "edge" && a.GetName() == "allowed" {
+				return authorizer.DecisionAllow, "", nil
+			}
+			return authorizer.DecisionDeny, "", nil
+		})
+		url := newServer(t, false, withAuthenticationAndAuthorization(logr.Discard(), AuthConfig{
+			Authenticator: authenticator.Request(authn),
+			Authorizer:    authz,
+		}, "/catalogs/", "/namespaces/", ok))
+
+		code, err := get(url+"/catalogs/allowed/api/v1/all", &clientCert)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, code)
+		code, err = get(url+"/catalogs/denied/api/v1/all", &clientCert)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, code)
+		code, err = get(url+"/catalogs/allowed/api/v1/all", nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+
+	// Run last, since it replaces the CA bundle shared by the cases above.
+	t.Run("CA bundle is reloaded when the file changes", func(t *testing.T) {
+		url := newServer(t, true, ok)
+		require.NoError(t, os.WriteFile(caFile, rotatedClientCA.certPEM, 0600))
+		require.Eventually(t, func() bool {
+			code, err := get(url, &rotatedClientCert)
+			return err == nil && code == http.StatusOK
+		}, 30*time.Second, 100*time.Millisecond)
+		_, err := get(url, &clientCert)
+		require.Error(t, err)
+	})
+}
+
+func TestNewClientCAWatcherInvalidFile(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "client-ca.crt")
+	require.NoError(t, os.WriteFile(caFile, []byte("not a certificate"), 0600))
+	_, err := NewClientCAWatcher(caFile)
+	require.Error(t, err)
+
+	_, err = NewClientCAWatcher(filepath.Join(t.TempDir(), "missing.crt"))
+	require.Error(t, err)
+}
+
+type testCA struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key, certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (ca *testCA) issue(t *testing.T, commonName string, organizations []string, usage x509.ExtKeyUsage) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: commonName, Organization: organizations},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
@@ -0,0 +1,142 @@
+package serverutil
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/apiserver/pkg/endpoints/request"
+
+	catalogdmetrics "github.com/operator-framework/catalogd/internal/metrics"
+)
+
+const (
+	rejectReasonRateLimited = "rate_limited"
+	rejectReasonMaxInFlight = "max_in_flight"
+
+	// clientLimiterIdleTimeout is how long the rate limiter of a client is
+	// kept after its last request. A client coming back after that starts
+	// over with a full burst, which is what it would have accumulated anyway.
+	clientLimiterIdleTimeout = 10 * time.Minute
+)
+
+// RateLimitConfig configures limits on the requests served by the catalog
+// server. A zero value for any of the limits disables it.
+type RateLimitConfig struct {
+	// RequestsPerSecond is the sustained rate of requests allowed for each
+	// client. Clients are identified by their authenticated user name when
+	// authentication is enabled, and by their IP address otherwise.
+	RequestsPerSecond float64
+	// Burst is the number of requests a client may make at once before
+	// RequestsPerSecond applies. It defaults to 1 if RequestsPerSecond is set.
+	Burst int
+	// MaxInFlight is the maximum number of requests, across all clients, that
+	// are served concurrently. Event streams are long-running and are not
+	// counted.
+	MaxInFlight int
+}
+
+// withMaxInFlight wraps handler so that at most maxInFlight requests are
+// served concurrently. Requests over the limit are rejected with 429.
+func withMaxInFlight(maxInFlight int, handler http.Handler) http.Handler {
+	inFlight := make(chan struct{}, maxInFlight)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isLongRunning(r) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		select {
+		case inFlight <- struct{}{}:
+			defer func() { <-inFlight }()
+			handler.ServeHTTP(w, r)
+		default:
+			reject(w, rejectReasonMaxInFlight, time.Second)
+		}
+	})
+}
+
+// withClientRateLimit wraps handler so that each client is limited to the
+// configured rate of requests. Requests over the limit are rejected with 429
+// and a Retry-After header telling the client when to try again.
+func withClientRateLimit(cfg RateLimitConfig, handler http.Handler) http.Handler {
+	limiters := &clientLimiters{
+		limit:    rate.Limit(cfg.RequestsPerSecond),
+		burst:    max(cfg.Burst, 1),
+		limiters: map[string]*clientLimiter{},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		reservation := limiters.get(clientKey(r), now).ReserveN(now, 1)
+		if delay := reservation.DelayFrom(now); delay > 0 {
+			reservation.CancelAt(now)
+			reject(w, rejectReasonRateLimited, delay)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+type clientLimiter struct {
+	*rate.Limiter
+	lastSeen time.Time
+}
+
+type clientLimiters struct {
+	limit     rate.Limit
+	burst     int
+	mu        sync.Mutex
+	limiters  map[string]*clientLimiter
+	lastSweep time.Time
+}
+
+func (c *clientLimiters) get(key string, now time.Time) *rate.Limiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.Sub(c.lastSweep) > clientLimiterIdleTimeout {
+		for k, l := range c.limiters {
+			if now.Sub(l.lastSeen) > clientLimiterIdleTimeout {
+				delete(c.limiters, k)
+			}
+		}
+		c.lastSweep = now
+	}
+	l, ok := c.limiters[key]
+	if !ok {
+		l = &clientLimiter{Limiter: rate.NewLimiter(c.limit, c.burst)}
+		c.limiters[key] = l
+	}
+	l.lastSeen = now
+	return l.Limiter
+}
+
+// clientKey identifies the client that made r, by the user it authenticated
+// as if any, or else by its IP address.
+func clientKey(r *http.Request) string {
+	if u, ok := request.UserFrom(r.Context()); ok {
+		return "user:" + u.GetName()
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// isLongRunning returns true for requests for a catalog's event stream, which
+// stay open for as long as the client is interested in changes.
+func isLongRunning(r *http.Request) bool {
+	return strings.HasSuffix(path.Clean(r.URL.Path), "/api/v1/events")
+}
+
+func reject(w http.ResponseWriter, reason string, retryAfter time.Duration) {
+	catalogdmetrics.RejectedRequestsMetric.WithLabelValues(reason).Inc()
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+	http.Error(w, "Too many requests, please try again later", http.StatusTooManyRequests)
+}
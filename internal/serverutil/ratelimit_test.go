@@ -0,0 +1,93 @@
+package serverutil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+
+	catalogdmetrics "github.com/operator-framework/catalogd/internal/metrics"
+)
+
+func TestWithMaxInFlight(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := withMaxInFlight(1, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("block") != "" {
+			started <- struct{}{}
+			<-release
+		}
+	}))
+	rejected := testutil.ToFloat64(catalogdmetrics.RejectedRequestsMetric.WithLabelValues(rejectReasonMaxInFlight))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/catalogs/test/api/v1/all?block=true", nil))
+	}()
+	<-started
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/catalogs/test/api/v1/all", nil))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	assert.InDelta(t, rejected+1, testutil.ToFloat64(catalogdmetrics.RejectedRequestsMetric.WithLabelValues(rejectReasonMaxInFlight)), 0)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/catalogs/test/api/v1/events", nil))
+	assert.Equal(t, http.StatusOK, rec.Code, "event streams are not subject to the in-flight limit")
+
+	close(release)
+	wg.Wait()
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/catalogs/test/api/v1/all", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestWithClientRateLimit(t *testing.T) {
+	handler := withClientRateLimit(RateLimitConfig{RequestsPerSecond: 0.1, Burst: 2}, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	serve := func(remoteAddr, userName string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/catalogs/test/api/v1/all", nil)
+		req.RemoteAddr = remoteAddr
+		if userName != "" {
+			req = req.WithContext(request.WithUser(req.Context(), &user.DefaultInfo{Name: userName}))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	rejected := testutil.ToFloat64(catalogdmetrics.RejectedRequestsMetric.WithLabelValues(rejectReasonRateLimited))
+
+	t.Run("requests within the burst are served", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve("10.0.0.1:1234", "").Code)
+		assert.Equal(t, http.StatusOK, serve("10.0.0.1:5678", "").Code)
+	})
+
+	t.Run("requests over the limit are rejected with Retry-After", func(t *testing.T) {
+		rec := serve("10.0.0.1:1234", "")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		retryAfter, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+		require.NoError(t, err)
+		assert.InDelta(t, 10, retryAfter, 1)
+		assert.InDelta(t, rejected+1, testutil.ToFloat64(catalogdmetrics.RejectedRequestsMetric.WithLabelValues(rejectReasonRateLimited)), 0)
+	})
+
+	t.Run("other IP addresses are limited separately", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve("10.0.0.2:1234", "").Code)
+	})
+
+	t.Run("authenticated users are limited by identity rather than IP address", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve("10.0.0.1:1234", "alice").Code)
+		assert.Equal(t, http.StatusOK, serve("10.0.0.3:1234", "alice").Code)
+		assert.Equal(t, http.StatusTooManyRequests, serve("10.0.0.4:1234", "alice").Code)
+		assert.Equal(t, http.StatusOK, serve("10.0.0.4:1234", "bob").Code)
+	})
+}
@@ -2,17 +2,23 @@ package serverutil
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"path"
+	"strings"
 	"time"
 
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/trace"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
 
 	catalogdmetrics "github.com/operator-framework/catalogd/internal/metrics"
 	"github.com/operator-framework/catalogd/internal/storage"
 	"github.com/operator-framework/catalogd/internal/third_party/server"
+	"github.com/operator-framework/catalogd/internal/tracing"
 )
 
 type CatalogServerConfig struct {
@@ -20,10 +26,33 @@ type CatalogServerConfig struct {
 	CatalogAddr  string
 	CertFile     string
 	KeyFile      string
+	// CatalogsPath is the URL path under which the content of each catalog is
+	// served, e.g. "/catalogs/". The first path element below it is the name
+	// of the catalog being requested.
+	CatalogsPath string
 	LocalStorage storage.Instance
+	// NamespacedCatalogsPath, if set, is the URL path under which the content
+	// of each namespaced Catalog stored in NamespacedStorage is served, e.g.
+	// "/namespaces/". The path of a catalog below it is
+	// <namespace>/catalogs/<name>.
+	NamespacedCatalogsPath string
+	NamespacedStorage      storage.Instance
+	// Auth, if set, requires clients to authenticate and to be authorized to
+	// read the content of the catalog they request.
+	Auth *AuthConfig
+	// ClientCA, if set, verifies client certificates against its CA bundle.
+	// Client certificates are required unless Auth is also set, in which case
+	// clients may authenticate with either a certificate or a bearer token.
+	// It requires CertFile and KeyFile to be set.
+	ClientCA *ClientCAWatcher
+	// RateLimit limits the requests served to each client and overall.
+	RateLimit RateLimitConfig
 }
 
 func AddCatalogServerToManager(mgr ctrl.Manager, cfg CatalogServerConfig, tlsFileWatcher *certwatcher.CertWatcher) error {
+	if cfg.ClientCA != nil && (cfg.CertFile == "" || cfg.KeyFile == "") {
+		return errors.New("client certificate authentication requires the catalog server to serve TLS")
+	}
 	listener, err := net.Listen("tcp", cfg.CatalogAddr)
 	if err != nil {
 		return fmt.Errorf("error creating catalog server listener: %w", err)
@@ -35,16 +64,39 @@ func AddCatalogServerToManager(mgr ctrl.Manager, cfg CatalogServerConfig, tlsFil
 			GetCertificate: tlsFileWatcher.GetCertificate,
 			MinVersion:     tls.VersionTLS12,
 		}
+		if cfg.ClientCA != nil {
+			config.GetConfigForClient = cfg.ClientCA.configForClient(config.Clone(), cfg.Auth == nil)
+		}
 		listener = tls.NewListener(listener, config)
 	}
 
 	shutdownTimeout := 30 * time.Second
 
+	// Requests are limited per client after authentication so that clients
+	// can be told apart by identity, while the in-flight limit applies first
+	// so that it also bounds the load of authenticating requests.
+	handler := cfg.LocalStorage.StorageServerHandler()
+	if cfg.NamespacedStorage != nil {
+		mux := http.NewServeMux()
+		mux.Handle(cfg.CatalogsPath, handler)
+		mux.Handle(cfg.NamespacedCatalogsPath, cfg.NamespacedStorage.StorageServerHandler())
+		handler = mux
+	}
+	if cfg.RateLimit.RequestsPerSecond > 0 {
+		handler = withClientRateLimit(cfg.RateLimit, handler)
+	}
+	if cfg.Auth != nil {
+		handler = withAuthenticationAndAuthorization(mgr.GetLogger().WithName("catalogserver"), *cfg.Auth, cfg.CatalogsPath, cfg.NamespacedCatalogsPath, handler)
+	}
+	if cfg.RateLimit.MaxInFlight > 0 {
+		handler = withMaxInFlight(cfg.RateLimit.MaxInFlight, handler)
+	}
+
 	catalogServer := server.Server{
 		Kind: "catalogs",
 		Server: &http.Server{
 			Addr:        cfg.CatalogAddr,
-			Handler:     catalogdmetrics.AddMetricsToHandler(cfg.LocalStorage.StorageServerHandler()),
+			Handler:     cfg.withTracing(catalogdmetrics.AddMetricsToHandler(catalogdmetrics.AddCatalogMetricsToHandler(handler, cfg.catalogLabels))),
 			ReadTimeout: 5 * time.Second,
 			// TODO: Revert this to 10 seconds if/when the API
 			// evolves to have significantly smaller responses
@@ -61,3 +113,96 @@ func AddCatalogServerToManager(mgr ctrl.Manager, cfg CatalogServerConfig, tlsFil
 
 	return nil
 }
+
+// Endpoint label values of the per-catalog request metrics.
+const (
+	endpointAll    = "all"
+	endpointEvents = "events"
+	endpointDiff   = "diff"
+	endpointSearch = "search"
+	endpointOther  = "other"
+)
+
+// catalogLabels returns the metric labels of a request. Only catalogs whose
+// content is being served get their own label value, which bounds the number
+// of label values by the number of ClusterCatalogs and Catalogs. Namespaced
+// Catalogs are labeled with the name their content is stored under.
+func (cfg CatalogServerConfig) catalogLabels(r *http.Request) catalogdmetrics.CatalogLabels {
+	if isSearchPath(cfg.CatalogsPath, r.URL.Path) {
+		return catalogdmetrics.CatalogLabels{Catalog: catalogdmetrics.UnknownCatalog, Endpoint: endpointSearch}
+	}
+	name, rest := catalogFromPath(cfg.CatalogsPath, r.URL.Path)
+	exists := name != "" && cfg.LocalStorage.ContentExists(name)
+	if namespace, nsName, nsRest := namespacedCatalogFromPath(cfg.NamespacedCatalogsPath, r.URL.Path); namespace != "" {
+		name, rest = storage.NamespacedCatalog(namespace, nsName), nsRest
+		exists = nsName != "" && cfg.NamespacedStorage.ContentExists(name)
+	}
+	labels := catalogdmetrics.CatalogLabels{Catalog: catalogdmetrics.UnknownCatalog, Endpoint: endpointOther}
+	if exists {
+		labels.Catalog = name
+	}
+	switch rest {
+	case "api/v1/all":
+		labels.Endpoint = endpointAll
+	case "api/v1/events":
+		labels.Endpoint = endpointEvents
+	case "api/v1/diff":
+		labels.Endpoint = endpointDiff
+	}
+	return labels
+}
+
+// withTracing wraps handler so that each request is served in a span, which
+// continues the trace of the client if it propagated one. Spans are named
+// after the endpoint requested rather than the URL path, which would make
+// for as many span names as there are catalogs.
+func (cfg CatalogServerConfig) withTracing(handler http.Handler) http.Handler {
+	return otelhttp.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		labels := cfg.catalogLabels(r)
+		span := trace.SpanFromContext(r.Context())
+		span.SetName(r.Method + " " + labels.Endpoint)
+		span.SetAttributes(tracing.CatalogKey.String(labels.Catalog))
+		handler.ServeHTTP(w, r)
+	}), "catalog-server")
+}
+
+// catalogFromPath splits the URL path of a request into the name of the
+// catalog it is for and the remainder of the path below that catalog. The
+// name is empty if the path is not below catalogsPath.
+func catalogFromPath(catalogsPath, urlPath string) (string, string) {
+	rest, ok := strings.CutPrefix(path.Clean(urlPath), path.Clean(catalogsPath)+"/")
+	if !ok {
+		return "", ""
+	}
+	name, rest, _ := strings.Cut(rest, "/")
+	return name, rest
+}
+
+// isSearchPath returns whether urlPath is the path at which the content of all
+// ClusterCatalogs is searched. It is below catalogsPath, but does not name a
+// catalog.
+func isSearchPath(catalogsPath, urlPath string) bool {
+	return path.Clean(urlPath) == path.Join(catalogsPath, storage.SearchPath)
+}
+
+// namespacedCatalogFromPath splits the URL path of a request into the
+// namespace and name of the namespaced Catalog it is for, and the remainder of
+// the path below that catalog. The namespace is empty if the path is not below
+// namespacedCatalogsPath, and the name is empty if the path does not name a
+// Catalog in the namespace.
+func namespacedCatalogFromPath(namespacedCatalogsPath, urlPath string) (string, string, string) {
+	if namespacedCatalogsPath == "" {
+		return "", "", ""
+	}
+	rest, ok := strings.CutPrefix(path.Clean(urlPath), path.Clean(namespacedCatalogsPath)+"/")
+	if !ok {
+		return "", "", ""
+	}
+	namespace, rest, _ := strings.Cut(rest, "/")
+	resource, rest, _ := strings.Cut(rest, "/")
+	if resource != catalogsResource {
+		return namespace, "", ""
+	}
+	name, rest, _ := strings.Cut(rest, "/")
+	return namespace, name, rest
+}
@@ -0,0 +1,165 @@
+package serverutil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	catalogdmetrics "github.com/operator-framework/catalogd/internal/metrics"
+	"github.com/operator-framework/catalogd/internal/storage"
+	"github.com/operator-framework/catalogd/internal/tracing"
+)
+
+type fakeStorage struct {
+	storage.Instance
+	catalogs []string
+}
+
+func (f fakeStorage) ContentExists(catalog string) bool {
+	return slices.Contains(f.catalogs, catalog)
+}
+
+func TestCatalogLabels(t *testing.T) {
+	cfg := CatalogServerConfig{
+		CatalogsPath:           "/catalogs/",
+		LocalStorage:           fakeStorage{catalogs: []string{"operatorhubio"}},
+		NamespacedCatalogsPath: "/namespaces/",
+		NamespacedStorage:      fakeStorage{catalogs: []string{"tenant-a/catalogs/mine"}},
+	}
+	for _, tc := range []struct {
+		path     string
+		expected catalogdmetrics.CatalogLabels
+	}{
+		{
+			path:     "/catalogs/operatorhubio/api/v1/all",
+			expected: catalogdmetrics.CatalogLabels{Catalog: "operatorhubio", Endpoint: "all"},
+		},
+		{
+			path:     "/catalogs/operatorhubio/api/v1/events",
+			expected: catalogdmetrics.CatalogLabels{Catalog: "operatorhubio", Endpoint: "events"},
+		},
+		{
+			path:     "/catalogs/operatorhubio/api/v1/diff",
+			expected: catalogdmetrics.CatalogLabels{Catalog: "operatorhubio", Endpoint: "diff"},
+		},
+		{
+			path:     "/catalogs/operatorhubio/api/v1/other",
+			expected: catalogdmetrics.CatalogLabels{Catalog: "operatorhubio", Endpoint: "other"},
+		},
+		{
+			path:     "/catalogs/operatorhubio//api/v1/./all",
+			expected: catalogdmetrics.CatalogLabels{Catalog: "operatorhubio", Endpoint: "all"},
+		},
+		{
+			path:     "/catalogs/api/v1/search",
+			expected: catalogdmetrics.CatalogLabels{Catalog: "unknown", Endpoint: "search"},
+		},
+		{
+			path:     "/catalogs/does-not-exist/api/v1/all",
+			expected: catalogdmetrics.CatalogLabels{Catalog: "unknown", Endpoint: "all"},
+		},
+		{
+			path:     "/catalogs/",
+			expected: catalogdmetrics.CatalogLabels{Catalog: "unknown", Endpoint: "other"},
+		},
+		{
+			path:     "/elsewhere/operatorhubio/api/v1/all",
+			expected: catalogdmetrics.CatalogLabels{Catalog: "unknown", Endpoint: "other"},
+		},
+		{
+			path:     "/namespaces/tenant-a/catalogs/mine/api/v1/all",
+			expected: catalogdmetrics.CatalogLabels{Catalog: "tenant-a/catalogs/mine", Endpoint: "all"},
+		},
+		{
+			path:     "/namespaces/tenant-b/catalogs/mine/api/v1/all",
+			expected: catalogdmetrics.CatalogLabels{Catalog: "unknown", Endpoint: "all"},
+		},
+		{
+			path:     "/namespaces/tenant-a/",
+			expected: catalogdmetrics.CatalogLabels{Catalog: "unknown", Endpoint: "other"},
+		},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			assert.Equal(t, tc.expected, cfg.catalogLabels(httptest.NewRequest(http.MethodGet, tc.path, nil)))
+		})
+	}
+}
+
+func TestCatalogMetrics(t *testing.T) {
+	cfg := CatalogServerConfig{
+		CatalogsPath: "/catalogs/",
+		LocalStorage: fakeStorage{catalogs: []string{"metrics-test"}},
+	}
+	body := strings.Repeat("x", 2048)
+	handler := catalogdmetrics.AddCatalogMetricsToHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/all") {
+			_, _ = w.Write([]byte(body))
+			return
+		}
+		http.NotFound(w, r)
+	}), cfg.catalogLabels)
+
+	for _, p := range []string{
+		"/catalogs/metrics-test/api/v1/all",
+		"/catalogs/metrics-test/api/v1/all",
+		"/catalogs/metrics-test/api/v1/missing",
+		"/catalogs/not-served-1/api/v1/all",
+		"/catalogs/not-served-2/api/v1/all",
+	} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, p, nil))
+	}
+
+	assert.InDelta(t, 2, testutil.ToFloat64(catalogdmetrics.CatalogRequestsMetric.WithLabelValues("200", "metrics-test", "all")), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(catalogdmetrics.CatalogRequestsMetric.WithLabelValues("404", "metrics-test", "other")), 0)
+	assert.InDelta(t, 2, testutil.ToFloat64(catalogdmetrics.CatalogRequestsMetric.WithLabelValues("200", "unknown", "all")), 0)
+
+	var size dto.Metric
+	require.NoError(t, catalogdmetrics.CatalogResponseSizeMetric.WithLabelValues("metrics-test", "all").(prometheus.Histogram).Write(&size))
+	assert.Equal(t, uint64(2), size.GetHistogram().GetSampleCount())
+	assert.InDelta(t, 2*len(body), size.GetHistogram().GetSampleSum(), 0)
+}
+
+func TestWithTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	})
+
+	cfg := CatalogServerConfig{
+		CatalogsPath: "/catalogs/",
+		LocalStorage: fakeStorage{catalogs: []string{"operatorhubio"}},
+	}
+	var handlerSpan trace.SpanContext
+	handler := cfg.withTracing(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		handlerSpan = trace.SpanContextFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/catalogs/operatorhubio/api/v1/all", nil)
+	req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "GET all", spans[0].Name())
+	assert.Contains(t, spans[0].Attributes(), tracing.CatalogKey.String("operatorhubio"))
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", spans[0].SpanContext().TraceID().String(), "the trace of the client is continued")
+	assert.Equal(t, "b7ad6b7169203331", spans[0].Parent().SpanID().String())
+	assert.Equal(t, spans[0].SpanContext().SpanID(), handlerSpan.SpanID(), "the span is available to the wrapped handler")
+}
@@ -0,0 +1,456 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"go.opentelemetry.io/otel/trace"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+
+	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+	catalogdmetrics "github.com/operator-framework/catalogd/internal/metrics"
+	"github.com/operator-framework/catalogd/internal/tracing"
+)
+
+const (
+	compositeMembersDir = "members"
+	compositeMergedDir  = "merged"
+	compositeMergedFile = "catalog.json"
+)
+
+// CatalogContentReader reads the content being served for a ClusterCatalog.
+type CatalogContentReader interface {
+	ContentReader(catalog string) (io.ReadCloser, string, error)
+}
+
+// Composite is an Unpacker for catalogs with a Composite source. It unpacks
+// the image members of a catalog with Images, reads the content of its
+// ClusterCatalog members with Catalogs, and merges them into a single FBC.
+//
+// The images of the members of a catalog named foo are unpacked as if they
+// were the catalogs foo/members/0, foo/members/1, and so on, so BaseCachePath
+// must be the BaseCachePath of Images for all of the content cached for a
+// catalog to be in its directory. The merged FBC is cached in
+// foo/merged/<digest>, where the digest identifies the resolved members and
+// how they were merged, so that the members are only merged again when one of
+// them changes.
+//
+// A catalog can not be one of its own members. If CatalogSources is set, it
+// returns the source of the ClusterCatalog with the given name, or nil if it
+// does not exist, and is used to also reject catalogs that are members of
+// themselves through other composite catalogs.
+//
+// Quota, if set, is the DiskQuota of Images, and pins the merged FBC in the
+// pins of the context of Unpack.
+type Composite struct {
+	BaseCachePath  string
+	Images         Unpacker
+	Catalogs       CatalogContentReader
+	CatalogSources func(ctx context.Context, name string) (*catalogdv1.CatalogSource, error)
+	Quota          *DiskQuota
+}
+
+func (c *Composite) Unpack(ctx context.Context, catalog *catalogdv1.ClusterCatalog) (*Result, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Composite.Unpack", trace.WithAttributes(tracing.CatalogKey.String(catalog.Name)))
+	result, err := c.unpack(ctx, catalog)
+	tracing.EndSpan(span, err)
+	return result, err
+}
+
+// compositeMember is a member of a composite source that has been resolved,
+// and whose content is ready to be loaded.
+type compositeMember struct {
+	resolved catalogdv1.ResolvedCompositeMember
+	priority int32
+	fsys     fs.FS
+	reader   io.ReadCloser
+}
+
+func (m *compositeMember) load(ctx context.Context) (*declcfg.DeclarativeConfig, error) {
+	if m.reader != nil {
+		return declcfg.LoadReader(m.reader)
+	}
+	return declcfg.LoadFS(ctx, m.fsys)
+}
+
+func (c *Composite) unpack(ctx context.Context, catalog *catalogdv1.ClusterCatalog) (*Result, error) {
+	if catalog.Spec.Source.Type != catalogdv1.SourceTypeComposite {
+		panic(fmt.Sprintf("programmer error: source type %q is unable to handle specified catalog source type %q", catalogdv1.SourceTypeComposite, catalog.Spec.Source.Type))
+	}
+	src := catalog.Spec.Source.Composite
+	if src == nil {
+		return nil, reconcile.TerminalError(fmt.Errorf("error parsing catalog, catalog %s has a nil composite source", catalog.Name))
+	}
+
+	if err := c.checkMembershipCycles(ctx, catalog); err != nil {
+		return nil, err
+	}
+
+	members := make([]*compositeMember, 0, len(src.Members))
+	defer func() {
+		for _, m := range members {
+			if m.reader != nil {
+				m.reader.Close()
+			}
+		}
+	}()
+	for i, spec := range src.Members {
+		m, err := c.resolveMember(ctx, catalog, i, spec)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving member %d: %w", i, err)
+		}
+		members = append(members, m)
+	}
+
+	key, err := mergeKey(src.ConflictPolicy, members)
+	if err != nil {
+		return nil, err
+	}
+	mergedRoot := filepath.Join(c.BaseCachePath, catalog.Name, compositeMergedDir)
+	mergedPath := filepath.Join(mergedRoot, key.String())
+	c.Quota.pin(ctx, mergedPath)
+	if stat, err := os.Stat(mergedPath); err == nil {
+		return compositeResult(mergedPath, members, stat.ModTime()), nil
+	}
+
+	cfgs := make([]*declcfg.DeclarativeConfig, 0, len(members))
+	for i, m := range members {
+		cfg, err := m.load(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error loading member %d: %w", i, err)
+		}
+		cfgs = append(cfgs, cfg)
+	}
+	priorities := make([]int32, 0, len(members))
+	for _, m := range members {
+		priorities = append(priorities, m.priority)
+	}
+	merged, err := mergeCatalogs(cfgs, priorities, src.ConflictPolicy)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := declcfg.ConvertToModel(*merged); err != nil {
+		return nil, fmt.Errorf("merged catalog is invalid: %w", err)
+	}
+	if err := writeMerged(mergedRoot, mergedPath, merged); err != nil {
+		return nil, fmt.Errorf("error writing merged catalog: %w", err)
+	}
+	if err := c.deleteStaleContent(catalog.Name, key, len(members)); err != nil {
+		return nil, fmt.Errorf("error deleting stale content: %w", err)
+	}
+	// Members that were removed, or are no longer images, are not pulled
+	// anymore.
+	imageMembers := sets.New[string]()
+	for i, spec := range src.Members {
+		if spec.Type == catalogdv1.CompositeMemberTypeImage {
+			imageMembers.Insert(compositeMemberName(catalog.Name, i))
+		}
+	}
+	catalogdmetrics.DeleteMemberMetrics(catalog.Name, imageMembers)
+	return compositeResult(mergedPath, members, time.Now()), nil
+}
+
+// compositeMemberName returns the name that the image of the member of the
+// composite catalog at index i is unpacked as.
+func compositeMemberName(catalog string, i int) string {
+	return path.Join(catalog, compositeMembersDir, strconv.Itoa(i))
+}
+
+func (c *Composite) resolveMember(ctx context.Context, catalog *catalogdv1.ClusterCatalog, i int, spec catalogdv1.CompositeMember) (*compositeMember, error) {
+	m := &compositeMember{
+		resolved: catalogdv1.ResolvedCompositeMember{Type: spec.Type},
+		priority: spec.Priority,
+	}
+	switch spec.Type {
+	case catalogdv1.CompositeMemberTypeImage:
+		if spec.Image == nil {
+			return nil, reconcile.TerminalError(errors.New("image member has a nil image source"))
+		}
+		result, err := c.Images.Unpack(ctx, &catalogdv1.ClusterCatalog{
+			ObjectMeta: metav1.ObjectMeta{Name: compositeMemberName(catalog.Name, i)},
+			Spec: catalogdv1.ClusterCatalogSpec{
+				Source: catalogdv1.CatalogSource{Type: catalogdv1.SourceTypeImage, Image: spec.Image},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		m.resolved.Image = result.ResolvedSource.Image
+		m.fsys = result.FS
+	case catalogdv1.CompositeMemberTypeClusterCatalog:
+		if spec.ClusterCatalog == nil {
+			return nil, reconcile.TerminalError(errors.New("ClusterCatalog member has a nil ClusterCatalog reference"))
+		}
+		name := spec.ClusterCatalog.Name
+		if name == catalog.Name {
+			return nil, reconcile.TerminalError(errors.New("a catalog can not be a member of itself"))
+		}
+		reader, contentDigest, err := c.Catalogs.ContentReader(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("ClusterCatalog %q is not serving any content", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m.resolved.ClusterCatalog = &catalogdv1.ResolvedClusterCatalogSource{Name: name, ContentDigest: contentDigest}
+		m.reader = reader
+	default:
+		return nil, reconcile.TerminalError(fmt.Errorf("unknown member type %q", spec.Type))
+	}
+	return m, nil
+}
+
+// checkMembershipCycles returns a terminal error if catalog is a member of
+// itself through the composite catalogs among its ClusterCatalog members, as
+// none of them could then be merged until another one is.
+func (c *Composite) checkMembershipCycles(ctx context.Context, catalog *catalogdv1.ClusterCatalog) error {
+	if c.CatalogSources == nil {
+		return nil
+	}
+	visited := sets.New[string]()
+	var visit func(chain []string, src *catalogdv1.CatalogSource) error
+	visit = func(chain []string, src *catalogdv1.CatalogSource) error {
+		if src.Type != catalogdv1.SourceTypeComposite || src.Composite == nil {
+			return nil
+		}
+		for _, m := range src.Composite.Members {
+			if m.ClusterCatalog == nil {
+				continue
+			}
+			name := m.ClusterCatalog.Name
+			if name == catalog.Name {
+				// Direct references to itself are rejected when
+				// resolving the members.
+				if len(chain) > 1 {
+					return reconcile.TerminalError(fmt.Errorf("catalog is a member of itself through %s", strings.Join(append(chain[1:], name), " -> ")))
+				}
+				continue
+			}
+			if visited.Has(name) {
+				continue
+			}
+			visited.Insert(name)
+			memberSrc, err := c.CatalogSources(ctx, name)
+			if err != nil {
+				return fmt.Errorf("error getting source of ClusterCatalog %q: %w", name, err)
+			}
+			if memberSrc == nil {
+				continue
+			}
+			if err := visit(append(slices.Clone(chain), name), memberSrc); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return visit([]string{catalog.Name}, &catalog.Spec.Source)
+}
+
+// mergeKey returns a digest identifying the result of merging members with
+// policy.
+func mergeKey(policy catalogdv1.ConflictPolicy, members []*compositeMember) (digest.Digest, error) {
+	type keyMember struct {
+		Resolved catalogdv1.ResolvedCompositeMember `json:"resolved"`
+		Priority int32                              `json:"priority"`
+	}
+	key := struct {
+		ConflictPolicy catalogdv1.ConflictPolicy `json:"conflictPolicy"`
+		Members        []keyMember               `json:"members"`
+	}{ConflictPolicy: policy}
+	for _, m := range members {
+		key.Members = append(key.Members, keyMember{Resolved: m.resolved, Priority: m.priority})
+	}
+	data, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	return digest.FromBytes(data), nil
+}
+
+// mergeCatalogs merges cfgs package by package. All of the objects of a
+// package are taken from the catalog chosen for it by policy, while objects
+// that do not belong to a package are taken from every catalog.
+func mergeCatalogs(cfgs []*declcfg.DeclarativeConfig, priorities []int32, policy catalogdv1.ConflictPolicy) (*declcfg.DeclarativeConfig, error) {
+	containedBy := map[string][]int{}
+	for i, cfg := range cfgs {
+		for _, pkg := range sets.List(packagesOf(cfg)) {
+			containedBy[pkg] = append(containedBy[pkg], i)
+		}
+	}
+
+	source := make(map[string]int, len(containedBy))
+	var conflicts []string
+	for pkg, members := range containedBy {
+		switch {
+		case len(members) == 1, policy == catalogdv1.ConflictPolicyPreferFirst:
+			source[pkg] = members[0]
+		case policy == catalogdv1.ConflictPolicyPreferPriority:
+			// members is in ascending order, so the first member with the
+			// highest priority wins ties.
+			best := members[0]
+			for _, m := range members[1:] {
+				if priorities[m] > priorities[best] {
+					best = m
+				}
+			}
+			source[pkg] = best
+		default:
+			conflicts = append(conflicts, fmt.Sprintf("%q (members %s)", pkg, joinInts(members)))
+		}
+	}
+	if len(conflicts) > 0 {
+		slices.Sort(conflicts)
+		return nil, fmt.Errorf("packages contained in more than one member: %s", strings.Join(conflicts, ", "))
+	}
+
+	merged := &declcfg.DeclarativeConfig{}
+	for i, cfg := range cfgs {
+		fromMember := func(pkg string) bool { return source[pkg] == i }
+		merged.Packages = append(merged.Packages, filterSlice(cfg.Packages, func(p declcfg.Package) bool { return fromMember(p.Name) })...)
+		merged.Channels = append(merged.Channels, filterSlice(cfg.Channels, func(c declcfg.Channel) bool { return fromMember(c.Package) })...)
+		merged.Bundles = append(merged.Bundles, filterSlice(cfg.Bundles, func(b declcfg.Bundle) bool { return fromMember(b.Package) })...)
+		merged.Deprecations = append(merged.Deprecations, filterSlice(cfg.Deprecations, func(d declcfg.Deprecation) bool { return fromMember(d.Package) })...)
+		merged.Others = append(merged.Others, filterSlice(cfg.Others, func(m declcfg.Meta) bool { return m.Package == "" || fromMember(m.Package) })...)
+	}
+	return merged, nil
+}
+
+func packagesOf(cfg *declcfg.DeclarativeConfig) sets.Set[string] {
+	pkgs := sets.New[string]()
+	for _, p := range cfg.Packages {
+		pkgs.Insert(p.Name)
+	}
+	for _, c := range cfg.Channels {
+		pkgs.Insert(c.Package)
+	}
+	for _, b := range cfg.Bundles {
+		pkgs.Insert(b.Package)
+	}
+	for _, d := range cfg.Deprecations {
+		pkgs.Insert(d.Package)
+	}
+	for _, m := range cfg.Others {
+		if m.Package != "" {
+			pkgs.Insert(m.Package)
+		}
+	}
+	return pkgs
+}
+
+func filterSlice[T any](s []T, keep func(T) bool) []T {
+	var out []T
+	for _, v := range s {
+		if keep(v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func joinInts(ints []int) string {
+	s := make([]string, 0, len(ints))
+	for _, i := range ints {
+		s = append(s, strconv.Itoa(i))
+	}
+	return strings.Join(s, ", ")
+}
+
+// writeMerged writes cfg to mergedPath. The content is written to a temporary
+// directory first so that mergedPath only ever holds complete content.
+func writeMerged(mergedRoot, mergedPath string, cfg *declcfg.DeclarativeConfig) error {
+	if err := os.MkdirAll(mergedRoot, 0700); err != nil {
+		return err
+	}
+	tmpDir, err := os.MkdirTemp(mergedRoot, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	f, err := os.Create(filepath.Join(tmpDir, compositeMergedFile))
+	if err != nil {
+		return err
+	}
+	if err := declcfg.WriteJSON(*cfg, f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpDir, mergedPath)
+}
+
+// deleteStaleContent deletes the content cached for a catalog that is not
+// needed by its current members: previously merged content, images of members
+// that were removed, and any images cached while it had a different source type.
+func (c *Composite) deleteStaleContent(catalogName string, key digest.Digest, numMembers int) error {
+	catalogPath := filepath.Join(c.BaseCachePath, catalogName)
+	keep := map[string]sets.Set[string]{
+		catalogPath: sets.New(compositeMembersDir, compositeMergedDir),
+		filepath.Join(catalogPath, compositeMergedDir):  sets.New(key.String()),
+		filepath.Join(catalogPath, compositeMembersDir): sets.New[string](),
+	}
+	for i := range numMembers {
+		keep[filepath.Join(catalogPath, compositeMembersDir)].Insert(strconv.Itoa(i))
+	}
+	for dir, names := range keep {
+		entries, err := os.ReadDir(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if names.Has(e.Name()) {
+				continue
+			}
+			if err := deleteRecursive(filepath.Join(dir, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func compositeResult(mergedPath string, members []*compositeMember, lastUnpacked time.Time) *Result {
+	resolved := make([]catalogdv1.ResolvedCompositeMember, 0, len(members))
+	for _, m := range members {
+		resolved = append(resolved, m.resolved)
+	}
+	return &Result{
+		FS: os.DirFS(mergedPath),
+		ResolvedSource: &catalogdv1.ResolvedCatalogSource{
+			Type:      catalogdv1.SourceTypeComposite,
+			Composite: &catalogdv1.ResolvedCompositeSource{Members: resolved},
+		},
+		State:   StateUnpacked,
+		Message: fmt.Sprintf("merged %d members successfully", len(members)),
+		// See successResult for why the times are truncated.
+		UnpackTime:                lastUnpacked.Truncate(time.Second),
+		LastSuccessfulPollAttempt: metav1.NewTime(time.Now().Truncate(time.Second)),
+	}
+}
+
+func (c *Composite) Cleanup(_ context.Context, catalog *catalogdv1.ClusterCatalog) error {
+	if err := deleteRecursive(filepath.Join(c.BaseCachePath, catalog.Name)); err != nil {
+		return fmt.Errorf("error deleting catalog cache: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+package source_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+
+	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+	catalogdmetrics "github.com/operator-framework/catalogd/internal/metrics"
+	"github.com/operator-framework/catalogd/internal/source"
+)
+
+// fakeImages unpacks the images of composite members from memory, keyed by
+// their reference.
+type fakeImages struct {
+	images   map[string]fstest.MapFS
+	unpacked []string
+}
+
+func (f *fakeImages) Unpack(_ context.Context, catalog *catalogdv1.ClusterCatalog) (*source.Result, error) {
+	ref := catalog.Spec.Source.Image.Ref
+	fsys, ok := f.images[ref]
+	if !ok {
+		return nil, fmt.Errorf("image %q not found", ref)
+	}
+	f.unpacked = append(f.unpacked, catalog.Name)
+	return &source.Result{
+		FS:             fsys,
+		ResolvedSource: &catalogdv1.ResolvedCatalogSource{Type: catalogdv1.SourceTypeImage, Image: &catalogdv1.ResolvedImageSource{Ref: ref + "@sha256:0"}},
+		State:          source.StateUnpacked,
+	}, nil
+}
+
+func (f *fakeImages) Cleanup(context.Context, *catalogdv1.ClusterCatalog) error { return nil }
+
+// fakeCatalogs serves the content of ClusterCatalog members from memory.
+type fakeCatalogs map[string]string
+
+func (f fakeCatalogs) ContentReader(catalog string) (io.ReadCloser, string, error) {
+	content, ok := f[catalog]
+	if !ok {
+		return nil, "", fs.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewBufferString(content)), "sha256:" + catalog, nil
+}
+
+func packageFBC(pkg, bundleImage string) string {
+	return fmt.Sprintf(`{"schema":"olm.package","name":%[1]q,"defaultChannel":"stable"}
+{"schema":"olm.channel","package":%[1]q,"name":"stable","entries":[{"name":"%[1]s.v1.0.0"}]}
+{"schema":"olm.bundle","package":%[1]q,"name":"%[1]s.v1.0.0","image":%[2]q,"properties":[{"type":"olm.package","value":{"packageName":%[1]q,"version":"1.0.0"}}]}
+`, pkg, bundleImage)
+}
+
+func imageFS(content string) fstest.MapFS {
+	return fstest.MapFS{"catalog.json": &fstest.MapFile{Data: []byte(content)}}
+}
+
+func compositeCatalog(policy catalogdv1.ConflictPolicy, members ...catalogdv1.CompositeMember) *catalogdv1.ClusterCatalog {
+	return &catalogdv1.ClusterCatalog{
+		ObjectMeta: metav1.ObjectMeta{Name: "composite"},
+		Spec: catalogdv1.ClusterCatalogSpec{
+			Source: catalogdv1.CatalogSource{
+				Type:      catalogdv1.SourceTypeComposite,
+				Composite: &catalogdv1.CompositeSource{Members: members, ConflictPolicy: policy},
+			},
+		},
+	}
+}
+
+func imageMember(ref string, priority int32) catalogdv1.CompositeMember {
+	return catalogdv1.CompositeMember{Type: catalogdv1.CompositeMemberTypeImage, Image: &catalogdv1.ImageSource{Ref: ref}, Priority: priority}
+}
+
+func catalogMember(name string, priority int32) catalogdv1.CompositeMember {
+	return catalogdv1.CompositeMember{Type: catalogdv1.CompositeMemberTypeClusterCatalog, ClusterCatalog: &catalogdv1.ClusterCatalogReference{Name: name}, Priority: priority}
+}
+
+// bundleImages returns the image of the bundle of each package of the
+// catalog in fsys.
+func bundleImages(t *testing.T, fsys fs.FS) map[string]string {
+	cfg, err := declcfg.LoadFS(context.Background(), fsys)
+	require.NoError(t, err)
+	images := map[string]string{}
+	for _, b := range cfg.Bundles {
+		images[b.Package] = b.Image
+	}
+	return images
+}
+
+func TestCompositeUnpack(t *testing.T) {
+	images := &fakeImages{images: map[string]fstest.MapFS{
+		"example.com/overlay:latest": imageFS(packageFBC("foo", "overlay/foo") + `{"schema":"custom.schema"}` + "\n"),
+		"example.com/other:latest":   imageFS(packageFBC("qux", "other/qux")),
+	}}
+	catalogs := fakeCatalogs{
+		"vendor": packageFBC("foo", "vendor/foo") + packageFBC("bar", "vendor/bar"),
+		"cyclic": packageFBC("baz", "cyclic/baz"),
+	}
+	sources := map[string]*catalogdv1.CatalogSource{
+		"vendor": {Type: catalogdv1.SourceTypeImage, Image: &catalogdv1.ImageSource{Ref: "example.com/vendor:latest"}},
+		"cyclic": &compositeCatalog(catalogdv1.ConflictPolicyFail, catalogMember("middle", 0)).Spec.Source,
+		"middle": &compositeCatalog(catalogdv1.ConflictPolicyFail, catalogMember("vendor", 0), catalogMember("composite", 0)).Spec.Source,
+	}
+
+	for _, tt := range []struct {
+		name         string
+		catalog      *catalogdv1.ClusterCatalog
+		wantImages   map[string]string
+		wantErr      string
+		wantTerminal bool
+		wantResolved []catalogdv1.ResolvedCompositeMember
+		wantUnpacked []string
+	}{
+		{
+			name:       "members without conflicts",
+			catalog:    compositeCatalog(catalogdv1.ConflictPolicyFail, imageMember("example.com/other:latest", 0), catalogMember("vendor", 0)),
+			wantImages: map[string]string{"qux": "other/qux", "foo": "vendor/foo", "bar": "vendor/bar"},
+			wantResolved: []catalogdv1.ResolvedCompositeMember{
+				{Type: catalogdv1.CompositeMemberTypeImage, Image: &catalogdv1.ResolvedImageSource{Ref: "example.com/other:latest@sha256:0"}},
+				{Type: catalogdv1.CompositeMemberTypeClusterCatalog, ClusterCatalog: &catalogdv1.ResolvedClusterCatalogSource{Name: "vendor", ContentDigest: "sha256:vendor"}},
+			},
+			wantUnpacked: []string{"composite/members/0"},
+		},
+		{
+			name:    "conflict with Fail policy",
+			catalog: compositeCatalog(catalogdv1.ConflictPolicyFail, imageMember("example.com/overlay:latest", 0), catalogMember("vendor", 0)),
+			wantErr: `packages contained in more than one member: "foo" (members 0, 1)`,
+		},
+		{
+			name:       "conflict with PreferFirst policy",
+			catalog:    compositeCatalog(catalogdv1.ConflictPolicyPreferFirst, imageMember("example.com/overlay:latest", 0), catalogMember("vendor", 10)),
+			wantImages: map[string]string{"foo": "overlay/foo", "bar": "vendor/bar"},
+		},
+		{
+			name:       "conflict with PreferPriority policy",
+			catalog:    compositeCatalog(catalogdv1.ConflictPolicyPreferPriority, imageMember("example.com/overlay:latest", 0), catalogMember("vendor", 10)),
+			wantImages: map[string]string{"foo": "vendor/foo", "bar": "vendor/bar"},
+		},
+		{
+			name:       "conflict with PreferPriority policy between members of the same priority",
+			catalog:    compositeCatalog(catalogdv1.ConflictPolicyPreferPriority, catalogMember("vendor", 0), imageMember("example.com/overlay:latest", 0)),
+			wantImages: map[string]string{"foo": "vendor/foo", "bar": "vendor/bar"},
+		},
+		{
+			name:    "member catalog without content",
+			catalog: compositeCatalog(catalogdv1.ConflictPolicyFail, catalogMember("missing", 0)),
+			wantErr: `error resolving member 0: ClusterCatalog "missing" is not serving any content`,
+		},
+		{
+			name:         "member of itself",
+			catalog:      compositeCatalog(catalogdv1.ConflictPolicyFail, catalogMember("composite", 0)),
+			wantErr:      "error resolving member 0: terminal error: a catalog can not be a member of itself",
+			wantTerminal: true,
+		},
+		{
+			name:         "member of itself through other composite catalogs",
+			catalog:      compositeCatalog(catalogdv1.ConflictPolicyFail, catalogMember("vendor", 0), catalogMember("cyclic", 0)),
+			wantErr:      "terminal error: catalog is a member of itself through cyclic -> middle -> composite",
+			wantTerminal: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			images.unpacked = nil
+			composite := &source.Composite{
+				BaseCachePath: t.TempDir(),
+				Images:        images,
+				Catalogs:      catalogs,
+				CatalogSources: func(_ context.Context, name string) (*catalogdv1.CatalogSource, error) {
+					return sources[name], nil
+				},
+			}
+			result, err := composite.Unpack(context.Background(), tt.catalog)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				assert.Equal(t, tt.wantTerminal, errors.Is(err, reconcile.TerminalError(nil)))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, source.StateUnpacked, result.State)
+			assert.Equal(t, catalogdv1.SourceTypeComposite, result.ResolvedSource.Type)
+			assert.Equal(t, tt.wantImages, bundleImages(t, result.FS))
+			if tt.wantResolved != nil {
+				assert.Equal(t, tt.wantResolved, result.ResolvedSource.Composite.Members)
+			}
+			if tt.wantUnpacked != nil {
+				assert.Equal(t, tt.wantUnpacked, images.unpacked)
+			}
+		})
+	}
+}
+
+func TestCompositeUnpackCache(t *testing.T) {
+	images := &fakeImages{images: map[string]fstest.MapFS{
+		"example.com/overlay:latest": imageFS(packageFBC("foo", "overlay/foo")),
+	}}
+	catalogs := fakeCatalogs{"vendor": packageFBC("bar", "vendor/bar")}
+	cacheDir := t.TempDir()
+	composite := &source.Composite{BaseCachePath: cacheDir, Images: images, Catalogs: catalogs}
+	catalog := compositeCatalog(catalogdv1.ConflictPolicyFail, imageMember("example.com/overlay:latest", 0), catalogMember("vendor", 0))
+
+	// Content cached while the catalog had an image source is deleted.
+	require.NoError(t, os.MkdirAll(filepath.Join(cacheDir, "composite", "sha256:1"), 0700))
+
+	first, err := composite.Unpack(context.Background(), catalog)
+	require.NoError(t, err)
+	entries, err := os.ReadDir(filepath.Join(cacheDir, "composite"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "merged", entries[0].Name())
+
+	// Members whose digests are unchanged are not merged again, even though
+	// the content of the image has been modified behind the fake.
+	images.images["example.com/overlay:latest"] = imageFS(packageFBC("foo", "modified/foo"))
+	second, err := composite.Unpack(context.Background(), catalog)
+	require.NoError(t, err)
+	assert.Equal(t, first.UnpackTime, second.UnpackTime)
+	assert.Equal(t, map[string]string{"foo": "overlay/foo", "bar": "vendor/bar"}, bundleImages(t, second.FS))
+
+	// A change to how the members are merged is merged again.
+	catalog.Spec.Source.Composite.ConflictPolicy = catalogdv1.ConflictPolicyPreferFirst
+	third, err := composite.Unpack(context.Background(), catalog)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"foo": "modified/foo", "bar": "vendor/bar"}, bundleImages(t, third.FS))
+	merged, err := os.ReadDir(filepath.Join(cacheDir, "composite", "merged"))
+	require.NoError(t, err)
+	assert.Len(t, merged, 1, "previously merged content is deleted")
+
+	require.NoError(t, composite.Cleanup(context.Background(), catalog))
+	assert.NoDirExists(t, filepath.Join(cacheDir, "composite"))
+}
+
+func TestCompositeUnpackDeletesMetricsOfRemovedMembers(t *testing.T) {
+	images := &fakeImages{images: map[string]fstest.MapFS{
+		"example.com/overlay:latest": imageFS(packageFBC("foo", "overlay/foo")),
+	}}
+	composite := &source.Composite{BaseCachePath: t.TempDir(), Images: images, Catalogs: fakeCatalogs{"vendor": packageFBC("bar", "vendor/bar")}}
+	for _, member := range []string{"composite/members/0", "composite/members/1", "composite/members/2", "other/members/1"} {
+		catalogdmetrics.PulledBytesMetric.WithLabelValues(member).Set(100)
+	}
+
+	catalog := compositeCatalog(catalogdv1.ConflictPolicyFail, imageMember("example.com/overlay:latest", 0), catalogMember("vendor", 0))
+	_, err := composite.Unpack(context.Background(), catalog)
+	require.NoError(t, err)
+	// DeleteLabelValues returns whether the series still existed.
+	assert.False(t, catalogdmetrics.PulledBytesMetric.DeleteLabelValues("composite/members/1"))
+	assert.False(t, catalogdmetrics.PulledBytesMetric.DeleteLabelValues("composite/members/2"))
+	assert.True(t, catalogdmetrics.PulledBytesMetric.DeleteLabelValues("composite/members/0"))
+
+	catalogdmetrics.PulledBytesMetric.WithLabelValues("composite/members/0").Set(100)
+	catalogdmetrics.DeleteCatalogMetrics("composite")
+	assert.False(t, catalogdmetrics.PulledBytesMetric.DeleteLabelValues("composite/members/0"))
+	assert.True(t, catalogdmetrics.PulledBytesMetric.DeleteLabelValues("other/members/1"))
+}
+
+func TestCompositeUnpackPinsMergedContent(t *testing.T) {
+	cacheDir := t.TempDir()
+	quota := &source.DiskQuota{Root: cacheDir, MaxBytes: 1 << 20, CachePaths: []string{cacheDir}}
+	composite := &source.Composite{BaseCachePath: cacheDir, Images: &fakeImages{}, Catalogs: fakeCatalogs{"vendor": packageFBC("bar", "vendor/bar")}, Quota: quota}
+	// evict tries to make room by evicting every unpacked image and merged
+	// FBC of other catalogs.
+	evict := func() error {
+		quota.MaxBytes = 1
+		defer func() { quota.MaxBytes = 1 << 20 }()
+		_, err := quota.Reserve(context.Background(), filepath.Join(cacheDir, "other"), "", 0)
+		return err
+	}
+
+	ctx, unpin := source.WithPins(context.Background())
+	_, err := composite.Unpack(ctx, compositeCatalog(catalogdv1.ConflictPolicyFail, catalogMember("vendor", 0)))
+	require.NoError(t, err)
+	merged, err := filepath.Glob(filepath.Join(cacheDir, "composite", "merged", "sha256:*"))
+	require.NoError(t, err)
+	require.Len(t, merged, 1)
+
+	require.ErrorContains(t, evict(), "cache directory disk budget")
+	assert.DirExists(t, merged[0], "pinned merged FBC is not evicted")
+
+	unpin()
+	require.NoError(t, evict())
+	assert.NoDirExists(t, merged[0])
+}
+
+func TestRouter(t *testing.T) {
+	images := &fakeImages{images: map[string]fstest.MapFS{"example.com/foo:latest": imageFS(packageFBC("foo", "foo"))}}
+	router := source.Router{catalogdv1.SourceTypeImage: images}
+
+	result, err := router.Unpack(context.Background(), &catalogdv1.ClusterCatalog{
+		ObjectMeta: metav1.ObjectMeta{Name: "image"},
+		Spec: catalogdv1.ClusterCatalogSpec{Source: catalogdv1.CatalogSource{
+			Type:  catalogdv1.SourceTypeImage,
+			Image: &catalogdv1.ImageSource{Ref: "example.com/foo:latest"},
+		}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "example.com/foo:latest@sha256:0", result.ResolvedSource.Image.Ref)
+
+	_, err = router.Unpack(context.Background(), compositeCatalog(catalogdv1.ConflictPolicyFail))
+	require.EqualError(t, err, `terminal error: unsupported source type "Composite"`)
+	assert.True(t, errors.Is(err, reconcile.TerminalError(nil)))
+}
@@ -24,11 +24,16 @@ import (
 	"github.com/containers/image/v5/types"
 	"github.com/go-logr/logr"
 	"github.com/opencontainers/go-digest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+	catalogdmetrics "github.com/operator-framework/catalogd/internal/metrics"
+	"github.com/operator-framework/catalogd/internal/tracing"
 )
 
 const ConfigDirLabel = "operators.operatorframework.io.index.configs.v1"
@@ -36,9 +41,31 @@ const ConfigDirLabel = "operators.operatorframework.io.index.configs.v1"
 type ContainersImageRegistry struct {
 	BaseCachePath     string
 	SourceContextFunc func(logger logr.Logger) (*types.SystemContext, error)
+	// AuthFunc, if set, returns the credentials used to pull the image of a
+	// catalog, in the format of an auth file, instead of the auth file of the
+	// context returned by SourceContextFunc. It returns nil if the image is
+	// pulled without credentials.
+	AuthFunc func(ctx context.Context, catalog *catalogdv1.ClusterCatalog) ([]byte, error)
+	// MaxContentBytes, if positive, is the maximum size of an image, and of
+	// its layers once decompressed. Larger images are not unpacked.
+	MaxContentBytes int64
+	// Quota, if set, reserves room in the cache directory for the layers of
+	// an image as they are decompressed, and pins the unpacked image in the
+	// pins of the context of Unpack.
+	Quota *DiskQuota
 }
 
 func (i *ContainersImageRegistry) Unpack(ctx context.Context, catalog *catalogdv1.ClusterCatalog) (*Result, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "ContainersImageRegistry.Unpack", trace.WithAttributes(tracing.CatalogKey.String(catalog.Name)))
+	result, err := i.unpack(ctx, catalog)
+	if err == nil && result.ResolvedSource != nil && result.ResolvedSource.Image != nil {
+		span.SetAttributes(attribute.String("catalogd.image.ref", result.ResolvedSource.Image.Ref))
+	}
+	tracing.EndSpan(span, err)
+	return result, err
+}
+
+func (i *ContainersImageRegistry) unpack(ctx context.Context, catalog *catalogdv1.ClusterCatalog) (*Result, error) {
 	l := log.FromContext(ctx)
 
 	if catalog.Spec.Source.Type != catalogdv1.SourceTypeImage {
@@ -53,15 +80,33 @@ func (i *ContainersImageRegistry) Unpack(ctx context.Context, catalog *catalogdv
 	if err != nil {
 		return nil, err
 	}
+	if i.AuthFunc != nil {
+		authFile, err := i.writeAuthFile(ctx, catalog)
+		if err != nil {
+			return nil, err
+		}
+		if authFile != "" {
+			defer func() {
+				if err := os.Remove(authFile); err != nil {
+					l.Error(err, "error removing temporary auth file")
+				}
+			}()
+		}
+		srcCtx.AuthFilePath = authFile
+	}
 	//////////////////////////////////////////////////////
 	//
 	// Resolve a canonical reference for the image.
 	//
 	//////////////////////////////////////////////////////
-	imgRef, canonicalRef, specIsCanonical, err := resolveReferences(ctx, catalog.Spec.Source.Image.Ref, srcCtx)
+	resolveStart := time.Now()
+	resolveCtx, resolveSpan := tracing.Tracer().Start(ctx, "resolve")
+	imgRef, canonicalRef, specIsCanonical, err := resolveReferences(resolveCtx, catalog.Spec.Source.Image.Ref, srcCtx)
+	tracing.EndSpan(resolveSpan, err)
 	if err != nil {
 		return nil, err
 	}
+	catalogdmetrics.CatalogOperationDurationMetric.WithLabelValues(catalogdmetrics.OperationResolve).Observe(time.Since(resolveStart).Seconds())
 
 	//////////////////////////////////////////////////////
 	//
@@ -70,6 +115,7 @@ func (i *ContainersImageRegistry) Unpack(ctx context.Context, catalog *catalogdv
 	//
 	//////////////////////////////////////////////////////
 	unpackPath := i.unpackPath(catalog.Name, canonicalRef.Digest())
+	i.Quota.pin(ctx, unpackPath)
 	if unpackStat, err := os.Stat(unpackPath); err == nil {
 		if !unpackStat.IsDir() {
 			panic(fmt.Sprintf("unexpected file at unpack path %q: expected a directory", unpackPath))
@@ -93,7 +139,8 @@ func (i *ContainersImageRegistry) Unpack(ctx context.Context, catalog *catalogdv
 		return nil, fmt.Errorf("error creating source reference: %w", err)
 	}
 
-	layoutDir, err := os.MkdirTemp("", fmt.Sprintf("oci-layout-%s", catalog.Name))
+	// The names of the members of composite catalogs contain path separators.
+	layoutDir, err := os.MkdirTemp("", OCILayoutTempDirPrefix+strings.ReplaceAll(catalog.Name, "/", "-"))
 	if err != nil {
 		return nil, fmt.Errorf("error creating temporary directory: %w", err)
 	}
@@ -103,6 +150,29 @@ func (i *ContainersImageRegistry) Unpack(ctx context.Context, catalog *catalogdv
 		}
 	}()
 
+	//////////////////////////////////////////////////////
+	//
+	// Check that the image fits in the limits before
+	// pulling it. The temporary OCI layout is not in the
+	// cache directory, so room is only reserved for the
+	// layers as they are decompressed into it.
+	//
+	//////////////////////////////////////////////////////
+	if i.MaxContentBytes > 0 {
+		imgSize, err := imageSize(ctx, dockerRef, srcCtx)
+		if err != nil {
+			return nil, err
+		}
+		if imgSize > i.MaxContentBytes {
+			return nil, wrapTerminal(fmt.Errorf("image size of %d bytes exceeds the maximum content size of %d bytes", imgSize, i.MaxContentBytes), specIsCanonical)
+		}
+	}
+	reservation, err := i.Quota.Reserve(ctx, i.catalogPath(catalog.Name), unpackPath, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer reservation.Release()
+
 	layoutRef, err := layout.NewReference(layoutDir, canonicalRef.String())
 	if err != nil {
 		return nil, fmt.Errorf("error creating reference: %w", err)
@@ -129,7 +199,9 @@ func (i *ContainersImageRegistry) Unpack(ctx context.Context, catalog *catalogdv
 	// Pull the image from the source to the destination
 	//
 	//////////////////////////////////////////////////////
-	if _, err := copy.Image(ctx, policyContext, layoutRef, dockerRef, &copy.Options{
+	pullStart := time.Now()
+	copyCtx, copySpan := tracing.Tracer().Start(ctx, "copy")
+	_, err = copy.Image(copyCtx, policyContext, layoutRef, dockerRef, &copy.Options{
 		SourceCtx: srcCtx,
 		// We use the OCI layout as a temporary storage and
 		// pushing signatures for OCI images is not supported
@@ -137,22 +209,35 @@ func (i *ContainersImageRegistry) Unpack(ctx context.Context, catalog *catalogdv
 		// Signature validation will still be performed
 		// accordingly to a provided policy context.
 		RemoveSignatures: true,
-	}); err != nil {
+	})
+	tracing.EndSpan(copySpan, err)
+	if err != nil {
 		return nil, fmt.Errorf("error copying image: %w", err)
 	}
+	catalogdmetrics.CatalogOperationDurationMetric.WithLabelValues(catalogdmetrics.OperationPull).Observe(time.Since(pullStart).Seconds())
 	l.Info("pulled image", "ref", imgRef.String(), "digest", canonicalRef.Digest().String())
+	if pulledBytes, err := dirSize(layoutDir); err != nil {
+		l.Error(err, "error computing size of pulled image")
+	} else {
+		catalogdmetrics.PulledBytesMetric.WithLabelValues(catalog.Name).Set(float64(pulledBytes))
+	}
 
 	//////////////////////////////////////////////////////
 	//
 	// Mount the image we just pulled
 	//
 	//////////////////////////////////////////////////////
-	if err := i.unpackImage(ctx, unpackPath, layoutRef, specIsCanonical, srcCtx); err != nil {
+	unpackStart := time.Now()
+	applyCtx, applySpan := tracing.Tracer().Start(ctx, "apply layers")
+	err = i.unpackImage(applyCtx, unpackPath, layoutRef, specIsCanonical, srcCtx, reservation)
+	tracing.EndSpan(applySpan, err)
+	if err != nil {
 		if cleanupErr := deleteRecursive(unpackPath); cleanupErr != nil {
 			err = errors.Join(err, cleanupErr)
 		}
 		return nil, fmt.Errorf("error unpacking image: %w", err)
 	}
+	catalogdmetrics.CatalogOperationDurationMetric.WithLabelValues(catalogdmetrics.OperationUnpack).Observe(time.Since(unpackStart).Seconds())
 
 	//////////////////////////////////////////////////////
 	//
@@ -188,6 +273,33 @@ func successResult(unpackPath string, canonicalRef reference.Canonical, lastUnpa
 	}
 }
 
+// writeAuthFile writes the credentials returned by AuthFunc for catalog to a
+// temporary file, and returns its path. It returns an empty path if there are
+// no credentials for catalog.
+func (i *ContainersImageRegistry) writeAuthFile(ctx context.Context, catalog *catalogdv1.ClusterCatalog) (string, error) {
+	auth, err := i.AuthFunc(ctx, catalog)
+	if err != nil {
+		return "", fmt.Errorf("error getting credentials to pull image: %w", err)
+	}
+	if auth == nil {
+		return "", nil
+	}
+	f, err := os.CreateTemp("", fmt.Sprintf("auth-%s-*.json", strings.ReplaceAll(catalog.Name, "/", "-")))
+	if err != nil {
+		return "", fmt.Errorf("error creating temporary auth file: %w", err)
+	}
+	if _, err := f.Write(auth); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return "", fmt.Errorf("error writing temporary auth file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return "", fmt.Errorf("error writing temporary auth file: %w", err)
+	}
+	return f.Name(), nil
+}
+
 func (i *ContainersImageRegistry) Cleanup(_ context.Context, catalog *catalogdv1.ClusterCatalog) error {
 	if err := deleteRecursive(i.catalogPath(catalog.Name)); err != nil {
 		return fmt.Errorf("error deleting catalog cache: %w", err)
@@ -203,8 +315,14 @@ func (i *ContainersImageRegistry) unpackPath(catalogName string, digest digest.D
 	return filepath.Join(i.catalogPath(catalogName), digest.String())
 }
 
+// ParseImageReference parses the reference of the image of an Image source
+// the way it is parsed before the image is pulled.
+func ParseImageReference(ref string) (reference.Named, error) {
+	return reference.ParseNamed(ref)
+}
+
 func resolveReferences(ctx context.Context, ref string, sourceContext *types.SystemContext) (reference.Named, reference.Canonical, bool, error) {
-	imgRef, err := reference.ParseNamed(ref)
+	imgRef, err := ParseImageReference(ref)
 	if err != nil {
 		return nil, nil, false, reconcile.TerminalError(fmt.Errorf("error parsing image reference %q: %w", ref, err))
 	}
@@ -259,7 +377,7 @@ func loadPolicyContext(sourceContext *types.SystemContext, l logr.Logger) (*sign
 	return signature.NewPolicyContext(policy)
 }
 
-func (i *ContainersImageRegistry) unpackImage(ctx context.Context, unpackPath string, imageReference types.ImageReference, specIsCanonical bool, sourceContext *types.SystemContext) error {
+func (i *ContainersImageRegistry) unpackImage(ctx context.Context, unpackPath string, imageReference types.ImageReference, specIsCanonical bool, sourceContext *types.SystemContext, reservation *Reservation) error {
 	img, err := imageReference.NewImage(ctx, sourceContext)
 	if err != nil {
 		return fmt.Errorf("error reading image: %w", err)
@@ -293,6 +411,12 @@ func (i *ContainersImageRegistry) unpackImage(ctx context.Context, unpackPath st
 	}
 	l := log.FromContext(ctx)
 	l.Info("unpacking image", "path", unpackPath)
+	// The decompressed size of the layers is only known once they are
+	// decompressed, and can be much larger than the size of the image.
+	var remaining *int64
+	if i.MaxContentBytes > 0 {
+		remaining = ptr.To(i.MaxContentBytes)
+	}
 	for i, layerInfo := range img.LayerInfos() {
 		if err := func() error {
 			layerReader, _, err := layoutSrc.GetBlob(ctx, layerInfo, none.NoCache)
@@ -301,7 +425,10 @@ func (i *ContainersImageRegistry) unpackImage(ctx context.Context, unpackPath st
 			}
 			defer layerReader.Close()
 
-			if err := applyLayer(ctx, unpackPath, dirToUnpack, layerReader); err != nil {
+			if err := applyLayer(ctx, unpackPath, dirToUnpack, layerReader, remaining, reservation); err != nil {
+				if errors.Is(err, errMaxContentBytesExceeded) {
+					return wrapTerminal(fmt.Errorf("error applying layer[%d]: decompressed layers exceed the maximum content size", i), specIsCanonical)
+				}
 				return fmt.Errorf("error applying layer[%d]: %w", i, err)
 			}
 			l.Info("applied layer", "layer", i)
@@ -316,17 +443,93 @@ func (i *ContainersImageRegistry) unpackImage(ctx context.Context, unpackPath st
 	return nil
 }
 
-func applyLayer(ctx context.Context, destPath string, srcPath string, layer io.ReadCloser) error {
+// applyLayer applies layer to destPath. If remaining is not nil, it is the
+// number of decompressed bytes that may still be read, and is decremented by
+// the number of bytes read from layer. Room is reserved in reservation for
+// the decompressed bytes as they are read.
+func applyLayer(ctx context.Context, destPath string, srcPath string, layer io.ReadCloser, remaining *int64, reservation *Reservation) error {
 	decompressed, _, err := compression.AutoDecompress(layer)
 	if err != nil {
 		return fmt.Errorf("auto-decompress failed: %w", err)
 	}
 	defer decompressed.Close()
 
-	_, err = archive.Apply(ctx, destPath, decompressed, archive.WithFilter(applyLayerFilter(srcPath)))
+	var r io.Reader = decompressed
+	if remaining != nil {
+		r = &limitedReader{r: r, remaining: remaining}
+	}
+	if reservation != nil {
+		r = &reservingReader{ctx: ctx, r: r, reservation: reservation}
+	}
+	_, err = archive.Apply(ctx, destPath, r, archive.WithFilter(applyLayerFilter(srcPath)))
 	return err
 }
 
+var errMaxContentBytesExceeded = errors.New("maximum content size exceeded")
+
+// limitedReader fails with errMaxContentBytesExceeded once more than
+// remaining bytes are read from r.
+type limitedReader struct {
+	r         io.Reader
+	remaining *int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	*l.remaining -= int64(n)
+	if *l.remaining < 0 {
+		return n, errMaxContentBytesExceeded
+	}
+	return n, err
+}
+
+// reservationGrowthBytes is the number of bytes a reservation grows by at
+// once while layers are decompressed, so that the size of the cache
+// directory is not computed for every read.
+const reservationGrowthBytes = 16 << 20
+
+// reservingReader grows reservation to fit the bytes read from r.
+type reservingReader struct {
+	ctx         context.Context
+	r           io.Reader
+	reservation *Reservation
+	// available is the number of bytes reserved but not read yet.
+	available int64
+}
+
+func (rr *reservingReader) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	if need := int64(n) - rr.available; need > 0 {
+		growth := max(need, reservationGrowthBytes)
+		if growErr := rr.reservation.Grow(rr.ctx, growth); growErr != nil {
+			// Close to the budget, only the bytes read are reserved.
+			growth = need
+			if growErr := rr.reservation.Grow(rr.ctx, growth); growErr != nil {
+				return n, growErr
+			}
+		}
+		rr.available += growth
+	}
+	rr.available -= int64(n)
+	return n, err
+}
+
+// imageSize returns the size of the image ref refers to, as listed in its
+// manifest.
+func imageSize(ctx context.Context, ref types.ImageReference, sourceContext *types.SystemContext) (int64, error) {
+	img, err := ref.NewImage(ctx, sourceContext)
+	if err != nil {
+		return 0, fmt.Errorf("error reading image manifest: %w", err)
+	}
+	defer img.Close()
+
+	size := max(img.ConfigInfo().Size, 0)
+	for _, layer := range img.LayerInfos() {
+		size += max(layer.Size, 0)
+	}
+	return size, nil
+}
+
 func applyLayerFilter(srcPath string) archive.Filter {
 	cleanSrcPath := path.Clean(strings.TrimPrefix(srcPath, "/"))
 	return func(h *tar.Header) (bool, error) {
@@ -396,6 +599,26 @@ func setReadOnlyRecursive(root string) error {
 	return nil
 }
 
+// dirSize returns the total size of the regular files below root.
+func dirSize(root string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(root, func(_ string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
 func deleteRecursive(root string) error {
 	if err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
 		if os.IsNotExist(err) {
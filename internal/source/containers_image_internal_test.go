@@ -2,9 +2,16 @@ package source
 
 import (
 	"archive/tar"
+	"context"
+	"errors"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
 )
 
 func TestContainersImage_applyLayerFilter(t *testing.T) {
@@ -128,3 +135,40 @@ func TestContainersImage_applyLayerFilter(t *testing.T) {
 		})
 	}
 }
+
+func TestContainersImage_writeAuthFile(t *testing.T) {
+	catalog := &catalogdv1.ClusterCatalog{ObjectMeta: metav1.ObjectMeta{Name: "tenant-a/catalogs/mine"}}
+
+	t.Run("writes the credentials to a private file", func(t *testing.T) {
+		i := &ContainersImageRegistry{AuthFunc: func(context.Context, *catalogdv1.ClusterCatalog) ([]byte, error) {
+			return []byte(`{"auths":{}}`), nil
+		}}
+		authFile, err := i.writeAuthFile(context.Background(), catalog)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = os.Remove(authFile) })
+
+		data, err := os.ReadFile(authFile)
+		require.NoError(t, err)
+		assert.Equal(t, `{"auths":{}}`, string(data))
+		info, err := os.Stat(authFile)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	})
+
+	t.Run("writes no file without credentials", func(t *testing.T) {
+		i := &ContainersImageRegistry{AuthFunc: func(context.Context, *catalogdv1.ClusterCatalog) ([]byte, error) {
+			return nil, nil
+		}}
+		authFile, err := i.writeAuthFile(context.Background(), catalog)
+		require.NoError(t, err)
+		assert.Empty(t, authFile)
+	})
+
+	t.Run("returns the error of AuthFunc", func(t *testing.T) {
+		i := &ContainersImageRegistry{AuthFunc: func(context.Context, *catalogdv1.ClusterCatalog) ([]byte, error) {
+			return nil, errors.New("pull secret \"foo\" not found")
+		}}
+		_, err := i.writeAuthFile(context.Background(), catalog)
+		require.EqualError(t, err, `error getting credentials to pull image: pull secret "foo" not found`)
+	})
+}
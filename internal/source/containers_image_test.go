@@ -5,10 +5,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -23,12 +26,18 @@ import (
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
 	"github.com/operator-framework/catalogd/internal/source"
+	"github.com/operator-framework/catalogd/internal/tracing"
 )
 
 func TestImageRegistry(t *testing.T) {
@@ -475,3 +484,355 @@ func TestImageRegistryMissingLabelConsistentFailure(t *testing.T) {
 		require.Error(t, err, "unpack run ", i)
 	}
 }
+
+func TestImageRegistryTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	imgReg := &source.ContainersImageRegistry{
+		BaseCachePath: t.TempDir(),
+		SourceContextFunc: func(logger logr.Logger) (*types.SystemContext, error) {
+			return &types.SystemContext{
+				OCIInsecureSkipTLSVerify:    true,
+				DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+			}, nil
+		},
+	}
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	url, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	labeled, err := random.Image(20, 3)
+	require.NoError(t, err)
+	labeled, err = mutate.Config(labeled, v1.Config{Labels: map[string]string{source.ConfigDirLabel: "/configs"}})
+	require.NoError(t, err)
+	labeledName, err := name.ParseReference(fmt.Sprintf("%s/%s", url.Host, "labeled:test"))
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(labeledName, labeled))
+
+	unlabeled, err := random.Image(20, 3)
+	require.NoError(t, err)
+	unlabeledName, err := name.ParseReference(fmt.Sprintf("%s/%s", url.Host, "unlabeled:test"))
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(unlabeledName, unlabeled))
+
+	newCatalog := func(ref string) *catalogdv1.ClusterCatalog {
+		return &catalogdv1.ClusterCatalog{
+			ObjectMeta: metav1.ObjectMeta{Name: "test"},
+			Spec: catalogdv1.ClusterCatalogSpec{
+				Source: catalogdv1.CatalogSource{
+					Type:  catalogdv1.SourceTypeImage,
+					Image: &catalogdv1.ImageSource{Ref: ref},
+				},
+			},
+		}
+	}
+
+	// spansOf returns the status of the spans recorded for a single Unpack
+	// call, keyed by name, after checking that they belong to it.
+	spansOf := func(t *testing.T, spans []sdktrace.ReadOnlySpan) map[string]codes.Code {
+		require.NotEmpty(t, spans)
+		root := spans[len(spans)-1]
+		require.Equal(t, "ContainersImageRegistry.Unpack", root.Name())
+		assert.Contains(t, root.Attributes(), tracing.CatalogKey.String("test"))
+		statuses := map[string]codes.Code{root.Name(): root.Status().Code}
+		for _, span := range spans[:len(spans)-1] {
+			assert.Equal(t, root.SpanContext().SpanID(), span.Parent().SpanID(), "span %q", span.Name())
+			statuses[span.Name()] = span.Status().Code
+		}
+		return statuses
+	}
+
+	t.Run("successful unpack", func(t *testing.T) {
+		_, err := imgReg.Unpack(context.Background(), newCatalog(labeledName.Name()))
+		require.NoError(t, err)
+		assert.Equal(t, map[string]codes.Code{
+			"ContainersImageRegistry.Unpack": codes.Unset,
+			"resolve":                        codes.Unset,
+			"copy":                           codes.Unset,
+			"apply layers":                   codes.Unset,
+		}, spansOf(t, recorder.Ended()))
+	})
+
+	t.Run("failed unpack", func(t *testing.T) {
+		previous := len(recorder.Ended())
+		_, err := imgReg.Unpack(context.Background(), newCatalog(unlabeledName.Name()))
+		require.Error(t, err)
+		assert.Equal(t, map[string]codes.Code{
+			"ContainersImageRegistry.Unpack": codes.Error,
+			"resolve":                        codes.Unset,
+			"copy":                           codes.Unset,
+			"apply layers":                   codes.Error,
+		}, spansOf(t, recorder.Ended()[previous:]))
+	})
+}
+
+func TestImageRegistryQuotaCountsDecompressedLayers(t *testing.T) {
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	url, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	img, err := random.Image(20, 3)
+	require.NoError(t, err)
+	img, err = mutate.Config(img, v1.Config{Labels: map[string]string{source.ConfigDirLabel: "/configs"}})
+	require.NoError(t, err)
+	tagRef, err := name.ParseReference(fmt.Sprintf("%s/%s", url.Host, "test-image:test"))
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(tagRef, img))
+	imgDigest, err := img.Digest()
+	require.NoError(t, err)
+	manifest, err := img.Manifest()
+	require.NoError(t, err)
+	imgSize := manifest.Config.Size
+	for _, layer := range manifest.Layers {
+		imgSize += layer.Size
+	}
+
+	ctx := context.Background()
+	testCache := t.TempDir()
+	imgReg := &source.ContainersImageRegistry{
+		BaseCachePath: testCache,
+		SourceContextFunc: func(logger logr.Logger) (*types.SystemContext, error) {
+			return &types.SystemContext{
+				OCIInsecureSkipTLSVerify:    true,
+				DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+			}, nil
+		},
+		// The decompressed layers do not fit.
+		Quota: &source.DiskQuota{Root: testCache, MaxBytes: imgSize + 100, CachePaths: []string{testCache}},
+	}
+	catalog := &catalogdv1.ClusterCatalog{
+		ObjectMeta: metav1.ObjectMeta{Name: "test"},
+		Spec: catalogdv1.ClusterCatalogSpec{
+			Source: catalogdv1.CatalogSource{
+				Type:  catalogdv1.SourceTypeImage,
+				Image: &catalogdv1.ImageSource{Ref: tagRef.Name()},
+			},
+		},
+	}
+	_, err = imgReg.Unpack(ctx, catalog)
+	require.ErrorContains(t, err, "cache directory disk budget")
+	assert.False(t, errors.Is(err, reconcile.TerminalError(nil)))
+	assert.NoDirExists(t, filepath.Join(testCache, catalog.Name, imgDigest.String()))
+
+	imgReg.Quota = &source.DiskQuota{Root: testCache, MaxBytes: 1 << 20, CachePaths: []string{testCache}}
+	_, err = imgReg.Unpack(ctx, catalog)
+	require.NoError(t, err)
+}
+
+func TestImageRegistryQuotaKeepsPinnedImages(t *testing.T) {
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	url, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	// The files of random layers are at the root of the image.
+	img, err := random.Image(20, 3)
+	require.NoError(t, err)
+	img, err = mutate.Config(img, v1.Config{Labels: map[string]string{source.ConfigDirLabel: "/"}})
+	require.NoError(t, err)
+	tagRef, err := name.ParseReference(fmt.Sprintf("%s/%s", url.Host, "test-image:test"))
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(tagRef, img))
+
+	testCache := t.TempDir()
+	quota := &source.DiskQuota{Root: testCache, MaxBytes: 1 << 20, CachePaths: []string{testCache}}
+	imgReg := &source.ContainersImageRegistry{
+		BaseCachePath: testCache,
+		SourceContextFunc: func(logger logr.Logger) (*types.SystemContext, error) {
+			return &types.SystemContext{
+				OCIInsecureSkipTLSVerify:    true,
+				DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+			}, nil
+		},
+		Quota: quota,
+	}
+	catalog := &catalogdv1.ClusterCatalog{
+		ObjectMeta: metav1.ObjectMeta{Name: "test"},
+		Spec: catalogdv1.ClusterCatalogSpec{
+			Source: catalogdv1.CatalogSource{
+				Type:  catalogdv1.SourceTypeImage,
+				Image: &catalogdv1.ImageSource{Ref: tagRef.Name()},
+			},
+		},
+	}
+	// evict tries to make room by evicting every unpacked image of other
+	// catalogs.
+	evict := func() error {
+		quota.MaxBytes = 1
+		defer func() { quota.MaxBytes = 1 << 20 }()
+		_, err := quota.Reserve(context.Background(), filepath.Join(testCache, "other"), "", 0)
+		return err
+	}
+
+	for _, tc := range []string{"unpacked", "already unpacked"} {
+		t.Run(tc, func(t *testing.T) {
+			ctx, unpin := source.WithPins(context.Background())
+			result, err := imgReg.Unpack(ctx, catalog)
+			require.NoError(t, err)
+			unpackPath := filepath.Join(testCache, catalog.Name, result.ResolvedSource.Image.Ref[strings.LastIndex(result.ResolvedSource.Image.Ref, "@")+1:])
+
+			require.ErrorContains(t, evict(), "cache directory disk budget")
+			assert.DirExists(t, unpackPath, "pinned images are not evicted")
+
+			unpin()
+			require.NoError(t, evict())
+			assert.NoDirExists(t, unpackPath)
+
+			// Unpacked again, and found already unpacked in the next run.
+			_, err = imgReg.Unpack(context.Background(), catalog)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestImageRegistryWithoutBudgetDoesNotFetchImageSize(t *testing.T) {
+	var manifestRequests atomic.Int32
+	registryHandler := registry.New()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/manifests/") && r.Method == http.MethodGet {
+			manifestRequests.Add(1)
+		}
+		registryHandler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	url, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	img, err := random.Image(20, 3)
+	require.NoError(t, err)
+	img, err = mutate.Config(img, v1.Config{Labels: map[string]string{source.ConfigDirLabel: "/configs"}})
+	require.NoError(t, err)
+	tagRef, err := name.ParseReference(fmt.Sprintf("%s/%s", url.Host, "test-image:test"))
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(tagRef, img))
+
+	// unpack returns the number of manifests fetched to unpack the image
+	// with quota.
+	unpack := func(quota *source.DiskQuota) int32 {
+		testCache := t.TempDir()
+		imgReg := &source.ContainersImageRegistry{
+			BaseCachePath: testCache,
+			SourceContextFunc: func(logger logr.Logger) (*types.SystemContext, error) {
+				return &types.SystemContext{
+					OCIInsecureSkipTLSVerify:    true,
+					DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+				}, nil
+			},
+			Quota: quota,
+		}
+		catalog := &catalogdv1.ClusterCatalog{
+			ObjectMeta: metav1.ObjectMeta{Name: "test"},
+			Spec: catalogdv1.ClusterCatalogSpec{
+				Source: catalogdv1.CatalogSource{
+					Type:  catalogdv1.SourceTypeImage,
+					Image: &catalogdv1.ImageSource{Ref: tagRef.Name()},
+				},
+			},
+		}
+		before := manifestRequests.Load()
+		_, err := imgReg.Unpack(context.Background(), catalog)
+		require.NoError(t, err)
+		return manifestRequests.Load() - before
+	}
+	withoutQuota := unpack(nil)
+	assert.Equal(t, withoutQuota, unpack(&source.DiskQuota{Root: t.TempDir()}))
+}
+
+func TestImageRegistryMaxContentBytes(t *testing.T) {
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	url, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	img, err := random.Image(20, 3)
+	require.NoError(t, err)
+	img, err = mutate.Config(img, v1.Config{Labels: map[string]string{source.ConfigDirLabel: "/configs"}})
+	require.NoError(t, err)
+	tagRef, err := name.ParseReference(fmt.Sprintf("%s/%s", url.Host, "test-image:test"))
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(tagRef, img))
+	imgDigest, err := img.Digest()
+	require.NoError(t, err)
+	digestRef := fmt.Sprintf("%s/test-image@%s", url.Host, imgDigest)
+
+	// The size of the image is the size of its config and of its compressed
+	// layers, which are much smaller than the layers once decompressed.
+	manifest, err := img.Manifest()
+	require.NoError(t, err)
+	imgSize := manifest.Config.Size
+	for _, layer := range manifest.Layers {
+		imgSize += layer.Size
+	}
+
+	for _, tt := range []struct {
+		name            string
+		ref             string
+		maxContentBytes int64
+		wantErr         string
+		terminal        bool
+	}{
+		{
+			name:            "image within the maximum content size",
+			ref:             tagRef.Name(),
+			maxContentBytes: 1 << 20,
+		},
+		{
+			name:            "tag based image larger than the maximum content size",
+			ref:             tagRef.Name(),
+			maxContentBytes: imgSize - 1,
+			wantErr:         fmt.Sprintf("image size of %d bytes exceeds the maximum content size of %d bytes", imgSize, imgSize-1),
+		},
+		{
+			name:            "digest based image larger than the maximum content size",
+			ref:             digestRef,
+			maxContentBytes: imgSize - 1,
+			wantErr:         fmt.Sprintf("image size of %d bytes exceeds the maximum content size of %d bytes", imgSize, imgSize-1),
+			terminal:        true,
+		},
+		{
+			name:            "decompressed layers larger than the maximum content size",
+			ref:             digestRef,
+			maxContentBytes: imgSize,
+			wantErr:         "decompressed layers exceed the maximum content size",
+			terminal:        true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			testCache := t.TempDir()
+			imgReg := &source.ContainersImageRegistry{
+				BaseCachePath: testCache,
+				SourceContextFunc: func(logger logr.Logger) (*types.SystemContext, error) {
+					return &types.SystemContext{
+						OCIInsecureSkipTLSVerify:    true,
+						DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+					}, nil
+				},
+				MaxContentBytes: tt.maxContentBytes,
+			}
+			catalog := &catalogdv1.ClusterCatalog{
+				ObjectMeta: metav1.ObjectMeta{Name: "test"},
+				Spec: catalogdv1.ClusterCatalogSpec{
+					Source: catalogdv1.CatalogSource{
+						Type:  catalogdv1.SourceTypeImage,
+						Image: &catalogdv1.ImageSource{Ref: tt.ref},
+					},
+				},
+			}
+
+			_, err := imgReg.Unpack(ctx, catalog)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.wantErr)
+				assert.Equal(t, tt.terminal, errors.Is(err, reconcile.TerminalError(nil)))
+				assert.NoDirExists(t, filepath.Join(testCache, catalog.Name, imgDigest.String()))
+			}
+			assert.NoError(t, imgReg.Cleanup(ctx, catalog))
+		})
+	}
+}
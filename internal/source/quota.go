@@ -0,0 +1,285 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// DiskQuota keeps the size of a cache directory under a budget by evicting
+// the images unpacked in the base cache paths of unpackers, least recently
+// unpacked first. The content served for catalogs is never evicted: it is
+// stored apart from unpacked images, which are only needed to skip pulling
+// an image that is already unpacked, and are pulled again when needed.
+//
+// Room is reserved for an image as its layers are decompressed into Root, so
+// that images unpacked concurrently, for instance by the reconcilers of
+// ClusterCatalogs, Catalogs and previews, do not all fit the budget on their
+// own but exceed it together. Unpacked images that are still being used, for
+// instance being patched, filtered or stored, are pinned so that they are not
+// evicted while in use.
+type DiskQuota struct {
+	// Root is the directory whose size is kept under MaxBytes.
+	Root string
+	// MaxBytes is the budget for the size of Root. There is no budget if it
+	// is not positive.
+	MaxBytes int64
+	// CachePaths are the base cache paths, in Root, of the unpackers whose
+	// unpacked images can be evicted.
+	CachePaths []string
+
+	mu           sync.Mutex
+	reservations map[*Reservation]struct{}
+	// pinned counts the pins of the unpacked images that are in use.
+	pinned map[string]int
+}
+
+type pinsKey struct{}
+
+// pins are the unpacked images pinned in a context returned by WithPins.
+type pins struct {
+	mu     sync.Mutex
+	unpins []func()
+}
+
+// WithPins returns a context in which the images unpacked, or found already
+// unpacked, by the unpackers of a DiskQuota are pinned, and a function that
+// unpins them. Pinned images are never evicted, so the function should be
+// called once the unpacked content is not used anymore.
+func WithPins(ctx context.Context) (context.Context, func()) {
+	p := &pins{}
+	return context.WithValue(ctx, pinsKey{}, p), func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		for _, unpin := range p.unpins {
+			unpin()
+		}
+		p.unpins = nil
+	}
+}
+
+// pin keeps the unpacked image at path from being evicted until the pins of
+// ctx are released. It does nothing if ctx has no pins.
+func (q *DiskQuota) pin(ctx context.Context, path string) {
+	if !q.hasBudget() {
+		return
+	}
+	p, ok := ctx.Value(pinsKey{}).(*pins)
+	if !ok {
+		return
+	}
+	q.mu.Lock()
+	if q.pinned == nil {
+		q.pinned = map[string]int{}
+	}
+	q.pinned[path]++
+	q.mu.Unlock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.unpins = append(p.unpins, func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if q.pinned[path]--; q.pinned[path] <= 0 {
+			delete(q.pinned, path)
+		}
+	})
+}
+
+// Reservation is room reserved in a DiskQuota for an image being unpacked.
+// The reserved bytes count as in use until it is released. A nil Reservation,
+// as reserved in a DiskQuota without a budget, reserves nothing.
+type Reservation struct {
+	q *DiskQuota
+	// keep is the directory whose unpacked images are never evicted to make
+	// room for the reservation, and path the directory the image is being
+	// unpacked to. The bytes written to path are accounted for by the
+	// reservation instead of being counted as in use.
+	keep, path string
+	size       int64
+}
+
+type evictionCandidate struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// Reserve evicts unpacked images until size more bytes fit in the budget, and
+// reserves them. The images unpacked in the directory keep are never evicted,
+// and the image being unpacked to path is accounted for by the reservation
+// until it is released. It returns an error if size more bytes do not fit
+// even when every other unpacked image is evicted.
+func (q *DiskQuota) Reserve(ctx context.Context, keep, path string, size int64) (*Reservation, error) {
+	if !q.hasBudget() {
+		return nil, nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	r := &Reservation{q: q, keep: keep, path: path}
+	if err := q.makeRoomLocked(ctx, keep, size); err != nil {
+		return nil, err
+	}
+	r.size = size
+	if q.reservations == nil {
+		q.reservations = map[*Reservation]struct{}{}
+	}
+	q.reservations[r] = struct{}{}
+	return r, nil
+}
+
+// hasBudget returns true if q keeps the size of its Root under a budget.
+func (q *DiskQuota) hasBudget() bool {
+	return q != nil && q.MaxBytes > 0
+}
+
+// Grow evicts unpacked images until size more bytes fit in the budget, and
+// adds them to the reservation.
+func (r *Reservation) Grow(ctx context.Context, size int64) error {
+	if r == nil {
+		return nil
+	}
+	r.q.mu.Lock()
+	defer r.q.mu.Unlock()
+	if err := r.q.makeRoomLocked(ctx, r.keep, size); err != nil {
+		return err
+	}
+	r.size += size
+	return nil
+}
+
+// Release releases the reserved bytes. What was written to the directory the
+// image was unpacked to counts as in use from then on.
+func (r *Reservation) Release() {
+	if r == nil {
+		return
+	}
+	r.q.mu.Lock()
+	defer r.q.mu.Unlock()
+	delete(r.q.reservations, r)
+}
+
+func (q *DiskQuota) makeRoomLocked(ctx context.Context, keep string, size int64) error {
+	used, err := q.usedLocked()
+	if err != nil {
+		return fmt.Errorf("error computing size of cache directory: %w", err)
+	}
+	if used+size <= q.MaxBytes {
+		return nil
+	}
+
+	candidates, err := q.evictionCandidatesLocked(keep)
+	if err != nil {
+		return err
+	}
+	l := log.FromContext(ctx)
+	for _, c := range candidates {
+		if used+size <= q.MaxBytes {
+			break
+		}
+		if err := deleteRecursive(c.path); err != nil {
+			return fmt.Errorf("error evicting unpacked image: %w", err)
+		}
+		l.Info("evicted unpacked image to stay within the cache directory disk budget", "path", c.path, "bytes", c.size)
+		used -= c.size
+	}
+	if used+size > q.MaxBytes {
+		return fmt.Errorf("cache directory disk budget of %d bytes exceeded: %d bytes are in use and %d more are needed", q.MaxBytes, used, size)
+	}
+	return nil
+}
+
+// usedLocked returns the number of bytes in use: the size of Root, apart
+// from the images being unpacked, and the bytes reserved.
+func (q *DiskQuota) usedLocked() (int64, error) {
+	var used int64
+	for r := range q.reservations {
+		used += r.size
+	}
+	err := filepath.WalkDir(q.Root, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			// Removed while walking.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && q.reservedLocked(path) {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		used += info.Size()
+		return nil
+	})
+	return used, err
+}
+
+// reservedLocked returns true if an image is being unpacked to path.
+func (q *DiskQuota) reservedLocked(path string) bool {
+	for r := range q.reservations {
+		if r.path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// evictionCandidatesLocked returns the images unpacked in the cache paths,
+// outside of keep and apart from those being unpacked or pinned, least
+// recently unpacked first. Unpacked images are the directories named after the digest
+// of their content.
+func (q *DiskQuota) evictionCandidatesLocked(keep string) ([]evictionCandidate, error) {
+	var candidates []evictionCandidate
+	for _, cachePath := range q.CachePaths {
+		err := filepath.WalkDir(cachePath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() {
+				return nil
+			}
+			if path == keep || strings.HasPrefix(path, keep+string(filepath.Separator)) || q.reservedLocked(path) || q.pinned[path] > 0 {
+				return filepath.SkipDir
+			}
+			if _, err := digest.Parse(d.Name()); err != nil {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size, err := dirSize(path)
+			if err != nil {
+				return err
+			}
+			candidates = append(candidates, evictionCandidate{path: path, size: size, modTime: info.ModTime()})
+			return filepath.SkipDir
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error finding unpacked images in %q: %w", cachePath, err)
+		}
+	}
+	slices.SortFunc(candidates, func(a, b evictionCandidate) int {
+		return a.modTime.Compare(b.modTime)
+	})
+	return candidates, nil
+}
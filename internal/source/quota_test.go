@@ -0,0 +1,123 @@
+package source_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/operator-framework/catalogd/internal/source"
+)
+
+func TestDiskQuotaReserve(t *testing.T) {
+	const (
+		digestA = "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+		digestB = "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	)
+	// Each unpacked image, and the stored content, takes 100 bytes.
+	setup := func(t *testing.T) (root string, quota *source.DiskQuota) {
+		root = t.TempDir()
+		unpackDir := filepath.Join(root, "unpack")
+		namespacedUnpackDir := filepath.Join(root, "unpack-namespaces")
+		write := func(dir string, modTime time.Time) {
+			require.NoError(t, os.MkdirAll(dir, 0700))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "catalog.json"), make([]byte, 100), 0600))
+			require.NoError(t, os.Chtimes(dir, modTime, modTime))
+		}
+		now := time.Now()
+		write(filepath.Join(unpackDir, "newest", digestA), now.Add(-time.Minute))
+		write(filepath.Join(unpackDir, "oldest", digestA), now.Add(-3*time.Hour))
+		write(filepath.Join(namespacedUnpackDir, "tenant-a", "catalogs", "middle", digestB), now.Add(-2*time.Hour))
+		write(filepath.Join(root, "catalogs", "served"), now.Add(-4*time.Hour))
+		return root, &source.DiskQuota{
+			Root:       root,
+			CachePaths: []string{unpackDir, namespacedUnpackDir},
+		}
+	}
+
+	reserve := func(t *testing.T, quota *source.DiskQuota, keep string, size int64) *source.Reservation {
+		t.Helper()
+		r, err := quota.Reserve(context.Background(), keep, "", size)
+		require.NoError(t, err)
+		return r
+	}
+
+	t.Run("no eviction within the budget", func(t *testing.T) {
+		root, quota := setup(t)
+		quota.MaxBytes = 450
+		reserve(t, quota, filepath.Join(root, "unpack", "newest"), 50)
+		assert.DirExists(t, filepath.Join(root, "unpack", "oldest", digestA))
+	})
+
+	t.Run("least recently unpacked images are evicted first", func(t *testing.T) {
+		root, quota := setup(t)
+		quota.MaxBytes = 400
+		reserve(t, quota, filepath.Join(root, "unpack", "newest"), 150)
+		assert.NoDirExists(t, filepath.Join(root, "unpack", "oldest", digestA))
+		assert.NoDirExists(t, filepath.Join(root, "unpack-namespaces", "tenant-a", "catalogs", "middle", digestB))
+		assert.DirExists(t, filepath.Join(root, "unpack", "newest", digestA))
+		assert.DirExists(t, filepath.Join(root, "catalogs", "served"))
+	})
+
+	t.Run("images of the catalog being unpacked are never evicted", func(t *testing.T) {
+		root, quota := setup(t)
+		quota.MaxBytes = 400
+		reserve(t, quota, filepath.Join(root, "unpack", "oldest"), 50)
+		assert.DirExists(t, filepath.Join(root, "unpack", "oldest", digestA))
+		assert.NoDirExists(t, filepath.Join(root, "unpack-namespaces", "tenant-a", "catalogs", "middle", digestB))
+		assert.DirExists(t, filepath.Join(root, "unpack", "newest", digestA))
+	})
+
+	t.Run("budget exceeded even after eviction", func(t *testing.T) {
+		root, quota := setup(t)
+		quota.MaxBytes = 250
+		_, err := quota.Reserve(context.Background(), filepath.Join(root, "unpack", "newest"), "", 100)
+		require.EqualError(t, err, "cache directory disk budget of 250 bytes exceeded: 200 bytes are in use and 100 more are needed")
+		assert.DirExists(t, filepath.Join(root, "catalogs", "served"))
+	})
+
+	t.Run("reserved bytes are in use until they are released", func(t *testing.T) {
+		root, quota := setup(t)
+		quota.MaxBytes = 500
+		r := reserve(t, quota, filepath.Join(root, "unpack", "newest"), 100)
+		reserve(t, quota, filepath.Join(root, "unpack", "newest"), 50)
+		assert.NoDirExists(t, filepath.Join(root, "unpack", "oldest", digestA))
+		assert.DirExists(t, filepath.Join(root, "unpack-namespaces", "tenant-a", "catalogs", "middle", digestB))
+
+		r.Release()
+		reserve(t, quota, filepath.Join(root, "unpack", "newest"), 100)
+		assert.DirExists(t, filepath.Join(root, "unpack-namespaces", "tenant-a", "catalogs", "middle", digestB))
+	})
+
+	t.Run("images being unpacked are accounted for by their reservation", func(t *testing.T) {
+		root, quota := setup(t)
+		quota.MaxBytes = 500
+		unpacking := filepath.Join(root, "unpack", "other", digestB)
+		r, err := quota.Reserve(context.Background(), filepath.Join(root, "unpack", "other"), unpacking, 100)
+		require.NoError(t, err)
+		require.NoError(t, os.MkdirAll(unpacking, 0700))
+		require.NoError(t, os.WriteFile(filepath.Join(unpacking, "catalog.json"), make([]byte, 100), 0600))
+
+		// The bytes written are not counted twice.
+		reserve(t, quota, filepath.Join(root, "unpack", "newest"), 0)
+		assert.DirExists(t, filepath.Join(root, "unpack", "oldest", digestA))
+
+		require.NoError(t, r.Grow(context.Background(), 100))
+		assert.NoDirExists(t, filepath.Join(root, "unpack", "oldest", digestA))
+		require.EqualError(t, r.Grow(context.Background(), 300), "cache directory disk budget of 500 bytes exceeded: 300 bytes are in use and 300 more are needed")
+		assert.DirExists(t, unpacking, "images being unpacked are never evicted")
+	})
+
+	t.Run("no budget", func(t *testing.T) {
+		root, quota := setup(t)
+		r, err := quota.Reserve(context.Background(), filepath.Join(root, "unpack", "newest"), "", 1000)
+		require.NoError(t, err)
+		assert.Nil(t, r)
+		require.NoError(t, r.Grow(context.Background(), 1000))
+		r.Release()
+	})
+}
@@ -2,10 +2,13 @@ package source
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io/fs"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
 )
@@ -70,3 +73,61 @@ type State string
 const StateUnpacked State = "Unpacked"
 
 const UnpackCacheDir = "unpack"
+
+// OCILayoutTempDirPrefix is the prefix of the names of the temporary
+// directories, in the default directory for temporary files, that images
+// are pulled to before they are unpacked.
+const OCILayoutTempDirPrefix = "oci-layout-"
+
+// Router is an Unpacker that delegates to the Unpacker registered for the
+// source type of each catalog.
+type Router map[catalogdv1.SourceType]Unpacker
+
+func (r Router) Unpack(ctx context.Context, catalog *catalogdv1.ClusterCatalog) (*Result, error) {
+	u, ok := r[catalog.Spec.Source.Type]
+	if !ok {
+		return nil, reconcile.TerminalError(fmt.Errorf("unsupported source type %q", catalog.Spec.Source.Type))
+	}
+	return u.Unpack(ctx, catalog)
+}
+
+// Cleanup cleans up after every registered Unpacker, since content may have
+// been unpacked for a catalog while it had a different source type.
+func (r Router) Cleanup(ctx context.Context, catalog *catalogdv1.ClusterCatalog) error {
+	var errs []error
+	for _, u := range r {
+		errs = append(errs, u.Cleanup(ctx, catalog))
+	}
+	return errors.Join(errs...)
+}
+
+// PollInterval returns the interval at which src is polled for new content,
+// and false if it is not polled. Composite sources are polled at the shortest
+// interval of their image members.
+func PollInterval(src catalogdv1.CatalogSource) (time.Duration, bool) {
+	var images []*catalogdv1.ImageSource
+	switch src.Type {
+	case catalogdv1.SourceTypeImage:
+		images = append(images, src.Image)
+	case catalogdv1.SourceTypeComposite:
+		if src.Composite != nil {
+			for _, m := range src.Composite.Members {
+				images = append(images, m.Image)
+			}
+		}
+	}
+	var (
+		interval time.Duration
+		polled   bool
+	)
+	for _, image := range images {
+		if image == nil || image.PollIntervalMinutes == nil {
+			continue
+		}
+		d := time.Duration(*image.PollIntervalMinutes) * time.Minute
+		if !polled || d < interval {
+			interval, polled = d, true
+		}
+	}
+	return interval, polled
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+)
+
+const v1ApiDiff = "diff"
+
+// Diff describes how the content of a catalog changed from one stored
+// revision to another. Revisions are identified by the digest of their
+// content.
+type Diff struct {
+	// From is the digest of the older revision. It is empty if there was no
+	// older revision, in which case all content is reported as added.
+	From string `json:"from,omitempty"`
+	// To is the digest of the newer revision.
+	To string `json:"to"`
+
+	Added   ContentSet      `json:"added"`
+	Removed ContentSet      `json:"removed"`
+	Changed []ChannelChange `json:"changed"`
+}
+
+// ContentSet is a set of packages, channels and bundles of a catalog.
+type ContentSet struct {
+	Packages []string     `json:"packages"`
+	Channels []ChannelRef `json:"channels"`
+	Bundles  []BundleRef  `json:"bundles"`
+}
+
+// ChannelChange lists the entries of a channel present in both revisions that
+// were added, removed or modified between them. An entry is modified when its
+// replaces, skips or skipRange changed.
+type ChannelChange struct {
+	ChannelRef
+	AddedEntries    []string `json:"addedEntries"`
+	RemovedEntries  []string `json:"removedEntries"`
+	ModifiedEntries []string `json:"modifiedEntries"`
+}
+
+// diffIndexes computes the Diff from the previous index to the current one.
+// A nil previous index is treated as an empty catalog.
+func diffIndexes(previous, current *catalogIndex) *Diff {
+	if previous == nil {
+		previous = newCatalogIndex()
+	}
+	previousChannels := sets.KeySet(previous.Channels)
+	currentChannels := sets.KeySet(current.Channels)
+
+	diff := &Diff{
+		From: previous.Digest,
+		To:   current.Digest,
+		Added: ContentSet{
+			Packages: sets.List(current.Packages.Difference(previous.Packages)),
+			Channels: sortedChannels(currentChannels.Difference(previousChannels)),
+			Bundles:  sortedBundles(current.Bundles.Difference(previous.Bundles)),
+		},
+		Removed: ContentSet{
+			Packages: sets.List(previous.Packages.Difference(current.Packages)),
+			Channels: sortedChannels(previousChannels.Difference(currentChannels)),
+			Bundles:  sortedBundles(previous.Bundles.Difference(current.Bundles)),
+		},
+		Changed: []ChannelChange{},
+	}
+	for _, ref := range sortedChannels(currentChannels.Intersection(previousChannels)) {
+		if change, changed := diffChannelEntries(ref, previous.Channels[ref], current.Channels[ref]); changed {
+			diff.Changed = append(diff.Changed, change)
+		}
+	}
+	return diff
+}
+
+func diffChannelEntries(ref ChannelRef, previous, current []declcfg.ChannelEntry) (ChannelChange, bool) {
+	previousEntries := entriesByName(previous)
+	currentEntries := entriesByName(current)
+	change := ChannelChange{
+		ChannelRef:      ref,
+		AddedEntries:    sets.List(sets.KeySet(currentEntries).Difference(sets.KeySet(previousEntries))),
+		RemovedEntries:  sets.List(sets.KeySet(previousEntries).Difference(sets.KeySet(currentEntries))),
+		ModifiedEntries: []string{},
+	}
+	for _, name := range sets.List(sets.KeySet(currentEntries).Intersection(sets.KeySet(previousEntries))) {
+		p, c := previousEntries[name], currentEntries[name]
+		if p.Replaces != c.Replaces || p.SkipRange != c.SkipRange || !slices.Equal(p.Skips, c.Skips) {
+			change.ModifiedEntries = append(change.ModifiedEntries, name)
+		}
+	}
+	changed := len(change.AddedEntries) > 0 || len(change.RemovedEntries) > 0 || len(change.ModifiedEntries) > 0
+	return change, changed
+}
+
+func entriesByName(entries []declcfg.ChannelEntry) map[string]declcfg.ChannelEntry {
+	byName := make(map[string]declcfg.ChannelEntry, len(entries))
+	for _, entry := range entries {
+		byName[entry.Name] = entry
+	}
+	return byName
+}
+
+// diffHandler serves the Diff from the previous revision of the catalog named
+// in the request path to the revision currently being served.
+func (s *LocalDirV1) diffHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		diff, err := s.ContentDiff(catalogFromRequest(r))
+		if err != nil {
+			http.Error(w, "error reading catalog content", http.StatusInternalServerError)
+			return
+		}
+		if diff == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(diff)
+	})
+}
@@ -0,0 +1,262 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing/fstest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+)
+
+var _ = Describe("diffIndexes", func() {
+	It("reports all content as added when there is no previous revision", func() {
+		current := newCatalogIndex()
+		current.Digest = "sha256:current"
+		current.Packages.Insert("foo")
+		current.Channels[ChannelRef{Package: "foo", Name: "stable"}] = []declcfg.ChannelEntry{{Name: "foo.v1.0.0"}}
+		current.Bundles.Insert(BundleRef{Package: "foo", Name: "foo.v1.0.0"})
+
+		diff := diffIndexes(nil, current)
+		Expect(diff.From).To(BeEmpty())
+		Expect(diff.To).To(Equal("sha256:current"))
+		Expect(diff.Added.Packages).To(Equal([]string{"foo"}))
+		Expect(diff.Added.Channels).To(Equal([]ChannelRef{{Package: "foo", Name: "stable"}}))
+		Expect(diff.Added.Bundles).To(Equal([]BundleRef{{Package: "foo", Name: "foo.v1.0.0"}}))
+		Expect(diff.Removed.Packages).To(BeEmpty())
+		Expect(diff.Changed).To(BeEmpty())
+	})
+
+	It("reports added, removed and modified entries of channels present in both revisions", func() {
+		stable := ChannelRef{Package: "foo", Name: "stable"}
+		previous := newCatalogIndex()
+		previous.Channels[stable] = []declcfg.ChannelEntry{
+			{Name: "foo.v1.0.0"},
+			{Name: "foo.v1.1.0", Replaces: "foo.v1.0.0"},
+			{Name: "foo.v1.2.0", Replaces: "foo.v1.1.0"},
+		}
+		current := newCatalogIndex()
+		current.Channels[stable] = []declcfg.ChannelEntry{
+			{Name: "foo.v1.1.0"},
+			{Name: "foo.v1.2.0", Replaces: "foo.v1.1.0", Skips: []string{"foo.v1.0.0"}},
+			{Name: "foo.v1.3.0", Replaces: "foo.v1.2.0"},
+		}
+
+		diff := diffIndexes(previous, current)
+		Expect(diff.Added.Channels).To(BeEmpty())
+		Expect(diff.Removed.Channels).To(BeEmpty())
+		Expect(diff.Changed).To(Equal([]ChannelChange{{
+			ChannelRef:      stable,
+			AddedEntries:    []string{"foo.v1.3.0"},
+			RemovedEntries:  []string{"foo.v1.0.0"},
+			ModifiedEntries: []string{"foo.v1.1.0", "foo.v1.2.0"},
+		}}))
+	})
+
+	It("does not report channels whose entries are unchanged", func() {
+		previous := newCatalogIndex()
+		previous.Channels[ChannelRef{Package: "foo", Name: "stable"}] = []declcfg.ChannelEntry{{Name: "foo.v1.0.0"}}
+		current := newCatalogIndex()
+		current.Channels[ChannelRef{Package: "foo", Name: "stable"}] = []declcfg.ChannelEntry{{Name: "foo.v1.0.0"}}
+
+		Expect(diffIndexes(previous, current).Changed).To(BeEmpty())
+	})
+})
+
+var _ = Describe("catalogIndex", func() {
+	It("round trips through JSON", func() {
+		idx := newCatalogIndex()
+		idx.Digest = "sha256:abc"
+		idx.Packages.Insert("foo", "bar")
+		idx.Channels[ChannelRef{Package: "foo", Name: "stable"}] = []declcfg.ChannelEntry{{Name: "foo.v1.0.0", SkipRange: "<1.0.0"}}
+		idx.Bundles.Insert(BundleRef{Package: "foo", Name: "foo.v1.0.0"})
+
+		data, err := json.Marshal(idx)
+		Expect(err).ToNot(HaveOccurred())
+		var out catalogIndex
+		Expect(json.Unmarshal(data, &out)).To(Succeed())
+		Expect(out.Digest).To(Equal(idx.Digest))
+		Expect(out.Packages).To(Equal(sets.New("foo", "bar")))
+		Expect(out.Channels).To(Equal(idx.Channels))
+		Expect(out.Bundles).To(Equal(idx.Bundles))
+	})
+})
+
+var _ = Describe("LocalDir content summary", func() {
+	It("returns nil for a catalog without stored content", func() {
+		store := &LocalDirV1{RootDir: GinkgoT().TempDir(), RootURL: &url.URL{Path: urlPrefix}}
+		summary, err := store.ContentSummary("test-catalog")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary).To(BeNil())
+	})
+
+	It("counts the objects of each schema and the size of the stored content", func() {
+		store := &LocalDirV1{RootDir: GinkgoT().TempDir(), RootURL: &url.URL{Path: urlPrefix}}
+		fsys := packageFS("foo")
+		fsys["extra.yaml"] = &fstest.MapFile{Data: []byte(`---
+schema: olm.deprecations
+package: foo
+entries:
+- reference:
+    schema: olm.package
+  message: foo is deprecated
+---
+schema: example.com.custom
+name: one
+---
+schema: example.com.custom
+name: two
+---
+schema: example.com.other
+`), Mode: os.ModePerm}
+		Expect(store.Store(context.Background(), "test-catalog", fsys)).To(Succeed())
+
+		summary, err := store.ContentSummary("test-catalog")
+		Expect(err).ToNot(HaveOccurred())
+		stored, err := os.Stat(filepath.Join(store.RootDir, "test-catalog", v1ApiPath, v1ApiData))
+		Expect(err).ToNot(HaveOccurred())
+		diff, err := store.ContentDiff("test-catalog")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary).To(Equal(&ContentSummary{
+			Digest:         diff.To,
+			SizeBytes:      stored.Size(),
+			Packages:       1,
+			Channels:       1,
+			Bundles:        1,
+			Deprecations:   1,
+			UnknownSchemas: []string{"example.com.custom", "example.com.other"},
+		}))
+	})
+})
+
+var _ = Describe("LocalDir content reader", func() {
+	It("returns an error for a catalog without stored content", func() {
+		store := &LocalDirV1{RootDir: GinkgoT().TempDir(), RootURL: &url.URL{Path: urlPrefix}}
+		_, _, err := store.ContentReader("test-catalog")
+		Expect(err).To(MatchError(fs.ErrNotExist))
+	})
+
+	It("keeps reading the revision it was opened for", func() {
+		store := &LocalDirV1{RootDir: GinkgoT().TempDir(), RootURL: &url.URL{Path: urlPrefix}}
+		Expect(store.Store(context.Background(), "test-catalog", packageFS("foo"))).To(Succeed())
+		summary, err := store.ContentSummary("test-catalog")
+		Expect(err).ToNot(HaveOccurred())
+
+		r, digest, err := store.ContentReader("test-catalog")
+		Expect(err).ToNot(HaveOccurred())
+		defer r.Close()
+		Expect(digest).To(Equal(summary.Digest))
+		Expect(store.Store(context.Background(), "test-catalog", packageFS("bar"))).To(Succeed())
+
+		cfg, err := declcfg.LoadReader(r)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cfg.Packages).To(HaveLen(1))
+		Expect(cfg.Packages[0].Name).To(Equal("foo"))
+	})
+})
+
+var _ = Describe("LocalDir diff endpoint", func() {
+	var (
+		catalog    = "test-catalog"
+		rootDir    string
+		testServer *httptest.Server
+		store      *LocalDirV1
+		diffURL    string
+	)
+	BeforeEach(func() {
+		rootDir = GinkgoT().TempDir()
+		store = &LocalDirV1{RootDir: rootDir, RootURL: &url.URL{Path: urlPrefix}}
+		testServer = httptest.NewServer(store.StorageServerHandler())
+		diffURL = fmt.Sprintf("%s%s%s/%s/%s", testServer.URL, urlPrefix, catalog, v1ApiPath, v1ApiDiff)
+	})
+	AfterEach(func() {
+		testServer.Close()
+	})
+
+	It("gets 404 for a catalog without stored content", func() {
+		expectNotFound(diffURL)
+	})
+
+	It("reports the initial revision as entirely added", func() {
+		Expect(store.Store(context.Background(), catalog, packageFS("foo"))).To(Succeed())
+
+		diff := getDiff(diffURL)
+		Expect(diff.From).To(BeEmpty())
+		Expect(diff.To).To(HavePrefix("sha256:"))
+		Expect(diff.Added.Packages).To(Equal([]string{"foo"}))
+		Expect(diff.Added.Channels).To(Equal([]ChannelRef{{Package: "foo", Name: "stable"}}))
+		Expect(diff.Removed.Packages).To(BeEmpty())
+	})
+
+	It("reports the changes between the previous and the current revision", func() {
+		Expect(store.Store(context.Background(), catalog, packageFS("foo"))).To(Succeed())
+		first := getDiff(diffURL)
+		Expect(store.Store(context.Background(), catalog, packageFS("bar"))).To(Succeed())
+
+		diff := getDiff(diffURL)
+		Expect(diff.From).To(Equal(first.To))
+		Expect(diff.To).ToNot(Equal(first.To))
+		Expect(diff.Added.Packages).To(Equal([]string{"bar"}))
+		Expect(diff.Added.Bundles).To(Equal([]BundleRef{{Package: "bar", Name: "bar.v1.0.0"}}))
+		Expect(diff.Removed.Packages).To(Equal([]string{"foo"}))
+		Expect(diff.Removed.Bundles).To(Equal([]BundleRef{{Package: "foo", Name: "foo.v1.0.0"}}))
+	})
+
+	It("keeps the diff when the stored content is unchanged", func() {
+		Expect(store.Store(context.Background(), catalog, packageFS("foo"))).To(Succeed())
+		Expect(store.Store(context.Background(), catalog, packageFS("bar"))).To(Succeed())
+		before := getDiff(diffURL)
+		Expect(store.Store(context.Background(), catalog, packageFS("bar"))).To(Succeed())
+
+		Expect(getDiff(diffURL)).To(Equal(before))
+	})
+
+	It("persists revisions across restarts", func() {
+		Expect(store.Store(context.Background(), catalog, packageFS("foo"))).To(Succeed())
+		Expect(store.Store(context.Background(), catalog, packageFS("bar"))).To(Succeed())
+		before, err := store.ContentDiff(catalog)
+		Expect(err).ToNot(HaveOccurred())
+
+		restarted := &LocalDirV1{RootDir: rootDir, RootURL: &url.URL{Path: urlPrefix}}
+		after, err := restarted.ContentDiff(catalog)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(after).To(Equal(before))
+	})
+
+	It("does not serve the recorded revisions as catalog content", func() {
+		Expect(store.Store(context.Background(), catalog, packageFS("foo"))).To(Succeed())
+		expectNotFound(fmt.Sprintf("%s%s%s/%s", testServer.URL, urlPrefix, catalog, revisionsFile))
+	})
+
+	It("clears the diff when the content is deleted", func() {
+		Expect(store.Store(context.Background(), catalog, packageFS("foo"))).To(Succeed())
+		Expect(store.Delete(catalog)).To(Succeed())
+
+		diff, err := store.ContentDiff(catalog)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diff).To(BeNil())
+		expectNotFound(diffURL)
+	})
+})
+
+func getDiff(url string) *Diff {
+	resp, err := http.Get(url) //nolint:gosec
+	Expect(err).ToNot(HaveOccurred())
+	defer resp.Body.Close()
+	Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	Expect(resp.Header.Get("Content-Type")).To(Equal("application/json"))
+	var diff Diff
+	Expect(json.NewDecoder(resp.Body).Decode(&diff)).To(Succeed())
+	return &diff
+}
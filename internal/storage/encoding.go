@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzhttp"
+	"github.com/klauspost/compress/zstd"
+
+	catalogdmetrics "github.com/operator-framework/catalogd/internal/metrics"
+)
+
+const (
+	encodingZstd     = "zstd"
+	encodingBrotli   = "br"
+	encodingGzip     = "gzip"
+	encodingIdentity = "identity"
+
+	// minCompressSize matches the default minimum size used by gzhttp so that
+	// all encodings agree on which responses are worth compressing.
+	minCompressSize = gzhttp.DefaultMinSize
+)
+
+// supportedEncodings lists the content encodings the catalog server can
+// produce, in order of server preference. When a client accepts more than one
+// of them with the same quality value, the earliest entry in this list wins.
+var supportedEncodings = []string{encodingZstd, encodingBrotli, encodingGzip}
+
+var (
+	zstdEncoderPool = sync.Pool{New: func() any {
+		// Errors are only returned for invalid options, which are static here.
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return enc
+	}}
+	brotliWriterPool = sync.Pool{New: func() any {
+		return brotli.NewWriterLevel(nil, brotli.DefaultCompression)
+	}}
+)
+
+// encodingHandler wraps handler so that responses are compressed using the
+// best content encoding accepted by the client. gzip is delegated to gzhttp,
+// while zstd and brotli are handled by encodingResponseWriter. The encoding
+// that ends up on the wire is recorded in the ResponseEncodingMetric.
+func encodingHandler(handler http.Handler) http.Handler {
+	gzHandler := gzhttp.GzipHandler(handler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			encoding := w.Header().Get("Content-Encoding")
+			if encoding == "" {
+				encoding = encodingIdentity
+			}
+			catalogdmetrics.ResponseEncodingMetric.WithLabelValues(encoding).Inc()
+		}()
+
+		// Partial content can't be meaningfully compressed on the fly.
+		if r.Header.Get("Range") != "" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		switch negotiateEncoding(r.Header.Get("Accept-Encoding")) {
+		case encodingZstd:
+			ew := &encodingResponseWriter{ResponseWriter: w, encoding: encodingZstd}
+			defer ew.Close()
+			handler.ServeHTTP(ew, r)
+		case encodingBrotli:
+			ew := &encodingResponseWriter{ResponseWriter: w, encoding: encodingBrotli}
+			defer ew.Close()
+			handler.ServeHTTP(ew, r)
+		case encodingGzip:
+			gzHandler.ServeHTTP(w, r)
+		default:
+			w.Header().Add("Vary", "Accept-Encoding")
+			handler.ServeHTTP(w, r)
+		}
+	})
+}
+
+// negotiateEncoding returns the supported encoding with the highest quality
+// value in the given Accept-Encoding header, or identity if the client does
+// not accept any of the supported encodings.
+func negotiateEncoding(acceptEncoding string) string {
+	qualities := map[string]float64{}
+	wildcard := -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if !found || strings.ToLower(strings.TrimSpace(key)) != "q" {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				// A malformed quality value makes the coding unacceptable.
+				parsed = 0
+			}
+			q = parsed
+		}
+		if name == "*" {
+			wildcard = q
+			continue
+		}
+		qualities[name] = q
+	}
+
+	best, bestQ := encodingIdentity, 0.0
+	for _, encoding := range supportedEncodings {
+		q, ok := qualities[encoding]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// encodingResponseWriter compresses the response body with either zstd or
+// brotli. Compression is only applied to successful responses that are not
+// already encoded and that are at least minCompressSize bytes long, when the
+// length is known up front.
+type encodingResponseWriter struct {
+	http.ResponseWriter
+	encoding string
+
+	wroteHeader bool
+	encoder     io.WriteCloser
+}
+
+func (w *encodingResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	h := w.Header()
+	h.Add("Vary", "Accept-Encoding")
+	if code == http.StatusOK && h.Get("Content-Encoding") == "" && !tooSmallToCompress(h.Get("Content-Length")) {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		switch w.encoding {
+		case encodingZstd:
+			enc := zstdEncoderPool.Get().(*zstd.Encoder)
+			enc.Reset(w.ResponseWriter)
+			w.encoder = enc
+		case encodingBrotli:
+			bw := brotliWriterPool.Get().(*brotli.Writer)
+			bw.Reset(w.ResponseWriter)
+			w.encoder = bw
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *encodingResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.encoder == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.encoder.Write(b)
+}
+
+// Close flushes any buffered compressed data and returns the encoder to its
+// pool. It must be called once the wrapped handler has returned.
+func (w *encodingResponseWriter) Close() error {
+	if w.encoder == nil {
+		return nil
+	}
+	err := w.encoder.Close()
+	switch enc := w.encoder.(type) {
+	case *zstd.Encoder:
+		enc.Reset(nil)
+		zstdEncoderPool.Put(enc)
+	case *brotli.Writer:
+		enc.Reset(nil)
+		brotliWriterPool.Put(enc)
+	}
+	w.encoder = nil
+	return err
+}
+
+func tooSmallToCompress(contentLength string) bool {
+	if contentLength == "" {
+		return false
+	}
+	n, err := strconv.ParseInt(contentLength, 10, 64)
+	return err == nil && n < minCompressSize
+}
@@ -0,0 +1,23 @@
+package storage
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = DescribeTable("Accept-Encoding negotiation",
+	func(acceptEncoding, expected string) {
+		Expect(negotiateEncoding(acceptEncoding)).To(Equal(expected))
+	},
+	Entry("no header", "", encodingIdentity),
+	Entry("only gzip", "gzip", encodingGzip),
+	Entry("server preference breaks ties", "gzip, br, zstd", encodingZstd),
+	Entry("brotli preferred over zstd without gzip", "br, gzip", encodingBrotli),
+	Entry("client quality values win over server preference", "zstd;q=0.5, gzip", encodingGzip),
+	Entry("encodings with q=0 are not acceptable", "zstd;q=0, br;q=0", encodingIdentity),
+	Entry("wildcard selects the most preferred encoding", "*", encodingZstd),
+	Entry("wildcard does not override explicit refusals", "zstd;q=0, *;q=0.5", encodingBrotli),
+	Entry("encoding names are case insensitive", "GZIP", encodingGzip),
+	Entry("unsupported encodings are ignored", "deflate, compress", encodingIdentity),
+	Entry("malformed quality values are not acceptable", "zstd;q=abc, gzip;q=0.1", encodingGzip),
+)
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	v1ApiEvents = "events"
+
+	eventTypeCurrent  = "current"
+	eventTypeRevision = "revision"
+	eventTypeDeleted  = "deleted"
+
+	// subscriberBufferSize is the number of events that may be queued for a
+	// single subscriber. Subscribers that fall further behind are disconnected
+	// and are expected to reconnect.
+	subscriberBufferSize = 16
+)
+
+// eventHeartbeatInterval is how often a comment line is written to idle
+// event streams so that intermediaries don't consider them dead.
+var eventHeartbeatInterval = 30 * time.Second
+
+// catalogEvent is the payload of an event sent to clients of the events
+// endpoint.
+type catalogEvent struct {
+	Type      string    `json:"-"`
+	Catalog   string    `json:"catalog"`
+	Digest    string    `json:"digest,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// Added and Removed are only set for revision events.
+	Added   *ContentSet `json:"added,omitempty"`
+	Removed *ContentSet `json:"removed,omitempty"`
+}
+
+// eventBroker fans out catalog events to the clients currently subscribed to
+// a catalog's event stream. The zero value is ready to use.
+type eventBroker struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan catalogEvent]struct{}
+}
+
+func (b *eventBroker) subscribe(catalog string) chan catalogEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers == nil {
+		b.subscribers = map[string]map[chan catalogEvent]struct{}{}
+	}
+	if b.subscribers[catalog] == nil {
+		b.subscribers[catalog] = map[chan catalogEvent]struct{}{}
+	}
+	ch := make(chan catalogEvent, subscriberBufferSize)
+	b.subscribers[catalog][ch] = struct{}{}
+	return ch
+}
+
+func (b *eventBroker) unsubscribe(catalog string, ch chan catalogEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[catalog][ch]; !ok {
+		return
+	}
+	delete(b.subscribers[catalog], ch)
+	if len(b.subscribers[catalog]) == 0 {
+		delete(b.subscribers, catalog)
+	}
+	close(ch)
+}
+
+// publish sends event to all subscribers of event.Catalog without blocking.
+// Subscribers whose buffer is full are dropped. If closeStreams is true, all
+// subscribers are removed after the event has been queued.
+func (b *eventBroker) publish(event catalogEvent, closeStreams bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers[event.Catalog] {
+		select {
+		case ch <- event:
+			if !closeStreams {
+				continue
+			}
+		default:
+		}
+		delete(b.subscribers[event.Catalog], ch)
+		close(ch)
+	}
+	if len(b.subscribers[event.Catalog]) == 0 {
+		delete(b.subscribers, event.Catalog)
+	}
+}
+
+// eventsHandler serves a server-sent events stream for the catalog named in
+// the request path. The stream starts with a "current" event describing the
+// revision currently being served, followed by a "revision" event each time
+// a new revision of the catalog is stored. The stream ends with a "deleted"
+// event if the catalog's content is deleted.
+func (s *LocalDirV1) eventsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		catalog := catalogFromRequest(r)
+
+		// Subscribe before looking up the current revision so that a
+		// revision stored in between is not missed.
+		events := s.events.subscribe(catalog)
+		defer s.events.unsubscribe(catalog, events)
+
+		current, err := s.currentIndex(r.Context(), catalog)
+		if err != nil {
+			http.Error(w, "error reading catalog content", http.StatusInternalServerError)
+			return
+		}
+		if current == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		rc := http.NewResponseController(w)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+
+		if r.Header.Get("Last-Event-ID") != current.Digest {
+			if err := writeEvent(w, catalogEvent{
+				Type:      eventTypeCurrent,
+				Catalog:   catalog,
+				Digest:    current.Digest,
+				Timestamp: time.Now(),
+			}); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(eventHeartbeatInterval)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if err := writeEvent(w, event); err != nil {
+					return
+				}
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	})
+}
+
+func writeEvent(w http.ResponseWriter, event catalogEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if event.Digest != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", event.Digest); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
+}
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing/fstest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LocalDir events endpoint", func() {
+	var (
+		catalog    = "test-catalog"
+		testServer *httptest.Server
+		store      *LocalDirV1
+		eventsURL  string
+	)
+	BeforeEach(func() {
+		store = &LocalDirV1{RootDir: GinkgoT().TempDir(), RootURL: &url.URL{Path: urlPrefix}}
+		testServer = httptest.NewServer(store.StorageServerHandler())
+		eventsURL = fmt.Sprintf("%s%s%s/%s/%s", testServer.URL, urlPrefix, catalog, v1ApiPath, v1ApiEvents)
+	})
+	AfterEach(func() {
+		testServer.Close()
+	})
+
+	It("gets 404 for a catalog without stored content", func() {
+		expectNotFound(eventsURL)
+	})
+
+	When("content is stored for the catalog", func() {
+		var events *sseReader
+		BeforeEach(func() {
+			Expect(store.Store(context.Background(), catalog, packageFS("foo"))).To(Succeed())
+			events = openEventStream(eventsURL, "")
+		})
+		AfterEach(func() {
+			events.Close()
+		})
+
+		It("starts the stream with the current revision", func() {
+			typ, id, event := events.next()
+			Expect(typ).To(Equal(eventTypeCurrent))
+			Expect(event.Catalog).To(Equal(catalog))
+			Expect(event.Digest).To(HavePrefix("sha256:"))
+			Expect(id).To(Equal(event.Digest))
+			Expect(event.Added).To(BeNil())
+			Expect(event.Removed).To(BeNil())
+		})
+
+		It("sends a revision event with the added and removed content when a new revision is stored", func() {
+			_, _, current := events.next()
+			Expect(store.Store(context.Background(), catalog, packageFS("bar"))).To(Succeed())
+
+			typ, id, event := events.next()
+			Expect(typ).To(Equal(eventTypeRevision))
+			Expect(event.Digest).ToNot(Equal(current.Digest))
+			Expect(id).To(Equal(event.Digest))
+			Expect(event.Added.Packages).To(Equal([]string{"bar"}))
+			Expect(event.Added.Bundles).To(Equal([]BundleRef{{Package: "bar", Name: "bar.v1.0.0"}}))
+			Expect(event.Removed.Packages).To(Equal([]string{"foo"}))
+			Expect(event.Removed.Bundles).To(Equal([]BundleRef{{Package: "foo", Name: "foo.v1.0.0"}}))
+		})
+
+		It("does not send an event when the stored content is unchanged", func() {
+			events.next()
+			Expect(store.Store(context.Background(), catalog, packageFS("foo"))).To(Succeed())
+			Expect(store.Store(context.Background(), catalog, packageFS("bar"))).To(Succeed())
+
+			typ, _, event := events.next()
+			Expect(typ).To(Equal(eventTypeRevision))
+			Expect(event.Added.Packages).To(Equal([]string{"bar"}))
+		})
+
+		It("sends a deleted event and ends the stream when the content is deleted", func() {
+			events.next()
+			Expect(store.Delete(catalog)).To(Succeed())
+
+			typ, _, event := events.next()
+			Expect(typ).To(Equal(eventTypeDeleted))
+			Expect(event.Catalog).To(Equal(catalog))
+			Expect(events.done()).To(BeTrue())
+		})
+
+		It("skips the current revision event when the client has already seen it", func() {
+			_, id, _ := events.next()
+			resumed := openEventStream(eventsURL, id)
+			defer resumed.Close()
+
+			Expect(store.Store(context.Background(), catalog, packageFS("bar"))).To(Succeed())
+			typ, _, _ := resumed.next()
+			Expect(typ).To(Equal(eventTypeRevision))
+		})
+	})
+})
+
+// packageFS returns an FBC containing a single package with a single bundle.
+func packageFS(pkg string) fstest.MapFS {
+	fbc := fmt.Sprintf(testPackageTemplate, "stable", pkg) +
+		fmt.Sprintf(testChannelTemplate, pkg, "stable", pkg+".v1.0.0") +
+		fmt.Sprintf(testBundleTemplate, "example.com/"+pkg+":v1.0.0", pkg+".v1.0.0", pkg, "operator", "example.com/"+pkg+"-operator:v1.0.0", "dW5pbXBvcnRhbnQK")
+	return fstest.MapFS{
+		"catalog.yaml": &fstest.MapFile{Data: []byte(fbc), Mode: os.ModePerm},
+	}
+}
+
+type sseReader struct {
+	resp    *http.Response
+	scanner *bufio.Scanner
+}
+
+func openEventStream(url, lastEventID string) *sseReader {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	Expect(err).ToNot(HaveOccurred())
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	Expect(resp.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+	return &sseReader{resp: resp, scanner: bufio.NewScanner(resp.Body)}
+}
+
+// next reads the next event from the stream, skipping comments.
+func (r *sseReader) next() (string, string, catalogEvent) {
+	var typ, id string
+	var event catalogEvent
+	for r.scanner.Scan() {
+		line := r.scanner.Text()
+		switch {
+		case line == "" && typ != "":
+			return typ, id, event
+		case strings.HasPrefix(line, "event: "):
+			typ = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			Expect(json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event)).To(Succeed())
+		}
+	}
+	Fail(fmt.Sprintf("event stream ended unexpectedly: %v", r.scanner.Err()))
+	return "", "", event
+}
+
+func (r *sseReader) done() bool {
+	return !r.scanner.Scan()
+}
+
+func (r *sseReader) Close() {
+	Expect(r.resp.Body.Close()).To(Succeed())
+}
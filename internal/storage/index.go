@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+)
+
+// revisionsFile is the name of the file, stored alongside the content of a
+// catalog, that records the indexes of the current and previous revisions.
+// It is hidden from clients of the content server.
+const revisionsFile = ".revisions.json"
+
+// catalogIndex is a summary of the content of a single stored revision of a
+// catalog. It is built while the content is being stored and is used to
+// describe the content and how a catalog changed between revisions.
+type catalogIndex struct {
+	Digest         string
+	SizeBytes      int64
+	Packages       sets.Set[string]
+	Channels       map[ChannelRef][]declcfg.ChannelEntry
+	Bundles        sets.Set[BundleRef]
+	Deprecations   int
+	UnknownSchemas sets.Set[string]
+}
+
+// ChannelRef identifies a channel within a catalog.
+type ChannelRef struct {
+	Package string `json:"package"`
+	Name    string `json:"name"`
+}
+
+// BundleRef identifies a bundle within a catalog.
+type BundleRef struct {
+	Package string `json:"package"`
+	Name    string `json:"name"`
+}
+
+func newCatalogIndex() *catalogIndex {
+	return &catalogIndex{
+		Packages:       sets.New[string](),
+		Channels:       map[ChannelRef][]declcfg.ChannelEntry{},
+		Bundles:        sets.New[BundleRef](),
+		UnknownSchemas: sets.New[string](),
+	}
+}
+
+func (idx *catalogIndex) add(meta *declcfg.Meta) error {
+	idx.SizeBytes += int64(len(meta.Blob))
+	switch meta.Schema {
+	case declcfg.SchemaPackage:
+		idx.Packages.Insert(meta.Name)
+	case declcfg.SchemaChannel:
+		var ch declcfg.Channel
+		if err := json.Unmarshal(meta.Blob, &ch); err != nil {
+			return fmt.Errorf("error parsing channel %q of package %q: %w", meta.Name, meta.Package, err)
+		}
+		idx.Channels[ChannelRef{Package: ch.Package, Name: ch.Name}] = ch.Entries
+	case declcfg.SchemaBundle:
+		idx.Bundles.Insert(BundleRef{Package: meta.Package, Name: meta.Name})
+	case declcfg.SchemaDeprecation:
+		idx.Deprecations++
+	default:
+		idx.UnknownSchemas.Insert(meta.Schema)
+	}
+	return nil
+}
+
+// indexJSON is the serialized form of a catalogIndex.
+type indexJSON struct {
+	Digest         string        `json:"digest"`
+	SizeBytes      int64         `json:"sizeBytes"`
+	Packages       []string      `json:"packages"`
+	Channels       []channelJSON `json:"channels"`
+	Bundles        []BundleRef   `json:"bundles"`
+	Deprecations   int           `json:"deprecations"`
+	UnknownSchemas []string      `json:"unknownSchemas"`
+}
+
+type channelJSON struct {
+	ChannelRef
+	Entries []declcfg.ChannelEntry `json:"entries"`
+}
+
+func (idx *catalogIndex) MarshalJSON() ([]byte, error) {
+	channels := make([]channelJSON, 0, len(idx.Channels))
+	for _, ref := range sortedChannels(sets.KeySet(idx.Channels)) {
+		channels = append(channels, channelJSON{ChannelRef: ref, Entries: idx.Channels[ref]})
+	}
+	return json.Marshal(indexJSON{
+		Digest:         idx.Digest,
+		SizeBytes:      idx.SizeBytes,
+		Packages:       sets.List(idx.Packages),
+		Channels:       channels,
+		Bundles:        sortedBundles(idx.Bundles),
+		Deprecations:   idx.Deprecations,
+		UnknownSchemas: sets.List(idx.UnknownSchemas),
+	})
+}
+
+func (idx *catalogIndex) UnmarshalJSON(data []byte) error {
+	var in indexJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	*idx = *newCatalogIndex()
+	idx.Digest = in.Digest
+	idx.SizeBytes = in.SizeBytes
+	idx.Packages.Insert(in.Packages...)
+	for _, ch := range in.Channels {
+		idx.Channels[ch.ChannelRef] = ch.Entries
+	}
+	idx.Bundles.Insert(in.Bundles...)
+	idx.Deprecations = in.Deprecations
+	idx.UnknownSchemas.Insert(in.UnknownSchemas...)
+	return nil
+}
+
+// catalogRevisions holds the indexes of the revision of a catalog that is
+// currently stored and of the revision that was stored before it.
+type catalogRevisions struct {
+	Current  *catalogIndex `json:"current"`
+	Previous *catalogIndex `json:"previous,omitempty"`
+}
+
+// loadCatalogRevisions reads the revisions recorded for the catalog stored in
+// catalogDir. Content stored before revisions were recorded is indexed from
+// the content file, without a previous revision. If no content is stored in
+// catalogDir, it returns nil and no error.
+func loadCatalogRevisions(ctx context.Context, catalogDir string) (*catalogRevisions, error) {
+	data, err := os.ReadFile(filepath.Join(catalogDir, revisionsFile))
+	if err == nil {
+		var revs catalogRevisions
+		if err := json.Unmarshal(data, &revs); err != nil {
+			return nil, fmt.Errorf("error parsing catalog revisions: %w", err)
+		}
+		return &revs, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	current, err := loadCatalogIndex(ctx, filepath.Join(catalogDir, v1ApiPath, v1ApiData))
+	if err != nil || current == nil {
+		return nil, err
+	}
+	return &catalogRevisions{Current: current}, nil
+}
+
+// writeTempCatalogRevisions writes revs to a temporary file in catalogDir,
+// and returns its path. Renaming it to revisionsFile atomically records revs
+// for the catalog stored in catalogDir.
+func writeTempCatalogRevisions(catalogDir string, revs *catalogRevisions) (string, error) {
+	data, err := json.Marshal(revs)
+	if err != nil {
+		return "", err
+	}
+	tempFile, err := os.CreateTemp(catalogDir, revisionsFile+"-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tempFile.Write(data); err != nil {
+		_ = tempFile.Close()
+		_ = os.Remove(tempFile.Name())
+		return "", err
+	}
+	if err := tempFile.Close(); err != nil {
+		_ = os.Remove(tempFile.Name())
+		return "", err
+	}
+	return tempFile.Name(), nil
+}
+
+// loadCatalogIndex builds the index of the content stored in the file at
+// path. If no file exists at path, it returns nil and no error.
+func loadCatalogIndex(ctx context.Context, path string) (*catalogIndex, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	idx := newCatalogIndex()
+	hash := sha256.New()
+	if err := declcfg.WalkMetasReader(io.TeeReader(file, hash), func(meta *declcfg.Meta, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return idx.add(meta)
+	}); err != nil {
+		return nil, fmt.Errorf("error indexing stored content %q: %w", path, err)
+	}
+	// Make sure the hash covers the entire file, even if the walk stopped
+	// reading before EOF.
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, err
+	}
+	idx.Digest = formatDigest(hash.Sum(nil))
+	return idx, nil
+}
+
+// summary returns the ContentSummary of the revision described by idx.
+func (idx *catalogIndex) summary() *ContentSummary {
+	return &ContentSummary{
+		Digest:         idx.Digest,
+		SizeBytes:      idx.SizeBytes,
+		Packages:       idx.Packages.Len(),
+		Channels:       len(idx.Channels),
+		Bundles:        idx.Bundles.Len(),
+		Deprecations:   idx.Deprecations,
+		UnknownSchemas: sets.List(idx.UnknownSchemas),
+	}
+}
+
+func formatDigest(sum []byte) string {
+	return fmt.Sprintf("sha256:%x", sum)
+}
+
+func sortedChannels(s sets.Set[ChannelRef]) []ChannelRef {
+	channels := s.UnsortedList()
+	slices.SortFunc(channels, func(a, b ChannelRef) int {
+		return cmp.Or(cmp.Compare(a.Package, b.Package), cmp.Compare(a.Name, b.Name))
+	})
+	return channels
+}
+
+func sortedBundles(s sets.Set[BundleRef]) []BundleRef {
+	bundles := s.UnsortedList()
+	slices.SortFunc(bundles, func(a, b BundleRef) int {
+		return cmp.Or(cmp.Compare(a.Package, b.Package), cmp.Compare(a.Name, b.Name))
+	})
+	return bundles
+}
@@ -2,16 +2,25 @@ package storage
 
 import (
 	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/klauspost/compress/gzhttp"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/operator-framework/operator-registry/alpha/declcfg"
+
+	"github.com/operator-framework/catalogd/internal/tracing"
 )
 
 // LocalDirV1 is a storage Instance. When Storing a new FBC contained in
@@ -19,62 +28,346 @@ import (
 // it is copied to its final destination in RootDir/catalogName/. This is
 // done so that clients accessing the content stored in RootDir/catalogName have
 // atomic view of the content for a catalog.
+//
+// LocalDirV1 keeps track of the current and previous revision of each
+// catalog it serves so that clients can be notified of and inspect the
+// changes between them. Files and directories whose names start with "."
+// hold this bookkeeping and are never served. A LocalDirV1 must not be
+// copied after first use.
+//
+// Different catalogs are stored concurrently: content is written, indexed and
+// hashed before the catalog is locked, and a catalog is only locked to
+// publish a new revision or delete its content.
+//
+// Catalogs are usually named by a single path element. The content of
+// namespaced Catalogs is stored under the name returned by NamespacedCatalog
+// instead, and is served below RootURL at <namespace>/catalogs/<name>.
 type LocalDirV1 struct {
 	RootDir string
 	RootURL *url.URL
+	// Priorities, if set, enables searching the content of catalogs at
+	// SearchPath below RootURL. It returns the catalogs to search, mapped to
+	// their priority.
+	Priorities func(ctx context.Context) (map[string]int32, error)
+
+	// m guards the maps below, and is only held to access them.
+	m             sync.Mutex
+	catalogLocks  map[string]*catalogLock
+	revisions     map[string]*catalogRevisions
+	searchIndexes map[string]*searchIndex
+	events        eventBroker
+}
+
+// catalogLock serializes the changes to the stored content of a catalog. It
+// is removed from LocalDirV1.catalogLocks once no goroutine holds or waits
+// for it.
+type catalogLock struct {
+	sync.Mutex
+	refs int
 }
 
 const (
 	v1ApiPath = "api/v1"
 	v1ApiData = "all"
+
+	namespacedCatalogsPath = "catalogs"
+
+	// previousContentFile is the name of the file, stored alongside the
+	// content of a catalog, that the previous content is kept in while a new
+	// revision is published. It is hidden from clients of the content server.
+	previousContentFile = ".previous-content"
 )
 
-func (s LocalDirV1) Store(ctx context.Context, catalog string, fsys fs.FS) error {
-	fbcDir := filepath.Join(s.RootDir, catalog, v1ApiPath)
-	if err := os.MkdirAll(fbcDir, 0700); err != nil {
-		return err
-	}
-	tempFile, err := os.CreateTemp(s.RootDir, fmt.Sprint(catalog))
+// NamespacedCatalog returns the name under which the content of the Catalog
+// with the given namespace and name is stored.
+func NamespacedCatalog(namespace, name string) string {
+	return path.Join(namespace, namespacedCatalogsPath, name)
+}
+
+func (s *LocalDirV1) Store(ctx context.Context, catalog string, fsys fs.FS) error {
+	ctx, span := tracing.Tracer().Start(ctx, "LocalDirV1.Store", trace.WithAttributes(tracing.CatalogKey.String(catalog)))
+	err := s.store(ctx, catalog, fsys)
+	tracing.EndSpan(span, err)
+	return err
+}
+
+func (s *LocalDirV1) store(ctx context.Context, catalog string, fsys fs.FS) error {
+	tempFile, err := os.CreateTemp(s.RootDir, fmt.Sprintf(".%s-*", strings.ReplaceAll(catalog, "/", "-")))
 	if err != nil {
 		return err
 	}
 	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	// The content is only indexed for searching when search is enabled.
+	var search *searchIndex
+	if s.Priorities != nil {
+		search = newSearchIndex()
+	}
+	idx := newCatalogIndex()
+	hash := sha256.New()
+	w := io.MultiWriter(tempFile, hash)
 	if err := declcfg.WalkMetasFS(ctx, fsys, func(path string, meta *declcfg.Meta, err error) error {
 		if err != nil {
 			return err
 		}
-		_, err = tempFile.Write(meta.Blob)
+		if err := idx.add(meta); err != nil {
+			return err
+		}
+		if search != nil {
+			if err := search.add(meta); err != nil {
+				return err
+			}
+		}
+		_, err = w.Write(meta.Blob)
 		return err
 	}); err != nil {
 		return fmt.Errorf("error walking FBC root: %w", err)
 	}
-	fbcFile := filepath.Join(fbcDir, v1ApiData)
-	return os.Rename(tempFile.Name(), fbcFile)
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+	idx.Digest = formatDigest(hash.Sum(nil))
+
+	unlock := s.lockCatalog(catalog)
+	defer unlock()
+	revs, err := s.revisionsLocked(ctx, catalog)
+	if err != nil {
+		return err
+	}
+	var previous *catalogIndex
+	if revs != nil {
+		if revs.Current.Digest == idx.Digest && s.ContentExists(catalog) {
+			// The content is unchanged, so there is no new revision to store.
+			return nil
+		}
+		previous = revs.Current
+	}
+
+	catalogDir := filepath.Join(s.RootDir, catalog)
+	if err := os.MkdirAll(filepath.Join(catalogDir, v1ApiPath), 0700); err != nil {
+		return err
+	}
+	revs = &catalogRevisions{Current: idx, Previous: previous}
+	if err := publishRevision(catalogDir, tempFile.Name(), revs); err != nil {
+		return err
+	}
+	s.m.Lock()
+	s.setRevisionsLocked(catalog, revs)
+	if search != nil {
+		search.digest = idx.Digest
+		s.setSearchIndexLocked(catalog, search)
+	}
+	s.m.Unlock()
+
+	diff := diffIndexes(previous, idx)
+	s.events.publish(catalogEvent{
+		Type:      eventTypeRevision,
+		Catalog:   catalog,
+		Digest:    idx.Digest,
+		Timestamp: time.Now(),
+		Added:     &diff.Added,
+		Removed:   &diff.Removed,
+	}, false)
+	return nil
 }
 
-func (s LocalDirV1) Delete(catalog string) error {
-	return os.RemoveAll(filepath.Join(s.RootDir, catalog))
+// publishRevision makes the content written to contentFile the current
+// revision of the catalog stored in catalogDir, as recorded by revs. The
+// revisions are written before the content is published, and the previous
+// content is restored if they can not be recorded, so that the content served
+// for a catalog always matches its recorded revisions.
+func publishRevision(catalogDir, contentFile string, revs *catalogRevisions) error {
+	revsFile, err := writeTempCatalogRevisions(catalogDir, revs)
+	if err != nil {
+		return fmt.Errorf("error recording catalog revisions: %w", err)
+	}
+	defer os.Remove(revsFile)
+
+	// The previous content is linked to a hidden file until the revisions
+	// are recorded, so that it can be restored without copying it.
+	fbcFile := filepath.Join(catalogDir, v1ApiPath, v1ApiData)
+	backupFile := filepath.Join(catalogDir, previousContentFile)
+	if err := os.Remove(backupFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	hasPrevious := true
+	if err := os.Link(fbcFile, backupFile); errors.Is(err, fs.ErrNotExist) {
+		hasPrevious = false
+	} else if err != nil {
+		return fmt.Errorf("error keeping previous content: %w", err)
+	}
+	defer os.Remove(backupFile)
+
+	if err := os.Rename(contentFile, fbcFile); err != nil {
+		return err
+	}
+	if err := os.Rename(revsFile, filepath.Join(catalogDir, revisionsFile)); err != nil {
+		var restoreErr error
+		if hasPrevious {
+			restoreErr = os.Rename(backupFile, fbcFile)
+		} else {
+			restoreErr = os.Remove(fbcFile)
+		}
+		if restoreErr != nil {
+			err = errors.Join(err, fmt.Errorf("error restoring previous content: %w", restoreErr))
+		}
+		return fmt.Errorf("error recording catalog revisions: %w", err)
+	}
+	return nil
 }
 
-func (s LocalDirV1) BaseURL(catalog string) string {
+func (s *LocalDirV1) Delete(catalog string) error {
+	unlock := s.lockCatalog(catalog)
+	defer unlock()
+
+	if err := os.RemoveAll(filepath.Join(s.RootDir, catalog)); err != nil {
+		return err
+	}
+	s.m.Lock()
+	delete(s.revisions, catalog)
+	delete(s.searchIndexes, catalog)
+	s.m.Unlock()
+	s.events.publish(catalogEvent{
+		Type:      eventTypeDeleted,
+		Catalog:   catalog,
+		Timestamp: time.Now(),
+	}, true)
+	return nil
+}
+
+// ContentDiff returns the Diff from the previous revision of catalog to the
+// revision currently stored. If only one revision of catalog has been stored,
+// all of its content is reported as added. If no content is stored for
+// catalog, it returns nil and no error.
+func (s *LocalDirV1) ContentDiff(catalog string) (*Diff, error) {
+	revs, err := s.catalogRevisions(context.Background(), catalog)
+	if err != nil || revs == nil {
+		return nil, err
+	}
+	return diffIndexes(revs.Previous, revs.Current), nil
+}
+
+// ContentSummary returns the ContentSummary of the revision of catalog that
+// is currently stored. If no content is stored for catalog, it returns nil and
+// no error.
+func (s *LocalDirV1) ContentSummary(catalog string) (*ContentSummary, error) {
+	current, err := s.currentIndex(context.Background(), catalog)
+	if err != nil || current == nil {
+		return nil, err
+	}
+	return current.summary(), nil
+}
+
+// ContentReader returns a reader of the revision of catalog that is currently
+// stored, along with its digest. The reader keeps reading the same revision
+// if a new one is stored before it is closed. If no content is stored for
+// catalog, it returns an error wrapping fs.ErrNotExist.
+func (s *LocalDirV1) ContentReader(catalog string) (io.ReadCloser, string, error) {
+	f, revs, err := s.openCurrent(context.Background(), catalog)
+	if err != nil {
+		return nil, "", err
+	}
+	if revs == nil {
+		return nil, "", fmt.Errorf("no content stored for catalog %q: %w", catalog, fs.ErrNotExist)
+	}
+	return f, revs.Current.Digest, nil
+}
+
+// openCurrent opens the revision of catalog that is currently stored, and
+// returns it along with the revisions of catalog. If no content is stored for
+// catalog, it returns nil and no error.
+func (s *LocalDirV1) openCurrent(ctx context.Context, catalog string) (*os.File, *catalogRevisions, error) {
+	unlock := s.lockCatalog(catalog)
+	defer unlock()
+	revs, err := s.revisionsLocked(ctx, catalog)
+	if err != nil || revs == nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(filepath.Join(s.RootDir, catalog, v1ApiPath, v1ApiData))
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, revs, nil
+}
+
+// ContentDigests returns the digest of the revision currently stored for
+// each catalog, by the name of the catalog.
+func (s *LocalDirV1) ContentDigests() (map[string]string, error) {
+	digests := map[string]string{}
+	err := filepath.WalkDir(s.RootDir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path != s.RootDir {
+			// The catalog was deleted while walking.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || path == s.RootDir {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		catalog, err := filepath.Rel(s.RootDir, path)
+		if err != nil {
+			return err
+		}
+		catalog = filepath.ToSlash(catalog)
+		if !s.ContentExists(catalog) {
+			// Namespaced catalogs are stored further down.
+			return nil
+		}
+		revs, err := s.catalogRevisions(context.Background(), catalog)
+		if err != nil {
+			return fmt.Errorf("error reading revisions of catalog %q: %w", catalog, err)
+		}
+		if revs != nil {
+			digests[catalog] = revs.Current.Digest
+		}
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, err
+	}
+	return digests, nil
+}
+
+func (s *LocalDirV1) BaseURL(catalog string) string {
 	return s.RootURL.JoinPath(catalog).String()
 }
 
-func (s LocalDirV1) StorageServerHandler() http.Handler {
+func (s *LocalDirV1) StorageServerHandler() http.Handler {
 	mux := http.NewServeMux()
 	fsHandler := http.FileServer(http.FS(&filesOnlyFilesystem{os.DirFS(s.RootDir)}))
 	spHandler := http.StripPrefix(s.RootURL.Path, fsHandler)
-	gzHandler := gzhttp.GzipHandler(spHandler)
+	encHandler := encodingHandler(spHandler)
 
 	typeHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Content-Type", "application/jsonl")
-		gzHandler.ServeHTTP(w, r)
+		encHandler.ServeHTTP(w, r)
 	})
 	mux.Handle(s.RootURL.Path, typeHandler)
+	for _, catalogPath := range []string{"{catalog}", path.Join("{namespace}", namespacedCatalogsPath, "{name}")} {
+		mux.Handle("GET "+path.Join(s.RootURL.Path, catalogPath, v1ApiPath, v1ApiEvents), s.eventsHandler())
+		mux.Handle("GET "+path.Join(s.RootURL.Path, catalogPath, v1ApiPath, v1ApiDiff), encodingHandler(s.diffHandler()))
+	}
+	if s.Priorities != nil {
+		mux.Handle("GET "+path.Join(s.RootURL.Path, SearchPath), encodingHandler(s.searchHandler()))
+	}
 	return mux
 }
 
-func (s LocalDirV1) ContentExists(catalog string) bool {
+// catalogFromRequest returns the name of the catalog in the path of a request
+// matched by one of the patterns of StorageServerHandler.
+func catalogFromRequest(r *http.Request) string {
+	if namespace := r.PathValue("namespace"); namespace != "" {
+		return NamespacedCatalog(namespace, r.PathValue("name"))
+	}
+	return r.PathValue("catalog")
+}
+
+func (s *LocalDirV1) ContentExists(catalog string) bool {
 	file, err := os.Stat(filepath.Join(s.RootDir, catalog, v1ApiPath, v1ApiData))
 	if err != nil {
 		return false
@@ -86,6 +379,83 @@ func (s LocalDirV1) ContentExists(catalog string) bool {
 	return true
 }
 
+// currentIndex returns the index of the revision of catalog that is
+// currently stored, or nil if no content is stored for catalog.
+func (s *LocalDirV1) currentIndex(ctx context.Context, catalog string) (*catalogIndex, error) {
+	revs, err := s.catalogRevisions(ctx, catalog)
+	if err != nil || revs == nil {
+		return nil, err
+	}
+	return revs.Current, nil
+}
+
+// lockCatalog locks the stored content of catalog, and returns a function
+// that unlocks it.
+func (s *LocalDirV1) lockCatalog(catalog string) func() {
+	s.m.Lock()
+	if s.catalogLocks == nil {
+		s.catalogLocks = map[string]*catalogLock{}
+	}
+	l, ok := s.catalogLocks[catalog]
+	if !ok {
+		l = &catalogLock{}
+		s.catalogLocks[catalog] = l
+	}
+	l.refs++
+	s.m.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		s.m.Lock()
+		defer s.m.Unlock()
+		if l.refs--; l.refs == 0 {
+			delete(s.catalogLocks, catalog)
+		}
+	}
+}
+
+// catalogRevisions returns the revisions of catalog, or nil if no content is
+// stored for catalog.
+func (s *LocalDirV1) catalogRevisions(ctx context.Context, catalog string) (*catalogRevisions, error) {
+	s.m.Lock()
+	revs, ok := s.revisions[catalog]
+	s.m.Unlock()
+	if ok {
+		return revs, nil
+	}
+	unlock := s.lockCatalog(catalog)
+	defer unlock()
+	return s.revisionsLocked(ctx, catalog)
+}
+
+// revisionsLocked is like catalogRevisions, for callers that hold the lock of
+// catalog.
+func (s *LocalDirV1) revisionsLocked(ctx context.Context, catalog string) (*catalogRevisions, error) {
+	s.m.Lock()
+	revs, ok := s.revisions[catalog]
+	s.m.Unlock()
+	if ok {
+		return revs, nil
+	}
+	// Revisions stored by a previous process are loaded on first use.
+	revs, err := loadCatalogRevisions(ctx, filepath.Join(s.RootDir, catalog))
+	if err != nil || revs == nil {
+		return nil, err
+	}
+	s.m.Lock()
+	s.setRevisionsLocked(catalog, revs)
+	s.m.Unlock()
+	return revs, nil
+}
+
+func (s *LocalDirV1) setRevisionsLocked(catalog string, revs *catalogRevisions) {
+	if s.revisions == nil {
+		s.revisions = map[string]*catalogRevisions{}
+	}
+	s.revisions[catalog] = revs
+}
+
 // filesOnlyFilesystem is a file system that can open only regular
 // files from the underlying filesystem. All other file types result
 // in os.ErrNotExists
@@ -94,9 +464,15 @@ type filesOnlyFilesystem struct {
 }
 
 // Open opens a named file from the underlying filesystem. If the file
-// is not a regular file, it return os.ErrNotExists. Callers are resposible
-// for closing the file returned.
+// is not a regular file, or any element of its path is hidden (starts
+// with "."), it return os.ErrNotExists. Callers are resposible for
+// closing the file returned.
 func (f *filesOnlyFilesystem) Open(name string) (fs.File, error) {
+	for _, elem := range strings.Split(name, "/") {
+		if strings.HasPrefix(elem, ".") {
+			return nil, os.ErrNotExist
+		}
+	}
 	file, err := f.FS.Open(name)
 	if err != nil {
 		return nil, err
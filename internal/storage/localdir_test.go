@@ -20,10 +20,19 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/andybalholm/brotli"
 	"github.com/google/go-cmp/cmp"
+	"github.com/klauspost/compress/zstd"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 	"sigs.k8s.io/yaml"
 
 	"github.com/operator-framework/operator-registry/alpha/declcfg"
+
+	"github.com/operator-framework/catalogd/internal/tracing"
 )
 
 const urlPrefix = "/catalogs/"
@@ -56,7 +65,7 @@ var _ = Describe("LocalDir Storage Test", func() {
 		rootDir = d
 
 		baseURL = &url.URL{Scheme: "http", Host: "test-addr", Path: urlPrefix}
-		store = LocalDirV1{RootDir: rootDir, RootURL: baseURL}
+		store = &LocalDirV1{RootDir: rootDir, RootURL: baseURL}
 		unpackResultFS = &fstest.MapFS{
 			"bundle.yaml":  &fstest.MapFile{Data: []byte(testBundle), Mode: os.ModePerm},
 			"package.yaml": &fstest.MapFile{Data: []byte(testPackage), Mode: os.ModePerm},
@@ -105,16 +114,80 @@ var _ = Describe("LocalDir Storage Test", func() {
 	})
 })
 
+var _ = Describe("LocalDir namespaced catalogs", func() {
+	var (
+		catalog    = NamespacedCatalog("tenant-a", "mine")
+		rootDir    string
+		testServer *httptest.Server
+		store      *LocalDirV1
+		catalogURL string
+	)
+	BeforeEach(func() {
+		rootDir = GinkgoT().TempDir()
+		store = &LocalDirV1{RootDir: rootDir, RootURL: &url.URL{Path: urlPrefix}}
+		testServer = httptest.NewServer(store.StorageServerHandler())
+		catalogURL = fmt.Sprintf("%s%stenant-a/catalogs/mine", testServer.URL, urlPrefix)
+		Expect(store.Store(context.Background(), catalog, packageFS("foo"))).To(Succeed())
+	})
+	AfterEach(func() {
+		testServer.Close()
+	})
+
+	It("serves the content under the namespace of the catalog", func() {
+		Expect(store.BaseURL(catalog)).To(Equal(urlPrefix + "tenant-a/catalogs/mine"))
+		Expect(store.ContentExists(catalog)).To(BeTrue())
+		data, err := os.ReadFile(filepath.Join(rootDir, "tenant-a", "catalogs", "mine", v1ApiPath, v1ApiData))
+		Expect(err).ToNot(HaveOccurred())
+		expectFound(fmt.Sprintf("%s/%s/%s", catalogURL, v1ApiPath, v1ApiData), data)
+	})
+
+	It("serves the diff of the catalog", func() {
+		diff := getDiff(fmt.Sprintf("%s/%s/%s", catalogURL, v1ApiPath, v1ApiDiff))
+		Expect(diff.Added.Packages).To(Equal([]string{"foo"}))
+	})
+
+	It("does not serve the catalog in other namespaces", func() {
+		expectNotFound(fmt.Sprintf("%s%stenant-b/catalogs/mine/%s/%s", testServer.URL, urlPrefix, v1ApiPath, v1ApiData))
+		expectNotFound(fmt.Sprintf("%s%stenant-b/catalogs/mine/%s/%s", testServer.URL, urlPrefix, v1ApiPath, v1ApiDiff))
+	})
+
+	It("deletes the content of the catalog", func() {
+		Expect(store.Delete(catalog)).To(Succeed())
+		Expect(store.ContentExists(catalog)).To(BeFalse())
+		expectNotFound(fmt.Sprintf("%s/%s/%s", catalogURL, v1ApiPath, v1ApiData))
+	})
+
+	It("lists the digests of the stored catalogs", func() {
+		Expect(store.Store(context.Background(), NamespacedCatalog("tenant-b", "other"), packageFS("bar"))).To(Succeed())
+		summary, err := store.ContentSummary(catalog)
+		Expect(err).ToNot(HaveOccurred())
+		otherSummary, err := store.ContentSummary(NamespacedCatalog("tenant-b", "other"))
+		Expect(err).ToNot(HaveOccurred())
+
+		digests, err := store.ContentDigests()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(digests).To(Equal(map[string]string{
+			catalog:                                summary.Digest,
+			NamespacedCatalog("tenant-b", "other"): otherSummary.Digest,
+		}))
+
+		Expect(store.Delete(catalog)).To(Succeed())
+		digests, err = store.ContentDigests()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(digests).To(HaveLen(1))
+	})
+})
+
 var _ = Describe("LocalDir Server Handler tests", func() {
 	var (
 		testServer *httptest.Server
-		store      LocalDirV1
+		store      *LocalDirV1
 	)
 	BeforeEach(func() {
 		d, err := os.MkdirTemp(GinkgoT().TempDir(), "cache")
 		Expect(err).ToNot(HaveOccurred())
 		Expect(os.MkdirAll(filepath.Join(d, "test-catalog", v1ApiPath), 0700)).To(Succeed())
-		store = LocalDirV1{RootDir: d, RootURL: &url.URL{Path: urlPrefix}}
+		store = &LocalDirV1{RootDir: d, RootURL: &url.URL{Path: urlPrefix}}
 		testServer = httptest.NewServer(store.StorageServerHandler())
 
 	})
@@ -155,6 +228,21 @@ var _ = Describe("LocalDir Server Handler tests", func() {
 		Expect(os.WriteFile(filepath.Join(store.RootDir, "test-catalog", v1ApiPath, v1ApiData), expectedContent, 0600)).To(Succeed())
 		expectFound(fmt.Sprintf("%s/%s", testServer.URL, "/catalogs/test-catalog/api/v1/all"), expectedContent)
 	})
+	It("provides zstd content for the path /catalogs/test-catalog/api/v1/all when preferred by the client", func() {
+		expectedContent := []byte(testCompressableJSON)
+		Expect(os.WriteFile(filepath.Join(store.RootDir, "test-catalog", v1ApiPath, v1ApiData), expectedContent, 0600)).To(Succeed())
+		expectFoundWithEncoding(fmt.Sprintf("%s/%s", testServer.URL, "/catalogs/test-catalog/api/v1/all"), "gzip, zstd", "zstd", expectedContent)
+	})
+	It("provides brotli content for the path /catalogs/test-catalog/api/v1/all when preferred by the client", func() {
+		expectedContent := []byte(testCompressableJSON)
+		Expect(os.WriteFile(filepath.Join(store.RootDir, "test-catalog", v1ApiPath, v1ApiData), expectedContent, 0600)).To(Succeed())
+		expectFoundWithEncoding(fmt.Sprintf("%s/%s", testServer.URL, "/catalogs/test-catalog/api/v1/all"), "br, gzip;q=0.5", "br", expectedContent)
+	})
+	It("ignores a zstd accept-encoding for the path /catalogs/test-catalog/api/v1/all with size < 1400 bytes", func() {
+		expectedContent := []byte("bar")
+		Expect(os.WriteFile(filepath.Join(store.RootDir, "test-catalog", v1ApiPath, v1ApiData), expectedContent, 0600)).To(Succeed())
+		expectFoundWithEncoding(fmt.Sprintf("%s/%s", testServer.URL, "/catalogs/test-catalog/api/v1/all"), "zstd", "", expectedContent)
+	})
 	It("provides json-lines format for the served JSON catalog", func() {
 		catalog := "test-catalog"
 		unpackResultFS := &fstest.MapFS{
@@ -225,6 +313,32 @@ func expectFound(url string, expectedContent []byte) {
 	Expect(resp.Body.Close()).To(Succeed())
 }
 
+func expectFoundWithEncoding(url, acceptEncoding, expectedEncoding string, expectedContent []byte) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	Expect(err).To(Not(HaveOccurred()))
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	resp, err := http.DefaultClient.Do(req)
+	Expect(err).To(Not(HaveOccurred()))
+	defer resp.Body.Close()
+	Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	Expect(resp.Header.Get("Content-Encoding")).To(Equal(expectedEncoding))
+	Expect(resp.Header.Values("Vary")).To(ContainElement("Accept-Encoding"))
+
+	var body io.Reader = resp.Body
+	switch expectedEncoding {
+	case "zstd":
+		dec, err := zstd.NewReader(resp.Body)
+		Expect(err).To(Not(HaveOccurred()))
+		defer dec.Close()
+		body = dec
+	case "br":
+		body = brotli.NewReader(resp.Body)
+	}
+	actualContent, err := io.ReadAll(body)
+	Expect(err).To(Not(HaveOccurred()))
+	Expect(actualContent).To(Equal(expectedContent))
+}
+
 const testBundleTemplate = `---
 image: %s
 name: %s
@@ -436,3 +550,104 @@ func generateJSONLines(in []byte) (string, error) {
 	})
 	return out.String(), err
 }
+
+var _ = Describe("LocalDir Storage tracing", func() {
+	var recorder *tracetest.SpanRecorder
+	BeforeEach(func() {
+		recorder = tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		DeferCleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	})
+	It("should record a span for each call to Store", func() {
+		store := &LocalDirV1{RootDir: GinkgoT().TempDir(), RootURL: &url.URL{Path: urlPrefix}}
+		valid := &fstest.MapFS{"package.json": &fstest.MapFile{Data: []byte(`{"schema":"olm.package","name":"foo"}`)}}
+		invalid := &fstest.MapFS{"package.json": &fstest.MapFile{Data: []byte(`{"schema":`)}}
+		Expect(store.Store(ctx, "traced", valid)).To(Succeed())
+		Expect(store.Store(ctx, "traced", invalid)).ToNot(Succeed())
+
+		spans := recorder.Ended()
+		Expect(spans).To(HaveLen(2))
+		for _, span := range spans {
+			Expect(span.Name()).To(Equal("LocalDirV1.Store"))
+			Expect(span.Attributes()).To(ContainElement(tracing.CatalogKey.String("traced")))
+		}
+		Expect(spans[0].Status().Code).To(Equal(codes.Unset))
+		Expect(spans[1].Status().Code).To(Equal(codes.Error))
+	})
+})
+
+// blockingFS blocks opening its files until release is closed, after
+// signalling opened.
+type blockingFS struct {
+	fstest.MapFS
+	opened, release chan struct{}
+}
+
+func (f *blockingFS) Open(name string) (fs.File, error) {
+	if name != "." {
+		close(f.opened)
+		<-f.release
+	}
+	return f.MapFS.Open(name)
+}
+
+var _ = Describe("LocalDir Storage concurrency", func() {
+	It("stores other catalogs while the content of a catalog is being written", func() {
+		store := &LocalDirV1{RootDir: GinkgoT().TempDir(), RootURL: &url.URL{Path: urlPrefix}}
+		pkg := func(name string) fstest.MapFS {
+			return fstest.MapFS{"package.json": &fstest.MapFile{Data: []byte(fmt.Sprintf(`{"schema":"olm.package","name":%q}`, name))}}
+		}
+		Expect(store.Store(ctx, "slow", pkg("foo"))).To(Succeed())
+
+		slow := &blockingFS{MapFS: pkg("bar"), opened: make(chan struct{}), release: make(chan struct{})}
+		done := make(chan error)
+		go func() { done <- store.Store(ctx, "slow", slow) }()
+		Eventually(slow.opened).Should(BeClosed())
+
+		fast := make(chan error)
+		go func() { fast <- store.Store(ctx, "fast", pkg("baz")) }()
+		Eventually(fast).Should(Receive(Succeed()))
+		digests, err := store.ContentDigests()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(digests).To(HaveKey("fast"))
+		summary, err := store.ContentSummary("slow")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary.Packages).To(Equal(1))
+
+		close(slow.release)
+		Eventually(done).Should(Receive(Succeed()))
+		diff, err := store.ContentDiff("slow")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diff.Added.Packages).To(ConsistOf("bar"))
+	})
+})
+
+var _ = Describe("LocalDir Storage publishing", func() {
+	It("keeps serving the previous content when the revisions can not be recorded", func() {
+		store := &LocalDirV1{RootDir: GinkgoT().TempDir(), RootURL: &url.URL{Path: urlPrefix}}
+		foo := &fstest.MapFS{"package.json": &fstest.MapFile{Data: []byte(`{"schema":"olm.package","name":"foo"}`)}}
+		bar := &fstest.MapFS{"package.json": &fstest.MapFile{Data: []byte(`{"schema":"olm.package","name":"bar"}`)}}
+		Expect(store.Store(ctx, "catalog", foo)).To(Succeed())
+		summary, err := store.ContentSummary("catalog")
+		Expect(err).ToNot(HaveOccurred())
+		fbcFile := filepath.Join(store.RootDir, "catalog", v1ApiPath, v1ApiData)
+		content, err := os.ReadFile(fbcFile)
+		Expect(err).ToNot(HaveOccurred())
+
+		// A non-empty directory can not be replaced by the revisions file.
+		revsFile := filepath.Join(store.RootDir, "catalog", revisionsFile)
+		Expect(os.Remove(revsFile)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(revsFile, "blocked"), 0700)).To(Succeed())
+		Expect(store.Store(ctx, "catalog", bar)).To(MatchError(ContainSubstring("error recording catalog revisions")))
+
+		Expect(os.ReadFile(fbcFile)).To(Equal(content))
+		Expect(store.ContentSummary("catalog")).To(Equal(summary))
+		entries, err := os.ReadDir(filepath.Join(store.RootDir, "catalog"))
+		Expect(err).ToNot(HaveOccurred())
+		names := make([]string, 0, len(entries))
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		Expect(names).To(ConsistOf("api", revisionsFile))
+	})
+})
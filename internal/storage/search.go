@@ -0,0 +1,283 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/alpha/property"
+)
+
+const v1ApiSearch = "search"
+
+// SearchPath is the path below RootURL at which the content of all catalogs
+// is searched.
+const SearchPath = v1ApiPath + "/" + v1ApiSearch
+
+// SearchQuery selects packages and bundles of catalogs. Every field that is
+// set must match. Package and Keyword select packages, along with all of
+// their bundles. The other fields select bundles, and the packages that have
+// at least one of them.
+type SearchQuery struct {
+	// Package is the name of a package.
+	Package string
+	// Keyword is a keyword of a package, matched ignoring case.
+	Keyword string
+	// Group, Version and Kind are of an API provided by a bundle.
+	Group   string
+	Version string
+	Kind    string
+	// Image is the image of a bundle.
+	Image string
+}
+
+func (q SearchQuery) selectsBundles() bool {
+	return q.Group != "" || q.Version != "" || q.Kind != "" || q.Image != ""
+}
+
+// SearchResult is a package of a catalog selected by a SearchQuery, along
+// with the bundles it selects.
+type SearchResult struct {
+	Catalog  string         `json:"catalog"`
+	Priority int32          `json:"priority"`
+	Package  string         `json:"package"`
+	Keywords []string       `json:"keywords,omitempty"`
+	Bundles  []SearchBundle `json:"bundles"`
+}
+
+// SearchBundle is a bundle in a SearchResult.
+type SearchBundle struct {
+	Name         string         `json:"name"`
+	Version      string         `json:"version,omitempty"`
+	Image        string         `json:"image"`
+	ProvidedAPIs []property.GVK `json:"providedAPIs,omitempty"`
+}
+
+func (b SearchBundle) matches(q SearchQuery) bool {
+	if q.Image != "" && b.Image != q.Image {
+		return false
+	}
+	if q.Group == "" && q.Version == "" && q.Kind == "" {
+		return true
+	}
+	return slices.ContainsFunc(b.ProvidedAPIs, func(gvk property.GVK) bool {
+		return (q.Group == "" || gvk.Group == q.Group) &&
+			(q.Version == "" || gvk.Version == q.Version) &&
+			(q.Kind == "" || gvk.Kind == q.Kind)
+	})
+}
+
+// searchIndex holds what can be searched of a single stored revision of a
+// catalog. Unlike a catalogIndex, it is only kept in memory.
+type searchIndex struct {
+	digest   string
+	packages map[string]*searchPackage
+}
+
+type searchPackage struct {
+	keywords sets.Set[string]
+	bundles  []SearchBundle
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{packages: map[string]*searchPackage{}}
+}
+
+func (idx *searchIndex) pkg(name string) *searchPackage {
+	p, ok := idx.packages[name]
+	if !ok {
+		p = &searchPackage{keywords: sets.New[string]()}
+		idx.packages[name] = p
+	}
+	return p
+}
+
+// searchedBundle is the part of a bundle that is searched. Bundle objects,
+// which are usually the largest properties, are not parsed.
+type searchedBundle struct {
+	Package    string              `json:"package"`
+	Name       string              `json:"name"`
+	Image      string              `json:"image"`
+	Properties []property.Property `json:"properties"`
+}
+
+func (idx *searchIndex) add(meta *declcfg.Meta) error {
+	switch meta.Schema {
+	case declcfg.SchemaPackage:
+		idx.pkg(meta.Name)
+	case declcfg.SchemaBundle:
+		var b searchedBundle
+		if err := json.Unmarshal(meta.Blob, &b); err != nil {
+			return fmt.Errorf("error parsing bundle %q of package %q: %w", meta.Name, meta.Package, err)
+		}
+		p := idx.pkg(b.Package)
+		bundle := SearchBundle{Name: b.Name, Image: b.Image}
+		for _, prop := range b.Properties {
+			switch prop.Type {
+			case property.TypePackage:
+				var v property.Package
+				if err := json.Unmarshal(prop.Value, &v); err == nil {
+					bundle.Version = v.Version
+				}
+			case property.TypeGVK:
+				var v property.GVK
+				if err := json.Unmarshal(prop.Value, &v); err == nil {
+					bundle.ProvidedAPIs = append(bundle.ProvidedAPIs, v)
+				}
+			case property.TypeCSVMetadata:
+				var v struct {
+					Keywords []string `json:"keywords"`
+				}
+				if err := json.Unmarshal(prop.Value, &v); err == nil {
+					p.keywords.Insert(v.Keywords...)
+				}
+			}
+		}
+		p.bundles = append(p.bundles, bundle)
+	}
+	return nil
+}
+
+// search returns the results of q in idx, sorted by package.
+func (idx *searchIndex) search(catalog string, priority int32, q SearchQuery) []SearchResult {
+	var results []SearchResult
+	for name, p := range idx.packages {
+		if q.Package != "" && name != q.Package {
+			continue
+		}
+		if q.Keyword != "" && !slices.ContainsFunc(p.keywords.UnsortedList(), func(k string) bool { return strings.EqualFold(k, q.Keyword) }) {
+			continue
+		}
+		bundles := p.bundles
+		if q.selectsBundles() {
+			bundles = slices.DeleteFunc(slices.Clone(bundles), func(b SearchBundle) bool { return !b.matches(q) })
+			if len(bundles) == 0 {
+				continue
+			}
+		}
+		results = append(results, SearchResult{
+			Catalog:  catalog,
+			Priority: priority,
+			Package:  name,
+			Keywords: sets.List(p.keywords),
+			Bundles:  slices.Clone(bundles),
+		})
+	}
+	slices.SortFunc(results, func(a, b SearchResult) int { return cmp.Compare(a.Package, b.Package) })
+	return results
+}
+
+// Search returns the results of q in the catalogs named in priorities, which
+// maps the name of each catalog to search to its priority. Results are sorted
+// from the highest to the lowest priority, and then by catalog and package.
+// Catalogs that have no content stored are skipped.
+func (s *LocalDirV1) Search(ctx context.Context, q SearchQuery, priorities map[string]int32) ([]SearchResult, error) {
+	catalogs := make([]string, 0, len(priorities))
+	for catalog := range priorities {
+		catalogs = append(catalogs, catalog)
+	}
+	slices.SortFunc(catalogs, func(a, b string) int {
+		return cmp.Or(cmp.Compare(priorities[b], priorities[a]), cmp.Compare(a, b))
+	})
+
+	results := []SearchResult{}
+	for _, catalog := range catalogs {
+		idx, err := s.searchIndex(ctx, catalog)
+		if err != nil {
+			return nil, fmt.Errorf("error searching catalog %q: %w", catalog, err)
+		}
+		if idx != nil {
+			results = append(results, idx.search(catalog, priorities[catalog], q)...)
+		}
+	}
+	return results, nil
+}
+
+// searchIndex returns the search index of the revision of catalog that is
+// currently stored, or nil if no content is stored for catalog. The index of
+// content stored by a previous process is built on first use, without
+// holding any lock, and is only kept when search is enabled.
+func (s *LocalDirV1) searchIndex(ctx context.Context, catalog string) (*searchIndex, error) {
+	revs, err := s.catalogRevisions(ctx, catalog)
+	if err != nil || revs == nil {
+		return nil, err
+	}
+	s.m.Lock()
+	idx, ok := s.searchIndexes[catalog]
+	s.m.Unlock()
+	if ok && idx.digest == revs.Current.Digest {
+		return idx, nil
+	}
+
+	file, revs, err := s.openCurrent(ctx, catalog)
+	if err != nil || revs == nil {
+		return nil, err
+	}
+	defer file.Close()
+	idx = newSearchIndex()
+	if err := declcfg.WalkMetasReader(file, func(meta *declcfg.Meta, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return idx.add(meta)
+	}); err != nil {
+		return nil, fmt.Errorf("error indexing stored content: %w", err)
+	}
+	idx.digest = revs.Current.Digest
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	// A newer revision may have been stored, along with its index, while
+	// this one was being indexed.
+	if current, ok := s.revisions[catalog]; ok && current.Current.Digest == idx.digest && s.Priorities != nil {
+		s.setSearchIndexLocked(catalog, idx)
+	}
+	return idx, nil
+}
+
+func (s *LocalDirV1) setSearchIndexLocked(catalog string, idx *searchIndex) {
+	if s.searchIndexes == nil {
+		s.searchIndexes = map[string]*searchIndex{}
+	}
+	s.searchIndexes[catalog] = idx
+}
+
+func (s *LocalDirV1) searchHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		q := SearchQuery{
+			Package: params.Get("package"),
+			Keyword: params.Get("keyword"),
+			Group:   params.Get("group"),
+			Version: params.Get("version"),
+			Kind:    params.Get("kind"),
+			Image:   params.Get("image"),
+		}
+		if q == (SearchQuery{}) {
+			http.Error(w, "at least one of the package, keyword, group, version, kind and image query parameters is required", http.StatusBadRequest)
+			return
+		}
+		priorities, err := s.Priorities(r.Context())
+		if err != nil {
+			http.Error(w, "error listing catalogs", http.StatusInternalServerError)
+			return
+		}
+		results, err := s.Search(r.Context(), q, priorities)
+		if err != nil {
+			http.Error(w, "error searching catalog content", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(results)
+	})
+}
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing/fstest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/operator-framework/operator-registry/alpha/property"
+)
+
+func searchableFS(pkg, kind string, keywords ...string) fstest.MapFS {
+	keywordsJSON, _ := json.Marshal(keywords)
+	return fstest.MapFS{"catalog.json": &fstest.MapFile{Data: []byte(fmt.Sprintf(`{"schema":"olm.package","name":%[1]q,"defaultChannel":"stable"}
+{"schema":"olm.channel","package":%[1]q,"name":"stable","entries":[{"name":"%[1]s.v1.0.0"},{"name":"%[1]s.v2.0.0","replaces":"%[1]s.v1.0.0"}]}
+{"schema":"olm.bundle","package":%[1]q,"name":"%[1]s.v1.0.0","image":"registry.example.com/%[1]s:v1.0.0","properties":[{"type":"olm.package","value":{"packageName":%[1]q,"version":"1.0.0"}}]}
+{"schema":"olm.bundle","package":%[1]q,"name":"%[1]s.v2.0.0","image":"registry.example.com/%[1]s:v2.0.0","properties":[{"type":"olm.package","value":{"packageName":%[1]q,"version":"2.0.0"}},{"type":"olm.gvk","value":{"group":"example.com","version":"v1","kind":%[2]q}},{"type":"olm.csv.metadata","value":{"keywords":%[3]s}}]}
+`, pkg, kind, keywordsJSON))}}
+}
+
+var _ = Describe("LocalDir search", func() {
+	var (
+		ctx        = context.Background()
+		store      *LocalDirV1
+		priorities map[string]int32
+	)
+	BeforeEach(func() {
+		store = &LocalDirV1{RootDir: GinkgoT().TempDir(), RootURL: &url.URL{Path: urlPrefix}}
+		priorities = map[string]int32{"community": 0, "platform": 100, "empty": 10}
+		Expect(store.Store(ctx, "community", searchableFS("foo", "FooDatabase", "Database"))).To(Succeed())
+		Expect(store.Store(ctx, "platform", searchableFS("foo", "FooDatabase", "storage"))).To(Succeed())
+		Expect(store.Store(ctx, "unknown", searchableFS("foo", "FooDatabase"))).To(Succeed())
+	})
+
+	It("orders results by priority and skips catalogs that are not searched or have no content", func() {
+		results, err := store.Search(ctx, SearchQuery{Package: "foo"}, priorities)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(results).To(HaveLen(2))
+		Expect(results[0].Catalog).To(Equal("platform"))
+		Expect(results[0].Priority).To(Equal(int32(100)))
+		Expect(results[1].Catalog).To(Equal("community"))
+		Expect(results[1].Bundles).To(Equal([]SearchBundle{
+			{Name: "foo.v1.0.0", Version: "1.0.0", Image: "registry.example.com/foo:v1.0.0"},
+			{Name: "foo.v2.0.0", Version: "2.0.0", Image: "registry.example.com/foo:v2.0.0", ProvidedAPIs: []property.GVK{{Group: "example.com", Version: "v1", Kind: "FooDatabase"}}},
+		}))
+	})
+
+	It("matches keywords ignoring case", func() {
+		results, err := store.Search(ctx, SearchQuery{Keyword: "database"}, priorities)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Catalog).To(Equal("community"))
+		Expect(results[0].Keywords).To(Equal([]string{"Database"}))
+		Expect(results[0].Bundles).To(HaveLen(2))
+	})
+
+	It("only returns the bundles matching a provided API or image", func() {
+		results, err := store.Search(ctx, SearchQuery{Group: "example.com", Kind: "FooDatabase"}, priorities)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(results).To(HaveLen(2))
+		for _, r := range results {
+			Expect(r.Bundles).To(HaveLen(1))
+			Expect(r.Bundles[0].Name).To(Equal("foo.v2.0.0"))
+		}
+
+		results, err = store.Search(ctx, SearchQuery{Image: "registry.example.com/foo:v1.0.0", Kind: "FooDatabase"}, priorities)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(results).To(BeEmpty())
+	})
+
+	It("searches new revisions and content stored by a previous process", func() {
+		Expect(store.Store(ctx, "community", searchableFS("bar", "BarCache"))).To(Succeed())
+		restarted := &LocalDirV1{RootDir: store.RootDir, RootURL: store.RootURL}
+		for _, s := range []*LocalDirV1{store, restarted} {
+			results, err := s.Search(ctx, SearchQuery{Kind: "BarCache"}, priorities)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].Package).To(Equal("bar"))
+		}
+	})
+
+	It("stops searching deleted content", func() {
+		Expect(store.Delete("platform")).To(Succeed())
+		results, err := store.Search(ctx, SearchQuery{Package: "foo"}, priorities)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Catalog).To(Equal("community"))
+	})
+
+	It("only keeps search indexes when search is enabled", func() {
+		_, err := store.Search(ctx, SearchQuery{Package: "foo"}, priorities)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(store.searchIndexes).To(BeEmpty())
+
+		searched := &LocalDirV1{RootDir: GinkgoT().TempDir(), RootURL: store.RootURL, Priorities: func(context.Context) (map[string]int32, error) { return priorities, nil }}
+		Expect(searched.Store(ctx, "community", searchableFS("foo", "FooDatabase"))).To(Succeed())
+		Expect(searched.searchIndexes).To(HaveKey("community"))
+	})
+
+	Describe("endpoint", func() {
+		var testServer *httptest.Server
+		BeforeEach(func() {
+			store.Priorities = func(context.Context) (map[string]int32, error) { return priorities, nil }
+			testServer = httptest.NewServer(store.StorageServerHandler())
+		})
+		AfterEach(func() {
+			testServer.Close()
+		})
+		get := func(query string) *http.Response {
+			resp, err := http.Get(testServer.URL + urlPrefix + SearchPath + query) //nolint:gosec
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(resp.Body.Close)
+			return resp
+		}
+
+		It("returns the results as JSON", func() {
+			resp := get("?kind=FooDatabase&package=foo")
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Header.Get("Content-Type")).To(Equal("application/json"))
+			var results []SearchResult
+			Expect(json.NewDecoder(resp.Body).Decode(&results)).To(Succeed())
+			Expect(results).To(HaveLen(2))
+			Expect(results[0].Catalog).To(Equal("platform"))
+		})
+
+		It("returns an empty array when nothing matches", func() {
+			resp := get("?package=bar")
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			var results []SearchResult
+			Expect(json.NewDecoder(resp.Body).Decode(&results)).To(Succeed())
+			Expect(results).ToNot(BeNil())
+			Expect(results).To(BeEmpty())
+		})
+
+		It("requires a query", func() {
+			Expect(get("").StatusCode).To(Equal(http.StatusBadRequest))
+		})
+
+		It("fails when the catalogs can not be listed", func() {
+			store.Priorities = func(context.Context) (map[string]int32, error) { return nil, errors.New("cache not synced") }
+			Expect(get("?package=foo").StatusCode).To(Equal(http.StatusInternalServerError))
+		})
+
+		It("is not served without priorities", func() {
+			store.Priorities = nil
+			noSearch := httptest.NewServer(store.StorageServerHandler())
+			defer noSearch.Close()
+			resp, err := http.Get(noSearch.URL + urlPrefix + SearchPath + "?package=foo") //nolint:gosec
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+		})
+	})
+})
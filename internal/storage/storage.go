@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"io"
 	"io/fs"
 	"net/http"
 )
@@ -16,4 +17,25 @@ type Instance interface {
 	BaseURL(catalog string) string
 	StorageServerHandler() http.Handler
 	ContentExists(catalog string) bool
+	ContentDiff(catalog string) (*Diff, error)
+	ContentSummary(catalog string) (*ContentSummary, error)
+	ContentReader(catalog string) (io.ReadCloser, string, error)
+}
+
+// ContentSummary describes the content of the revision of a catalog that is
+// currently stored.
+type ContentSummary struct {
+	// Digest is the digest of the stored content.
+	Digest string
+	// SizeBytes is the size of the stored content in bytes.
+	SizeBytes int64
+	// Packages, Channels, Bundles and Deprecations are the number of
+	// objects of each of the well-known FBC schemas in the content.
+	Packages     int
+	Channels     int
+	Bundles      int
+	Deprecations int
+	// UnknownSchemas lists the schemas of the remaining objects in the
+	// content, sorted by name.
+	UnknownSchemas []string
 }
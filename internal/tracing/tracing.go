@@ -0,0 +1,112 @@
+// Package tracing configures the export of OpenTelemetry traces and provides
+// the tracer used to instrument catalogd.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/operator-framework/catalogd/internal/version"
+)
+
+const (
+	instrumentationName = "github.com/operator-framework/catalogd"
+	serviceName         = "catalogd"
+
+	// CatalogKey is the attribute identifying the ClusterCatalog a span
+	// is about.
+	CatalogKey = attribute.Key("catalogd.catalog")
+)
+
+// Config configures the export of traces over OTLP/gRPC.
+type Config struct {
+	// Endpoint is the host:port of the OTLP collector. If it is empty, the
+	// standard OTEL_EXPORTER_OTLP_TRACES_ENDPOINT and
+	// OTEL_EXPORTER_OTLP_ENDPOINT environment variables are used instead.
+	// When none of them is set, spans are not exported.
+	Endpoint string
+	// Insecure disables TLS for the connection to the collector.
+	Insecure bool
+	// SampleRatio is the fraction of traces started by catalogd that are
+	// sampled. Traces propagated from a caller keep the caller's decision.
+	SampleRatio float64
+}
+
+func (c Config) enabled() bool {
+	return c.Endpoint != "" ||
+		os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" ||
+		os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != ""
+}
+
+// Setup installs the global tracer provider and propagator according to cfg
+// and returns a function that flushes any pending spans and stops the
+// exporter. If no collector is configured, the default no-op tracer provider
+// is left in place.
+func Setup(ctx context.Context, log logr.Logger, cfg Config) (func(context.Context) error, error) {
+	otel.SetLogger(log)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if !cfg.enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var opts []otlptracegrpc.Option
+	if cfg.Endpoint != "" {
+		opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+	}
+	if cfg.Insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating OTLP trace exporter: %w", err)
+	}
+
+	// Attributes from OTEL_RESOURCE_ATTRIBUTES and OTEL_SERVICE_NAME take
+	// precedence over the defaults, as they are detected last.
+	res, err := resource.New(ctx,
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(
+			semconv.ServiceName(serviceName),
+			semconv.ServiceVersion(version.Version().GitVersion),
+		),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer used to instrument catalogd, from the global
+// tracer provider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// EndSpan records err, if any, as the outcome of span and ends it.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
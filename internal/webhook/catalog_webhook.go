@@ -0,0 +1,121 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+	"github.com/operator-framework/catalogd/internal/storage"
+)
+
+// +kubebuilder:webhook:admissionReviewVersions={v1},failurePolicy=Fail,groups=olm.operatorframework.io,mutating=false,name=validate-catalog.olm.operatorframework.io,path=/validate-olm-operatorframework-io-v1-catalog,resources=catalogs,verbs=create;update,versions=v1,sideEffects=None,timeoutSeconds=10
+
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get
+
+// Catalog wraps the external v1.Catalog type and implements admission.CustomValidator
+type Catalog struct {
+	// Reader reads the pull secrets of Catalogs, which are not cached by the
+	// manager.
+	Reader client.Reader
+	// StorageDir is the directory the content of Catalogs is stored in. When
+	// set, creating a Catalog whose content would be stored in a directory
+	// that already exists is rejected.
+	StorageDir string
+}
+
+// ValidateCreate is the method that will be called by the webhook to validate a new Catalog.
+func (r *Catalog) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	catalog, ok := obj.(*catalogdv1.Catalog)
+	if !ok {
+		return nil, fmt.Errorf("expected a Catalog but got a %T", obj)
+	}
+	specPath := field.NewPath("spec")
+	allErrs := validateSpec(&catalog.Spec.ClusterCatalogSpec, specPath)
+	allErrs = append(allErrs, r.validatePullSecrets(ctx, catalog, nil, specPath.Child("pullSecrets"))...)
+	allErrs = append(allErrs, validateStorageDir(r.StorageDir, storage.NamespacedCatalog(catalog.Namespace, catalog.Name), field.NewPath("metadata", "name"))...)
+	return nil, invalidCatalog(catalog, allErrs)
+}
+
+// ValidateUpdate is the method that will be called by the webhook to validate an updated Catalog.
+// Only changes to the spec are validated, and only the pull secrets added by
+// the update have to exist, so that deleting a pull secret does not prevent
+// the finalizers of a Catalog from being removed.
+func (r *Catalog) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldCatalog, ok := oldObj.(*catalogdv1.Catalog)
+	if !ok {
+		return nil, fmt.Errorf("expected a Catalog but got a %T", oldObj)
+	}
+	catalog, ok := newObj.(*catalogdv1.Catalog)
+	if !ok {
+		return nil, fmt.Errorf("expected a Catalog but got a %T", newObj)
+	}
+	if equality.Semantic.DeepEqual(oldCatalog.Spec, catalog.Spec) {
+		return nil, nil
+	}
+	specPath := field.NewPath("spec")
+	allErrs := validateSpec(&catalog.Spec.ClusterCatalogSpec, specPath)
+	allErrs = append(allErrs, r.validatePullSecrets(ctx, catalog, oldCatalog.Spec.PullSecrets, specPath.Child("pullSecrets"))...)
+	return nil, invalidCatalog(catalog, allErrs)
+}
+
+// ValidateDelete is the method that will be called by the webhook to validate a deleted Catalog.
+// Deleting a Catalog is always allowed.
+func (r *Catalog) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validatePullSecrets checks that the pull secrets of catalog that are not
+// in existing exist in the namespace of catalog.
+func (r *Catalog) validatePullSecrets(ctx context.Context, catalog *catalogdv1.Catalog, existing []corev1.LocalObjectReference, fldPath *field.Path) field.ErrorList {
+	if r.Reader == nil {
+		return nil
+	}
+	known := map[string]struct{}{}
+	for _, ref := range existing {
+		known[ref.Name] = struct{}{}
+	}
+	var allErrs field.ErrorList
+	for i, ref := range catalog.Spec.PullSecrets {
+		if _, ok := known[ref.Name]; ok {
+			continue
+		}
+		var secret corev1.Secret
+		err := r.Reader.Get(ctx, types.NamespacedName{Namespace: catalog.Namespace, Name: ref.Name}, &secret)
+		switch {
+		case apierrors.IsNotFound(err):
+			allErrs = append(allErrs, field.NotFound(fldPath.Index(i).Child("name"), ref.Name))
+		case err != nil:
+			allErrs = append(allErrs, field.InternalError(fldPath.Index(i).Child("name"), fmt.Errorf("error getting pull secret %q: %w", ref.Name, err)))
+		default:
+			if _, ok := secret.Data[corev1.DockerConfigJsonKey]; !ok {
+				allErrs = append(allErrs, field.Invalid(fldPath.Index(i).Child("name"), ref.Name, fmt.Sprintf("secret has no %s key", corev1.DockerConfigJsonKey)))
+			}
+		}
+	}
+	return allErrs
+}
+
+func invalidCatalog(catalog *catalogdv1.Catalog, allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(catalogdv1.GroupVersion.WithKind("Catalog").GroupKind(), catalog.Name, allErrs)
+}
+
+// SetupWebhookWithManager sets up the webhook with the manager
+func (r *Catalog) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&catalogdv1.Catalog{}).
+		WithValidator(r).
+		Complete()
+}
@@ -0,0 +1,117 @@
+package webhook
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+)
+
+func newImageCatalog(namespace, name string, pullSecrets ...string) *catalogdv1.Catalog {
+	catalog := &catalogdv1.Catalog{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: catalogdv1.CatalogSpec{
+			ClusterCatalogSpec: catalogdv1.ClusterCatalogSpec{
+				Source: catalogdv1.CatalogSource{
+					Type:  catalogdv1.SourceTypeImage,
+					Image: &catalogdv1.ImageSource{Ref: "registry.example.com/tenant-a/catalog:latest"},
+				},
+			},
+		},
+	}
+	for _, name := range pullSecrets {
+		catalog.Spec.PullSecrets = append(catalog.Spec.PullSecrets, corev1.LocalObjectReference{Name: name})
+	}
+	return catalog
+}
+
+func newCatalogValidator(t *testing.T) *Catalog {
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	pullSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "tenant-a", Name: "pull-secret"},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{}}`)},
+	}
+	opaque := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "tenant-a", Name: "opaque"},
+		Data:       map[string][]byte{"password": []byte("hunter2")},
+	}
+	storageDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(storageDir, "tenant-a", "catalogs", "existing"), 0700))
+	return &Catalog{
+		Reader:     fake.NewClientBuilder().WithScheme(scheme).WithObjects(pullSecret, opaque).Build(),
+		StorageDir: storageDir,
+	}
+}
+
+func TestCatalogValidateCreate(t *testing.T) {
+	tests := map[string]struct {
+		catalog        *catalogdv1.Catalog
+		expectedErrors []string
+	}{
+		"existing pull secret": {
+			catalog: newImageCatalog("tenant-a", "mine", "pull-secret"),
+		},
+		"missing pull secret": {
+			catalog:        newImageCatalog("tenant-a", "mine", "pull-secret", "missing"),
+			expectedErrors: []string{`spec.pullSecrets[1].name: Not found: "missing"`},
+		},
+		"pull secret in another namespace": {
+			catalog:        newImageCatalog("tenant-b", "mine", "pull-secret"),
+			expectedErrors: []string{`spec.pullSecrets[0].name: Not found: "pull-secret"`},
+		},
+		"pull secret without a .dockerconfigjson key": {
+			catalog:        newImageCatalog("tenant-a", "mine", "opaque"),
+			expectedErrors: []string{`spec.pullSecrets[0].name: Invalid value: "opaque": secret has no .dockerconfigjson key`},
+		},
+		"name collides with an existing storage directory": {
+			catalog:        newImageCatalog("tenant-a", "existing"),
+			expectedErrors: []string{`metadata.name: Forbidden: collides with the existing storage directory "tenant-a/catalogs/existing"`},
+		},
+		"same name in another namespace": {
+			catalog: newImageCatalog("tenant-b", "existing"),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := newCatalogValidator(t).ValidateCreate(context.TODO(), tc.catalog)
+			if len(tc.expectedErrors) == 0 {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.True(t, apierrors.IsInvalid(err))
+			for _, expected := range tc.expectedErrors {
+				assert.Contains(t, err.Error(), expected)
+			}
+		})
+	}
+}
+
+func TestCatalogValidateUpdate(t *testing.T) {
+	validator := newCatalogValidator(t)
+	// A pull secret that was deleted after it was added to the Catalog does
+	// not prevent the Catalog from being updated.
+	oldCatalog := newImageCatalog("tenant-a", "mine", "deleted")
+
+	updated := newImageCatalog("tenant-a", "mine", "deleted", "pull-secret")
+	_, err := validator.ValidateUpdate(context.TODO(), oldCatalog, updated)
+	require.NoError(t, err)
+
+	updated = newImageCatalog("tenant-a", "mine", "deleted", "missing")
+	_, err = validator.ValidateUpdate(context.TODO(), oldCatalog, updated)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `spec.pullSecrets[1].name: Not found: "missing"`)
+}
@@ -4,19 +4,31 @@ import (
 	"context"
 	"fmt"
 
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
 )
 
 // +kubebuilder:webhook:admissionReviewVersions={v1},failurePolicy=Fail,groups=olm.operatorframework.io,mutating=true,name=inject-metadata-name.olm.operatorframework.io,path=/mutate-olm-operatorframework-io-v1-clustercatalog,resources=clustercatalogs,verbs=create;update,versions=v1,sideEffects=None,timeoutSeconds=10
 
+// +kubebuilder:webhook:admissionReviewVersions={v1},failurePolicy=Fail,groups=olm.operatorframework.io,mutating=false,name=validate-clustercatalog.olm.operatorframework.io,path=/validate-olm-operatorframework-io-v1-clustercatalog,resources=clustercatalogs,verbs=create;update,versions=v1,sideEffects=None,timeoutSeconds=10
+
 // +kubebuilder:rbac:groups=olm.operatorframework.io,resources=clustercatalogs,verbs=get;list;watch;patch;update
 
-// ClusterCatalog wraps the external v1.ClusterCatalog type and implements admission.Defaulter
-type ClusterCatalog struct{}
+// ClusterCatalog wraps the external v1.ClusterCatalog type and implements
+// admission.Defaulter and admission.CustomValidator
+type ClusterCatalog struct {
+	// StorageDir is the directory the content of ClusterCatalogs is stored
+	// in. When set, creating a ClusterCatalog whose content would be stored
+	// in a directory that already exists is rejected.
+	StorageDir string
+}
 
 // Default is the method that will be called by the webhook to apply defaults.
 func (r *ClusterCatalog) Default(ctx context.Context, obj runtime.Object) error {
@@ -37,10 +49,54 @@ func (r *ClusterCatalog) Default(ctx context.Context, obj runtime.Object) error
 	return nil
 }
 
+// ValidateCreate is the method that will be called by the webhook to validate a new ClusterCatalog.
+func (r *ClusterCatalog) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	catalog, ok := obj.(*catalogdv1.ClusterCatalog)
+	if !ok {
+		return nil, fmt.Errorf("expected a ClusterCatalog but got a %T", obj)
+	}
+	allErrs := validateSpec(&catalog.Spec, field.NewPath("spec"))
+	allErrs = append(allErrs, validateStorageDir(r.StorageDir, catalog.Name, field.NewPath("metadata", "name"))...)
+	return nil, invalidClusterCatalog(catalog, allErrs)
+}
+
+// ValidateUpdate is the method that will be called by the webhook to validate an updated ClusterCatalog.
+// Only changes to the spec are validated, so that a ClusterCatalog that was
+// admitted before can always have its metadata, such as its finalizers,
+// updated.
+func (r *ClusterCatalog) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldCatalog, ok := oldObj.(*catalogdv1.ClusterCatalog)
+	if !ok {
+		return nil, fmt.Errorf("expected a ClusterCatalog but got a %T", oldObj)
+	}
+	catalog, ok := newObj.(*catalogdv1.ClusterCatalog)
+	if !ok {
+		return nil, fmt.Errorf("expected a ClusterCatalog but got a %T", newObj)
+	}
+	if equality.Semantic.DeepEqual(oldCatalog.Spec, catalog.Spec) {
+		return nil, nil
+	}
+	return nil, invalidClusterCatalog(catalog, validateSpec(&catalog.Spec, field.NewPath("spec")))
+}
+
+// ValidateDelete is the method that will be called by the webhook to validate a deleted ClusterCatalog.
+// Deleting a ClusterCatalog is always allowed.
+func (r *ClusterCatalog) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func invalidClusterCatalog(catalog *catalogdv1.ClusterCatalog, allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(catalogdv1.GroupVersion.WithKind("ClusterCatalog").GroupKind(), catalog.Name, allErrs)
+}
+
 // SetupWebhookWithManager sets up the webhook with the manager
 func (r *ClusterCatalog) SetupWebhookWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(&catalogdv1.ClusterCatalog{}).
 		WithDefaulter(r).
+		WithValidator(r).
 		Complete()
 }
@@ -2,11 +2,16 @@ package webhook
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
 
 	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
 )
@@ -103,3 +108,99 @@ func TestClusterCatalogDefaulting(t *testing.T) {
 		})
 	}
 }
+
+func newImageClusterCatalog(name, ref string, pollIntervalMinutes *int) *catalogdv1.ClusterCatalog {
+	return &catalogdv1.ClusterCatalog{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: catalogdv1.ClusterCatalogSpec{
+			Source: catalogdv1.CatalogSource{
+				Type:  catalogdv1.SourceTypeImage,
+				Image: &catalogdv1.ImageSource{Ref: ref, PollIntervalMinutes: pollIntervalMinutes},
+			},
+		},
+	}
+}
+
+func TestClusterCatalogValidateCreate(t *testing.T) {
+	storageDir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(storageDir, "existing"), 0700))
+	pollInterval := ptr.To(10)
+	digestRef := "quay.io/operatorhubio/catalog@sha256:1d6e9d7b7b6a4fdb1e2d8e7b5c0b0c3b0a7b0e2c3d4e5f60718293a4b5c6d7e8"
+
+	tests := map[string]struct {
+		clusterCatalog *catalogdv1.ClusterCatalog
+		expectedErrors []string
+	}{
+		"valid tag-based image with a poll interval": {
+			clusterCatalog: newImageClusterCatalog("test-catalog", "quay.io/operatorhubio/catalog:latest", pollInterval),
+		},
+		"valid digest-based image": {
+			clusterCatalog: newImageClusterCatalog("test-catalog", digestRef, nil),
+		},
+		"unparsable image reference": {
+			clusterCatalog: newImageClusterCatalog("test-catalog", "quay.io/operatorhubio/Catalog:latest", nil),
+			expectedErrors: []string{`spec.source.image.ref: Invalid value: "quay.io/operatorhubio/Catalog:latest"`},
+		},
+		"digest-based image with a poll interval": {
+			clusterCatalog: newImageClusterCatalog("test-catalog", digestRef, pollInterval),
+			expectedErrors: []string{"spec.source.image.pollIntervalMinutes: Forbidden: may not be specified when ref is a digest-based image reference"},
+		},
+		"digest-based composite member image with a poll interval": {
+			clusterCatalog: &catalogdv1.ClusterCatalog{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-catalog"},
+				Spec: catalogdv1.ClusterCatalogSpec{
+					Source: catalogdv1.CatalogSource{
+						Type: catalogdv1.SourceTypeComposite,
+						Composite: &catalogdv1.CompositeSource{
+							Members: []catalogdv1.CompositeMember{
+								{Type: catalogdv1.CompositeMemberTypeClusterCatalog, ClusterCatalog: &catalogdv1.ClusterCatalogReference{Name: "other"}},
+								{Type: catalogdv1.CompositeMemberTypeImage, Image: &catalogdv1.ImageSource{Ref: digestRef, PollIntervalMinutes: pollInterval}},
+							},
+						},
+					},
+				},
+			},
+			expectedErrors: []string{"spec.source.composite.members[1].image.pollIntervalMinutes: Forbidden"},
+		},
+		"name collides with an existing storage directory": {
+			clusterCatalog: newImageClusterCatalog("existing", "quay.io/operatorhubio/catalog:latest", nil),
+			expectedErrors: []string{`metadata.name: Forbidden: collides with the existing storage directory "existing"`},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			validator := &ClusterCatalog{StorageDir: storageDir}
+			_, err := validator.ValidateCreate(context.TODO(), tc.clusterCatalog)
+			if len(tc.expectedErrors) == 0 {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.True(t, apierrors.IsInvalid(err))
+			for _, expected := range tc.expectedErrors {
+				assert.Contains(t, err.Error(), expected)
+			}
+		})
+	}
+}
+
+func TestClusterCatalogValidateUpdate(t *testing.T) {
+	storageDir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(storageDir, "test-catalog"), 0700))
+	digestRef := "quay.io/operatorhubio/catalog@sha256:1d6e9d7b7b6a4fdb1e2d8e7b5c0b0c3b0a7b0e2c3d4e5f60718293a4b5c6d7e8"
+	oldCatalog := newImageClusterCatalog("test-catalog", "quay.io/operatorhubio/catalog:latest", ptr.To(10))
+	validator := &ClusterCatalog{StorageDir: storageDir}
+
+	// The storage directory of an existing ClusterCatalog is its own.
+	updated := oldCatalog.DeepCopy()
+	updated.Finalizers = []string{"olm.operatorframework.io/delete-server-cache"}
+	_, err := validator.ValidateUpdate(context.TODO(), oldCatalog, updated)
+	require.NoError(t, err)
+
+	updated = oldCatalog.DeepCopy()
+	updated.Spec.Source.Image.Ref = digestRef
+	_, err = validator.ValidateUpdate(context.TODO(), oldCatalog, updated)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "spec.source.image.pollIntervalMinutes: Forbidden")
+}
@@ -0,0 +1,66 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/containers/image/v5/docker/reference"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	catalogdv1 "github.com/operator-framework/catalogd/api/v1"
+	"github.com/operator-framework/catalogd/internal/source"
+)
+
+// validateSpec validates the parts of spec that the CRD schema can not, such
+// as the image references that are parsed only when an image is pulled.
+func validateSpec(spec *catalogdv1.ClusterCatalogSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	sourcePath := fldPath.Child("source")
+	if spec.Source.Image != nil {
+		allErrs = append(allErrs, validateImageSource(spec.Source.Image, sourcePath.Child("image"))...)
+	}
+	if spec.Source.Composite != nil {
+		membersPath := sourcePath.Child("composite", "members")
+		for i, member := range spec.Source.Composite.Members {
+			if member.Image != nil {
+				allErrs = append(allErrs, validateImageSource(member.Image, membersPath.Index(i).Child("image"))...)
+			}
+		}
+	}
+	return allErrs
+}
+
+func validateImageSource(image *catalogdv1.ImageSource, fldPath *field.Path) field.ErrorList {
+	ref, err := source.ParseImageReference(image.Ref)
+	if err != nil {
+		return field.ErrorList{field.Invalid(fldPath.Child("ref"), image.Ref, err.Error())}
+	}
+	// A digest-based reference always resolves to the same image, so there
+	// is nothing to poll.
+	if _, ok := ref.(reference.Canonical); ok && image.PollIntervalMinutes != nil {
+		return field.ErrorList{field.Forbidden(fldPath.Child("pollIntervalMinutes"), "may not be specified when ref is a digest-based image reference")}
+	}
+	return nil
+}
+
+// validateStorageDir rejects a catalog whose content would be stored in a
+// directory of storageDir that already exists, and so would be served mixed
+// with the content found there.
+func validateStorageDir(storageDir, catalog string, fldPath *field.Path) field.ErrorList {
+	if storageDir == "" {
+		return nil
+	}
+	dir := filepath.Join(storageDir, catalog)
+	_, err := os.Stat(dir)
+	switch {
+	case err == nil:
+		return field.ErrorList{field.Forbidden(fldPath, fmt.Sprintf("collides with the existing storage directory %q", catalog))}
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	default:
+		return field.ErrorList{field.InternalError(fldPath, fmt.Errorf("error checking storage directory %q: %w", dir, err))}
+	}
+}